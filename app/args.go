@@ -0,0 +1,131 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Options that can be given more than once, each occurrence applied on its
+// own, and that aren't parameters reported by CONFIG GET
+var repeatableOptions = map[string]bool{
+	"loadmodule":     true,
+	"rename-command": true,
+}
+
+// Options whose occurrences are joined into one space separated value, as
+// several --bind flags listen on every address given, and several --save
+// flags set every save point given
+var accumulatedOptions = map[string]bool{
+	"bind": true,
+	"save": true,
+}
+
+// commandLine holds the parsed arguments of the server: an optional config
+// file followed by options given as --name value or --name=value
+type commandLine struct {
+	configFile string
+	options    []configOption
+	help       bool
+	version    bool
+}
+
+// parseArgs parses the command line. The value of an option is made of all
+// the arguments up to the next option, joined with spaces, so that
+// --replicaof host port works like --replicaof "host port". A yes or no
+// parameter given without a value is set to yes.
+func parseArgs(args []string) (*commandLine, error) {
+	cl := &commandLine{}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cl.configFile = args[0]
+		args = args[1:]
+	}
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-h", "--help":
+			cl.help = true
+			continue
+		case "-v", "--version":
+			cl.version = true
+			continue
+		}
+
+		name, ok := strings.CutPrefix(arg, "--")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("unexpected argument '%s', options start with --", arg)
+		}
+		name, value, hasValue := strings.Cut(name, "=")
+		name = strings.ToLower(name)
+		if !knownOption(name) {
+			return nil, fmt.Errorf("unknown option '--%s'", name)
+		}
+
+		if !hasValue {
+			var values []string
+			for i+1 < len(args) && !strings.HasPrefix(args[i+1], "--") {
+				i++
+				values = append(values, args[i])
+			}
+			value = strings.Join(values, " ")
+			if len(values) == 0 {
+				if !yesNoParameters[name] {
+					return nil, fmt.Errorf("missing value for '--%s'", name)
+				}
+				value = "yes"
+			}
+		}
+		if err := validateConfig(name, value); err != nil {
+			return nil, fmt.Errorf("invalid value '%s' for '--%s', %s", value, name, err)
+		}
+
+		if accumulatedOptions[name] {
+			if j := slices.IndexFunc(cl.options, func(o configOption) bool { return o.name == name }); j >= 0 {
+				cl.options[j].value = accumulate(cl.options[j].value, value)
+				continue
+			}
+		}
+		cl.options = append(cl.options, configOption{name, value})
+	}
+	return cl, nil
+}
+
+// accumulate adds the value of an option given again to the previous ones.
+// An empty value clears them, as save "" removes every save point.
+func accumulate(previous, value string) string {
+	if previous == "" || value == "" {
+		return value
+	}
+	return previous + " " + value
+}
+
+func knownOption(name string) bool {
+	if repeatableOptions[name] || configAliases[name] != "" {
+		return true
+	}
+	return slices.ContainsFunc(configParameters, func(p configParameter) bool { return p.name == name })
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: redis-server [/path/to/redis.conf] [options]")
+	fmt.Fprintln(w, "       redis-server -v or --version")
+	fmt.Fprintln(w, "       redis-server -h or --help")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Options are given as --name value or --name=value, and take precedence")
+	fmt.Fprintln(w, "over the config file, e.g. --port 7777 --replicaof 127.0.0.1 6379.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Parameters, with their defaults:")
+	for _, p := range configParameters {
+		fmt.Fprintf(w, "  --%-28s %s\n", p.name, p.defaultValue)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Options that can be repeated:")
+	fmt.Fprintln(w, "  --loadmodule /path/to/module.so")
+	fmt.Fprintln(w, "  --rename-command name new-name")
+}
+
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "Redis server v=%s\n", REDIS_VERSION)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"crypto/subtle"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Password set with requirepass, nil when clients don't need to authenticate
+var requirePass atomic.Pointer[string]
+
+// Commands an unauthenticated client can run
+var noAuthCommands = map[string]bool{
+	"auth":  true,
+	"hello": true,
+}
+
+func authMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if !c.authenticated && !c.fromMaster && requirePass.Load() != nil && !noAuthCommands[entry.name] {
+		return nil, resp.ErrNoAuth
+	}
+	return next()
+}
+
+// AUTH [username] password. Only the default user exists.
+func handleCommandAuth(cmd []resp.Resp, c *client) ([]byte, error) {
+	password := cmd[len(cmd)-1].Content.(string)
+	expected := requirePass.Load()
+	if expected == nil {
+		return nil, resp.NewError("ERR", "AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+
+	if (len(cmd) == 2 && cmd[0].Content != "default") ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(*expected)) != 1 {
+		return nil, resp.NewError("WRONGPASS", "invalid username-password pair or user is disabled.")
+	}
+
+	c.authenticated = true
+	return OK_RESP, nil
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// usePassword requires a password from clients until the end of the test
+func usePassword(t *testing.T, password string) {
+	requirePass.Store(&password)
+	t.Cleanup(func() { requirePass.Store(nil) })
+}
+
+func TestHelloAuth(t *testing.T) {
+	tc := newTestClient(t)
+	usePassword(t, "secret")
+
+	reply := tc.do(t, "HELLO 2 AUTH default wrong")
+	if reply.DataType != resp.ERROR || !strings.HasPrefix(reply.Content.(string), "WRONGPASS") {
+		t.Fatalf("HELLO with a wrong password = %v, want -WRONGPASS", reply.Content)
+	}
+	if reply := tc.do(t, "GET k"); reply.DataType != resp.ERROR || !strings.HasPrefix(reply.Content.(string), "NOAUTH") {
+		t.Fatalf("GET after a failed HELLO AUTH = %v, want -NOAUTH", reply.Content)
+	}
+
+	if reply := tc.do(t, "HELLO 2 AUTH default secret"); reply.DataType == resp.ERROR {
+		t.Fatalf("HELLO with the right password = %v", reply.Content)
+	}
+	if reply := tc.do(t, "GET k"); reply.DataType == resp.ERROR {
+		t.Fatalf("GET after HELLO AUTH = %v", reply.Content)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/internal/timerwheel"
+)
+
+const (
+	// Resolution of the timeouts of blocked clients
+	BLOCK_TIMEOUT_TICK = 10 * time.Millisecond
+	// Slots of the timeout wheel, which makes one turn every ~10s
+	BLOCK_TIMEOUT_SLOTS = 1024
+)
+
+// blockedClient is a client waiting, e.g. in XREAD BLOCK or WAIT, for data
+// that isn't there yet. Blocking commands run on the executor, and so do all
+// attempts to serve them, so that no write can slip between an attempt and
+// the registration of the client.
+type blockedClient struct {
+	c *client
+	// Keys whose changes may let the client be served. A client without
+	// keys waits for replica acknowledgements instead.
+	keys []string
+	// serve is called on the executor after a change to one of the keys,
+	// returning the reply of the client or nil if it has to keep waiting.
+	// It must propagate any change it makes to the dataset itself.
+	serve func() []byte
+	// timeout returns the reply once the timeout elapsed
+	timeout func() []byte
+
+	// Order in which clients blocked
+	seq   uint64
+	timer *timerwheel.Timer
+	reply chan []byte
+	done  bool
+}
+
+// Clients waiting on each key, in the order they blocked, and the keys that
+// changed since the waiting clients were last tried
+var blocking struct {
+	sync.Mutex
+	byKey map[string][]*blockedClient
+	// Clients waiting in WAIT, tried after each REPLCONF ACK
+	acks  []*blockedClient
+	ready map[string]bool
+	// Set by a REPLCONF ACK
+	acked   bool
+	lastSeq uint64
+
+	wheel *timerwheel.Wheel
+}
+
+func init() {
+	blocking.byKey = map[string][]*blockedClient{}
+	blocking.ready = map[string]bool{}
+	blocking.wheel = timerwheel.New(BLOCK_TIMEOUT_TICK, BLOCK_TIMEOUT_SLOTS)
+}
+
+// blockClient is returned from the handler of a blocking command that found
+// nothing to reply yet. The client waits for b.serve to succeed or for the
+// timeout to elapse, forever if it is zero. Clients inside a transaction and
+// the master can't block, and get the timeout reply right away.
+func blockClient(c *client, b *blockedClient, timeout time.Duration) ([]byte, error) {
+	if c.execing || c.fromMaster {
+		return b.timeout(), nil
+	}
+
+	b.c = c
+	b.reply = make(chan []byte, 1)
+
+	blocking.Lock()
+	defer blocking.Unlock()
+	blocking.lastSeq++
+	b.seq = blocking.lastSeq
+	if b.keys == nil {
+		blocking.acks = append(blocking.acks, b)
+	}
+	for _, key := range b.keys {
+		blocking.byKey[key] = append(blocking.byKey[key], b)
+	}
+	if timeout > 0 {
+		b.timer = blocking.wheel.Add(timeout, func() {
+			go executor.run(func() ([]byte, error) {
+				unblockClient(b, b.timeout())
+				return nil, nil
+			})
+		})
+	}
+
+	c.blocked = b
+	return nil, nil
+}
+
+// unblockClient removes a client from the waiting lists and delivers its
+// reply, unless it was already unblocked. It must run on the executor.
+func unblockClient(b *blockedClient, reply []byte) {
+	blocking.Lock()
+	defer blocking.Unlock()
+
+	if b.done {
+		return
+	}
+	b.done = true
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+
+	isClient := func(other *blockedClient) bool { return other == b }
+	if b.keys == nil {
+		blocking.acks = slices.DeleteFunc(blocking.acks, isClient)
+	}
+	for _, key := range b.keys {
+		waiting := slices.DeleteFunc(blocking.byKey[key], isClient)
+		if len(waiting) == 0 {
+			delete(blocking.byKey, key)
+		} else {
+			blocking.byKey[key] = waiting
+		}
+	}
+	b.reply <- reply
+}
+
+// serveBlockedClients tries the clients waiting on the keys that changed,
+// first come first served, until no more keys are ready. It runs on the
+// executor after every job, as serving a client may change other keys.
+func serveBlockedClients() {
+	for {
+		blocking.Lock()
+		var waiting []*blockedClient
+		for key := range blocking.ready {
+			waiting = append(waiting, blocking.byKey[key]...)
+		}
+		if blocking.acked {
+			waiting = append(waiting, blocking.acks...)
+		}
+		clear(blocking.ready)
+		blocking.acked = false
+		blocking.Unlock()
+
+		if len(waiting) == 0 {
+			return
+		}
+		// Clients waiting on several ready keys are tried once, in the order
+		// they blocked
+		slices.SortFunc(waiting, func(a, b *blockedClient) int {
+			return cmp.Compare(a.seq, b.seq)
+		})
+		waiting = slices.Compact(waiting)
+
+		for _, b := range waiting {
+			if b.done {
+				continue
+			}
+			if reply := b.serve(); reply != nil {
+				unblockClient(b, reply)
+			}
+		}
+	}
+}
+
+// waitUnblocked waits for the reply of the blocked client. The connection is
+// read in the meantime to notice the client going away, and the bytes
+// received, e.g. pipelined commands, are returned to be executed next.
+func (c *client) waitUnblocked() (reply []byte, input []byte, err error) {
+	b := c.blocked
+	c.blocked = nil
+
+	// The connection gives its slot back to the others meanwhile
+	connLimit.release()
+	defer connLimit.acquire()
+
+	type read struct {
+		input []byte
+		err   error
+	}
+	reads := make(chan read, 1)
+	go func() {
+		var input []byte
+		buffer := make([]byte, READ_BUFFER_SIZE)
+		for {
+			n, err := c.conn.Read(buffer)
+			input = append(input, buffer[:n]...)
+			if err != nil {
+				reads <- read{input, err}
+				return
+			}
+		}
+	}()
+
+	select {
+	case reply = <-b.reply:
+		// Interrupt the read, keeping what it got so far
+		c.conn.SetReadDeadline(time.Now())
+		r := <-reads
+		c.conn.SetReadDeadline(time.Time{})
+		return reply, r.input, nil
+	case r := <-reads:
+		executor.run(func() ([]byte, error) {
+			unblockClient(b, nil)
+			return nil, nil
+		})
+		return nil, nil, r.err
+	}
+}
+
+// readyKeysListener marks the keys that changed while clients wait on them
+type readyKeysListener struct{}
+
+func (readyKeysListener) Changed(key string, entry *store.Entry) {
+	if entry == nil {
+		return
+	}
+
+	blocking.Lock()
+	defer blocking.Unlock()
+	if len(blocking.byKey[key]) > 0 {
+		blocking.ready[key] = true
+	}
+}
+
+func (readyKeysListener) Reset() {}
+
+// signalReplicaAck lets the clients in WAIT check the acknowledged offsets
+func signalReplicaAck() {
+	blocking.Lock()
+	waiting := len(blocking.acks) > 0
+	blocking.acked = waiting
+	blocking.Unlock()
+
+	if waiting {
+		go executor.run(func() ([]byte, error) { return nil, nil })
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/bloom"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// Type name of Bloom filters, as used by RedisBloom
+const BLOOM_TYPE_NAME = "MBbloom--"
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   BLOOM_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			f, err := bloom.Unmarshal(data)
+			if err != nil {
+				return nil, err
+			}
+			return &bloomValue{f}, nil
+		},
+	})
+}
+
+type bloomValue struct {
+	*bloom.Filter
+}
+
+func (v *bloomValue) TypeName() string {
+	return BLOOM_TYPE_NAME
+}
+
+func (v *bloomValue) Clone() store.ModuleValue {
+	return &bloomValue{v.Filter.Clone()}
+}
+
+func (v *bloomValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.Filter)) + v.Size()
+}
+
+func getBloom(key string) (*bloomValue, bool, error) {
+	value, ok, err := cache.GetModule(key, BLOOM_TYPE_NAME)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*bloomValue), true, nil
+}
+
+// BF.RESERVE key error_rate capacity [EXPANSION expansion] [NONSCALING]
+func handleCommandBFReserve(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+
+	errorRate, err := strconv.ParseFloat(cmd[1].Content.(string), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		return nil, resp.NewError("ERR", "(0 < error rate range < 1)")
+	}
+	capacity, err := strconv.ParseUint(cmd[2].Content.(string), 10, 64)
+	if err != nil || capacity == 0 {
+		return nil, resp.NewError("ERR", "(capacity should be larger than 0)")
+	}
+
+	expansion := uint64(bloom.DEFAULT_EXPANSION)
+	nonScaling := false
+	for args := cmd[3:]; len(args) > 0; {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "EXPANSION":
+			if len(args) < 2 {
+				return nil, resp.NewError("ERR", "no expansion")
+			}
+			expansion, err = strconv.ParseUint(args[1].Content.(string), 10, 64)
+			if err != nil || expansion == 0 {
+				return nil, resp.NewError("ERR", "expansion should be greater or equal to 1")
+			}
+			args = args[2:]
+		case "NONSCALING":
+			nonScaling = true
+			args = args[1:]
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+	if nonScaling {
+		expansion = 0
+	}
+
+	if entry, ok := cache.Get(key); ok && !entry.Expired() {
+		return nil, resp.NewError("ERR", "item exists")
+	}
+	cache.Set(key, &bloomValue{bloom.New(errorRate, capacity, expansion)}, time.Time{}, store.TYPE_MODULE)
+	return OK_RESP, nil
+}
+
+// addToBloom adds items to the filter at key, which is created with the
+// default parameters if needed
+func addToBloom(key string, items []resp.Resp) ([]resp.Resp, error) {
+	f, ok, err := getBloom(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		f = &bloomValue{bloom.New(bloom.DEFAULT_ERROR_RATE, bloom.DEFAULT_CAPACITY, bloom.DEFAULT_EXPANSION)}
+		cache.Set(key, f, time.Time{}, store.TYPE_MODULE)
+	}
+
+	results := make([]resp.Resp, 0, len(items))
+	cache.Modify(key, func() error {
+		for _, item := range items {
+			added, err := f.Add(item.Content.(string))
+			if err != nil {
+				results = append(results, resp.Resp{Content: err.Error(), DataType: resp.ERROR})
+			} else {
+				results = append(results, resp.Resp{Content: boolToInt(added), DataType: resp.INTEGER})
+			}
+		}
+		return nil
+	})
+	return results, nil
+}
+
+// BF.ADD key item
+func handleCommandBFAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	results, err := addToBloom(cmd[0].Content.(string), cmd[1:])
+	if err != nil {
+		return nil, err
+	}
+	return resp.AppendValue(nil, results[0]), nil
+}
+
+// BF.MADD key item [item ...]
+func handleCommandBFMAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	results, err := addToBloom(cmd[0].Content.(string), cmd[1:])
+	if err != nil {
+		return nil, err
+	}
+	return resp.AppendArray(nil, results), nil
+}
+
+// BF.EXISTS key item
+func handleCommandBFExists(cmd []resp.Resp, c *client) ([]byte, error) {
+	f, ok, err := getBloom(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.AppendInteger(nil, 0), nil
+	}
+	return resp.AppendInteger(nil, int64(boolToInt(f.Exists(cmd[1].Content.(string))))), nil
+}
+
+// BF.INFO key
+func handleCommandBFInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	f, ok, err := getBloom(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "not found")
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "Capacity", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Capacity()), DataType: resp.INTEGER},
+		{Content: "Size", DataType: resp.SIMPLE_STRING},
+		{Content: f.MemoryUsage(), DataType: resp.INTEGER},
+		{Content: "Number of filters", DataType: resp.SIMPLE_STRING},
+		{Content: f.NumFilters(), DataType: resp.INTEGER},
+		{Content: "Number of items inserted", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Count()), DataType: resp.INTEGER},
+		{Content: "Expansion rate", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Expansion), DataType: resp.INTEGER},
+	}), nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
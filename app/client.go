@@ -0,0 +1,136 @@
+package main
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// client holds the per-connection state shared by the command handlers.
+type client struct {
+	id         int64
+	conn       net.Conn
+	fromMaster bool
+	createdAt  time.Time
+
+	// Closes the connection, in a way that lets the goroutine serving it
+	// clean up
+	kill func()
+	// Set when the client killed itself, to close the connection after
+	// replying
+	killed bool
+
+	// Whether the client ran AUTH successfully, only checked with requirepass
+	authenticated bool
+	// Set by HELLO 3. Read by PUBLISH from other clients to encode messages
+	// as push frames.
+	resp3 atomic.Bool
+	// Set by HELLO SETNAME. Read by CLIENT LIST from other clients.
+	name atomic.Pointer[string]
+
+	// Set by ASKING, for the next command to run on a slot being imported
+	asking bool
+	// Set by READONLY, for a cluster replica to serve reads of its master's
+	// slots instead of redirecting them
+	readOnly bool
+
+	// Address a replica announced with REPLCONF before PSYNC, and its
+	// registration once synchronized
+	listeningPort string
+	announcedIP   string
+	replica       *replicaConn
+
+	// Input of a command that hasn't been received in full yet, past the
+	// elements the parser already holds
+	query  []byte
+	parser resp.RequestParser
+
+	// MULTI state. dirtyExec is set when a command failed to queue, so that
+	// EXEC aborts the whole transaction.
+	multi     bool
+	dirtyExec bool
+	queued    [][]resp.Resp
+
+	// Commands replicated in place of the one being executed, when it is not
+	// deterministic. An empty, non-nil slice means nothing is propagated.
+	effects [][]resp.Resp
+
+	// Where the worker pool delivers the result of the current command
+	results chan commandResult
+
+	// Set while the client runs a command on the single writer executor
+	exclusive bool
+	// Set while EXEC runs the queued commands, which can't block
+	execing bool
+	// Set by a blocking command that has to wait for its reply
+	blocked *blockedClient
+
+	// Writes the output of the client once it subscribed to something
+	subscriber *subscriber
+
+	// Memory used by the buffers of the client, see accountMemory
+	memoryMu sync.Mutex
+	memory   int64
+	removed  bool
+	// Accounted by the goroutine serving the client: the input buffers and
+	// the size of the commands queued by MULTI
+	inputMemory  int64
+	queuedMemory int64
+	// Set once the client was disconnected by maxmemory-clients
+	evicted atomic.Bool
+}
+
+// Connected clients by id, for CLIENT LIST and CLIENT KILL
+var clients struct {
+	sync.Mutex
+	byID map[int64]*client
+}
+
+var lastClientID atomic.Int64
+
+// newClient registers the client of a new connection, which must be
+// unregistered with removeClient once closed
+func newClient(conn net.Conn, fromMaster bool) *client {
+	c := &client{
+		id:         lastClientID.Add(1),
+		conn:       conn,
+		fromMaster: fromMaster,
+		createdAt:  time.Now(),
+		kill:       func() { conn.Close() },
+	}
+
+	clients.Lock()
+	defer clients.Unlock()
+	if clients.byID == nil {
+		clients.byID = map[int64]*client{}
+	}
+	clients.byID[c.id] = c
+	return c
+}
+
+// removeClient unregisters a closed client from everything it may have
+// registered to, so that nothing keeps writing to its dead connection
+func removeClient(c *client) {
+	clients.Lock()
+	delete(clients.byID, c.id)
+	clients.Unlock()
+	c.releaseMemory()
+
+	if c.subscriber != nil {
+		removeSubscriber(c.subscriber)
+	}
+	removeMonitor(c.conn)
+	if c.replica != nil {
+		removeReplica(c.replica)
+	}
+}
+
+func (c *client) discardTransaction() {
+	c.multi = false
+	c.dirtyExec = false
+	c.queued = nil
+	c.queuedMemory = 0
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Only the default user exists, so every client is authenticated as it
+const DEFAULT_USER = "default"
+
+// clientType is the type CLIENT KILL TYPE matches, which is also reported by
+// CLIENT LIST
+func (c *client) clientType() string {
+	switch {
+	case c.fromMaster:
+		return "master"
+	case c.replica != nil:
+		return "replica"
+	case c.subscribed():
+		return "pubsub"
+	default:
+		return "normal"
+	}
+}
+
+var clientTypeFlags = map[string]string{
+	"master":  "M",
+	"replica": "S",
+	"pubsub":  "P",
+	"normal":  "N",
+}
+
+func (c *client) info() string {
+	resp := 2
+	if c.resp3.Load() {
+		resp = 3
+	}
+	return fmt.Sprintf("id=%d addr=%s laddr=%s name=%s age=%d flags=%s tot-mem=%d user=%s resp=%d",
+		c.id, c.conn.RemoteAddr(), c.conn.LocalAddr(), c.clientName(), int(time.Since(c.createdAt).Seconds()),
+		clientTypeFlags[c.clientType()], c.usedMemory(), DEFAULT_USER, resp)
+}
+
+// clientName returns the name set with HELLO SETNAME, empty if none
+func (c *client) clientName() string {
+	if name := c.name.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// CLIENT ID | LIST | KILL
+func handleCommandClient(cmd []resp.Resp, c *client) ([]byte, error) {
+	subCmd := strings.ToLower(cmd[0].Content.(string))
+	switch {
+	case subCmd == "id" && len(cmd) == 1:
+		return resp.AppendInteger(nil, c.id), nil
+	case subCmd == "list" && len(cmd) == 1:
+		var sb strings.Builder
+		for _, other := range connectedClients() {
+			sb.WriteString(other.info())
+			sb.WriteString("\n")
+		}
+		return resp.AppendBulkString(nil, sb.String()), nil
+	case subCmd == "kill" && len(cmd) == 2:
+		// Old form, killing the client with the given address
+		addr := cmd[1].Content.(string)
+		for _, other := range connectedClients() {
+			if other.conn.RemoteAddr().String() == addr {
+				if other == c {
+					c.killed = true
+				} else {
+					other.kill()
+				}
+				return OK_RESP, nil
+			}
+		}
+		return nil, resp.NewError("ERR", "No such client")
+	case subCmd == "kill" && len(cmd) > 2:
+		filter, err := parseClientKillFilter(cmd[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		killed := 0
+		for _, other := range connectedClients() {
+			if (other == c && filter.skipMe) || !filter.matches(other) {
+				continue
+			}
+			if other == c {
+				// Closed once the reply is written
+				c.killed = true
+			} else {
+				other.kill()
+			}
+			killed++
+		}
+		return resp.AppendInteger(nil, int64(killed)), nil
+	default:
+		return nil, resp.NewError("ERR", "unknown subcommand or wrong number of arguments for '"+cmd[0].Content.(string)+"'. Try CLIENT HELP.")
+	}
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]] switches the
+// protocol of the connection and replies with the properties of the server,
+// as a map in RESP3. Only pub/sub output uses RESP3 types so far, the other
+// replies are the same in both protocols.
+func handleCommandHello(cmd []resp.Resp, c *client) ([]byte, error) {
+	resp3 := c.resp3.Load()
+	if len(cmd) > 0 {
+		switch cmd[0].Content.(string) {
+		case "2":
+			resp3 = false
+		case "3":
+			resp3 = true
+		default:
+			return nil, resp.NewError("NOPROTO", "unsupported protocol version")
+		}
+	}
+
+	var auth []resp.Resp
+	name, setName := "", false
+	for i := 1; i < len(cmd); i++ {
+		opt := strings.ToUpper(cmd[i].Content.(string))
+		switch {
+		case opt == "AUTH" && i+2 < len(cmd):
+			auth = cmd[i+1 : i+3]
+			i += 2
+		case opt == "SETNAME" && i+1 < len(cmd):
+			name, setName = cmd[i+1].Content.(string), true
+			if strings.ContainsAny(name, " \n") {
+				return nil, resp.NewError("ERR", "Client names cannot contain spaces, newlines or special characters.")
+			}
+			i++
+		default:
+			return nil, resp.NewError("ERR", "Syntax error in HELLO option '"+cmd[i].Content.(string)+"'")
+		}
+	}
+
+	if auth != nil && requirePass.Load() != nil {
+		if _, err := handleCommandAuth(auth, c); err != nil {
+			return nil, err
+		}
+	} else if auth == nil && !c.authenticated && requirePass.Load() != nil {
+		return nil, resp.NewError("NOAUTH", "HELLO must be called with the client already authenticated, otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client and select the RESP protocol version at the same time")
+	}
+
+	c.resp3.Store(resp3)
+	if setName {
+		c.name.Store(&name)
+	}
+
+	proto, mode, role := 2, "standalone", "master"
+	if resp3 {
+		proto = 3
+	}
+	if clusterState != nil {
+		mode = "cluster"
+	}
+	if !node.isMaster() {
+		role = "replica"
+	}
+
+	var res bytes.Buffer
+	encoder := resp.NewEncoder(&res)
+	if resp3 {
+		encoder.WriteMapHeader(7)
+	} else {
+		encoder.WriteArrayHeader(14)
+	}
+	encoder.WriteBulkString("server")
+	encoder.WriteBulkString("redis")
+	encoder.WriteBulkString("version")
+	encoder.WriteBulkString(REDIS_VERSION)
+	encoder.WriteBulkString("proto")
+	encoder.WriteInteger(int64(proto))
+	encoder.WriteBulkString("id")
+	encoder.WriteInteger(c.id)
+	encoder.WriteBulkString("mode")
+	encoder.WriteBulkString(mode)
+	encoder.WriteBulkString("role")
+	encoder.WriteBulkString(role)
+	encoder.WriteBulkString("modules")
+	encoder.WriteArrayHeader(0)
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// connectedClients returns the registered clients ordered by id
+func connectedClients() []*client {
+	clients.Lock()
+	defer clients.Unlock()
+
+	list := make([]*client, 0, len(clients.byID))
+	for _, c := range clients.byID {
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b *client) int { return cmp.Compare(a.id, b.id) })
+	return list
+}
+
+// clientKillFilter holds the filters of CLIENT KILL, which must all match
+// for a client to be killed. Zero values match any client.
+type clientKillFilter struct {
+	ids        []int64
+	clientType string
+	addr       string
+	laddr      string
+	maxAge     time.Duration
+	skipMe     bool
+}
+
+func parseClientKillFilter(args []resp.Resp) (*clientKillFilter, error) {
+	if len(args)%2 != 0 {
+		return nil, resp.ErrSyntax
+	}
+
+	filter := &clientKillFilter{skipMe: true}
+	for i := 0; i < len(args); i += 2 {
+		value := args[i+1].Content.(string)
+		switch strings.ToUpper(args[i].Content.(string)) {
+		case "ID":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return nil, resp.NewError("ERR", "client-id should be greater than 0")
+			}
+			filter.ids = append(filter.ids, id)
+		case "TYPE":
+			switch t := strings.ToLower(value); t {
+			case "normal", "master", "replica", "pubsub":
+				filter.clientType = t
+			case "slave":
+				filter.clientType = "replica"
+			default:
+				return nil, resp.Errorf("ERR", "Unknown client type '%s'", value)
+			}
+		case "USER":
+			if value != DEFAULT_USER {
+				return nil, resp.Errorf("ERR", "No such user '%s'", value)
+			}
+		case "ADDR":
+			filter.addr = value
+		case "LADDR":
+			filter.laddr = value
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.skipMe = true
+			case "no":
+				filter.skipMe = false
+			default:
+				return nil, resp.ErrSyntax
+			}
+		case "MAXAGE":
+			seconds, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || seconds <= 0 {
+				return nil, resp.ErrSyntax
+			}
+			filter.maxAge = time.Duration(seconds) * time.Second
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+	return filter, nil
+}
+
+func (f *clientKillFilter) matches(c *client) bool {
+	if len(f.ids) > 0 && !slices.Contains(f.ids, c.id) {
+		return false
+	}
+	if f.clientType != "" && f.clientType != c.clientType() {
+		return false
+	}
+	if f.addr != "" && f.addr != c.conn.RemoteAddr().String() {
+		return false
+	}
+	if f.laddr != "" && f.laddr != c.conn.LocalAddr().String() {
+		return false
+	}
+	// MAXAGE kills the clients connected for longer than the given age
+	if f.maxAge > 0 && time.Since(c.createdAt) <= f.maxAge {
+		return false
+	}
+	return true
+}
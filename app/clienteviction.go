@@ -0,0 +1,101 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// maxmemory-clients, the memory all clients together can use before the
+	// heaviest are disconnected. Zero disables client eviction.
+	maxMemoryClients atomic.Int64
+	// Memory used by the buffers of all connected clients
+	clientsMemory atomic.Int64
+	// Held while evicting, so that clients aren't evicted twice for the same
+	// excess
+	evicting sync.Mutex
+)
+
+// accountMemory records a change in the memory used by the buffers of the
+// client, evicting clients if the total went over maxmemory-clients. Changes
+// after the client was removed are ignored.
+func (c *client) accountMemory(delta int64) {
+	c.memoryMu.Lock()
+	if c.removed {
+		c.memoryMu.Unlock()
+		return
+	}
+	c.memory += delta
+	total := clientsMemory.Add(delta)
+	c.memoryMu.Unlock()
+
+	if limit := maxMemoryClients.Load(); delta > 0 && limit > 0 && total > limit {
+		evictClients(limit)
+	}
+}
+
+func (c *client) usedMemory() int64 {
+	c.memoryMu.Lock()
+	defer c.memoryMu.Unlock()
+	return c.memory
+}
+
+// updateInputMemory accounts the query buffer and the commands queued by
+// MULTI. It is called by the goroutine serving the client after each read.
+func (c *client) updateInputMemory() {
+	used := int64(cap(c.query)+c.parser.Pending()) + c.queuedMemory
+	if delta := used - c.inputMemory; delta != 0 {
+		c.inputMemory = used
+		c.accountMemory(delta)
+	}
+}
+
+// releaseMemory stops accounting the memory of a client that was removed
+func (c *client) releaseMemory() {
+	c.memoryMu.Lock()
+	defer c.memoryMu.Unlock()
+
+	c.removed = true
+	clientsMemory.Add(-c.memory)
+}
+
+// evictClients disconnects the clients using the most memory until the
+// total is back under limit. Clients already evicted count as freed, as they
+// may not be removed yet. The master and replicas are never evicted.
+func evictClients(limit int64) {
+	if !evicting.TryLock() {
+		return
+	}
+	defer evicting.Unlock()
+
+	type candidate struct {
+		c      *client
+		memory int64
+	}
+	used := clientsMemory.Load()
+	var candidates []candidate
+	for _, c := range connectedClients() {
+		memory := c.usedMemory()
+		switch {
+		case c.evicted.Load():
+			used -= memory
+		case !c.fromMaster && c.replica == nil:
+			candidates = append(candidates, candidate{c, memory})
+		}
+	}
+	slices.SortFunc(candidates, func(a, b candidate) int { return cmp.Compare(b.memory, a.memory) })
+
+	for _, candidate := range candidates {
+		if used <= limit {
+			return
+		}
+		used -= candidate.memory
+		candidate.c.evicted.Store(true)
+		counters.evictedClients.Add(1)
+		fmt.Printf("evicting client %s using %d bytes, maxmemory-clients reached\n", candidate.c.conn.RemoteAddr(), candidate.memory)
+		candidate.c.kill()
+	}
+}
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/cluster"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+const DEFAULT_CLUSTER_CONFIG_FILE = "nodes.conf"
+
+// View of the cluster, nil unless cluster-enabled is set
+var clusterState *cluster.State
+
+// Keys of each slot, maintained in cluster mode only
+var slotIndex *cluster.SlotIndex
+
+// slotIndexListener keeps the slot index up to date as keys come and go
+type slotIndexListener struct{}
+
+func (slotIndexListener) Changed(key string, entry *store.Entry) {
+	if entry == nil {
+		slotIndex.Remove(key)
+	} else {
+		slotIndex.Add(key)
+	}
+}
+
+func (slotIndexListener) Reset() {
+	slotIndex.Clear()
+}
+
+func clusterConfigFile() string {
+	if path, ok := config.get("cluster-config-file"); ok {
+		return path
+	}
+	return DEFAULT_CLUSTER_CONFIG_FILE
+}
+
+// initCluster loads the cluster configuration file, or creates it with a new
+// node ID on the first start
+func initCluster() error {
+	if enabled, _ := config.get("cluster-enabled"); enabled != "yes" {
+		return nil
+	}
+
+	// The address other nodes and clients are given can differ from the one
+	// the server is bound to, e.g. behind NAT or in a container
+	host, ok := config.get("cluster-announce-ip")
+	if !ok {
+		host = "127.0.0.1"
+	}
+	port, err := announcedPort("cluster-announce-port", node.port)
+	if err != nil {
+		return err
+	}
+	busPort, err := announcedPort("cluster-announce-bus-port", strconv.Itoa(port))
+	if err != nil {
+		return err
+	}
+
+	state, err := cluster.Load(clusterConfigFile())
+	if errors.Is(err, os.ErrNotExist) {
+		state = cluster.New(&cluster.Node{ID: cluster.NewNodeID()})
+	} else if err != nil {
+		return err
+	}
+	state.Myself.Host, state.Myself.Port, state.Myself.BusPort = host, port, busPort
+
+	// A replica resumes replicating its master, started by main like a
+	// replica configured with replicaof
+	if master, ok := state.Node(state.Myself.MasterID); ok {
+		node.role = SLAVE
+		node.masterHost = master.Addr()
+	}
+
+	clusterState = state
+	slotIndex = cluster.NewSlotIndex()
+	cache.Iterate(func(key string, entry store.Entry) bool {
+		slotIndex.Add(key)
+		return true
+	})
+	cache.AddListener(slotIndexListener{})
+	fmt.Printf("cluster node %s\n", state.Myself.ID)
+	return state.Save(clusterConfigFile())
+}
+
+// announcedPort returns the port set by the given parameter, or the default
+// when it's unset or 0
+func announcedPort(name, defaultPort string) (int, error) {
+	value, ok := config.get(name)
+	if !ok || value == "0" {
+		value = defaultPort
+	}
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 0 || port > 65535 {
+		return 0, fmt.Errorf("invalid %s '%s'", name, value)
+	}
+	return port, nil
+}
+
+// saveClusterConfig persists the cluster state after a change. It must be
+// called with the state locked.
+func saveClusterConfig() {
+	if err := clusterState.Save(clusterConfigFile()); err != nil {
+		fmt.Println("error saving cluster config, ", err)
+	}
+}
+
+type clusterSubcommand struct {
+	name    string
+	minArgs int
+	handler commandHandler
+}
+
+var clusterSubcommands []clusterSubcommand
+
+func init() {
+	clusterSubcommands = []clusterSubcommand{
+		{"myid", 0, handleClusterMyID},
+		{"nodes", 0, handleClusterNodes},
+		{"info", 0, handleClusterInfo},
+		{"slots", 0, handleClusterSlots},
+		{"keyslot", 1, handleClusterKeySlot},
+		{"addslots", 1, handleClusterAddSlots},
+		{"addslotsrange", 2, handleClusterAddSlotsRange},
+		{"delslots", 1, handleClusterDelSlots},
+		{"delslotsrange", 2, handleClusterDelSlotsRange},
+		{"setslot", 2, handleClusterSetSlot},
+		{"meet", 2, handleClusterMeet},
+		{"gossip", 1, handleClusterGossip},
+		{"getkeysinslot", 2, handleClusterGetKeysInSlot},
+		{"countkeysinslot", 1, handleClusterCountKeysInSlot},
+		{"replicate", 1, handleClusterReplicate},
+		{"failover", 0, handleClusterFailover},
+		{"failover-auth-request", 2, handleClusterFailoverAuthRequest},
+		{"saveconfig", 0, handleClusterSaveConfig},
+	}
+}
+
+func handleCommandCluster(cmd []resp.Resp, c *client) ([]byte, error) {
+	if clusterState == nil {
+		return nil, resp.NewError("ERR", "This instance has cluster support disabled")
+	}
+
+	name := strings.ToLower(cmd[0].Content.(string))
+	for _, sub := range clusterSubcommands {
+		if sub.name != name {
+			continue
+		}
+		if len(cmd)-1 < sub.minArgs {
+			return nil, resp.Errorf("ERR", "wrong number of arguments for 'cluster|%s' command", name)
+		}
+		return sub.handler(cmd[1:], c)
+	}
+	return nil, resp.Errorf("ERR", "unknown subcommand '%s'. Try CLUSTER HELP.", cmd[0].Content)
+}
+
+// CLUSTER SAVECONFIG forces the state to be written to the config file, which
+// otherwise happens after every change
+func handleClusterSaveConfig(args []resp.Resp, c *client) ([]byte, error) {
+	// Locked for writing, as concurrent saves would share the temporary file
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	if err := clusterState.Save(clusterConfigFile()); err != nil {
+		return nil, resp.NewError("ERR", "error saving the cluster node config: "+err.Error())
+	}
+	return OK_RESP, nil
+}
+
+func handleClusterMyID(args []resp.Resp, c *client) ([]byte, error) {
+	return resp.AppendBulkString(nil, clusterState.Myself.ID), nil
+}
+
+func handleClusterNodes(args []resp.Resp, c *client) ([]byte, error) {
+	clusterState.RLock()
+	defer clusterState.RUnlock()
+
+	var sb strings.Builder
+	for _, n := range clusterState.Nodes() {
+		sb.WriteString(clusterState.NodeLine(n))
+		sb.WriteString("\n")
+	}
+	return resp.AppendBulkString(nil, sb.String()), nil
+}
+
+func handleClusterInfo(args []resp.Resp, c *client) ([]byte, error) {
+	clusterState.RLock()
+	defer clusterState.RUnlock()
+
+	assigned := clusterState.AssignedSlots()
+	status := "ok"
+	if assigned < cluster.SLOTS {
+		status = "fail"
+	}
+
+	size := 0
+	nodes := clusterState.Nodes()
+	for _, n := range nodes {
+		if n.IsMaster() && len(clusterState.Slots(n)) > 0 {
+			size++
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "cluster_state:%s\r\n", status)
+	fmt.Fprintf(&sb, "cluster_slots_assigned:%d\r\n", assigned)
+	fmt.Fprintf(&sb, "cluster_slots_ok:%d\r\n", assigned)
+	sb.WriteString("cluster_slots_pfail:0\r\n")
+	sb.WriteString("cluster_slots_fail:0\r\n")
+	fmt.Fprintf(&sb, "cluster_known_nodes:%d\r\n", len(nodes))
+	fmt.Fprintf(&sb, "cluster_size:%d\r\n", size)
+	fmt.Fprintf(&sb, "cluster_current_epoch:%d\r\n", clusterState.CurrentEpoch)
+	fmt.Fprintf(&sb, "cluster_my_epoch:%d\r\n", clusterState.Myself.ConfigEpoch)
+	return resp.AppendBulkString(nil, sb.String()), nil
+}
+
+func nodeEndpoint(n *cluster.Node) resp.Resp {
+	return resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+		{Content: n.Host, DataType: resp.STRING},
+		{Content: n.Port, DataType: resp.INTEGER},
+		{Content: n.ID, DataType: resp.STRING},
+	}}
+}
+
+// CLUSTER SLOTS replies with each range of consecutive slots served by the
+// same node, followed by the master and its replicas
+func handleClusterSlots(args []resp.Resp, c *client) ([]byte, error) {
+	clusterState.RLock()
+	defer clusterState.RUnlock()
+
+	nodes := clusterState.Nodes()
+	var ranges []resp.Resp
+	for start := 0; start < cluster.SLOTS; {
+		owner := clusterState.Owner(start)
+		end := start
+		for end+1 < cluster.SLOTS && clusterState.Owner(end+1) == owner {
+			end++
+		}
+		if owner != nil {
+			entry := []resp.Resp{
+				{Content: start, DataType: resp.INTEGER},
+				{Content: end, DataType: resp.INTEGER},
+				nodeEndpoint(owner),
+			}
+			for _, n := range nodes {
+				if n.MasterID == owner.ID {
+					entry = append(entry, nodeEndpoint(n))
+				}
+			}
+			ranges = append(ranges, resp.Resp{Content: entry, DataType: resp.ARRAY})
+		}
+		start = end + 1
+	}
+	return resp.AppendArray(nil, ranges), nil
+}
+
+func handleClusterKeySlot(args []resp.Resp, c *client) ([]byte, error) {
+	return resp.AppendInteger(nil, int64(cluster.KeySlot(args[0].Content.(string)))), nil
+}
+
+func parseSlot(arg resp.Resp) (int, error) {
+	slot, err := strconv.Atoi(arg.Content.(string))
+	if err != nil || slot < 0 || slot >= cluster.SLOTS {
+		return 0, resp.NewError("ERR", "Invalid or out of range slot")
+	}
+	return slot, nil
+}
+
+func parseSlots(args []resp.Resp) ([]int, error) {
+	slots := make([]int, 0, len(args))
+	for _, arg := range args {
+		slot, err := parseSlot(arg)
+		if err != nil {
+			return nil, err
+		}
+		slots = append(slots, slot)
+	}
+	return slots, nil
+}
+
+// parseSlotRanges expands pairs of start and end slots
+func parseSlotRanges(args []resp.Resp) ([]int, error) {
+	if len(args)%2 != 0 {
+		return nil, resp.NewError("ERR", "wrong number of arguments for slot ranges")
+	}
+
+	var slots []int
+	for i := 0; i < len(args); i += 2 {
+		start, err := parseSlot(args[i])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseSlot(args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if start > end {
+			return nil, resp.Errorf("ERR", "start slot number %d is greater than end slot number %d", start, end)
+		}
+		for slot := start; slot <= end; slot++ {
+			slots = append(slots, slot)
+		}
+	}
+	return slots, nil
+}
+
+// updateSlots applies a change to the slots of this node, then persists and
+// announces it
+func updateSlots(slots []int, parseErr error, update func([]int) error) ([]byte, error) {
+	if parseErr != nil {
+		return nil, parseErr
+	}
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	if err := update(slots); err != nil {
+		return nil, err
+	}
+	saveClusterConfig()
+	broadcastMyself()
+	return OK_RESP, nil
+}
+
+func handleClusterAddSlots(args []resp.Resp, c *client) ([]byte, error) {
+	slots, err := parseSlots(args)
+	return updateSlots(slots, err, clusterState.AddSlots)
+}
+
+func handleClusterAddSlotsRange(args []resp.Resp, c *client) ([]byte, error) {
+	slots, err := parseSlotRanges(args)
+	return updateSlots(slots, err, clusterState.AddSlots)
+}
+
+func handleClusterDelSlots(args []resp.Resp, c *client) ([]byte, error) {
+	slots, err := parseSlots(args)
+	return updateSlots(slots, err, clusterState.DelSlots)
+}
+
+func handleClusterDelSlotsRange(args []resp.Resp, c *client) ([]byte, error) {
+	slots, err := parseSlotRanges(args)
+	return updateSlots(slots, err, clusterState.DelSlots)
+}
+
+// CLUSTER SETSLOT slot IMPORTING node-id | MIGRATING node-id | NODE node-id | STABLE
+func handleClusterSetSlot(args []resp.Resp, c *client) ([]byte, error) {
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	action := strings.ToUpper(args[1].Content.(string))
+	if action == "STABLE" {
+		clusterState.SetStable(slot)
+		saveClusterConfig()
+		return OK_RESP, nil
+	}
+
+	if len(args) < 3 {
+		return nil, resp.ErrSyntax
+	}
+	id := args[2].Content.(string)
+	n, ok := clusterState.Node(id)
+	if !ok {
+		return nil, resp.NewError("ERR", "I don't know about node "+id)
+	}
+
+	switch action {
+	case "MIGRATING":
+		err = clusterState.SetMigrating(slot, n)
+	case "IMPORTING":
+		if n.Myself {
+			return nil, resp.NewError("ERR", "I'm already the owner of hash slot "+strconv.Itoa(slot))
+		}
+		err = clusterState.SetImporting(slot, n)
+	case "NODE":
+		if owner := clusterState.Owner(slot); owner != nil && owner.Myself && !n.Myself && slotIndex.Count(slot) > 0 {
+			return nil, resp.Errorf("ERR", "Can't assign hashslot %d to a different node while I still hold keys for this hash slot.", slot)
+		}
+		// Taking over an imported slot needs a new epoch, for the other nodes
+		// to prefer this node's claim over the previous owner's
+		_, importing := clusterState.Importing(slot)
+		clusterState.SetOwner(slot, n)
+		if n.Myself && importing {
+			clusterState.BumpEpoch()
+		}
+		broadcastMyself()
+	default:
+		return nil, resp.NewError("ERR", "Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	saveClusterConfig()
+	return OK_RESP, nil
+}
+
+// learnNode applies a CLUSTER NODES line received from another node
+func learnNode(line string) error {
+	parsed, err := cluster.ParseNodeLine(line)
+	if err != nil {
+		return err
+	}
+	if parsed.Node.ID == clusterState.Myself.ID {
+		return nil
+	}
+
+	before := make(map[*cluster.Node][]int)
+	for _, n := range clusterState.Nodes() {
+		before[n] = clusterState.Slots(n)
+	}
+
+	parsed.Node.Myself = false
+	n := clusterState.AddNode(parsed.Node)
+	n.Host, n.Port, n.BusPort = parsed.Node.Host, parsed.Node.Port, parsed.Node.BusPort
+	n.MasterID, n.ConfigEpoch = parsed.Node.MasterID, parsed.Node.ConfigEpoch
+	clusterState.Claim(n, parsed.Slots)
+	followSlotsOwner(n, before)
+	return nil
+}
+
+// CLUSTER MEET ip port learns the nodes known by the node at that address,
+// and announces this node to it
+func handleClusterMeet(args []resp.Resp, c *client) ([]byte, error) {
+	addr := args[0].Content.(string) + ":" + args[1].Content.(string)
+	reply, err := clusterCall(addr, "CLUSTER", "NODES")
+	if err != nil {
+		return nil, resp.NewError("ERR", "Invalid node address specified: "+addr)
+	}
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	for _, line := range strings.Split(reply.Content.(string), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if err := learnNode(line); err != nil {
+			return nil, resp.NewError("ERR", "invalid CLUSTER NODES reply from "+addr)
+		}
+	}
+	saveClusterConfig()
+	broadcastMyself()
+	return OK_RESP, nil
+}
+
+// CLUSTER GOSSIP line is sent by other nodes to announce their configuration,
+// as a line of CLUSTER NODES
+func handleClusterGossip(args []resp.Resp, c *client) ([]byte, error) {
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	if err := learnNode(args[0].Content.(string)); err != nil {
+		return nil, resp.NewError("ERR", err.Error())
+	}
+	saveClusterConfig()
+	return OK_RESP, nil
+}
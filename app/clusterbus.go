@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Nodes talk to each other over their client port, with CLUSTER commands,
+// instead of a dedicated binary bus.
+const CLUSTER_BUS_TIMEOUT = 2 * time.Second
+
+// clusterCall runs a command on another node and returns its reply
+func clusterCall(addr string, args ...string) (resp.Resp, error) {
+	conn, err := net.DialTimeout("tcp", addr, CLUSTER_BUS_TIMEOUT)
+	if err != nil {
+		return resp.Resp{}, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(CLUSTER_BUS_TIMEOUT))
+
+	encoder := resp.NewEncoder(conn)
+	decoder := resp.NewDecoder(conn)
+
+	if password, _ := config.get("masterauth"); password != "" {
+		encoder.WriteCommand("AUTH", password)
+	}
+	encoder.WriteCommand(args...)
+	if err := encoder.Flush(); err != nil {
+		return resp.Resp{}, err
+	}
+
+	if password, _ := config.get("masterauth"); password != "" {
+		if reply, err := decoder.Decode(); err != nil || reply.DataType == resp.ERROR {
+			return resp.Resp{}, errors.New("authentication failed")
+		}
+	}
+
+	reply, err := decoder.Decode()
+	if err != nil {
+		return resp.Resp{}, err
+	}
+	if reply.DataType == resp.ERROR {
+		return reply, errors.New(reply.Content.(string))
+	}
+	return reply, nil
+}
+
+// broadcastMyself announces the slots and epoch of this node to every other
+// known node. It must be called with the cluster state locked.
+func broadcastMyself() {
+	line := clusterState.NodeLine(clusterState.Myself)
+	for _, n := range clusterState.Nodes() {
+		if n.Myself {
+			continue
+		}
+		go func(addr string) {
+			if _, err := clusterCall(addr, "CLUSTER", "GOSSIP", line); err != nil {
+				fmt.Printf("error announcing configuration to %s, %s\n", addr, err)
+			}
+		}(n.Addr())
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/cluster"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Time a manual failover waits for the replica to process the master's stream
+const CLUSTER_MANUAL_FAILOVER_TIMEOUT = 5 * time.Second
+
+// CLUSTER REPLICATE node-id makes this node, an empty master, a replica of
+// another master
+func handleClusterReplicate(args []resp.Resp, c *client) ([]byte, error) {
+	id := args[0].Content.(string)
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	master, ok := clusterState.Node(id)
+	if !ok {
+		return nil, resp.NewError("ERR", "Unknown node "+id)
+	}
+	if master.Myself {
+		return nil, resp.NewError("ERR", "Can't replicate myself")
+	}
+	if !master.IsMaster() {
+		return nil, resp.NewError("ERR", "I can only replicate a master, not a replica.")
+	}
+	if clusterState.Myself.IsMaster() {
+		if keys, _, _ := cache.Stats(); keys > 0 || len(clusterState.Slots(clusterState.Myself)) > 0 {
+			return nil, resp.NewError("ERR", "To set a master the node must be empty and without assigned slots.")
+		}
+	}
+
+	followMaster(master)
+	saveClusterConfig()
+	return OK_RESP, nil
+}
+
+// followMaster makes this node a replica of master and announces it. It must
+// be called with the cluster state locked.
+func followMaster(master *cluster.Node) {
+	clusterState.Myself.MasterID = master.ID
+	replicateFrom(master.Addr())
+	broadcastMyself()
+}
+
+// followSlotsOwner is called after n announced its slots. A master that lost
+// its last slots to n, as when one of its replicas was failed over, becomes a
+// replica of n, and so do the replicas of such a master. It must be called
+// with the cluster state locked.
+func followSlotsOwner(n *cluster.Node, before map[*cluster.Node][]int) {
+	myself := clusterState.Myself
+	master := myself
+	if !myself.IsMaster() {
+		master, _ = clusterState.Node(myself.MasterID)
+	}
+	if master == nil || master == n || !n.IsMaster() {
+		return
+	}
+
+	slots := before[master]
+	if len(slots) == 0 || len(clusterState.Slots(master)) > 0 {
+		return
+	}
+	for _, slot := range slots {
+		if clusterState.Owner(slot) == n {
+			followMaster(n)
+			return
+		}
+	}
+}
+
+// CLUSTER FAILOVER [FORCE|TAKEOVER] promotes this replica to master of the
+// slots of its master. By default the replica first catches up with the
+// master's replication stream, FORCE skips that for a master that is down,
+// and both need the votes of a majority of masters. TAKEOVER doesn't ask for
+// votes and simply claims a new config epoch.
+func handleClusterFailover(args []resp.Resp, c *client) ([]byte, error) {
+	mode := ""
+	if len(args) > 1 {
+		return nil, resp.ErrSyntax
+	}
+	if len(args) == 1 {
+		mode = strings.ToUpper(args[0].Content.(string))
+		if mode != "FORCE" && mode != "TAKEOVER" {
+			return nil, resp.ErrSyntax
+		}
+	}
+
+	clusterState.RLock()
+	myself := clusterState.Myself
+	master, ok := clusterState.Node(myself.MasterID)
+	if myself.IsMaster() {
+		clusterState.RUnlock()
+		return nil, resp.NewError("ERR", "You should send CLUSTER FAILOVER to a replica")
+	}
+	if !ok {
+		clusterState.RUnlock()
+		return nil, resp.NewError("ERR", "I'm a replica but my master is unknown to me")
+	}
+	masterAddr := master.Addr()
+	epoch := clusterState.CurrentEpoch + 1
+	var voters []string
+	for _, n := range clusterState.Nodes() {
+		if n.IsMaster() && len(clusterState.Slots(n)) > 0 {
+			voters = append(voters, n.Addr())
+		}
+	}
+	clusterState.RUnlock()
+
+	if mode == "" {
+		if masterLinkStatus() != "up" {
+			return nil, resp.NewError("ERR", "Master is down or failed, please use CLUSTER FAILOVER FORCE")
+		}
+		if err := catchUpWithMaster(masterAddr); err != nil {
+			return nil, resp.NewError("ERR", "Manual failover failed: "+err.Error())
+		}
+	}
+
+	if mode != "TAKEOVER" {
+		votes := 0
+		for _, addr := range voters {
+			if _, err := clusterCall(addr, "CLUSTER", "FAILOVER-AUTH-REQUEST", myself.ID, strconv.FormatUint(epoch, 10)); err == nil {
+				votes++
+			}
+		}
+		if needed := len(voters)/2 + 1; votes < needed {
+			return nil, resp.Errorf("ERR", "Failover auth denied: got %d votes, %d needed", votes, needed)
+		}
+	}
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	if mode == "TAKEOVER" {
+		// Taking over without an election needs an epoch no other node has
+		// claimed, so that this node's view of the slots wins
+		epoch = clusterState.CurrentEpoch + 1
+	}
+	clusterState.Promote(epoch)
+	promoteToMaster()
+	saveClusterConfig()
+	broadcastMyself()
+	fmt.Printf("failover to epoch %d, now serving the slots of %s\n", epoch, master.ID)
+	return OK_RESP, nil
+}
+
+// catchUpWithMaster waits for this replica to process the replication stream
+// up to the master's current offset. Writes the master accepts in the
+// meantime may still be lost, as its clients aren't paused.
+func catchUpWithMaster(addr string) error {
+	reply, err := clusterCall(addr, "INFO", "replication")
+	if err != nil {
+		return err
+	}
+
+	var target int64 = -1
+	for _, line := range strings.Split(reply.Content.(string), "\n") {
+		if value, ok := strings.CutPrefix(strings.TrimSpace(line), "master_repl_offset:"); ok {
+			target, _ = strconv.ParseInt(value, 10, 64)
+		}
+	}
+	if target < 0 {
+		return errors.New("the master didn't report its replication offset")
+	}
+
+	deadline := time.Now().Add(CLUSTER_MANUAL_FAILOVER_TIMEOUT)
+	for replicaOffset() < target {
+		if time.Now().After(deadline) {
+			return errors.New("timed out waiting for the replica to catch up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return nil
+}
+
+// CLUSTER FAILOVER-AUTH-REQUEST node-id epoch is sent by a replica starting
+// a failover. A master serving slots grants its vote once per epoch.
+func handleClusterFailoverAuthRequest(args []resp.Resp, c *client) ([]byte, error) {
+	id := args[0].Content.(string)
+	epoch, err := strconv.ParseUint(args[1].Content.(string), 10, 64)
+	if err != nil {
+		return nil, resp.NewError("ERR", "invalid epoch")
+	}
+
+	clusterState.Lock()
+	defer clusterState.Unlock()
+
+	myself := clusterState.Myself
+	if !myself.IsMaster() || len(clusterState.Slots(myself)) == 0 {
+		return nil, resp.NewError("ERR", "only masters serving slots can vote")
+	}
+	n, ok := clusterState.Node(id)
+	if !ok || n.IsMaster() {
+		return nil, resp.NewError("ERR", "unknown replica "+id)
+	}
+	if epoch < clusterState.CurrentEpoch || epoch <= clusterState.LastVoteEpoch {
+		return nil, resp.Errorf("ERR", "already voted for epoch %d", clusterState.LastVoteEpoch)
+	}
+
+	clusterState.LastVoteEpoch = epoch
+	clusterState.CurrentEpoch = epoch
+	saveClusterConfig()
+	return OK_RESP, nil
+}
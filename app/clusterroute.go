@@ -0,0 +1,101 @@
+package main
+
+import (
+	"github.com/codecrafters-io/redis-starter-go/internal/cluster"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// clusterMiddleware redirects commands on keys of slots this node doesn't
+// serve: -MOVED to the owner of the slot, or -ASK to the node a slot is being
+// migrated to when the keys aren't here anymore. A client that was sent -ASK
+// runs ASKING before retrying on the importing node.
+func clusterMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	// ASKING only applies to the command that follows it. MIGRATE restores
+	// keys with RESTORE-ASKING, which implies it.
+	asking := c.asking || entry.name == "restore-asking"
+	c.asking = false
+
+	if clusterState == nil || c.fromMaster {
+		return next()
+	}
+
+	keys := entry.keys(cmd)
+	if len(keys) == 0 {
+		return next()
+	}
+
+	readOnly := c.readOnly && !entry.hasFlag(FLAG_WRITE)
+	if err := clusterRedirect(keys, asking, readOnly); err != nil {
+		return nil, err
+	}
+	return next()
+}
+
+// clusterRedirect returns the error redirecting a command on keys, or nil if
+// this node serves them. The keys of a command must all hash
+// to the same slot. A replica serves the slots of its master to read-only
+// commands of clients that sent READONLY.
+func clusterRedirect(keys []string, asking, readOnly bool) error {
+	slot := cluster.KeySlot(keys[0])
+	for _, key := range keys[1:] {
+		if cluster.KeySlot(key) != slot {
+			return resp.ErrCrossSlot
+		}
+	}
+
+	clusterState.RLock()
+	defer clusterState.RUnlock()
+
+	owner := clusterState.Owner(slot)
+	if owner == nil {
+		return resp.NewError("CLUSTERDOWN", "Hash slot not served")
+	}
+
+	if owner.Myself {
+		to, migrating := clusterState.Migrating(slot)
+		if !migrating {
+			return nil
+		}
+		for _, key := range keys {
+			if entry, ok := cache.Get(key); !ok || entry.Expired() {
+				return resp.Ask(slot, to.Addr())
+			}
+		}
+		return nil
+	}
+
+	if _, importing := clusterState.Importing(slot); importing && asking {
+		return nil
+	}
+	if readOnly && clusterState.Myself.MasterID == owner.ID {
+		return nil
+	}
+	return resp.Moved(slot, owner.Addr())
+}
+
+// ASKING lets the next command run on a slot being imported
+func handleCommandAsking(cmd []resp.Resp, c *client) ([]byte, error) {
+	if clusterState == nil {
+		return nil, resp.NewError("ERR", "This instance has cluster support disabled")
+	}
+	c.asking = true
+	return OK_RESP, nil
+}
+
+// READONLY lets the connection read from a replica the keys of its master
+func handleCommandReadOnly(cmd []resp.Resp, c *client) ([]byte, error) {
+	if clusterState == nil {
+		return nil, resp.NewError("ERR", "This instance has cluster support disabled")
+	}
+	c.readOnly = true
+	return OK_RESP, nil
+}
+
+// READWRITE restores the default of redirecting all commands to the master
+func handleCommandReadWrite(cmd []resp.Resp, c *client) ([]byte, error) {
+	if clusterState == nil {
+		return nil, resp.NewError("ERR", "This instance has cluster support disabled")
+	}
+	c.readOnly = false
+	return OK_RESP, nil
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type commandHandler func(args []resp.Resp, c *client) ([]byte, error)
+
+type commandFlags uint
+
+const (
+	// Executed right away instead of being queued inside MULTI
+	FLAG_NO_QUEUE commandFlags = 1 << iota
+	// Modifies the dataset, so its effects are propagated to replicas
+	FLAG_WRITE
+	// Runs on the single writer executor without modifying the dataset
+	FLAG_EXCLUSIVE
+	// Its arguments hold credentials, so it isn't shown by MONITOR or SLOWLOG
+	FLAG_SENSITIVE
+	// May use more memory, so it is rejected once maxmemory is reached and
+	// nothing can be evicted
+	FLAG_DENY_OOM
+	// Doesn't read the dataset and may wait on other nodes, so it runs
+	// without holding datasetLock, which would hold up the executor
+	FLAG_NO_DATASET
+)
+
+// Arities count the command name itself, as in Redis. A maxArgs of -1 means the
+// command is variadic. Key positions are indexes into the full command, with a
+// lastKey of -1 meaning the last argument and a firstKey of 0 meaning no keys.
+type command struct {
+	name     string
+	minArgs  int
+	maxArgs  int
+	firstKey int
+	lastKey  int
+	keyStep  int
+	handler  commandHandler
+	flags    commandFlags
+}
+
+var commandTable map[string]*command
+
+func init() {
+	commandTable = make(map[string]*command)
+	for _, cmd := range []*command{
+		{"ping", 1, 2, 0, 0, 0, handleCommandPing, 0},
+		{"echo", 2, 2, 0, 0, 0, handleCommandEcho, 0},
+		{"time", 1, 1, 0, 0, 0, handleCommandTime, 0},
+		{"get", 2, 2, 1, 1, 1, handleCommandGet, 0},
+		{"getrange", 4, 4, 1, 1, 1, handleCommandGetRange, 0},
+		{"substr", 4, 4, 1, 1, 1, handleCommandGetRange, 0},
+		{"set", 3, -1, 1, 1, 1, handleCommandSet, FLAG_WRITE | FLAG_DENY_OOM},
+		{"config", 2, -1, 0, 0, 0, handleCommandConfig, 0},
+		{"info", 1, -1, 0, 0, 0, handleCommandInfo, 0},
+		{"replconf", 2, -1, 0, 0, 0, handleCommandReplConfig, 0},
+		{"psync", 3, 3, 0, 0, 0, handleCommandSync, FLAG_EXCLUSIVE},
+		{"wait", 3, 3, 0, 0, 0, handleCommandWait, FLAG_EXCLUSIVE},
+		{"replicaof", 3, 3, 0, 0, 0, handleCommandReplicaOf, FLAG_EXCLUSIVE},
+		{"slaveof", 3, 3, 0, 0, 0, handleCommandReplicaOf, FLAG_EXCLUSIVE},
+		{"role", 1, 1, 0, 0, 0, handleCommandRole, 0},
+		{"type", 2, 2, 1, 1, 1, handleCommandType, 0},
+		{"xadd", 5, -1, 1, 1, 1, handleCommandStreamAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"xrange", 4, 6, 1, 1, 1, handleCommandStreamRange, FLAG_EXCLUSIVE},
+		{"xread", 4, -1, 0, 0, 0, handleCommandStreamRead, FLAG_EXCLUSIVE},
+		{"del", 2, -1, 1, -1, 1, handleCommandDel, FLAG_WRITE},
+		{"expire", 3, 3, 1, 1, 1, expireCommand("expire", time.Second, false), FLAG_WRITE},
+		{"pexpire", 3, 3, 1, 1, 1, expireCommand("pexpire", time.Millisecond, false), FLAG_WRITE},
+		{"expireat", 3, 3, 1, 1, 1, expireCommand("expireat", time.Second, true), FLAG_WRITE},
+		{"pexpireat", 3, 3, 1, 1, 1, expireCommand("pexpireat", time.Millisecond, true), FLAG_WRITE},
+		{"ttl", 2, 2, 1, 1, 1, ttlCommand(time.Second), 0},
+		{"pttl", 2, 2, 1, 1, 1, ttlCommand(time.Millisecond), 0},
+		{"lolwut", 1, -1, 0, 0, 0, handleCommandLolwut, 0},
+		{"save", 1, 1, 0, 0, 0, handleCommandSave, FLAG_EXCLUSIVE},
+		{"shutdown", 1, 4, 0, 0, 0, handleCommandShutdown, FLAG_EXCLUSIVE | FLAG_NO_QUEUE},
+		{"bgsave", 1, 2, 0, 0, 0, handleCommandBgsave, 0},
+		{"lastsave", 1, 1, 0, 0, 0, handleCommandLastSave, 0},
+		{"debug", 2, -1, 0, 0, 0, handleCommandDebug, FLAG_EXCLUSIVE},
+		{"multi", 1, 1, 0, 0, 0, handleCommandMulti, FLAG_NO_QUEUE},
+		{"exec", 1, 1, 0, 0, 0, handleCommandExec, FLAG_NO_QUEUE | FLAG_EXCLUSIVE},
+		{"discard", 1, 1, 0, 0, 0, handleCommandDiscard, FLAG_NO_QUEUE},
+		{"hset", 4, -1, 1, 1, 1, handleCommandHSet, FLAG_WRITE | FLAG_DENY_OOM},
+		{"hget", 3, 3, 1, 1, 1, handleCommandHGet, FLAG_EXCLUSIVE},
+		{"hdel", 3, -1, 1, 1, 1, handleCommandHDel, FLAG_WRITE},
+		{"hlen", 2, 2, 1, 1, 1, handleCommandHLen, FLAG_EXCLUSIVE},
+		{"hgetall", 2, 2, 1, 1, 1, handleCommandHGetAll, FLAG_EXCLUSIVE},
+		{"hscan", 3, -1, 1, 1, 1, handleCommandHScan, FLAG_EXCLUSIVE},
+		{"object", 2, -1, 2, 2, 1, handleCommandObject, FLAG_EXCLUSIVE},
+		{"memory", 2, -1, 0, 0, 0, handleCommandMemory, FLAG_EXCLUSIVE},
+		{"scan", 2, -1, 0, 0, 0, handleCommandScan, 0},
+		{"keys", 2, 2, 0, 0, 0, handleCommandKeys, 0},
+		{"slowlog", 2, 3, 0, 0, 0, handleCommandSlowlog, 0},
+		{"auth", 2, 3, 0, 0, 0, handleCommandAuth, FLAG_NO_QUEUE | FLAG_SENSITIVE},
+		{"hello", 1, 7, 0, 0, 0, handleCommandHello, FLAG_NO_QUEUE | FLAG_SENSITIVE},
+		{"monitor", 1, 1, 0, 0, 0, handleCommandMonitor, 0},
+		{"client", 2, -1, 0, 0, 0, handleCommandClient, 0},
+		{"subscribe", 2, -1, 0, 0, 0, subscribeCommand("subscribe", CHANNEL_SUBSCRIPTION), 0},
+		{"unsubscribe", 1, -1, 0, 0, 0, unsubscribeCommand("unsubscribe", CHANNEL_SUBSCRIPTION), 0},
+		{"psubscribe", 2, -1, 0, 0, 0, subscribeCommand("psubscribe", PATTERN_SUBSCRIPTION), 0},
+		{"punsubscribe", 1, -1, 0, 0, 0, unsubscribeCommand("punsubscribe", PATTERN_SUBSCRIPTION), 0},
+		{"ssubscribe", 2, -1, 1, -1, 1, subscribeCommand("ssubscribe", SHARD_SUBSCRIPTION), 0},
+		{"sunsubscribe", 1, -1, 1, -1, 1, unsubscribeCommand("sunsubscribe", SHARD_SUBSCRIPTION), 0},
+		// Replicated from the executor, in order with the writes
+		{"publish", 3, 3, 0, 0, 0, handleCommandPublish, FLAG_EXCLUSIVE},
+		{"spublish", 3, 3, 1, 1, 1, handleCommandSpublish, FLAG_EXCLUSIVE},
+		{"json.set", 4, 5, 1, 1, 1, handleCommandJSONSet, FLAG_WRITE | FLAG_DENY_OOM},
+		{"json.get", 2, -1, 1, 1, 1, handleCommandJSONGet, FLAG_EXCLUSIVE},
+		{"json.del", 2, 3, 1, 1, 1, handleCommandJSONDel, FLAG_WRITE},
+		{"json.forget", 2, 3, 1, 1, 1, handleCommandJSONDel, FLAG_WRITE},
+		{"json.type", 2, 3, 1, 1, 1, handleCommandJSONType, FLAG_EXCLUSIVE},
+		{"ft.create", 5, -1, 0, 0, 0, handleCommandFTCreate, FLAG_WRITE | FLAG_DENY_OOM},
+		{"ft.dropindex", 2, 2, 0, 0, 0, handleCommandFTDropIndex, FLAG_WRITE},
+		{"ft._list", 1, 1, 0, 0, 0, handleCommandFTList, 0},
+		{"ft.info", 2, 2, 0, 0, 0, handleCommandFTInfo, 0},
+		{"ft.search", 3, -1, 0, 0, 0, handleCommandFTSearch, FLAG_EXCLUSIVE},
+		{"ts.create", 2, -1, 1, 1, 1, handleCommandTSCreate, FLAG_WRITE | FLAG_DENY_OOM},
+		{"ts.add", 4, -1, 1, 1, 1, handleCommandTSAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"ts.get", 2, 2, 1, 1, 1, handleCommandTSGet, FLAG_EXCLUSIVE},
+		{"ts.range", 4, -1, 1, 1, 1, handleCommandTSRange, FLAG_EXCLUSIVE},
+		{"ts.createrule", 6, 6, 1, 2, 1, handleCommandTSCreateRule, FLAG_WRITE | FLAG_DENY_OOM},
+		{"ts.deleterule", 3, 3, 1, 2, 1, handleCommandTSDeleteRule, FLAG_WRITE},
+		{"ts.info", 2, 2, 1, 1, 1, handleCommandTSInfo, FLAG_EXCLUSIVE},
+		{"bf.reserve", 4, 7, 1, 1, 1, handleCommandBFReserve, FLAG_WRITE | FLAG_DENY_OOM},
+		{"bf.add", 3, 3, 1, 1, 1, handleCommandBFAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"bf.madd", 3, -1, 1, 1, 1, handleCommandBFMAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"bf.exists", 3, 3, 1, 1, 1, handleCommandBFExists, FLAG_EXCLUSIVE},
+		{"bf.info", 2, 2, 1, 1, 1, handleCommandBFInfo, FLAG_EXCLUSIVE},
+		{"cf.reserve", 3, 9, 1, 1, 1, handleCommandCFReserve, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cf.add", 3, 3, 1, 1, 1, handleCommandCFAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cf.addnx", 3, 3, 1, 1, 1, handleCommandCFAddNX, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cf.exists", 3, 3, 1, 1, 1, handleCommandCFExists, FLAG_EXCLUSIVE},
+		{"cf.count", 3, 3, 1, 1, 1, handleCommandCFCount, FLAG_EXCLUSIVE},
+		{"cf.del", 3, 3, 1, 1, 1, handleCommandCFDel, FLAG_WRITE},
+		{"cf.info", 2, 2, 1, 1, 1, handleCommandCFInfo, FLAG_EXCLUSIVE},
+		{"cms.initbydim", 4, 4, 1, 1, 1, handleCommandCMSInitByDim, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cms.initbyprob", 4, 4, 1, 1, 1, handleCommandCMSInitByProb, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cms.incrby", 4, -1, 1, 1, 1, handleCommandCMSIncrBy, FLAG_WRITE | FLAG_DENY_OOM},
+		{"cms.query", 3, -1, 1, 1, 1, handleCommandCMSQuery, FLAG_EXCLUSIVE},
+		{"cms.info", 2, 2, 1, 1, 1, handleCommandCMSInfo, FLAG_EXCLUSIVE},
+		{"topk.reserve", 3, 6, 1, 1, 1, handleCommandTopKReserve, FLAG_WRITE | FLAG_DENY_OOM},
+		{"topk.add", 3, -1, 1, 1, 1, handleCommandTopKAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"topk.query", 3, -1, 1, 1, 1, handleCommandTopKQuery, FLAG_EXCLUSIVE},
+		{"topk.list", 2, 3, 1, 1, 1, handleCommandTopKList, FLAG_EXCLUSIVE},
+		{"topk.info", 2, 2, 1, 1, 1, handleCommandTopKInfo, FLAG_EXCLUSIVE},
+		{"vadd", 4, -1, 1, 1, 1, handleCommandVAdd, FLAG_WRITE | FLAG_DENY_OOM},
+		{"vsim", 3, -1, 1, 1, 1, handleCommandVSim, FLAG_EXCLUSIVE},
+		{"vrem", 3, 3, 1, 1, 1, handleCommandVRem, FLAG_WRITE},
+		{"vdim", 2, 2, 1, 1, 1, handleCommandVDim, FLAG_EXCLUSIVE},
+		{"vcard", 2, 2, 1, 1, 1, handleCommandVCard, FLAG_EXCLUSIVE},
+		{"cluster", 2, -1, 0, 0, 0, handleCommandCluster, FLAG_NO_DATASET},
+		{"asking", 1, 1, 0, 0, 0, handleCommandAsking, 0},
+		{"readonly", 1, 1, 0, 0, 0, handleCommandReadOnly, 0},
+		{"readwrite", 1, 1, 0, 0, 0, handleCommandReadWrite, 0},
+		{"dump", 2, 2, 1, 1, 1, handleCommandDump, FLAG_EXCLUSIVE},
+		{"restore", 4, -1, 1, 1, 1, handleCommandRestore, FLAG_WRITE | FLAG_DENY_OOM},
+		{"restore-asking", 4, -1, 1, 1, 1, handleCommandRestore, FLAG_WRITE | FLAG_DENY_OOM},
+		{"migrate", 6, -1, 3, 3, 1, handleCommandMigrate, FLAG_WRITE | FLAG_SENSITIVE},
+	} {
+		commandTable[cmd.name] = cmd
+	}
+}
+
+func lookupCommand(name string) (*command, bool) {
+	cmd, ok := commandTable[strings.ToLower(name)]
+	return cmd, ok
+}
+
+// renameCommand applies a rename-command directive, "name new-name", which
+// makes the command only callable as new-name, or "name" alone or with an
+// empty new name, which disables it. The entry keeps its name, which is what
+// middlewares check, so that e.g. a renamed AUTH still works before
+// authenticating.
+func renameCommand(value string) error {
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return fmt.Errorf("invalid rename-command '%s'", value)
+	}
+
+	name := strings.ToLower(fields[0])
+	cmd, ok := commandTable[name]
+	if !ok {
+		return fmt.Errorf("no such command '%s' in rename-command", fields[0])
+	}
+	delete(commandTable, name)
+
+	if len(fields) == 1 || fields[1] == `""` {
+		return nil
+	}
+	newName := strings.ToLower(fields[1])
+	if _, ok := commandTable[newName]; ok {
+		return fmt.Errorf("target command name '%s' already exists in rename-command", fields[1])
+	}
+	commandTable[newName] = cmd
+	return nil
+}
+
+func (c *command) hasFlag(flag commandFlags) bool {
+	return c.flags&flag != 0
+}
+
+func (c *command) checkArity(argc int) bool {
+	return argc >= c.minArgs && (c.maxArgs < 0 || argc <= c.maxArgs)
+}
+
+// Commands whose keys can't be described with positions, e.g. because they
+// follow an option, have a function returning them from the full command
+var keysFuncs = map[string]func(cmd []resp.Resp) []string{
+	"migrate": migrateKeys,
+	"xread":   xreadKeys,
+}
+
+// keys returns the key arguments of a full command (name included) according
+// to the key positions of the table entry.
+func (c *command) keys(cmd []resp.Resp) []string {
+	if keysFunc, ok := keysFuncs[c.name]; ok {
+		return keysFunc(cmd)
+	}
+	if c.firstKey == 0 {
+		return nil
+	}
+
+	last := c.lastKey
+	if last < 0 {
+		last = len(cmd) + last
+	}
+
+	keys := make([]string, 0, 1)
+	for i := c.firstKey; i <= last && i < len(cmd); i += c.keyStep {
+		keys = append(keys, cmd[i].Content.(string))
+	}
+	return keys
+}
+
+func unknownCommandError(cmd []resp.Resp) *resp.Error {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "unknown command '%s', with args beginning with: ", cmd[0].Content)
+	for _, arg := range cmd[1:] {
+		fmt.Fprintf(&sb, "'%s' ", arg.Content)
+	}
+	return resp.NewError("ERR", sb.String())
+}
+
+func arityError(name string) *resp.Error {
+	return resp.Errorf("ERR", "wrong number of arguments for '%s' command", name)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/replication"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+type safeConfig struct {
+	sync.RWMutex
+	values map[string]string
+}
+
+func (c *safeConfig) get(name string) (string, bool) {
+	c.RWMutex.RLock()
+	defer c.RWMutex.RUnlock()
+
+	value, ok := c.values[name]
+	return value, ok
+}
+
+func (c *safeConfig) set(name, value string) {
+	c.RWMutex.Lock()
+	defer c.RWMutex.Unlock()
+
+	c.values[name] = value
+}
+
+var (
+	// Path of the config file given as first argument, if any
+	configFile string
+	// Parameters given as flags, which take precedence over the config file
+	commandLineOptions = map[string]bool{}
+)
+
+// Parameters that are only read at startup, so changing them in the config
+// file has no effect until the server is restarted.
+var restartRequired = map[string]bool{
+	"port":                      true,
+	"bind":                      true,
+	"replicaof":                 true,
+	"health-port":               true,
+	"pprof-port":                true,
+	"otel-endpoint":             true,
+	"worker-threads":            true,
+	"io-model":                  true,
+	"io-threads":                true,
+	"storage-engine":            true,
+	"loadmodule":                true,
+	"rename-command":            true,
+	"cluster-enabled":           true,
+	"cluster-config-file":       true,
+	"cluster-announce-ip":       true,
+	"cluster-announce-port":     true,
+	"cluster-announce-bus-port": true,
+}
+
+// Parameters whose value must be yes or no
+var yesNoParameters = map[string]bool{
+	"replica-read-only":        true,
+	"slave-read-only":          true,
+	"replica-serve-stale-data": true,
+	"slave-serve-stale-data":   true,
+	"trace-proto":              true,
+	"command-watchdog-slowlog": true,
+	"cluster-enabled":          true,
+	"read-only":                true,
+}
+
+// Parameters holding a number of bytes, with the smallest value they accept
+var memoryParameters = map[string]int64{
+	"proto-max-bulk-len": 1024 * 1024,
+	"maxmemory-clients":  0,
+	"maxmemory":          0,
+}
+
+// Parameters holding a count, with the smallest value they accept
+var countParameters = map[string]int64{
+	"io-threads":              0,
+	"repl-timeout":            1,
+	"maxmemory-samples":       1,
+	"proto-max-multibulk-len": 1,
+}
+
+// parseMemory parses a number of bytes with an optional unit, k, kb, m, mb, g
+// or gb, where the units ending with b are powers of 1024 and the others of
+// 1000
+func parseMemory(value string) (int64, error) {
+	units := []struct {
+		suffix string
+		factor int64
+	}{
+		{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30},
+		{"k", 1e3}, {"m", 1e6}, {"g", 1e9}, {"b", 1},
+	}
+
+	value = strings.ToLower(value)
+	factor := int64(1)
+	for _, unit := range units {
+		if number, ok := strings.CutSuffix(value, unit.suffix); ok {
+			value, factor = number, unit.factor
+			break
+		}
+	}
+
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/factor {
+		return 0, fmt.Errorf("invalid memory value '%s'", value)
+	}
+	return n * factor, nil
+}
+
+// CONFIG SET parameter value [parameter value ...] applies the parameters at
+// runtime. Nothing is applied if one of them can't be set.
+func configSet(args []resp.Resp) ([]byte, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, resp.NewError("ERR", "wrong number of arguments for 'config|set' command")
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		name := strings.ToLower(args[i].Content.(string))
+		if !knownOption(name) {
+			return nil, resp.Errorf("ERR", "Unknown option or number of arguments for CONFIG SET - '%s'", args[i].Content)
+		}
+		if err := checkConfig(name, args[i+1].Content.(string)); err != nil {
+			return nil, resp.Errorf("ERR", "CONFIG SET failed (possibly related to argument '%s') - %s", name, err)
+		}
+	}
+
+	for i := 0; i < len(args); i += 2 {
+		applyConfig(strings.ToLower(args[i].Content.(string)), args[i+1].Content.(string))
+	}
+	return OK_RESP, nil
+}
+
+// setConfig changes a parameter at runtime, as CONFIG SET and a reload of the
+// config file do. Nothing changes when it returns an error.
+func setConfig(name, value string) error {
+	if err := checkConfig(name, value); err != nil {
+		return err
+	}
+	applyConfig(name, value)
+	return nil
+}
+
+// checkConfig checks that a parameter can change at runtime to the given
+// value
+func checkConfig(name, value string) error {
+	if restartRequired[name] {
+		return errors.New("can't set immutable config")
+	}
+	return validateConfig(name, value)
+}
+
+// validateConfig checks the value of a parameter that only accepts some
+// values, whether given with CONFIG SET or on the command line
+func validateConfig(name, value string) error {
+	if yesNoParameters[name] && value != "yes" && value != "no" {
+		return errors.New("argument must be 'yes' or 'no'")
+	}
+	if name == "client-output-buffer-limit" {
+		if _, _, _, err := parseClientOutputBufferLimit(value); err != nil {
+			return err
+		}
+	}
+	if name == "maxmemory-policy" {
+		if _, ok := store.ParseEvictionPolicy(value); !ok {
+			return errors.New("argument must be a valid eviction policy")
+		}
+	}
+	if name == "save" {
+		if _, err := parseSavePoints(value); err != nil {
+			return err
+		}
+	}
+	if minimum, ok := countParameters[name]; ok {
+		if n, err := strconv.ParseInt(value, 10, 64); err != nil || n < minimum {
+			return fmt.Errorf("argument must be a number of at least %d", minimum)
+		}
+	}
+	if minimum, ok := memoryParameters[name]; ok {
+		if n, err := parseMemory(value); err != nil || n < minimum {
+			return fmt.Errorf("argument must be a memory value of at least %d bytes", minimum)
+		}
+	}
+	return nil
+}
+
+// configParameter is a parameter known to CONFIG GET, with the value it has
+// when it isn't set, which is the one the code reading it falls back to
+type configParameter struct {
+	name         string
+	defaultValue string
+}
+
+var configParameters = []configParameter{
+	{"bind", DEFAULT_BIND},
+	{"client-output-buffer-limit", "normal 0 0 0 replica 268435456 67108864 60 pubsub 33554432 8388608 60"},
+	{"cluster-announce-bus-port", "0"},
+	{"cluster-announce-ip", ""},
+	{"cluster-announce-port", "0"},
+	{"cluster-config-file", DEFAULT_CLUSTER_CONFIG_FILE},
+	{"cluster-enabled", "no"},
+	{"command-watchdog-slowlog", "no"},
+	{"command-watchdog-timeout", "0"},
+	{"dbfilename", "dump.rdb"},
+	{"dir", "."},
+	{"hash-max-listpack-entries", "128"},
+	{"hash-max-listpack-value", "64"},
+	{"health-port", ""},
+	{"io-model", ""},
+	{"io-threads", "0"},
+	{"masterauth", ""},
+	{"maxmemory", "0"},
+	{"maxmemory-clients", "0"},
+	{"maxmemory-policy", DEFAULT_MAXMEMORY_POLICY},
+	{"maxmemory-samples", strconv.Itoa(DEFAULT_MAXMEMORY_SAMPLES)},
+	{"otel-endpoint", ""},
+	{"port", "6379"},
+	{"pprof-port", ""},
+	{"proto-max-bulk-len", strconv.Itoa(resp.DEFAULT_MAX_BULK_LENGTH)},
+	{"proto-max-multibulk-len", strconv.Itoa(resp.DEFAULT_MAX_MULTIBULK_LENGTH)},
+	{"read-only", "no"},
+	{"repl-backlog-size", strconv.Itoa(replication.DEFAULT_BACKLOG_SIZE)},
+	{"repl-timeout", strconv.Itoa(DEFAULT_REPL_TIMEOUT)},
+	{"replica-announce-ip", ""},
+	{"replica-announce-port", ""},
+	{"replica-priority", strconv.Itoa(DEFAULT_REPLICA_PRIORITY)},
+	{"replica-read-only", "yes"},
+	{"replica-serve-stale-data", "yes"},
+	{"replicaof", ""},
+	{"requirepass", ""},
+	{"save", ""},
+	{"slowlog-log-slower-than", strconv.Itoa(SLOWLOG_DEFAULT_SLOWER_THAN)},
+	{"slowlog-max-len", strconv.Itoa(SLOWLOG_DEFAULT_MAX_LEN)},
+	{"storage-engine", store.DEFAULT_ENGINE},
+	{"trace-proto", "no"},
+	{"worker-threads", "0"},
+}
+
+// Old names still accepted for some parameters. They are matched by CONFIG
+// GET when given in full, but not by patterns.
+var configAliases = map[string]string{
+	"slave-read-only":        "replica-read-only",
+	"slave-serve-stale-data": "replica-serve-stale-data",
+	"slave-priority":         "replica-priority",
+	"slaveof":                "replicaof",
+}
+
+// CONFIG GET parameter [parameter ...] replies with the name and value of
+// every known parameter matching one of the glob-style patterns
+func configGet(args []resp.Resp) ([]byte, error) {
+	if len(args) == 0 {
+		return nil, resp.NewError("ERR", "wrong number of arguments for 'config|get' command")
+	}
+
+	var reply []resp.Resp
+	add := func(name, value string) {
+		reply = append(reply,
+			resp.Resp{Content: name, DataType: resp.STRING},
+			resp.Resp{Content: value, DataType: resp.STRING},
+		)
+	}
+
+	matched := map[string]bool{}
+	for _, arg := range args {
+		pattern := strings.ToLower(arg.Content.(string))
+		for _, param := range configParameters {
+			if matched[param.name] || !glob.Match(pattern, param.name) {
+				continue
+			}
+			matched[param.name] = true
+			add(param.name, configValue(param))
+		}
+
+		if name, ok := configAliases[pattern]; ok && !matched[pattern] {
+			matched[pattern] = true
+			for _, param := range configParameters {
+				if param.name == name {
+					add(pattern, configValue(param))
+				}
+			}
+		}
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// configValue returns the value of a parameter, set under its name or one of
+// its aliases, or its default
+func configValue(param configParameter) string {
+	if value, ok := config.get(param.name); ok {
+		return value
+	}
+	for alias, name := range configAliases {
+		if name != param.name {
+			continue
+		}
+		if value, ok := config.get(alias); ok {
+			return value
+		}
+	}
+	return param.defaultValue
+}
+
+type configOption struct {
+	name  string
+	value string
+}
+
+// parseConfigFile reads a redis.conf style file: one "name value" directive
+// per line, with blank lines and lines starting with # ignored.
+func parseConfigFile(path string) ([]configOption, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var options []configOption
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name, value, found := strings.Cut(text, " ")
+		if !found {
+			return nil, fmt.Errorf("%s:%d: missing value for '%s'", path, line, name)
+		}
+
+		name = strings.ToLower(name)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		// Every save line adds save points, as in redis.conf
+		if name == "save" {
+			if j := slices.IndexFunc(options, func(o configOption) bool { return o.name == name }); j >= 0 {
+				options[j].value = accumulate(options[j].value, value)
+				continue
+			}
+		}
+		options = append(options, configOption{name, value})
+	}
+	return options, scanner.Err()
+}
+
+// newEngine creates an empty storage engine of the configured kind
+func newEngine() (store.Engine, error) {
+	name, ok := config.get("storage-engine")
+	if !ok {
+		name = store.DEFAULT_ENGINE
+	}
+	return store.NewEngine(name)
+}
+
+// applyConfig sets a parameter that can change while the server is running
+func applyConfig(name, value string) {
+	switch name {
+	case "trace-proto":
+		traceProto.Store(value == "yes")
+	case "slowlog-log-slower-than":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			slowlog.slowerThan.Store(n)
+		}
+	case "slowlog-max-len":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			slowlog.maxLen.Store(n)
+		}
+	case "command-watchdog-timeout":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			watchdog.timeout.Store(n)
+		}
+	case "command-watchdog-slowlog":
+		watchdog.slowlog.Store(value == "yes")
+	case "read-only":
+		readOnly.Store(value == "yes")
+	case "requirepass":
+		if value == "" {
+			requirePass.Store(nil)
+		} else {
+			requirePass.Store(&value)
+		}
+	case "proto-max-bulk-len":
+		if n, err := parseMemory(value); err == nil && n >= memoryParameters[name] {
+			resp.MaxBulkLength.Store(n)
+		}
+	case "proto-max-multibulk-len":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= countParameters[name] {
+			resp.MaxMultibulkLength.Store(n)
+		}
+	case "maxmemory-clients":
+		if n, err := parseMemory(value); err == nil {
+			maxMemoryClients.Store(n)
+		}
+	case "maxmemory":
+		if n, err := parseMemory(value); err == nil {
+			maxMemory.Store(n)
+		}
+	case "maxmemory-policy":
+		if policy, ok := store.ParseEvictionPolicy(value); ok {
+			maxMemoryPolicy.Store(int64(policy))
+		}
+	case "maxmemory-samples":
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && n >= countParameters[name] {
+			maxMemorySamples.Store(n)
+		}
+	case "client-output-buffer-limit":
+		// Classes not given keep their limits
+		if hard, soft, seconds, err := parseClientOutputBufferLimit(value); err == nil && hard >= 0 {
+			pubsubLimits.hard.Store(hard)
+			pubsubLimits.soft.Store(soft)
+			pubsubLimits.softSeconds.Store(seconds)
+		}
+	case "save":
+		if points, err := parseSavePoints(value); err == nil {
+			savePoints.Store(&points)
+		}
+	case "hash-max-listpack-entries":
+		if n, err := strconv.Atoi(value); err == nil {
+			store.HashMaxListpackEntries.Store(int64(n))
+		}
+	case "hash-max-listpack-value":
+		if n, err := strconv.Atoi(value); err == nil {
+			store.HashMaxListpackValue.Store(int64(n))
+		}
+	}
+	config.set(name, value)
+}
+
+// reloadConfig re-reads the config file, applying the parameters that changed
+// and logging the ones that need a restart to take effect.
+func reloadConfig() {
+	if configFile == "" {
+		fmt.Println("no config file to reload")
+		return
+	}
+
+	options, err := parseConfigFile(configFile)
+	if err != nil {
+		fmt.Println("error reloading config file, ", err)
+		return
+	}
+
+	for _, option := range options {
+		current, _ := config.get(option.name)
+		if current == option.value || commandLineOptions[option.name] {
+			continue
+		}
+
+		if restartRequired[option.name] {
+			fmt.Printf("config %s changed to '%s', restart required to apply it\n", option.name, option.value)
+			continue
+		}
+
+		if err := setConfig(option.name, option.value); err != nil {
+			fmt.Printf("config %s not changed to '%s', %s\n", option.name, option.value, err)
+			continue
+		}
+		fmt.Printf("config %s changed from '%s' to '%s'\n", option.name, current, option.value)
+	}
+}
+
+func watchConfigReloads() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		fmt.Println("received SIGHUP, reloading config")
+		reloadConfig()
+	}
+}
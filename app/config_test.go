@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// writeConfigFile writes a config file in a temporary directory and returns
+// its path
+func writeConfigFile(t *testing.T, content string) string {
+	path := filepath.Join(t.TempDir(), "redis.conf")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigFileSaveLines(t *testing.T) {
+	for content, want := range map[string]string{
+		"save 900 1\nsave 300 10\n":               "900 1 300 10",
+		"save 900 1\nsave \"\"\n":                 "",
+		"save 900 1\nsave \"\"\nsave 60 10000\n":  "60 10000",
+		"save 900 1\nport 6380\nsave 300 10\n":    "900 1 300 10",
+		"save \"\"\nsave 900 1\nsave 300 10\n":    "900 1 300 10",
+		"# save 1 1\nsave 900 1\n\nsave 300 10\n": "900 1 300 10",
+	} {
+		options, err := parseConfigFile(writeConfigFile(t, content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		saves := 0
+		for _, option := range options {
+			if option.name != "save" {
+				continue
+			}
+			saves++
+			if option.value != want {
+				t.Errorf("save lines of %q read as %q, want %q", content, option.value, want)
+			}
+		}
+		if saves != 1 {
+			t.Errorf("save lines of %q read as %d options, want 1", content, saves)
+		}
+	}
+}
+
+func TestReloadConfigValidates(t *testing.T) {
+	startTestServer(t)
+	saved := configFile
+	t.Cleanup(func() { configFile = saved })
+
+	configFile = writeConfigFile(t, "maxmemory-policy allkeys-lru\n")
+	reloadConfig()
+	if value, _ := config.get("maxmemory-policy"); value != "allkeys-lru" {
+		t.Fatalf("maxmemory-policy is %q after a reload, want allkeys-lru", value)
+	}
+	t.Cleanup(func() { applyConfig("maxmemory-policy", DEFAULT_MAXMEMORY_POLICY) })
+
+	// Refused as CONFIG SET refuses it
+	configFile = writeConfigFile(t, "maxmemory-policy sometimes\nsave 0 1\n")
+	reloadConfig()
+	if value, _ := config.get("maxmemory-policy"); value != "allkeys-lru" {
+		t.Fatalf("maxmemory-policy is %q after reloading an invalid value", value)
+	}
+	if value, _ := config.get("save"); value == "0 1" {
+		t.Fatal("save points reloaded despite being invalid")
+	}
+}
+
+func TestConfigSetUnknownOption(t *testing.T) {
+	tc := newTestClient(t)
+	reply := tc.do(t, "CONFIG SET maxmemory-samples 7 no-such-option 1")
+	if want := "ERR Unknown option or number of arguments for CONFIG SET - 'no-such-option'"; reply.Content != want {
+		t.Fatalf("CONFIG SET of an unknown option = %v, want -%s", reply.Content, want)
+	}
+	// The known parameter given along with it isn't set either
+	if reply := tc.do(t, "CONFIG GET maxmemory-samples"); reply.Content.([]resp.Resp)[1].Content == "7" {
+		t.Fatal("CONFIG SET applied a parameter given with an unknown one")
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+// connLimiter bounds the number of connections whose requests are being
+// parsed and executed at the same time. It is set with io-threads, the name
+// Redis config files use, but it is not an I/O offload: each connection
+// already reads, parses and writes on its own goroutine, in parallel with the
+// others, so there is no main thread to take that work from. What's left to
+// tune is how many connections are served at once. Connections wait for
+// their data, and write their replies, without holding a slot, so that a
+// client slow to read can't keep the others waiting. Writes still go through
+// the single executor, so commands stay atomic. A client blocked by a command
+// gives its slot back while it waits.
+type connLimiter struct {
+	slots chan struct{}
+
+	served atomic.Int64
+}
+
+// nil when every connection is served as soon as it has data
+var connLimit *connLimiter
+
+func newConnLimiter(size int) *connLimiter {
+	return &connLimiter{slots: make(chan struct{}, size)}
+}
+
+func (l *connLimiter) acquire() {
+	if l == nil {
+		return
+	}
+	l.slots <- struct{}{}
+	l.served.Add(1)
+}
+
+func (l *connLimiter) release() {
+	if l == nil {
+		return
+	}
+	<-l.slots
+}
+
+// info reports the limit under the io_threads fields of Redis, for the tools
+// reading them
+func (l *connLimiter) info() string {
+	if l == nil {
+		return "io_threads:0\n"
+	}
+
+	return fmt.Sprintf("io_threads:%d\n"+
+		"io_threads_active:%d\n"+
+		"io_threaded_batches_processed:%d\n",
+		cap(l.slots), len(l.slots), l.served.Load())
+}
+
+func initConnLimit() {
+	value, ok := config.get("io-threads")
+	if !ok {
+		return
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		fmt.Printf("invalid io-threads value '%s'\n", value)
+		return
+	}
+
+	if size > 0 {
+		connLimit = newConnLimiter(size)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/cuckoo"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// Type name of cuckoo filters, as used by RedisBloom
+const CUCKOO_TYPE_NAME = "MBbloomCF"
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   CUCKOO_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			f, err := cuckoo.Unmarshal(data)
+			if err != nil {
+				return nil, err
+			}
+			return &cuckooValue{f}, nil
+		},
+	})
+}
+
+type cuckooValue struct {
+	*cuckoo.Filter
+}
+
+func (v *cuckooValue) TypeName() string {
+	return CUCKOO_TYPE_NAME
+}
+
+func (v *cuckooValue) Clone() store.ModuleValue {
+	return &cuckooValue{v.Filter.Clone()}
+}
+
+func (v *cuckooValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.Filter)) + v.Size()
+}
+
+func getCuckoo(key string) (*cuckooValue, bool, error) {
+	value, ok, err := cache.GetModule(key, CUCKOO_TYPE_NAME)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*cuckooValue), true, nil
+}
+
+// CF.RESERVE key capacity [BUCKETSIZE size] [MAXITERATIONS iterations]
+// [EXPANSION expansion]
+func handleCommandCFReserve(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+
+	capacity, err := strconv.ParseUint(cmd[1].Content.(string), 10, 64)
+	if err != nil || capacity < 2 {
+		return nil, resp.NewError("ERR", "(capacity should be larger than 1)")
+	}
+
+	bucketSize := uint64(cuckoo.DEFAULT_BUCKET_SIZE)
+	maxIterations := uint64(cuckoo.DEFAULT_MAX_ITERATIONS)
+	expansion := uint64(cuckoo.DEFAULT_EXPANSION)
+	for args := cmd[2:]; len(args) > 0; args = args[2:] {
+		if len(args) < 2 {
+			return nil, resp.ErrSyntax
+		}
+
+		n, err := strconv.ParseUint(args[1].Content.(string), 10, 64)
+		switch option := strings.ToUpper(args[0].Content.(string)); option {
+		case "BUCKETSIZE":
+			if err != nil || n == 0 || n > cuckoo.MAX_BUCKET_SIZE {
+				return nil, resp.NewError("ERR", "Bad bucket size")
+			}
+			bucketSize = n
+		case "MAXITERATIONS":
+			if err != nil || n == 0 {
+				return nil, resp.NewError("ERR", "MAXITERATIONS parameter needs to be a positive integer")
+			}
+			maxIterations = n
+		case "EXPANSION":
+			if err != nil {
+				return nil, resp.NewError("ERR", "EXPANSION parameter needs to be a non-negative integer")
+			}
+			expansion = n
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+
+	if entry, ok := cache.Get(key); ok && !entry.Expired() {
+		return nil, resp.NewError("ERR", "item exists")
+	}
+	cache.Set(key, &cuckooValue{cuckoo.New(capacity, bucketSize, maxIterations, expansion)}, time.Time{}, store.TYPE_MODULE)
+	return OK_RESP, nil
+}
+
+func addToCuckoo(key, item string, nx bool) ([]byte, error) {
+	f, ok, err := getCuckoo(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		f = &cuckooValue{cuckoo.New(cuckoo.DEFAULT_CAPACITY, cuckoo.DEFAULT_BUCKET_SIZE, cuckoo.DEFAULT_MAX_ITERATIONS, cuckoo.DEFAULT_EXPANSION)}
+		cache.Set(key, f, time.Time{}, store.TYPE_MODULE)
+	}
+
+	added := true
+	err = cache.Modify(key, func() (err error) {
+		if nx {
+			added, err = f.AddNX(item)
+			return err
+		}
+		return f.Add(item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.AppendInteger(nil, int64(boolToInt(added))), nil
+}
+
+// CF.ADD key item
+func handleCommandCFAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	return addToCuckoo(cmd[0].Content.(string), cmd[1].Content.(string), false)
+}
+
+// CF.ADDNX key item
+func handleCommandCFAddNX(cmd []resp.Resp, c *client) ([]byte, error) {
+	return addToCuckoo(cmd[0].Content.(string), cmd[1].Content.(string), true)
+}
+
+// CF.EXISTS key item
+func handleCommandCFExists(cmd []resp.Resp, c *client) ([]byte, error) {
+	f, ok, err := getCuckoo(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.AppendInteger(nil, 0), nil
+	}
+	return resp.AppendInteger(nil, int64(boolToInt(f.Exists(cmd[1].Content.(string))))), nil
+}
+
+// CF.COUNT key item
+func handleCommandCFCount(cmd []resp.Resp, c *client) ([]byte, error) {
+	f, ok, err := getCuckoo(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.AppendInteger(nil, 0), nil
+	}
+	return resp.AppendInteger(nil, int64(f.Count(cmd[1].Content.(string)))), nil
+}
+
+// CF.DEL key item
+func handleCommandCFDel(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	f, ok, err := getCuckoo(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "Not found")
+	}
+
+	deleted := false
+	cache.Modify(key, func() error {
+		deleted = f.Delete(cmd[1].Content.(string))
+		return nil
+	})
+	return resp.AppendInteger(nil, int64(boolToInt(deleted))), nil
+}
+
+// CF.INFO key
+func handleCommandCFInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	f, ok, err := getCuckoo(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "not found")
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "Size", DataType: resp.SIMPLE_STRING},
+		{Content: f.MemoryUsage(), DataType: resp.INTEGER},
+		{Content: "Number of buckets", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.NumBuckets()), DataType: resp.INTEGER},
+		{Content: "Number of filters", DataType: resp.SIMPLE_STRING},
+		{Content: f.NumFilters(), DataType: resp.INTEGER},
+		{Content: "Number of items inserted", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Inserted - f.Deleted), DataType: resp.INTEGER},
+		{Content: "Number of items deleted", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Deleted), DataType: resp.INTEGER},
+		{Content: "Bucket size", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.BucketSize), DataType: resp.INTEGER},
+		{Content: "Expansion rate", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.Expansion), DataType: resp.INTEGER},
+		{Content: "Max iterations", DataType: resp.SIMPLE_STRING},
+		{Content: int(f.MaxIterations), DataType: resp.INTEGER},
+	}), nil
+}
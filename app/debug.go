@@ -0,0 +1,40 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// DEBUG <subcommand> [<arg> ...]
+func handleCommandDebug(cmd []resp.Resp, c *client) ([]byte, error) {
+	switch strings.ToUpper(cmd[0].Content.(string)) {
+	case "RELOAD":
+		return debugReload()
+	case "TRACE-PROTO":
+		if len(cmd) != 2 {
+			return nil, arityError("debug|trace-proto")
+		}
+		traceProto.Store(strings.ToLower(cmd[1].Content.(string)) == "yes")
+		return OK_RESP, nil
+	default:
+		return nil, resp.Errorf("ERR", "unknown subcommand '%s'. Try DEBUG HELP.", cmd[0].Content)
+	}
+}
+
+// debugReload saves the dataset and loads it back, so that the keyspace is
+// whatever survived a round trip through the RDB serialization.
+func debugReload() ([]byte, error) {
+	if err := rdbSave(); err != nil {
+		return nil, resp.NewError("ERR", "Error trying to save the DB: "+err.Error())
+	}
+
+	loaded, err := rdbLoad(rdbPath())
+	defer stopLoading()
+	if err != nil {
+		return nil, resp.NewError("ERR", "Error trying to load the RDB dump: "+err.Error())
+	}
+
+	cache.Replace(loaded)
+	return OK_RESP, nil
+}
@@ -0,0 +1,180 @@
+//go:build linux
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+)
+
+// Maximum number of readiness events fetched by a single epoll_wait
+const EPOLL_EVENTS = 256
+
+// eventLoop multiplexes client connections on a single epoll instance instead
+// of parking a goroutine on each of them. Connections are registered with
+// EPOLLONESHOT: when one becomes readable a goroutine drains it and re-arms it,
+// so idle connections only cost their file descriptor and client state.
+type eventLoop struct {
+	epfd int
+
+	sync.Mutex
+	clients map[int]*loopClient
+}
+
+type loopClient struct {
+	fd     int
+	conn   net.Conn
+	client *client
+	buffer []byte
+}
+
+// serveEventLoop accepts connections on the listener and serves them from the
+// event loop. It only returns if the loop can't be set up or stops working.
+func serveEventLoop(listener net.Listener) error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+
+	loop := &eventLoop{
+		epfd:    epfd,
+		clients: make(map[int]*loopClient),
+	}
+	go loop.poll()
+
+	fmt.Println("serving connections from the epoll event loop")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		counters.totalConnectionsReceived.Add(1)
+		if err := loop.register(conn); err != nil {
+			fmt.Println("Error registering connection: ", err.Error())
+			conn.Close()
+		}
+	}
+}
+
+func (l *eventLoop) register(conn net.Conn) error {
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return errors.New("not a TCP connection")
+	}
+
+	raw, err := tcpConn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	fd := -1
+	if err := raw.Control(func(sysfd uintptr) { fd = int(sysfd) }); err != nil {
+		return err
+	}
+
+	traced := traceConn(conn)
+	lc := &loopClient{
+		fd:     fd,
+		conn:   traced,
+		client: newClient(traced, false),
+		buffer: make([]byte, READ_BUFFER_SIZE),
+	}
+	// Closing the descriptor would let a new connection reuse it while
+	// still registered, so the loop is left to notice the shutdown instead
+	lc.client.kill = func() { syscall.Shutdown(fd, syscall.SHUT_RDWR) }
+
+	l.Lock()
+	l.clients[fd] = lc
+	l.Unlock()
+
+	fmt.Printf("new connection from %s\n", conn.RemoteAddr().String())
+	if err := l.arm(fd, syscall.EPOLL_CTL_ADD); err != nil {
+		l.Lock()
+		delete(l.clients, fd)
+		l.Unlock()
+		removeClient(lc.client)
+		return err
+	}
+	return nil
+}
+
+func (l *eventLoop) arm(fd int, op int) error {
+	event := syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT,
+		Fd:     int32(fd),
+	}
+	return syscall.EpollCtl(l.epfd, op, fd, &event)
+}
+
+func (l *eventLoop) poll() {
+	events := make([]syscall.EpollEvent, EPOLL_EVENTS)
+	for {
+		n, err := syscall.EpollWait(l.epfd, events, -1)
+		if err != nil {
+			if errors.Is(err, syscall.EINTR) {
+				continue
+			}
+			fmt.Println("Error waiting for events: ", err.Error())
+			return
+		}
+
+		for _, event := range events[:n] {
+			l.Lock()
+			lc, ok := l.clients[int(event.Fd)]
+			l.Unlock()
+
+			if ok {
+				go l.serve(lc)
+			}
+		}
+	}
+}
+
+// serve reads everything available on a ready connection, executes it and
+// re-arms the connection for the next batch.
+func (l *eventLoop) serve(lc *loopClient) {
+	for {
+		n, err := syscall.Read(lc.fd, lc.buffer)
+		if errors.Is(err, syscall.EAGAIN) {
+			break
+		}
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil || n == 0 {
+			if err != nil {
+				fmt.Println("Error reading connection: ", err.Error())
+			} else {
+				fmt.Println("Client connection closed", lc.conn.RemoteAddr())
+			}
+			l.close(lc)
+			return
+		}
+
+		traceInput(lc.conn.RemoteAddr(), lc.buffer[:n])
+		if err := lc.client.handleInput(lc.buffer[:n]); err != nil {
+			fmt.Printf("Error parsing input from client %s\n", err)
+			l.close(lc)
+			return
+		}
+	}
+
+	if err := l.arm(lc.fd, syscall.EPOLL_CTL_MOD); err != nil {
+		fmt.Println("Error re-arming connection: ", err.Error())
+		l.close(lc)
+	}
+}
+
+func (l *eventLoop) close(lc *loopClient) {
+	l.Lock()
+	delete(l.clients, lc.fd)
+	l.Unlock()
+
+	syscall.EpollCtl(l.epfd, syscall.EPOLL_CTL_DEL, lc.fd, nil)
+	lc.conn.Close()
+	removeClient(lc.client)
+}
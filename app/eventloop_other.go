@@ -0,0 +1,12 @@
+//go:build !linux
+
+package main
+
+import (
+	"errors"
+	"net"
+)
+
+func serveEventLoop(listener net.Listener) error {
+	return errors.New("io-model epoll is only supported on Linux")
+}
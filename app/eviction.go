@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+const (
+	DEFAULT_MAXMEMORY_POLICY  = "noeviction"
+	DEFAULT_MAXMEMORY_SAMPLES = 5
+)
+
+var (
+	// maxmemory, the size the dataset can grow to before keys are evicted.
+	// Zero disables the limit.
+	maxMemory atomic.Int64
+	// maxmemory-policy and maxmemory-samples, how the keys are picked
+	maxMemoryPolicy  atomic.Int64
+	maxMemorySamples atomic.Int64
+	// Candidates kept from one eviction to the next. Evictions only happen
+	// before writes, which run on the executor, so it needs no lock.
+	evictionPool store.EvictionPool
+)
+
+func init() {
+	maxMemorySamples.Store(DEFAULT_MAXMEMORY_SAMPLES)
+}
+
+// evictionMiddleware evicts keys before a write while the dataset is over
+// maxmemory. Commands that may use more memory are rejected if not enough
+// could be evicted, while others, e.g. DEL, still run. Replicas leave
+// eviction to their master and apply the DELs it propagates.
+//
+// A transaction is checked as a whole at EXEC, as Redis does, so that it is
+// either rejected or runs to the end rather than failing halfway.
+func evictionMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	limit := maxMemory.Load()
+	if limit <= 0 || c.fromMaster || c.execing || !node.isMaster() {
+		return next()
+	}
+
+	if entry.name == "exec" && c.multi && !c.dirtyExec {
+		if !evictKeys(limit) && queuedDenyOOM(c) {
+			c.discardTransaction()
+			return nil, resp.NewError("EXECABORT", "Transaction discarded because of: "+resp.ErrOOM.Error())
+		}
+		return next()
+	}
+	if !entry.hasFlag(FLAG_WRITE) {
+		return next()
+	}
+
+	if !evictKeys(limit) && entry.hasFlag(FLAG_DENY_OOM) {
+		return nil, resp.ErrOOM
+	}
+	return next()
+}
+
+// queuedDenyOOM reports whether the transaction of c has a command that may
+// use more memory
+func queuedDenyOOM(c *client) bool {
+	for _, cmd := range c.queued {
+		if entry, ok := lookupCommand(cmd[0].Content.(string)); ok && entry.hasFlag(FLAG_DENY_OOM) {
+			return true
+		}
+	}
+	return false
+}
+
+// outOfMemory reports whether a command of c that may use more memory would
+// be rejected, without evicting anything. Used where keys can't be evicted,
+// e.g. when a command is queued in a transaction.
+func outOfMemory(c *client) bool {
+	limit := maxMemory.Load()
+	if limit <= 0 || c.fromMaster || !node.isMaster() {
+		return false
+	}
+	return store.EvictionPolicy(maxMemoryPolicy.Load()) == store.NO_EVICTION && int64(cache.UsedMemory()) > limit
+}
+
+// evictKeys evicts keys until the dataset fits in limit, reporting whether
+// it does
+func evictKeys(limit int64) bool {
+	policy := store.EvictionPolicy(maxMemoryPolicy.Load())
+	samples := int(maxMemorySamples.Load())
+	for int64(cache.UsedMemory()) > limit {
+		key, ok := cache.Evict(policy, samples, &evictionPool)
+		if !ok {
+			return false
+		}
+
+		counters.evictedKeys.Add(1)
+		propagate([]resp.Resp{
+			{Content: "DEL", DataType: resp.STRING},
+			{Content: key, DataType: resp.STRING},
+		})
+	}
+	return true
+}
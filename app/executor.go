@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// commandExecutor runs every command that modifies the dataset on a single
+// goroutine, one at a time, as Redis does with its main thread. Writes are
+// therefore atomic with respect to each other without the data structures
+// needing their own locks. Lookups release the keyspace lock before returning
+// the value, so only reads of values that are never changed in place, like
+// strings, keep running on the connection (or worker) goroutines. Commands
+// reading hashes, streams or module types are flagged FLAG_EXCLUSIVE to run
+// here as well.
+type commandExecutor struct {
+	jobs chan func()
+}
+
+// datasetLock is held by the executor while it runs a job, and for reading by
+// the commands running outside of it, so that reads never see a job half
+// done, like an EXEC that applied only some of its commands. Jobs propagate
+// their writes before releasing it, which also orders them with the DELs of
+// the keys reads find expired.
+var datasetLock sync.RWMutex
+
+var executor = newCommandExecutor()
+
+func newCommandExecutor() *commandExecutor {
+	e := &commandExecutor{jobs: make(chan func(), WORKER_QUEUE_SIZE)}
+	go func() {
+		for job := range e.jobs {
+			datasetLock.Lock()
+			job()
+			serveBlockedClients()
+			datasetLock.Unlock()
+		}
+	}()
+	return e
+}
+
+// run executes fn on the executor goroutine and waits for its result
+func (e *commandExecutor) run(fn func() ([]byte, error)) ([]byte, error) {
+	done := make(chan commandResult, 1)
+	e.jobs <- func() {
+		out, err := fn()
+		done <- commandResult{out, err}
+	}
+
+	res := <-done
+	return res.out, res.err
+}
+
+// dispatch calls a command, going through the executor for writes and other
+// commands that need exclusive access to the dataset. Other reads run on the
+// calling goroutine, holding datasetLock for reading. Commands executed by an
+// exclusive one, like the ones queued in a transaction, run inline.
+func dispatch(entry *command, cmd []resp.Resp, c *client) ([]byte, error) {
+	if c.exclusive || entry.hasFlag(FLAG_NO_DATASET) {
+		return call(entry, cmd, c)
+	}
+	if !entry.hasFlag(FLAG_WRITE) && !entry.hasFlag(FLAG_EXCLUSIVE) {
+		datasetLock.RLock()
+		defer datasetLock.RUnlock()
+		return call(entry, cmd, c)
+	}
+
+	return executor.run(func() ([]byte, error) {
+		c.exclusive = true
+		defer func() { c.exclusive = false }()
+		return call(entry, cmd, c)
+	})
+}
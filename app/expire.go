@@ -0,0 +1,131 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// expireTime returns the time n units after now, or after the unix epoch when
+// absolute. Times are kept in nanoseconds, so the ones that don't fit are
+// rejected with the error Redis replies for the ones overflowing its
+// milliseconds, instead of silently wrapping around.
+func expireTime(n int64, unit time.Duration, absolute bool, name string) (time.Time, error) {
+	base := time.Now()
+	if absolute {
+		base = time.Unix(0, 0)
+	}
+	if n > math.MaxInt64/int64(unit) || n < math.MinInt64/int64(unit) ||
+		n*int64(unit) > math.MaxInt64-base.UnixNano() {
+		return time.Time{}, resp.Errorf("ERR", "invalid expire time in '%s' command", name)
+	}
+	return base.Add(time.Duration(n) * unit), nil
+}
+
+// expireCommand builds the handler of the EXPIRE family: EXPIRE and PEXPIRE
+// take a relative time in seconds or milliseconds, EXPIREAT and PEXPIREAT a
+// unix timestamp.
+func expireCommand(name string, unit time.Duration, absolute bool) commandHandler {
+	return func(cmd []resp.Resp, c *client) ([]byte, error) {
+		key := cmd[0].Content.(string)
+		n, err := strconv.ParseInt(cmd[1].Content.(string), 10, 64)
+		if err != nil {
+			return nil, resp.ErrNotInteger
+		}
+
+		exp, err := expireTime(n, unit, absolute, name)
+		if err != nil {
+			return nil, err
+		}
+
+		if !cache.SetExpiry(key, exp) {
+			c.propagateAs()
+			return resp.AppendInteger(nil, 0), nil
+		}
+
+		if !exp.After(time.Now()) {
+			cache.Delete(key)
+			c.propagateAs("DEL", key)
+		} else {
+			c.propagateAs("PEXPIREAT", key, strconv.FormatInt(exp.UnixMilli(), 10))
+		}
+
+		return resp.AppendInteger(nil, 1), nil
+	}
+}
+
+// ttlCommand builds the TTL (seconds) and PTTL (milliseconds) handlers.
+func ttlCommand(unit time.Duration) commandHandler {
+	return func(cmd []resp.Resp, c *client) ([]byte, error) {
+		entry, ok := cache.Get(cmd[0].Content.(string))
+		if !ok || entry.Expired() {
+			return resp.AppendInteger(nil, -2), nil
+		}
+
+		if entry.Exp.IsZero() {
+			return resp.AppendInteger(nil, -1), nil
+		}
+
+		ttl := time.Until(entry.Exp)
+		return resp.AppendInteger(nil, int64((ttl+unit/2)/unit)), nil
+	}
+}
+
+const (
+	// How many times per second the active expire cycle runs
+	ACTIVE_EXPIRE_CYCLE_HZ = 10
+	// Keys sampled by each round of the cycle
+	ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP = 20
+	// Percentage of expired keys in a sample past which the cycle goes on
+	// with another round
+	ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE = 10
+	// Longest a cycle runs, as it holds the executor
+	ACTIVE_EXPIRE_CYCLE_BUDGET = 25 * time.Millisecond
+)
+
+// Moving average of the percentage of expired keys found by the active
+// expire cycle, an estimate of the keys that expired but still use memory.
+// Holds the bits of a float64.
+var expiredStale atomic.Uint64
+
+func expiredStalePerc() float64 {
+	return math.Float64frombits(expiredStale.Load())
+}
+
+// activeExpireCycle deletes the keys that expired but aren't read anymore,
+// which lookups alone would never delete. It runs on the executor, so the
+// DELs are propagated in order with the writes. Replicas wait for the DELs
+// of their master instead.
+func activeExpireCycle() {
+	ticker := time.NewTicker(time.Second / ACTIVE_EXPIRE_CYCLE_HZ)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if !node.isMaster() {
+			continue
+		}
+
+		executor.run(func() ([]byte, error) {
+			start := time.Now()
+			sampled, expired := 0, 0
+			for time.Since(start) < ACTIVE_EXPIRE_CYCLE_BUDGET {
+				volatile, n := cache.ExpireCycle(ACTIVE_EXPIRE_CYCLE_KEYS_PER_LOOP)
+				sampled += volatile
+				expired += n
+				if volatile == 0 || n*100 <= volatile*ACTIVE_EXPIRE_CYCLE_ACCEPTABLE_STALE {
+					break
+				}
+			}
+
+			current := 0.0
+			if sampled > 0 {
+				current = float64(expired) * 100 / float64(sampled)
+			}
+			expiredStale.Store(math.Float64bits(current*0.05 + expiredStalePerc()*0.95))
+			return nil, nil
+		})
+	}
+}
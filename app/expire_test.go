@@ -0,0 +1,137 @@
+package main
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// actAsReplica turns the test server into a replica, without any link, until
+// the end of the test
+func actAsReplica(t *testing.T) {
+	setRole := func(role nodeRole) {
+		node.mu.Lock()
+		defer node.mu.Unlock()
+		node.role = role
+	}
+	setRole(SLAVE)
+	t.Cleanup(func() { setRole(MASTER) })
+}
+
+func TestReplicaKeepsExpiredKeys(t *testing.T) {
+	tc := newTestClient(t)
+	actAsReplica(t)
+	cache.Set("expired", "v", time.Now().Add(-time.Second), store.TYPE_STRING)
+
+	if reply := tc.do(t, "GET expired"); reply.Content != nil {
+		t.Fatalf("GET of an expired key = %v, want nil", reply.Content)
+	}
+	if reply := tc.do(t, "TTL expired"); reply.Content != -2 {
+		t.Fatalf("TTL of an expired key = %v, want -2", reply.Content)
+	}
+	cache.ExpireCycle(100)
+	if _, ok := cache.Get("expired"); !ok {
+		t.Fatal("the replica deleted an expired key on its own")
+	}
+
+	// Until its master deletes it
+	masterSide, replicaSide := net.Pipe()
+	defer masterSide.Close()
+	go handleClientConn(replicaSide, true)
+	encoder := resp.NewEncoder(masterSide)
+	encoder.WriteCommand("DEL", "expired")
+	if err := encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, ok := cache.Get("expired"); !ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the DEL of the master didn't delete the expired key")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Run with -race as well: lookups propagate the DEL of the keys they find
+// expired from the goroutine of their connection
+func TestMasterPropagatesExpiredKeys(t *testing.T) {
+	replica, tc := newTestClient(t), newTestClient(t)
+
+	if reply := replica.do(t, "PSYNC ? -1"); reply.DataType != resp.SIMPLE_STRING {
+		t.Fatalf("PSYNC replied with %v", reply.Content)
+	}
+	dump, err := replica.decoder.DecodeRdb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, dump); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Set("expired", "v", time.Now().Add(-time.Second), store.TYPE_STRING)
+	if reply := tc.do(t, "GET expired"); reply.Content != nil {
+		t.Fatalf("GET of an expired key = %v, want nil", reply.Content)
+	}
+	if _, ok := cache.Get("expired"); ok {
+		t.Fatal("the master kept an expired key after reading it")
+	}
+
+	replica.conn.SetReadDeadline(time.Now().Add(time.Second))
+	propagated := replica.receive(t)
+	args, ok := propagated.Content.([]resp.Resp)
+	if !ok || len(args) != 2 || args[0].Content != "DEL" || args[1].Content != "expired" {
+		t.Fatalf("propagated %v, want DEL expired", propagated.Content)
+	}
+}
+
+func TestExpireTimeOverflow(t *testing.T) {
+	tc := newTestClient(t)
+
+	// Expire times are kept in nanoseconds since the epoch, which run out in
+	// April 2262
+	for _, tt := range []struct {
+		command string
+		valid   bool
+	}{
+		{"EXPIREAT overflow 9223372036", true},
+		{"EXPIREAT overflow 9223372037", false},
+		{"EXPIREAT overflow 9300000000", false},
+		{"PEXPIREAT overflow 9223372036854", true},
+		{"PEXPIREAT overflow 9223372036855", false},
+		{"EXPIRE overflow 9300000000", false},
+		// Fits on its own but not once added to the current time
+		{"PEXPIRE overflow 9223372036854", false},
+		{"EXPIRE overflow -9223372037", false},
+		{"SET overflow v EX 9300000000", false},
+		{"SET overflow v PX 9223372036854", false},
+		{"SET overflow v EXAT 9300000000", false},
+		{"SET overflow v EXAT 9223372036", true},
+	} {
+		tc.do(t, "SET overflow v")
+		reply := tc.do(t, tt.command)
+		if !tt.valid {
+			name := strings.ToLower(strings.Fields(tt.command)[0])
+			want := "ERR invalid expire time in '" + name + "' command"
+			if reply.DataType != resp.ERROR || reply.Content != want {
+				t.Fatalf("%s = %v, want -%s", tt.command, reply.Content, want)
+			}
+		} else if reply.DataType == resp.ERROR {
+			t.Fatalf("%s = %v", tt.command, reply.Content)
+		}
+
+		// Whether it was rejected or set far in the future, the key is still
+		// there
+		if reply := tc.do(t, "TTL overflow"); reply.Content == -2 {
+			t.Fatalf("%s deleted the key", tt.command)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+func handleCommandHSet(cmd []resp.Resp, c *client) ([]byte, error) {
+	if len(cmd)%2 == 0 {
+		return nil, arityError("hset")
+	}
+
+	key := cmd[0].Content.(string)
+	hash, ok, err := cache.GetHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		hash = store.NewHash()
+		cache.Set(key, hash, time.Time{}, store.TYPE_HASH)
+	}
+
+	added := 0
+	cache.Modify(key, func() error {
+		for i := 1; i+1 < len(cmd); i += 2 {
+			field, value := cmd[i].Content.(string), interned.intern(cmd[i+1].Content.(string))
+			if hash.Set(field, value) {
+				added++
+			}
+		}
+		return nil
+	})
+	return resp.AppendInteger(nil, int64(added)), nil
+}
+
+func handleCommandHGet(cmd []resp.Resp, c *client) ([]byte, error) {
+	hash, ok, err := cache.GetHash(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	if !ok {
+		counters.keyspaceMisses.Add(1)
+		return NULL_RESP, nil
+	}
+	counters.keyspaceHits.Add(1)
+
+	value, ok := hash.Get(cmd[1].Content.(string))
+	if !ok {
+		return NULL_RESP, nil
+	}
+	return resp.AppendBulkString(nil, value), nil
+}
+
+func handleCommandHDel(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	hash, ok, err := cache.GetHash(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		c.propagateAs()
+		return resp.AppendInteger(nil, 0), nil
+	}
+
+	deleted := 0
+	cache.Modify(key, func() error {
+		for _, arg := range cmd[1:] {
+			if hash.Del(arg.Content.(string)) {
+				deleted++
+			}
+		}
+		return nil
+	})
+
+	if hash.Len() == 0 {
+		cache.Delete(key)
+	}
+	if deleted == 0 {
+		c.propagateAs()
+	}
+	return resp.AppendInteger(nil, int64(deleted)), nil
+}
+
+func handleCommandHLen(cmd []resp.Resp, c *client) ([]byte, error) {
+	hash, ok, err := cache.GetHash(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.AppendInteger(nil, 0), nil
+	}
+	return resp.AppendInteger(nil, int64(hash.Len())), nil
+}
+
+func handleCommandHGetAll(cmd []resp.Resp, c *client) ([]byte, error) {
+	hash, ok, err := cache.GetHash(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	reply := []resp.Resp{}
+	if ok {
+		for _, s := range hash.Fields() {
+			reply = append(reply, resp.Resp{Content: s, DataType: resp.STRING})
+		}
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+func handleCommandHScan(cmd []resp.Resp, c *client) ([]byte, error) {
+	args, err := parseScanArgs(cmd[1:], "novalues")
+	if err != nil {
+		return nil, err
+	}
+
+	hash, ok, err := cache.GetHash(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var next uint64
+	matched := []resp.Resp{}
+	if ok {
+		var fields []string
+		fields, next = hash.Scan(args.cursor, args.count)
+		for i := 0; i+1 < len(fields); i += 2 {
+			if args.pattern != "" && !glob.Match(args.pattern, fields[i]) {
+				continue
+			}
+			matched = append(matched, resp.Resp{Content: fields[i], DataType: resp.STRING})
+			if !args.noValues {
+				matched = append(matched, resp.Resp{Content: fields[i+1], DataType: resp.STRING})
+			}
+		}
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: strconv.FormatUint(next, 10), DataType: resp.STRING},
+		{Content: matched, DataType: resp.ARRAY},
+	}), nil
+}
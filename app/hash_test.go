@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Run with -race: reads of a hash must not overlap with the writes made to it
+// by other clients
+func TestHashReadsWhileWriting(t *testing.T) {
+	writer, reader := newTestClient(t), newTestClient(t)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			writer.encoder.WriteCommand("HSET", "racy", fmt.Sprintf("f%d", i), "v")
+			if err := writer.encoder.Flush(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		reader.do(t, "HGETALL racy")
+		reader.do(t, "HSCAN racy 0 COUNT 1000")
+		reader.do(t, "HGET racy f0")
+	}
+	wg.Wait()
+
+	for i := 0; i < 500; i++ {
+		writer.receive(t)
+	}
+	if reply := reader.do(t, "HLEN racy"); reply.Content != 500 {
+		t.Fatalf("HLEN = %v, want 500", reply.Content)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type healthStatus struct {
+	Status           string `json:"status"`
+	Role             string `json:"role"`
+	Loading          bool   `json:"loading"`
+	MasterLinkStatus string `json:"master_link_status,omitempty"`
+	LastSaveAge      int64  `json:"last_save_age_seconds"`
+}
+
+func currentHealth() (healthStatus, bool) {
+	persistence.Lock()
+	lastSave := persistence.lastSave
+	persistence.Unlock()
+
+	role, _ := node.replicationRole()
+	status := healthStatus{
+		Role:        string(role),
+		Loading:     loading.Load(),
+		LastSaveAge: int64(time.Since(lastSave).Seconds()),
+	}
+
+	ready := !status.Loading
+	if role != MASTER {
+		status.MasterLinkStatus = masterLinkStatus()
+		if status.MasterLinkStatus != "up" {
+			ready = false
+		}
+	}
+
+	status.Status = "ok"
+	if !ready {
+		status.Status = "unavailable"
+	}
+	return status, ready
+}
+
+// serveHealth exposes liveness and readiness probes over HTTP, so that
+// orchestrators can check the server without speaking RESP, along with
+// metrics for Prometheus.
+func serveHealth(port string) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		status, ready := currentHealth()
+		w.Header().Set("Content-Type", "application/json")
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	})
+
+	mux.HandleFunc("/metrics", handleMetrics)
+
+	fmt.Printf("serving health checks and metrics on port %s\n", port)
+	if err := http.ListenAndServe("0.0.0.0:"+port, mux); err != nil {
+		fmt.Println("error serving health checks, ", err)
+	}
+}
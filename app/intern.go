@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Values 0 to SHARED_INTEGERS-1 are shared by every key storing them
+	SHARED_INTEGERS = 10000
+	// Longest string that is interned
+	INTERN_MAX_LENGTH = 16
+	// Interned strings are never released, so the table is bounded
+	INTERN_TABLE_SIZE = 1 << 16
+)
+
+var sharedIntegers [SHARED_INTEGERS]string
+
+func init() {
+	for i := range sharedIntegers {
+		sharedIntegers[i] = strconv.Itoa(i)
+	}
+}
+
+// internTable deduplicates short values, so that many keys storing the same
+// counter or flag point to a single copy of it instead of one per write.
+type internTable struct {
+	sync.RWMutex
+	strings map[string]string
+
+	sharedIntegerHits atomic.Int64
+	hits              atomic.Int64
+	misses            atomic.Int64
+}
+
+var interned = internTable{
+	strings: make(map[string]string),
+}
+
+// intern returns the shared copy of s if there is one, registering s as the
+// shared copy if there is room for it.
+func (t *internTable) intern(s string) string {
+	if len(s) > INTERN_MAX_LENGTH {
+		return s
+	}
+
+	if n, ok := sharedIntegerIndex(s); ok {
+		t.sharedIntegerHits.Add(1)
+		return sharedIntegers[n]
+	}
+
+	t.RLock()
+	shared, ok := t.strings[s]
+	t.RUnlock()
+	if ok {
+		t.hits.Add(1)
+		return shared
+	}
+
+	t.misses.Add(1)
+	t.Lock()
+	defer t.Unlock()
+
+	if shared, ok := t.strings[s]; ok {
+		return shared
+	}
+	if len(t.strings) < INTERN_TABLE_SIZE {
+		t.strings[s] = s
+	}
+	return s
+}
+
+// sharedIntegerIndex returns the integer s is the canonical representation of,
+// when it is one of the shared integers.
+func sharedIntegerIndex(s string) (int, bool) {
+	if len(s) == 0 || len(s) > 4 || (s[0] == '0' && len(s) > 1) {
+		return 0, false
+	}
+
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return 0, false
+		}
+		n = n*10 + int(s[i]-'0')
+	}
+	return n, true
+}
+
+func (t *internTable) size() int {
+	t.RLock()
+	defer t.RUnlock()
+
+	return len(t.strings)
+}
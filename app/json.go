@@ -0,0 +1,272 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/jsondoc"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// Type name of JSON documents, as used by RedisJSON
+const JSON_TYPE_NAME = "ReJSON-RL"
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   JSON_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			root, err := jsondoc.Parse(data)
+			if err != nil {
+				return nil, err
+			}
+			return newJSONValue(root), nil
+		},
+	})
+}
+
+// jsonValue is a parsed document, so that paths can be read and updated
+// without serializing the whole document back and forth.
+type jsonValue struct {
+	root any
+	size int
+}
+
+func newJSONValue(root any) *jsonValue {
+	v := &jsonValue{root: root}
+	v.updateSize()
+	return v
+}
+
+// updateSize recomputes the memory used, which has to be done after every
+// modification.
+func (v *jsonValue) updateSize() {
+	v.size = jsondoc.Size(v.root)
+}
+
+func (v *jsonValue) TypeName() string {
+	return JSON_TYPE_NAME
+}
+
+func (v *jsonValue) Clone() store.ModuleValue {
+	return &jsonValue{root: jsondoc.Clone(v.root), size: v.size}
+}
+
+func (v *jsonValue) MemoryUsage() int {
+	return v.size
+}
+
+func (v *jsonValue) MarshalBinary() ([]byte, error) {
+	return jsondoc.Marshal(v.root, jsondoc.Format{}), nil
+}
+
+func getJSON(key string) (*jsonValue, bool, error) {
+	value, ok, err := cache.GetModule(key, JSON_TYPE_NAME)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*jsonValue), true, nil
+}
+
+func parsePathArg(arg resp.Resp) (*jsondoc.Path, error) {
+	return jsondoc.ParsePath(arg.Content.(string))
+}
+
+// JSON.SET key path value [NX | XX]
+func handleCommandJSONSet(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	path, err := parsePathArg(cmd[1])
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := jsondoc.Parse([]byte(cmd[2].Content.(string)))
+	if err != nil {
+		return nil, resp.NewError("ERR", err.Error())
+	}
+
+	nx, xx := false, false
+	if len(cmd) == 4 {
+		switch strings.ToUpper(cmd[3].Content.(string)) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+
+	doc, ok, err := getJSON(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		if !path.IsRoot() {
+			return nil, resp.NewError("ERR", "new objects must be created at the root")
+		}
+		if xx {
+			return NULL_RESP, nil
+		}
+		cache.Set(key, newJSONValue(value), time.Time{}, store.TYPE_MODULE)
+		return OK_RESP, nil
+	}
+
+	exists := len(path.Find(doc.root)) > 0
+	if (nx && exists) || (xx && !exists) {
+		return NULL_RESP, nil
+	}
+
+	set := 0
+	cache.Modify(key, func() error {
+		doc.root, set = path.Set(doc.root, value)
+		doc.updateSize()
+		return nil
+	})
+	if set == 0 {
+		return NULL_RESP, nil
+	}
+	return OK_RESP, nil
+}
+
+// JSON.GET key [INDENT indent] [NEWLINE newline] [SPACE space] [path ...]
+func handleCommandJSONGet(cmd []resp.Resp, c *client) ([]byte, error) {
+	var format jsondoc.Format
+	args := cmd[1:]
+options:
+	for len(args) >= 2 {
+		value := args[1].Content.(string)
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "INDENT":
+			format.Indent = value
+		case "NEWLINE":
+			format.Newline = value
+		case "SPACE":
+			format.Space = value
+		default:
+			break options
+		}
+		args = args[2:]
+	}
+
+	var paths []*jsondoc.Path
+	legacy := true
+	for _, arg := range args {
+		path, err := parsePathArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		paths = append(paths, path)
+		legacy = legacy && path.Legacy
+	}
+	if len(paths) == 0 {
+		paths = append(paths, &jsondoc.Path{Raw: ".", Legacy: true})
+	}
+
+	doc, ok, err := getJSON(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return NULL_RESP, nil
+	}
+
+	// Legacy paths return a single value, the others all the values matched
+	results := make([]any, 0, len(paths))
+	for _, path := range paths {
+		matches := path.Find(doc.root)
+		if legacy {
+			if len(matches) == 0 {
+				return nil, resp.NewError("ERR", "Path '"+path.Raw+"' does not exist")
+			}
+			results = append(results, matches[0].Value)
+			continue
+		}
+
+		values := &jsondoc.Array{Items: make([]any, 0, len(matches))}
+		for _, m := range matches {
+			values.Items = append(values.Items, m.Value)
+		}
+		results = append(results, values)
+	}
+
+	if len(paths) == 1 {
+		return resp.AppendBulkString(nil, string(jsondoc.Marshal(results[0], format))), nil
+	}
+
+	byPath := jsondoc.NewObject()
+	for i, path := range paths {
+		byPath.Set(path.Raw, results[i])
+	}
+	return resp.AppendBulkString(nil, string(jsondoc.Marshal(byPath, format))), nil
+}
+
+// JSON.DEL key [path]
+func handleCommandJSONDel(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	path := &jsondoc.Path{Raw: "$"}
+	if len(cmd) == 2 {
+		var err error
+		if path, err = parsePathArg(cmd[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, ok, err := getJSON(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		c.propagateAs()
+		return resp.AppendInteger(nil, 0), nil
+	}
+
+	deleted, rootDeleted := 0, false
+	cache.Modify(key, func() error {
+		deleted, rootDeleted = path.Delete(doc.root)
+		doc.updateSize()
+		return nil
+	})
+
+	if rootDeleted {
+		cache.Delete(key)
+	}
+	if deleted == 0 {
+		c.propagateAs()
+	}
+	return resp.AppendInteger(nil, int64(deleted)), nil
+}
+
+// JSON.TYPE key [path]
+func handleCommandJSONType(cmd []resp.Resp, c *client) ([]byte, error) {
+	path := &jsondoc.Path{Raw: ".", Legacy: true}
+	if len(cmd) == 2 {
+		var err error
+		if path, err = parsePathArg(cmd[1]); err != nil {
+			return nil, err
+		}
+	}
+
+	doc, ok, err := getJSON(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return NULL_RESP, nil
+	}
+
+	matches := path.Find(doc.root)
+	if path.Legacy {
+		if len(matches) == 0 {
+			return NULL_RESP, nil
+		}
+		return resp.AppendSimpleString(nil, jsondoc.TypeName(matches[0].Value)), nil
+	}
+
+	types := make([]resp.Resp, 0, len(matches))
+	for _, m := range matches {
+		types = append(types, resp.Resp{Content: jsondoc.TypeName(m.Value), DataType: resp.STRING})
+	}
+	return resp.AppendArray(nil, types), nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Set while a dump is being loaded into the keyspace, from disk or from the
+// master during a full resynchronization
+var loading atomic.Bool
+
+// Progress of the load in progress, for INFO persistence
+var loadingProgress struct {
+	start atomic.Int64
+	// Size of the dump, zero when it isn't known up front, e.g. streamed by
+	// the master with an EOF mark
+	total  atomic.Int64
+	loaded atomic.Int64
+}
+
+// Commands that still run while loading, as they don't touch the dataset
+var loadingCommands = map[string]bool{
+	"auth":         true,
+	"hello":        true,
+	"ping":         true,
+	"info":         true,
+	"role":         true,
+	"config":       true,
+	"client":       true,
+	"slowlog":      true,
+	"monitor":      true,
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"publish":      true,
+	"shutdown":     true,
+}
+
+func loadingMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if loading.Load() && !c.fromMaster && !loadingCommands[entry.name] {
+		return nil, resp.ErrLoading
+	}
+	return next()
+}
+
+// startLoading marks the server as loading a dump of total bytes, zero if
+// unknown, read from r. The returned reader counts the bytes read for the
+// progress.
+func startLoading(r io.Reader, total int64) io.Reader {
+	loadingProgress.start.Store(time.Now().Unix())
+	loadingProgress.total.Store(total)
+	loadingProgress.loaded.Store(0)
+	loading.Store(true)
+	return &loadingReader{r}
+}
+
+func stopLoading() {
+	loading.Store(false)
+}
+
+type loadingReader struct {
+	r io.Reader
+}
+
+func (l *loadingReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	loadingProgress.loaded.Add(int64(n))
+	return n, err
+}
+
+// loadingInfo renders the loading fields of INFO persistence, with the
+// progress while a dump is being loaded
+func loadingInfo() string {
+	if !loading.Load() {
+		return "loading:0\n"
+	}
+
+	start := loadingProgress.start.Load()
+	total := loadingProgress.total.Load()
+	loaded := loadingProgress.loaded.Load()
+
+	perc, eta := 0.0, 1
+	if total > 0 {
+		perc = float64(loaded) * 100 / float64(total)
+		if elapsed := time.Now().Unix() - start; loaded > 0 {
+			eta = int(float64(elapsed) * float64(total-loaded) / float64(loaded))
+		}
+	}
+
+	return fmt.Sprintf("loading:1\n"+
+		"loading_start_time:%d\n"+
+		"loading_total_bytes:%d\n"+
+		"loading_loaded_bytes:%d\n"+
+		"loading_loaded_perc:%.2f\n"+
+		"loading_eta_seconds:%d\n",
+		start, total, loaded, perc, eta)
+}
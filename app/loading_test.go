@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// useDir makes the dump live in a temporary directory until the end of the
+// test
+func useDir(t *testing.T) {
+	saved, ok := config.get("dir")
+	config.set("dir", t.TempDir())
+	t.Cleanup(func() {
+		if ok {
+			config.set("dir", saved)
+		}
+	})
+}
+
+func TestLoadDataFromDisk(t *testing.T) {
+	tc := newTestClient(t)
+	useDir(t)
+	cache.Set("saved", "v", time.Time{}, store.TYPE_STRING)
+	if err := rdbSave(); err != nil {
+		t.Fatal(err)
+	}
+	cache.Delete("saved")
+
+	// As set by main before accepting clients
+	loading.Store(true)
+	defer stopLoading()
+	if reply := tc.do(t, "GET saved"); !strings.HasPrefix(reply.Content.(string), "LOADING") {
+		t.Fatalf("GET while loading = %v, want -LOADING", reply.Content)
+	}
+	if reply := tc.do(t, "PING"); reply.Content != "PONG" {
+		t.Fatalf("PING while loading = %v, want PONG", reply.Content)
+	}
+	if reply := tc.do(t, "INFO persistence"); !strings.Contains(reply.Content.(string), "loading:1") {
+		t.Fatalf("INFO while loading lacks loading:1:\n%s", reply.Content)
+	}
+
+	if err := loadDataFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if loading.Load() {
+		t.Fatal("still loading after the dump was loaded")
+	}
+	if reply := tc.do(t, "GET saved"); reply.Content != "v" {
+		t.Fatalf("GET after loading = %v, want v", reply.Content)
+	}
+}
+
+func TestLoadDataFromDiskWithoutDump(t *testing.T) {
+	startTestServer(t)
+	useDir(t)
+
+	loading.Store(true)
+	defer stopLoading()
+	if err := loadDataFromDisk(); err != nil {
+		t.Fatal(err)
+	}
+	if loading.Load() {
+		t.Fatal("still loading without a dump to load")
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type lolwutCanvas struct {
+	width, height int
+	pixels        []bool
+}
+
+func newLolwutCanvas(width, height int) *lolwutCanvas {
+	return &lolwutCanvas{width, height, make([]bool, width*height)}
+}
+
+func (c *lolwutCanvas) set(x, y int) {
+	if x < 0 || y < 0 || x >= c.width || y >= c.height {
+		return
+	}
+	c.pixels[y*c.width+x] = true
+}
+
+// Bresenham line between two points
+func (c *lolwutCanvas) line(x0, y0, x1, y1 int) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	err := dx + dy
+	for {
+		c.set(x0, y0)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * err; e2 >= dy {
+			err += dy
+			x0 += sx
+		} else {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+// square draws a square centered in x, y rotated by angle radians. Characters
+// are about twice as tall as they are wide, so x coordinates are stretched.
+func (c *lolwutCanvas) square(x, y, size int, angle float64) {
+	var px, py [4]int
+	for i := range 4 {
+		a := angle + math.Pi/4 + float64(i)*math.Pi/2
+		r := float64(size) / math.Sqrt2
+		px[i] = x + int(math.Round(2*r*math.Cos(a)))
+		py[i] = y + int(math.Round(r*math.Sin(a)))
+	}
+
+	for i := range 4 {
+		j := (i + 1) % 4
+		c.line(px[i], py[i], px[j], py[j])
+	}
+}
+
+func (c *lolwutCanvas) String() string {
+	var sb strings.Builder
+	for y := range c.height {
+		for x := range c.width {
+			if c.pixels[y*c.width+x] {
+				sb.WriteByte('#')
+			} else {
+				sb.WriteByte(' ')
+			}
+		}
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// schotter draws a grid of squares getting more and more disordered towards
+// the bottom, after Georg Nees' plotter work.
+func schotter(cols, squaresPerRow, squaresPerCol int) string {
+	size := max(cols/squaresPerRow/2, 2)
+	canvas := newLolwutCanvas(cols, squaresPerCol*size+1)
+
+	for row := range squaresPerCol {
+		disorder := float64(row) / float64(squaresPerCol)
+		for col := range squaresPerRow {
+			x := col*size*2 + size
+			y := row*size + size/2
+			angle := (rand.Float64() - 0.5) * math.Pi / 2 * disorder
+			shift := int((rand.Float64() - 0.5) * float64(size) * disorder)
+			canvas.square(x+shift, y, size-1, angle)
+		}
+	}
+	return canvas.String()
+}
+
+// LOLWUT [VERSION <version>] [columns] [squares-per-row] [squares-per-col]
+func handleCommandLolwut(cmd []resp.Resp, c *client) ([]byte, error) {
+	version := REDIS_VERSION
+	if len(cmd) >= 2 && strings.ToUpper(cmd[0].Content.(string)) == "VERSION" {
+		version = cmd[1].Content.(string)
+		cmd = cmd[2:]
+	}
+
+	params := []int{66, 8, 12}
+	for i := 0; i < len(cmd) && i < len(params); i++ {
+		n, err := strconv.Atoi(cmd[i].Content.(string))
+		if err != nil || n <= 0 || n > 1000 {
+			return nil, resp.NewError("ERR", "value is out of range, must be positive")
+		}
+		params[i] = n
+	}
+
+	art := schotter(params[0], params[1], params[2])
+	return resp.AppendBulkString(nil, fmt.Sprintf("%s\nGeorg Nees - schotter, plotter on paper, 1968. Redis ver. %s\n", art, version)), nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+func handleCommandMemory(cmd []resp.Resp, c *client) ([]byte, error) {
+	switch strings.ToLower(cmd[0].Content.(string)) {
+	case "stats":
+		return memoryStats()
+	case "usage":
+		return memoryUsage(cmd[1:])
+	default:
+		return nil, resp.NewError("ERR", "unknown subcommand '"+cmd[0].Content.(string)+"'. Try MEMORY HELP.")
+	}
+}
+
+// memoryStats replies with the name and value of every metric, flattened
+func memoryStats() ([]byte, error) {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	keys, _, _ := cache.Stats()
+
+	metrics := []struct {
+		name  string
+		value int
+	}{
+		{"total.allocated", int(mem.HeapAlloc)},
+		{"keys.count", keys},
+		{"dataset.bytes", cache.UsedMemory()},
+		{"shared-integers.hits", int(interned.sharedIntegerHits.Load())},
+		{"interned-strings.count", interned.size()},
+		{"interned-strings.hits", int(interned.hits.Load())},
+		{"interned-strings.misses", int(interned.misses.Load())},
+	}
+
+	reply := make([]resp.Resp, 0, 2*len(metrics))
+	for _, metric := range metrics {
+		reply = append(reply,
+			resp.Resp{Content: metric.name, DataType: resp.STRING},
+			resp.Resp{Content: metric.value, DataType: resp.INTEGER},
+		)
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// MEMORY USAGE key [SAMPLES count]. Sizes are maintained incrementally, so
+// SAMPLES is accepted but there is nothing to sample.
+func memoryUsage(args []resp.Resp) ([]byte, error) {
+	if len(args) != 1 && (len(args) != 3 || strings.ToLower(args[1].Content.(string)) != "samples") {
+		return nil, resp.ErrSyntax
+	}
+
+	key := args[0].Content.(string)
+	entry, ok := cache.Get(key)
+	if !ok || entry.Expired() {
+		return NULL_RESP, nil
+	}
+	return resp.AppendInteger(nil, int64(entry.MemoryUsage(key))), nil
+}
+
+// memoryInfo renders the memory section of INFO. used_memory is the size of
+// the dataset as accounted by the keyspace, while the go_* fields come from
+// the runtime and cover everything else the process holds: buffers, indexes,
+// garbage not collected yet.
+func memoryInfo() string {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	used := cache.UsedMemory()
+	limit := maxMemory.Load()
+	policy, _ := config.get("maxmemory-policy")
+	if policy == "" {
+		policy = DEFAULT_MAXMEMORY_POLICY
+	}
+
+	var lastPause time.Duration
+	if mem.NumGC > 0 {
+		lastPause = time.Duration(mem.PauseNs[(mem.NumGC+255)%256])
+	}
+
+	return fmt.Sprintf("used_memory:%d\n"+
+		"used_memory_human:%s\n"+
+		"maxmemory:%d\n"+
+		"maxmemory_human:%s\n"+
+		"maxmemory_policy:%s\n"+
+		"go_heap_alloc:%d\n"+
+		"go_heap_inuse:%d\n"+
+		"go_heap_idle:%d\n"+
+		"go_heap_released:%d\n"+
+		"go_heap_objects:%d\n"+
+		"go_stack_inuse:%d\n"+
+		"go_sys:%d\n"+
+		"go_sys_human:%s\n"+
+		"go_next_gc:%d\n"+
+		"go_num_gc:%d\n"+
+		"go_gc_pause_total_us:%d\n"+
+		"go_gc_last_pause_us:%d\n"+
+		"go_gc_cpu_fraction:%.6f\n"+
+		"go_goroutines:%d\n",
+		used, bytesToHuman(uint64(used)),
+		limit, bytesToHuman(uint64(limit)), policy,
+		mem.HeapAlloc, mem.HeapInuse, mem.HeapIdle, mem.HeapReleased, mem.HeapObjects,
+		mem.StackInuse, mem.Sys, bytesToHuman(mem.Sys), mem.NextGC,
+		mem.NumGC, mem.PauseTotalNs/1000, lastPause.Microseconds(), mem.GCCPUFraction,
+		runtime.NumGoroutine(),
+	)
+}
+
+// bytesToHuman formats a size the way Redis does in INFO, e.g. 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T"}
+	size, unit := float64(n), 0
+	for size >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", size, units[unit])
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+)
+
+type metric struct {
+	name   string
+	help   string
+	kind   string
+	labels string
+	value  float64
+}
+
+// handleMetrics exposes the server counters in the Prometheus text format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := []metric{
+		{"redis_commands_processed_total", "Commands executed", "counter", "", float64(counters.totalCommandsProcessed.Load())},
+		{"redis_connections_received_total", "Connections accepted", "counter", "", float64(counters.totalConnectionsReceived.Load())},
+		{"redis_keyspace_hits_total", "Lookups that found the key", "counter", "", float64(counters.keyspaceHits.Load())},
+		{"redis_keyspace_misses_total", "Lookups that didn't find the key", "counter", "", float64(counters.keyspaceMisses.Load())},
+		{"redis_expired_keys_total", "Keys deleted as they expired, found by a lookup or by the active expire cycle", "counter", `cycle="lazy"`, float64(counters.expiredKeysLazy.Load())},
+		{"redis_expired_keys_total", "", "", `cycle="active"`, float64(counters.expiredKeysActive.Load())},
+		{"redis_expired_stale_perc", "Estimated percentage of keys that expired but weren't deleted yet", "gauge", "", expiredStalePerc()},
+		{"redis_evicted_keys_total", "Keys evicted by maxmemory", "counter", "", float64(counters.evictedKeys.Load())},
+		{"redis_evicted_clients_total", "Clients disconnected by maxmemory-clients", "counter", "", float64(counters.evictedClients.Load())},
+		{"redis_used_memory_bytes", "Memory used by the dataset", "gauge", "", float64(cache.UsedMemory())},
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	for _, m := range metrics {
+		writeMetric(w, m)
+	}
+}
+
+// writeMetric writes a sample, preceded by the HELP and TYPE lines of the
+// metric unless it is another sample of the previous one
+func writeMetric(w io.Writer, m metric) {
+	if m.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.kind)
+	}
+	if m.labels != "" {
+		fmt.Fprintf(w, "%s{%s} %g\n", m.name, m.labels, m.value)
+	} else {
+		fmt.Fprintf(w, "%s %g\n", m.name, m.value)
+	}
+}
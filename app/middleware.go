@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/telemetry"
+)
+
+// commandMiddleware runs around the execution of a command. It either calls
+// next, possibly doing some work before and after it, or replies on its own
+// so that the command doesn't run at all.
+type commandMiddleware func(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error)
+
+// Every command goes through these in order, the last one calling the handler
+var middlewares = []commandMiddleware{
+	recoverMiddleware,
+	authMiddleware,
+	loadingMiddleware,
+	pubsubMiddleware,
+	clusterMiddleware,
+	staleDataMiddleware,
+	readOnlyReplicaMiddleware,
+	readOnlyMiddleware,
+	evictionMiddleware,
+	monitorMiddleware,
+	traceMiddleware,
+	statsMiddleware,
+	watchdogMiddleware,
+	slowlogMiddleware,
+	propagateMiddleware,
+}
+
+// call executes an already validated command through the middlewares.
+// Errors meant for the client, returned by a handler or a middleware, are
+// turned into their reply here, while other errors are internal ones that
+// get no reply.
+func call(entry *command, cmd []resp.Resp, c *client) ([]byte, error) {
+	out, err := callFrom(0, entry, cmd, c)
+	var replyErr *resp.Error
+	if errors.As(err, &replyErr) {
+		return resp.EncodeError(replyErr), nil
+	}
+	return out, err
+}
+
+func callFrom(i int, entry *command, cmd []resp.Resp, c *client) ([]byte, error) {
+	if i == len(middlewares) {
+		return entry.handler(cmd[1:], c)
+	}
+	return middlewares[i](entry, cmd, c, func() ([]byte, error) {
+		return callFrom(i+1, entry, cmd, c)
+	})
+}
+
+// Set by the read-only parameter, for maintenance: clients can't write
+// whatever the role of the node, e.g. while serving a dump for inspection
+var readOnly atomic.Bool
+
+// readOnlyMiddleware rejects writes from clients in read-only mode. Commands
+// from the master still apply, so that a replica keeps up with it.
+func readOnlyMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if readOnly.Load() && !c.fromMaster && entry.hasFlag(FLAG_WRITE) {
+		return nil, resp.NewError("READONLY", "You can't write against a read only server.")
+	}
+	return next()
+}
+
+func traceMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	span := tracer.StartSpan(strings.ToUpper(entry.name), telemetry.SPAN_KIND_SERVER)
+	out, err := next()
+	endCommandSpan(span, entry, cmd, out, err)
+	return out, err
+}
+
+func statsMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	out, err := next()
+
+	counters.totalCommandsProcessed.Add(1)
+	stats.record(entry.name, time.Since(start), err != nil || isErrorReply(out))
+	return out, err
+}
+
+// propagateMiddleware replicates write commands that succeeded
+func propagateMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	out, err := next()
+
+	if entry.hasFlag(FLAG_WRITE) && err == nil && !isErrorReply(out) {
+		propagateEffects(cmd, c)
+	}
+	c.effects = nil
+	return out, err
+}
+
+// recoverMiddleware turns a panic of the handler, e.g. a bad type assertion on
+// unexpected input, into an error reply, so that one command can't bring down
+// the server and every other client with it. It comes first, to also catch
+// the panics of the other middlewares.
+func recoverMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) (out []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("panic running '%s' for %s: %v\n%s", entry.name, clientAddr(c), r, debug.Stack())
+			c.effects = nil
+			out, err = nil, resp.NewError("ERR", "internal error")
+		}
+	}()
+	return next()
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+func TestRecoverFromPanics(t *testing.T) {
+	startTestServer(t)
+	conn, other := net.Pipe()
+	defer other.Close()
+	c := newClient(conn, false)
+	defer removeClient(c)
+
+	panicking := &command{"panicking", 1, 1, 0, 0, 0, func(args []resp.Resp, c *client) ([]byte, error) {
+		var m map[string]int
+		m["boom"]++
+		return nil, nil
+	}, 0}
+	cmd := []resp.Resp{{Content: "panicking", DataType: resp.STRING}}
+	want := "-ERR internal error\r\n"
+
+	if out, err := call(panicking, cmd, c); err != nil || string(out) != want {
+		t.Fatalf("panicking handler replied %q, %v, want %q", out, err, want)
+	}
+
+	// Middlewares run inside the recover boundary as well
+	saved := middlewares
+	defer func() { middlewares = saved }()
+	middlewares = append(middlewares[:1:1], func(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+		panic("middleware")
+	})
+	middlewares = append(middlewares, saved[1:]...)
+
+	ping, _ := lookupCommand("ping")
+	cmd = []resp.Resp{{Content: "ping", DataType: resp.STRING}}
+	if out, err := call(ping, cmd, c); err != nil || string(out) != want {
+		t.Fatalf("panicking middleware replied %q, %v, want %q", out, err, want)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/rdb"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// dumpEntry serializes a key's value as DUMP does
+func dumpEntry(entry store.Entry) ([]byte, error) {
+	value, err := rdbValue(entry.Value)
+	if err != nil {
+		return nil, err
+	}
+	return rdb.Dump(value)
+}
+
+// DUMP key
+func handleCommandDump(cmd []resp.Resp, c *client) ([]byte, error) {
+	entry, ok := cache.Get(cmd[0].Content.(string))
+	if !ok || entry.Expired() {
+		return NULL_RESP, nil
+	}
+
+	payload, err := dumpEntry(entry)
+	if err != nil {
+		return nil, resp.NewError("ERR", err.Error())
+	}
+	return resp.AppendBulkString(nil, string(payload)), nil
+}
+
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds]
+// [FREQ frequency]. There is no LRU or LFU, so IDLETIME and FREQ are only
+// validated.
+func handleCommandRestore(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	ttl, err := strconv.ParseInt(cmd[1].Content.(string), 10, 64)
+	if err != nil || ttl < 0 {
+		return nil, resp.NewError("ERR", "Invalid TTL value, must be >= 0")
+	}
+
+	replace, absTTL := false, false
+	for args := cmd[3:]; len(args) > 0; {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "REPLACE":
+			replace = true
+			args = args[1:]
+		case "ABSTTL":
+			absTTL = true
+			args = args[1:]
+		case "IDLETIME", "FREQ":
+			if len(args) < 2 {
+				return nil, resp.ErrSyntax
+			}
+			if n, err := strconv.ParseInt(args[1].Content.(string), 10, 64); err != nil || n < 0 {
+				return nil, resp.NewError("ERR", "Invalid "+strings.ToUpper(args[0].Content.(string))+" value, must be >= 0")
+			}
+			args = args[2:]
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+
+	if entry, ok := cache.Get(key); ok && !entry.Expired() && !replace {
+		return nil, resp.ErrBusyKey
+	}
+
+	decoded, err := rdb.Restore([]byte(cmd[2].Content.(string)))
+	if err != nil {
+		return nil, resp.NewError("ERR", rdb.ErrBadDump.Error())
+	}
+	value, valueType, err := storeValue(decoded)
+	if err != nil {
+		return nil, resp.NewError("ERR", "Bad data format")
+	}
+
+	var exp time.Time
+	switch {
+	case ttl > 0 && absTTL:
+		exp = time.UnixMilli(ttl)
+	case ttl > 0:
+		exp = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+	}
+	if !exp.IsZero() && !exp.After(time.Now()) {
+		// Already expired, so only the previous value goes away
+		cache.Delete(key)
+		c.propagateAs("DEL", key)
+		return OK_RESP, nil
+	}
+
+	cache.Set(key, value, exp, valueType)
+	if ttl > 0 && !absTTL {
+		c.propagateAs("RESTORE", key, strconv.FormatInt(exp.UnixMilli(), 10), cmd[2].Content.(string), "REPLACE", "ABSTTL")
+	}
+	return OK_RESP, nil
+}
+
+// migrateOptions are the options following the timeout of MIGRATE
+type migrateOptions struct {
+	copy    bool
+	replace bool
+	// AUTH command to run on the target first, if any
+	auth []string
+	keys []string
+}
+
+func parseMigrateOptions(args []resp.Resp) (*migrateOptions, error) {
+	opts := &migrateOptions{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToUpper(args[i].Content.(string)) {
+		case "COPY":
+			opts.copy = true
+		case "REPLACE":
+			opts.replace = true
+		case "AUTH":
+			if i+1 >= len(args) {
+				return nil, resp.ErrSyntax
+			}
+			opts.auth = []string{"AUTH", args[i+1].Content.(string)}
+			i++
+		case "AUTH2":
+			if i+2 >= len(args) {
+				return nil, resp.ErrSyntax
+			}
+			opts.auth = []string{"AUTH", args[i+1].Content.(string), args[i+2].Content.(string)}
+			i += 2
+		case "KEYS":
+			if i+1 >= len(args) {
+				return nil, resp.ErrSyntax
+			}
+			for _, arg := range args[i+1:] {
+				opts.keys = append(opts.keys, arg.Content.(string))
+			}
+			return opts, nil
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+	return opts, nil
+}
+
+// migrateKeys returns the keys of a full MIGRATE command, which are those
+// following KEYS when the key argument is empty
+func migrateKeys(cmd []resp.Resp) []string {
+	if len(cmd) < 6 {
+		return nil
+	}
+	if cmd[3].Content.(string) == "" {
+		for i := 6; i < len(cmd); i++ {
+			if strings.EqualFold(cmd[i].Content.(string), "KEYS") {
+				keys := make([]string, 0, len(cmd)-i-1)
+				for _, arg := range cmd[i+1:] {
+					keys = append(keys, arg.Content.(string))
+				}
+				return keys
+			}
+		}
+	}
+	return []string{cmd[3].Content.(string)}
+}
+
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password | AUTH2 username password] [KEYS key [key ...]] moves keys
+// to another instance with RESTORE, deleting them here once the target
+// accepted them unless COPY is given. The timeout in milliseconds applies to
+// connecting and to the whole exchange with the target.
+func handleCommandMigrate(cmd []resp.Resp, c *client) ([]byte, error) {
+	addr := net.JoinHostPort(cmd[0].Content.(string), cmd[1].Content.(string))
+
+	if db, err := strconv.Atoi(cmd[3].Content.(string)); err != nil || db != 0 {
+		return nil, resp.NewError("ERR", "only the destination-db 0 is supported")
+	}
+	timeout, err := strconv.ParseInt(cmd[4].Content.(string), 10, 64)
+	if err != nil || timeout < 0 {
+		return nil, resp.ErrNotInteger
+	}
+	if timeout == 0 {
+		timeout = 1000
+	}
+	opts, err := parseMigrateOptions(cmd[5:])
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{cmd[2].Content.(string)}
+	if opts.keys != nil {
+		if keys[0] != "" {
+			return nil, resp.NewError("ERR", "When using MIGRATE KEYS option, the key argument must be set to the empty string")
+		}
+		keys = opts.keys
+	}
+
+	// The target serves the slot only after ASKING while it imports it
+	restore := "RESTORE"
+	if clusterState != nil {
+		restore = "RESTORE-ASKING"
+	}
+
+	var restores [][]string
+	var migrated []string
+	for _, key := range keys {
+		entry, ok := cache.Get(key)
+		if !ok || entry.Expired() {
+			continue
+		}
+
+		payload, err := dumpEntry(entry)
+		if err != nil {
+			return nil, resp.NewError("ERR", err.Error())
+		}
+		ttl := int64(0)
+		if !entry.Exp.IsZero() {
+			ttl = max(time.Until(entry.Exp).Milliseconds(), 1)
+		}
+
+		args := []string{restore, key, strconv.FormatInt(ttl, 10), string(payload)}
+		if opts.replace {
+			args = append(args, "REPLACE")
+		}
+		restores = append(restores, args)
+		migrated = append(migrated, key)
+	}
+	if len(migrated) == 0 {
+		c.propagateAs()
+		return resp.AppendSimpleString(nil, "NOKEY"), nil
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, time.Duration(timeout)*time.Millisecond)
+	if err != nil {
+		return nil, resp.Errorf("IOERR", "error or timeout connecting to the client: %s", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(time.Duration(timeout) * time.Millisecond))
+
+	encoder := resp.NewEncoder(conn)
+	if opts.auth != nil {
+		encoder.WriteCommand(opts.auth...)
+	}
+	for _, args := range restores {
+		encoder.WriteCommand(args...)
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, resp.Errorf("IOERR", "error or timeout writing to target instance: %s", err)
+	}
+
+	decoder := resp.NewDecoder(conn)
+	if opts.auth != nil {
+		reply, err := decoder.Decode()
+		if err != nil {
+			return nil, resp.Errorf("IOERR", "error or timeout reading to target instance: %s", err)
+		}
+		if reply.DataType == resp.ERROR {
+			return nil, resp.NewError("ERR", "Target instance replied with error: "+reply.Content.(string))
+		}
+	}
+
+	// Keys the target accepted are removed even if a later one failed, so
+	// that a retry only moves the remaining keys
+	c.propagateAs()
+	var failure error
+	for _, key := range migrated {
+		reply, err := decoder.Decode()
+		if err != nil {
+			failure = resp.Errorf("IOERR", "error or timeout reading to target instance: %s", err)
+			break
+		}
+		if reply.DataType == resp.ERROR {
+			if failure == nil {
+				failure = resp.NewError("ERR", "Target instance replied with error: "+reply.Content.(string))
+			}
+			continue
+		}
+		if !opts.copy {
+			cache.Delete(key)
+			c.propagateAs("DEL", key)
+		}
+	}
+
+	if failure != nil {
+		// Error replies aren't propagated, but the deletions must be
+		if len(c.effects) > 0 {
+			propagateEffects(cmd, c)
+		}
+		return nil, failure
+	}
+	return OK_RESP, nil
+}
+
+// CLUSTER GETKEYSINSLOT slot count
+func handleClusterGetKeysInSlot(args []resp.Resp, c *client) ([]byte, error) {
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(args[1].Content.(string))
+	if err != nil || count < 0 {
+		return nil, resp.NewError("ERR", "Invalid number of keys")
+	}
+
+	var keys []resp.Resp
+	for _, key := range slotIndex.Keys(slot, count) {
+		keys = append(keys, resp.Resp{Content: key, DataType: resp.STRING})
+	}
+	return resp.AppendArray(nil, keys), nil
+}
+
+// CLUSTER COUNTKEYSINSLOT slot
+func handleClusterCountKeysInSlot(args []resp.Resp, c *client) ([]byte, error) {
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return nil, err
+	}
+	return resp.AppendInteger(nil, int64(slotIndex.Count(slot))), nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"plugin"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/module"
+)
+
+// Go plugins given with loadmodule, which can appear several times
+var modulePaths []string
+
+// loadModules opens the configured plugins, whose OnLoad function registers
+// their commands, and adds every registered command to the command table.
+func loadModules() error {
+	for _, path := range modulePaths {
+		p, err := plugin.Open(path)
+		if err != nil {
+			return err
+		}
+
+		symbol, err := p.Lookup("OnLoad")
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		onLoad, ok := symbol.(func() error)
+		if !ok {
+			return fmt.Errorf("%s: OnLoad must be a func() error", path)
+		}
+		if err := onLoad(); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	for _, cmd := range module.Commands() {
+		if _, ok := commandTable[cmd.Name]; ok {
+			return fmt.Errorf("module command '%s' conflicts with a builtin command", cmd.Name)
+		}
+		commandTable[cmd.Name] = moduleCommand(cmd)
+	}
+	return nil
+}
+
+func moduleCommand(cmd module.Command) *command {
+	minArgs, maxArgs := cmd.Arity, cmd.Arity
+	if cmd.Arity < 0 {
+		minArgs, maxArgs = -cmd.Arity, -1
+	}
+
+	var flags commandFlags
+	if cmd.Write {
+		flags |= FLAG_WRITE
+	}
+
+	return &command{cmd.Name, minArgs, maxArgs, cmd.FirstKey, cmd.LastKey, cmd.KeyStep, moduleHandler(cmd.Handler), flags}
+}
+
+func moduleHandler(handler module.Handler) commandHandler {
+	return func(cmd []resp.Resp, c *client) ([]byte, error) {
+		args := make([]string, 0, len(cmd))
+		for _, arg := range cmd {
+			args = append(args, arg.Content.(string))
+		}
+
+		var out bytes.Buffer
+		ctx := module.NewContext(&out, moduleClient{c}, moduleKeyspace{})
+		err := handler(ctx, args)
+		if err != nil && !ctx.Replied() {
+			ctx.ReplyError("ERR " + err.Error())
+		}
+		if err := ctx.Flush(); err != nil {
+			return nil, err
+		}
+
+		if out.Len() == 0 {
+			return NULL_RESP, nil
+		}
+		return out.Bytes(), nil
+	}
+}
+
+type moduleClient struct {
+	c *client
+}
+
+func (m moduleClient) RemoteAddr() string {
+	if m.c.conn == nil {
+		return ""
+	}
+	return m.c.conn.RemoteAddr().String()
+}
+
+type moduleKeyspace struct{}
+
+func (moduleKeyspace) Get(key string) (string, bool, error) {
+	return cache.GetString(key)
+}
+
+func (moduleKeyspace) Set(key, value string) {
+	cache.Set(key, value, time.Time{}, store.TYPE_STRING)
+}
+
+func (moduleKeyspace) Delete(key string) bool {
+	entry, ok := cache.Get(key)
+	if !ok || entry.Expired() {
+		return false
+	}
+	cache.Delete(key)
+	return true
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Connections of the clients that ran MONITOR, which receive every command
+// executed by the server.
+var monitors struct {
+	sync.Mutex
+	conns []net.Conn
+}
+
+func monitorMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if !entry.hasFlag(FLAG_SENSITIVE) {
+		feedMonitors(cmd, c)
+	}
+	return next()
+}
+
+// +<unix time with microseconds> [0 <client address>] "<arg>" ...
+func feedMonitors(cmd []resp.Resp, c *client) {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	if len(monitors.conns) == 0 {
+		return
+	}
+
+	now := time.Now()
+	addr := "master"
+	if c.conn != nil && !c.fromMaster {
+		addr = c.conn.RemoteAddr().String()
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "+%d.%06d [0 %s]", now.Unix(), now.Nanosecond()/1000, addr)
+	for _, arg := range cmd {
+		sb.WriteByte(' ')
+		sb.WriteString(quoteArg(arg.Content.(string)))
+	}
+	sb.WriteString("\r\n")
+
+	line := []byte(sb.String())
+	monitors.conns = slices.DeleteFunc(monitors.conns, func(conn net.Conn) bool {
+		_, err := conn.Write(line)
+		return err != nil
+	})
+}
+
+// quoteArg quotes an argument the way redis-cli prints it, escaping non
+// printable bytes.
+func quoteArg(s string) string {
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch b := s[i]; b {
+		case '\\', '"':
+			sb.WriteByte('\\')
+			sb.WriteByte(b)
+		case '\n':
+			sb.WriteString(`\n`)
+		case '\r':
+			sb.WriteString(`\r`)
+		case '\t':
+			sb.WriteString(`\t`)
+		default:
+			if b < 0x20 || b > 0x7e {
+				fmt.Fprintf(&sb, `\x%02x`, b)
+			} else {
+				sb.WriteByte(b)
+			}
+		}
+	}
+	sb.WriteByte('"')
+	return sb.String()
+}
+
+// removeMonitor stops feeding a connection, e.g. once its client is gone
+func removeMonitor(conn net.Conn) {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	monitors.conns = slices.DeleteFunc(monitors.conns, func(other net.Conn) bool {
+		return other == conn
+	})
+}
+
+func handleCommandMonitor(cmd []resp.Resp, c *client) ([]byte, error) {
+	monitors.Lock()
+	defer monitors.Unlock()
+
+	if !slices.Contains(monitors.conns, c.conn) {
+		monitors.conns = append(monitors.conns, c.conn)
+	}
+	return OK_RESP, nil
+}
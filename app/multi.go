@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+func handleCommandMulti(cmd []resp.Resp, c *client) ([]byte, error) {
+	if c.multi {
+		return nil, resp.NewError("ERR", "MULTI calls can not be nested")
+	}
+
+	c.multi = true
+	return OK_RESP, nil
+}
+
+func handleCommandDiscard(cmd []resp.Resp, c *client) ([]byte, error) {
+	if !c.multi {
+		return nil, resp.NewError("ERR", "DISCARD without MULTI")
+	}
+
+	c.discardTransaction()
+	return OK_RESP, nil
+}
+
+func handleCommandExec(cmd []resp.Resp, c *client) ([]byte, error) {
+	if !c.multi {
+		return nil, resp.NewError("ERR", "EXEC without MULTI")
+	}
+
+	queued, dirty := c.queued, c.dirtyExec
+	c.discardTransaction()
+
+	if dirty {
+		return nil, resp.ErrExecAbort
+	}
+
+	c.execing = true
+	defer func() { c.execing = false }()
+
+	var res bytes.Buffer
+	encoder := resp.NewEncoder(&res)
+	encoder.WriteArrayHeader(len(queued))
+
+	for _, queuedCmd := range queued {
+		entry, _ := lookupCommand(queuedCmd[0].Content.(string))
+		out, err := call(entry, queuedCmd, c)
+		if err != nil {
+			// Runtime errors are reported in place without aborting the rest
+			out = resp.EncodeError(err)
+		}
+		if out == nil {
+			out = NULL_RESP
+		}
+		encoder.WriteRaw(out)
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// queueCommand stores a command issued inside MULTI. Unknown commands, arity
+// errors and commands rejected for being over maxmemory flag the transaction
+// so that EXEC fails with EXECABORT.
+func queueCommand(cmd []resp.Resp, c *client) ([]byte, error) {
+	entry, ok := lookupCommand(cmd[0].Content.(string))
+	if !ok {
+		c.dirtyExec = true
+		return resp.EncodeError(unknownCommandError(cmd)), nil
+	}
+
+	if !entry.checkArity(len(cmd)) {
+		c.dirtyExec = true
+		stats.recordRejected(entry.name)
+		return resp.EncodeError(arityError(entry.name)), nil
+	}
+
+	if entry.hasFlag(FLAG_DENY_OOM) && outOfMemory(c) {
+		c.dirtyExec = true
+		return resp.EncodeError(resp.ErrOOM), nil
+	}
+
+	c.queued = append(c.queued, cmd)
+	for _, arg := range cmd {
+		c.queuedMemory += int64(len(arg.Content.(string)))
+	}
+	return resp.AppendSimpleString(nil, "QUEUED"), nil
+}
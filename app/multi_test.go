@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+// Reads running outside the executor must see a transaction applied either
+// in full or not at all. The transactions are long enough for the reader to
+// be scheduled in the middle of one even with a single CPU.
+func TestExecIsAtomicForReads(t *testing.T) {
+	writer, reader := newTestClient(t), newTestClient(t)
+
+	const transactions, padding = 5, 20000
+	replies := make(chan struct{})
+	go func() {
+		defer close(replies)
+		// MULTI, the queued commands and EXEC
+		for i := 0; i < transactions*(padding+4); i++ {
+			if _, err := writer.decoder.Decode(); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < transactions; i++ {
+		writer.encoder.WriteCommand("MULTI")
+		writer.encoder.WriteCommand("SET", "atomic", "intermediate")
+		for j := 0; j < padding; j++ {
+			writer.encoder.WriteCommand("SET", "atomic:padding", "v")
+		}
+		writer.encoder.WriteCommand("SET", "atomic", "final")
+		writer.encoder.WriteCommand("EXEC")
+	}
+	if err := writer.encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	for done := false; !done; {
+		select {
+		case <-replies:
+			done = true
+		default:
+		}
+		if reply := reader.do(t, "GET atomic"); reply.Content == "intermediate" {
+			t.Error("GET returned a value set halfway through a transaction")
+			break
+		}
+	}
+	<-replies
+}
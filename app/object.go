@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// Strings up to this length are embedded in the object header in Redis
+const EMBSTR_SIZE_LIMIT = 44
+
+func handleCommandObject(cmd []resp.Resp, c *client) ([]byte, error) {
+	subCmd := strings.ToLower(cmd[0].Content.(string))
+	if subCmd != "encoding" {
+		return nil, resp.NewError("ERR", "unknown subcommand '"+cmd[0].Content.(string)+"'. Try OBJECT HELP.")
+	}
+	if len(cmd) != 2 {
+		return nil, arityError("object|encoding")
+	}
+
+	entry, ok := cache.Get(cmd[1].Content.(string))
+	if !ok || entry.Expired() {
+		return NULL_RESP, nil
+	}
+	return resp.AppendBulkString(nil, encoding(entry)), nil
+}
+
+func encoding(entry store.Entry) string {
+	switch value := entry.Value.(type) {
+	case string:
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil && strconv.FormatInt(n, 10) == value {
+			return "int"
+		}
+		if len(value) <= EMBSTR_SIZE_LIMIT {
+			return "embstr"
+		}
+		return "raw"
+	case *store.Hash:
+		return value.Encoding()
+	case *store.Stream:
+		return "stream"
+	case store.ModuleValue:
+		return "raw"
+	default:
+		return ""
+	}
+}
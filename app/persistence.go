@@ -0,0 +1,465 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/rdb"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+const (
+	// How often the save points are checked
+	SAVE_CRON_INTERVAL = time.Second
+	// Least time between a failed background save and the next automatic
+	// one, so that a full disk isn't hammered every second
+	BGSAVE_RETRY_DELAY = 5 * time.Second
+)
+
+type persistenceState struct {
+	sync.Mutex
+	lastSave         time.Time
+	lastBgsaveOk     bool
+	lastBgsaveTry    time.Time
+	bgsaveInProgress bool
+	// Keyspace changes already in the last dump, see changesSinceSave
+	savedChanges int64
+}
+
+var persistence = persistenceState{
+	lastSave:     time.Now(),
+	lastBgsaveOk: true,
+}
+
+func rdbPath() string {
+	dir, ok := config.get("dir")
+	if !ok {
+		dir = "."
+	}
+
+	filename, ok := config.get("dbfilename")
+	if !ok {
+		filename = "dump.rdb"
+	}
+	return filepath.Join(dir, filename)
+}
+
+// rdbSave dumps the whole dataset to the configured dbfilename. The dump is
+// written to a temporary file in the same directory, synced and renamed over
+// the previous one, so that a crash while saving never leaves a truncated
+// dump behind. The outcome is reported as rdb_last_bgsave_status.
+func rdbSave() error {
+	// Changes made while the dump is written may or may not be in it, so
+	// they are counted as not saved yet
+	changes := cache.Changes()
+	err := writeRdbFile(rdbPath())
+
+	persistence.Lock()
+	defer persistence.Unlock()
+	if err == nil {
+		persistence.lastSave = time.Now()
+		persistence.savedChanges = changes
+	}
+	persistence.lastBgsaveOk = err == nil
+	return err
+}
+
+// changesSinceSave is the number of changes to the keyspace not in the last
+// dump, the dirty counter of Redis
+func changesSinceSave() int64 {
+	persistence.Lock()
+	defer persistence.Unlock()
+
+	return cache.Changes() - persistence.savedChanges
+}
+
+func writeRdbFile(path string) error {
+	dir := filepath.Dir(path)
+	f, err := os.CreateTemp(dir, "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	// CreateTemp makes the file private, dumps are readable like any other
+	if err = f.Chmod(0644); err == nil {
+		snapshot := cache.BeginSnapshot()
+		err = writeRdb(f, snapshot)
+		cache.EndSnapshot(snapshot)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Sync the directory too, or the rename may be lost on a crash
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func writeRdb(out io.Writer, snapshot *store.Snapshot) error {
+	w := rdb.NewWriter(out)
+	err := w.WriteHeader(map[string]string{
+		"redis-ver":  REDIS_VERSION,
+		"redis-bits": "64",
+		"ctime":      strconv.FormatInt(time.Now().Unix(), 10),
+	})
+	if err != nil {
+		return err
+	}
+
+	if snapshot.Len() > 0 {
+		if err := w.SelectDB(0, snapshot.Len(), snapshot.Expires()); err != nil {
+			return err
+		}
+	}
+
+	err = snapshot.Each(cache, func(key string, entry store.Entry) error {
+		if entry.Expired() {
+			return nil
+		}
+
+		switch value := entry.Value.(type) {
+		case string:
+			return w.WriteString(key, value, entry.Exp)
+		case *store.Stream:
+			return w.WriteStream(key, value.ToRdb(), entry.Exp)
+		case *store.Hash:
+			return w.WriteHash(key, value.ToRdb(), entry.Exp)
+		case store.ModuleValue:
+			return writeModuleValue(w, key, value, entry.Exp)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return w.Close()
+}
+
+func writeModuleValue(w *rdb.Writer, key string, value store.ModuleValue, exp time.Time) error {
+	m, err := rdbValue(value)
+	if err != nil {
+		return err
+	}
+	return w.WriteModule(key, m.(*rdb.Module), exp)
+}
+
+// rdbLoad reads the dataset stored in a dump, skipping the keys that already
+// expired. The server is left loading, for the caller to stop once the
+// dataset replaced the keyspace.
+func rdbLoad(path string) (store.Engine, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var size int64
+	if info, err := f.Stat(); err == nil {
+		size = info.Size()
+	}
+	return readRdb(startLoading(f, size))
+}
+
+// loadDataFromDisk fills the keyspace with the dump at dir/dbfilename, if
+// there is one, when the server starts
+func loadDataFromDisk() error {
+	defer stopLoading()
+	start := time.Now()
+	loaded, err := rdbLoad(rdbPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cache.Replace(loaded)
+	fmt.Printf("DB loaded from disk: %.3f seconds\n", time.Since(start).Seconds())
+	return nil
+}
+
+func readRdb(in io.Reader) (store.Engine, error) {
+	r := rdb.NewReader(in)
+	if err := r.ReadHeader(); err != nil {
+		return nil, err
+	}
+
+	loaded, err := newEngine()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return loaded, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		stored := store.Entry{Exp: entry.Expire}
+		if stored.Expired() {
+			continue
+		}
+
+		stored.Value, stored.Type, err = storeValue(entry.Value)
+		if errors.Is(err, errUnsupportedType) {
+			// Keys of types this server lacks, e.g. from a Redis master,
+			// are dropped rather than failing the whole load
+			fmt.Printf("skipping key %q: %s\n", entry.Key, err)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		loaded.Set(entry.Key, stored)
+	}
+}
+
+var errUnsupportedType = errors.New("type not supported by the keyspace")
+
+// storeValue converts a value read from a dump to its keyspace form
+func storeValue(value any) (any, store.Type, error) {
+	switch value := value.(type) {
+	case string:
+		return value, store.TYPE_STRING, nil
+	case *rdb.Stream:
+		return store.StreamFromRdb(value), store.TYPE_STREAM, nil
+	case *rdb.Hash:
+		return store.HashFromRdb(value), store.TYPE_HASH, nil
+	case *rdb.Module:
+		decoded, err := store.DecodeModuleValue(value.Name, value.EncVer, value.Payload)
+		return decoded, store.TYPE_MODULE, err
+	case *rdb.List, *rdb.Set, *rdb.ZSet:
+		return nil, 0, fmt.Errorf("%w: %T", errUnsupportedType, value)
+	default:
+		return nil, 0, fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// rdbValue converts a keyspace value to the form written to dumps
+func rdbValue(value any) (any, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case *store.Stream:
+		return value.ToRdb(), nil
+	case *store.Hash:
+		return value.ToRdb(), nil
+	case store.ModuleValue:
+		t, ok := store.LookupModuleType(value.TypeName())
+		if !ok {
+			return nil, fmt.Errorf("unknown module type %s", value.TypeName())
+		}
+		payload, err := value.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return &rdb.Module{Name: t.Name, EncVer: t.EncVer, Payload: payload}, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+func handleCommandSave(cmd []resp.Resp, c *client) ([]byte, error) {
+	persistence.Lock()
+	inProgress := persistence.bgsaveInProgress
+	persistence.Unlock()
+	if inProgress {
+		return nil, resp.NewError("ERR", "Background save already in progress")
+	}
+
+	if err := rdbSave(); err != nil {
+		fmt.Println("error saving the dataset, ", err)
+		return nil, resp.NewError("ERR", err.Error())
+	}
+	return OK_RESP, nil
+}
+
+func handleCommandBgsave(cmd []resp.Resp, c *client) ([]byte, error) {
+	persistence.Lock()
+	defer persistence.Unlock()
+
+	if persistence.bgsaveInProgress {
+		return nil, resp.NewError("ERR", "Background save already in progress")
+	}
+	startBgsaveLocked()
+
+	return resp.AppendSimpleString(nil, "Background saving started"), nil
+}
+
+// startBgsaveLocked saves the dataset in the background. It must be called
+// with the persistence state locked and no background save in progress.
+func startBgsaveLocked() {
+	persistence.bgsaveInProgress = true
+	persistence.lastBgsaveTry = time.Now()
+
+	go func() {
+		err := rdbSave()
+		if err != nil {
+			fmt.Println("error in background save, ", err)
+		}
+
+		persistence.Lock()
+		persistence.bgsaveInProgress = false
+		persistence.Unlock()
+	}()
+}
+
+// savePoint triggers a background save once there were at least changes
+// changes in the last seconds seconds, as set by the save parameter
+type savePoint struct {
+	seconds int64
+	changes int64
+}
+
+// Set by the save parameter, no automatic saves when empty
+var savePoints atomic.Pointer[[]savePoint]
+
+// parseSavePoints parses the save parameter: pairs of seconds and changes,
+// or an empty string for no save points
+func parseSavePoints(value string) ([]savePoint, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, errors.New("invalid save parameters")
+	}
+
+	points := make([]savePoint, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds < 1 {
+			return nil, errors.New("invalid save parameters")
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes < 0 {
+			return nil, errors.New("invalid save parameters")
+		}
+		points = append(points, savePoint{seconds, changes})
+	}
+	return points, nil
+}
+
+// saveCron starts a background save whenever a save point is reached. After
+// a failed save it waits a bit before trying again, even if a save point is
+// still reached.
+func saveCron() {
+	ticker := time.NewTicker(SAVE_CRON_INTERVAL)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		points := savePoints.Load()
+		if points == nil || len(*points) == 0 || loading.Load() {
+			continue
+		}
+		changes := changesSinceSave()
+
+		persistence.Lock()
+		retry := persistence.lastBgsaveOk || time.Since(persistence.lastBgsaveTry) > BGSAVE_RETRY_DELAY
+		if !persistence.bgsaveInProgress && retry {
+			elapsed := int64(time.Since(persistence.lastSave) / time.Second)
+			for _, point := range *points {
+				if changes >= point.changes && elapsed >= point.seconds {
+					fmt.Printf("%d changes in %d seconds. Saving...\n", point.changes, point.seconds)
+					startBgsaveLocked()
+					break
+				}
+			}
+		}
+		persistence.Unlock()
+	}
+}
+
+// SHUTDOWN [NOSAVE | SAVE] [NOW] [FORCE] saves the dataset if it has unsaved
+// changes and save points are configured, or if SAVE is given, and exits. A
+// failed save prevents the shutdown, unless FORCE is given. NOW is accepted
+// for compatibility, as there are no replicas to wait for.
+func handleCommandShutdown(cmd []resp.Resp, c *client) ([]byte, error) {
+	var save, noSave, force bool
+	for _, arg := range cmd {
+		switch strings.ToLower(arg.Content.(string)) {
+		case "save":
+			save = true
+		case "nosave":
+			noSave = true
+		case "now":
+		case "force":
+			force = true
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+	if save && noSave {
+		return nil, resp.ErrSyntax
+	}
+
+	// A dataset only partly loaded must not overwrite the dump
+	if loading.Load() {
+		save, noSave = false, true
+	}
+	if points := savePoints.Load(); save || (!noSave && points != nil && len(*points) > 0 && changesSinceSave() > 0) {
+		fmt.Println("saving the final RDB snapshot before exiting")
+		if err := rdbSave(); err != nil {
+			fmt.Println("error saving the final RDB snapshot, ", err)
+			if !force {
+				return nil, resp.NewError("ERR", "Errors trying to SHUTDOWN. Check logs.")
+			}
+		}
+	}
+
+	fmt.Println("redis is now ready to exit, bye bye...")
+	os.Exit(0)
+	return nil, nil
+}
+
+func handleCommandLastSave(cmd []resp.Resp, c *client) ([]byte, error) {
+	persistence.Lock()
+	defer persistence.Unlock()
+
+	return resp.AppendInteger(nil, persistence.lastSave.Unix()), nil
+}
+
+func persistenceInfo() string {
+	persistence.Lock()
+	defer persistence.Unlock()
+
+	status := "ok"
+	if !persistence.lastBgsaveOk {
+		status = "err"
+	}
+
+	inProgress := 0
+	if persistence.bgsaveInProgress {
+		inProgress = 1
+	}
+
+	return loadingInfo() + fmt.Sprintf("rdb_changes_since_last_save:%d\n"+
+		"rdb_bgsave_in_progress:%d\n"+
+		"rdb_last_save_time:%d\n"+
+		"rdb_last_bgsave_status:%s\n",
+		cache.Changes()-persistence.savedChanges, inProgress, persistence.lastSave.Unix(), status)
+}
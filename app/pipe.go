@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const PIPE_BATCH_SIZE = 64 * 1024
+
+// pipeMode sends a raw RESP command stream read from stdin to a running
+// server, like redis-cli --pipe: --pipe [--host <host>] [--port <port>]
+func pipeMode(args []string) int {
+	host, port := "127.0.0.1", "6379"
+	for i := 0; i+1 < len(args); i += 2 {
+		switch args[i] {
+		case "--host":
+			host = args[i+1]
+		case "--port":
+			port = args[i+1]
+		}
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(host, port))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error connecting to server, ", err)
+		return 1
+	}
+	defer conn.Close()
+
+	// An ECHO with a random marker is sent last: once it comes back every
+	// previous reply has been received.
+	marker := make([]byte, 20)
+	rand.Read(marker)
+	echo := hex.EncodeToString(marker)
+
+	type result struct {
+		replies, errors int
+		err             error
+	}
+	done := make(chan result)
+	go func() {
+		var res result
+		r := bufio.NewReader(conn)
+		for {
+			line, err := readReply(r)
+			if err != nil {
+				res.err = err
+				done <- res
+				return
+			}
+
+			if line == "$"+echo {
+				done <- res
+				return
+			}
+
+			res.replies++
+			if strings.HasPrefix(line, "-") {
+				res.errors++
+				if res.errors <= 10 {
+					fmt.Println(line)
+				}
+			}
+		}
+	}()
+
+	buf := make([]byte, PIPE_BATCH_SIZE)
+	w := bufio.NewWriterSize(conn, PIPE_BATCH_SIZE)
+	for {
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				fmt.Fprintln(os.Stderr, "error writing to server, ", err)
+				return 1
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "error reading stdin, ", err)
+			return 1
+		}
+	}
+
+	fmt.Fprintf(w, "*2\r\n$4\r\nECHO\r\n$%d\r\n%s\r\n", len(echo), echo)
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(os.Stderr, "error writing to server, ", err)
+		return 1
+	}
+	fmt.Println("All data transferred. Waiting for the last reply...")
+
+	res := <-done
+	if res.err != nil {
+		fmt.Fprintln(os.Stderr, "error reading replies, ", res.err)
+		return 1
+	}
+
+	fmt.Printf("Last reply received from server.\nerrors: %d, replies: %d\n", res.errors, res.replies)
+	if res.errors > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readReply consumes a whole reply, returning its first line. For bulk strings
+// the payload replaces the length, so that the ECHO marker can be recognized.
+func readReply(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return "", errors.New("empty reply")
+	}
+
+	switch line[0] {
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return line, err
+		}
+
+		payload := make([]byte, n+2)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return "", err
+		}
+		return "$" + string(payload[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return "", err
+		}
+		for range max(n, 0) {
+			if _, err := readReply(r); err != nil {
+				return "", err
+			}
+		}
+	}
+	return line, nil
+}
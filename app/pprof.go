@@ -0,0 +1,16 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	_ "net/http/pprof"
+)
+
+// servePprof exposes the net/http/pprof handlers registered on the default
+// mux. It only listens on the loopback interface, as profiles leak internals.
+func servePprof(port string) {
+	fmt.Printf("serving pprof on 127.0.0.1:%s/debug/pprof/\n", port)
+	if err := http.ListenAndServe("127.0.0.1:"+port, nil); err != nil {
+		fmt.Println("error serving pprof, ", err)
+	}
+}
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+const (
+	// Messages a subscriber can have queued, whatever their size, before it
+	// is disconnected
+	SUBSCRIBER_QUEUE_SIZE = 4096
+
+	DEFAULT_PUBSUB_HARD_LIMIT   = 32 * 1024 * 1024
+	DEFAULT_PUBSUB_SOFT_LIMIT   = 8 * 1024 * 1024
+	DEFAULT_PUBSUB_SOFT_SECONDS = 60
+)
+
+// Commands a client can run while subscribed
+var pubsubCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ssubscribe":   true,
+	"sunsubscribe": true,
+	"ping":         true,
+	"quit":         true,
+	"reset":        true,
+}
+
+// The pubsub class of client-output-buffer-limit: a subscriber is
+// disconnected once its queued output exceeds the hard limit, or stays above
+// the soft limit for the given number of seconds. Zero disables a limit.
+var pubsubLimits struct {
+	hard        atomic.Int64
+	soft        atomic.Int64
+	softSeconds atomic.Int64
+}
+
+func init() {
+	pubsubLimits.hard.Store(DEFAULT_PUBSUB_HARD_LIMIT)
+	pubsubLimits.soft.Store(DEFAULT_PUBSUB_SOFT_LIMIT)
+	pubsubLimits.softSeconds.Store(DEFAULT_PUBSUB_SOFT_SECONDS)
+}
+
+// Subscribers by channel and by pattern
+var pubsub struct {
+	sync.RWMutex
+	channels      map[string]map[*subscriber]bool
+	patterns      map[string]map[*subscriber]bool
+	shardChannels map[string]map[*subscriber]bool
+}
+
+func init() {
+	pubsub.channels = map[string]map[*subscriber]bool{}
+	pubsub.patterns = map[string]map[*subscriber]bool{}
+	pubsub.shardChannels = map[string]map[*subscriber]bool{}
+}
+
+// subscriber writes the output of a client that subscribed to something from
+// its own goroutine, so that PUBLISH only queues messages and a slow
+// subscriber can't hold it up. The replies of the client go through the same
+// queue from then on, to keep them ordered with the messages.
+type subscriber struct {
+	c        *client
+	messages chan []byte
+
+	// Guarded by the pubsub lock
+	channels      map[string]bool
+	patterns      map[string]bool
+	shardChannels map[string]bool
+	count         atomic.Int64
+
+	mu     sync.Mutex
+	closed bool
+	// Bytes queued and not written yet, and since when they exceed the soft
+	// limit
+	pending   int64
+	softSince time.Time
+}
+
+func newSubscriber(c *client) *subscriber {
+	s := &subscriber{
+		c:             c,
+		messages:      make(chan []byte, SUBSCRIBER_QUEUE_SIZE),
+		channels:      map[string]bool{},
+		patterns:      map[string]bool{},
+		shardChannels: map[string]bool{},
+	}
+	go s.writeLoop()
+	return s
+}
+
+// writeLoop writes the queued output, batching whatever is queued at once
+func (s *subscriber) writeLoop() {
+	var batch []byte
+	for msg := range s.messages {
+		batch = append(batch[:0], msg...)
+		for more := true; more && len(batch) < REPLY_CHUNK_SIZE; {
+			select {
+			case msg, ok := <-s.messages:
+				if !ok {
+					more = false
+					break
+				}
+				batch = append(batch, msg...)
+			default:
+				more = false
+			}
+		}
+
+		written, err := s.c.conn.Write(batch)
+		counters.totalNetOutputBytes.Add(int64(written))
+
+		s.mu.Lock()
+		s.pending -= int64(len(batch))
+		s.mu.Unlock()
+		s.c.accountMemory(-int64(len(batch)))
+		if err != nil {
+			// Drain the queue until the client is removed
+			for msg := range s.messages {
+				s.c.accountMemory(-int64(len(msg)))
+			}
+			return
+		}
+	}
+}
+
+// send queues output for the client, disconnecting it if it went over the
+// pubsub output buffer limits
+func (s *subscriber) send(out []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+
+	s.pending += int64(len(out))
+	if s.overLimit() {
+		fmt.Printf("closing subscriber %s for overcoming of output buffer limits\n", s.c.conn.RemoteAddr())
+		s.closeLocked()
+		s.c.kill()
+		return
+	}
+
+	select {
+	case s.messages <- out:
+		s.c.accountMemory(int64(len(out)))
+	default:
+		fmt.Printf("closing subscriber %s with %d messages queued\n", s.c.conn.RemoteAddr(), SUBSCRIBER_QUEUE_SIZE)
+		s.closeLocked()
+		s.c.kill()
+	}
+}
+
+func (s *subscriber) overLimit() bool {
+	if hard := pubsubLimits.hard.Load(); hard > 0 && s.pending > hard {
+		return true
+	}
+
+	soft := pubsubLimits.soft.Load()
+	if soft == 0 || s.pending <= soft {
+		s.softSince = time.Time{}
+		return false
+	}
+	if s.softSince.IsZero() {
+		s.softSince = time.Now()
+	}
+	return time.Since(s.softSince) > time.Duration(pubsubLimits.softSeconds.Load())*time.Second
+}
+
+func (s *subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *subscriber) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.messages)
+	}
+}
+
+// subscribed reports whether the client has any subscription, in which case
+// only pubsubCommands are allowed
+func (c *client) subscribed() bool {
+	return c.subscriber != nil && c.subscriber.count.Load() > 0
+}
+
+func pubsubMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	// RESP3 clients get messages as push frames, which can't be mistaken for
+	// replies, so they can run any command
+	if c.subscribed() && !c.resp3.Load() && !pubsubCommands[entry.name] {
+		return nil, resp.Errorf("ERR", "Can't execute '%s': only (P|S)SUBSCRIBE / (P|S)UNSUBSCRIBE / PING / QUIT / RESET are allowed in this context", entry.name)
+	}
+	return next()
+}
+
+// pubsubReply encodes a message or a subscription change, which are arrays
+// of bulk strings ending with a count or a payload, or push frames in RESP3
+func pubsubReply(resp3 bool, kind string, args ...any) []byte {
+	var res bytes.Buffer
+	encoder := resp.NewEncoder(&res)
+	if resp3 {
+		encoder.WritePushHeader(len(args) + 1)
+	} else {
+		encoder.WriteArrayHeader(len(args) + 1)
+	}
+	encoder.WriteBulkString(kind)
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case string:
+			encoder.WriteBulkString(arg)
+		case int:
+			encoder.WriteInteger(int64(arg))
+		case nil:
+			encoder.WriteNull()
+		}
+	}
+	encoder.Flush()
+	return res.Bytes()
+}
+
+// subscriptionType tells channels, patterns and shard channels apart, which
+// are separate namespaces
+type subscriptionType int
+
+const (
+	CHANNEL_SUBSCRIPTION subscriptionType = iota
+	PATTERN_SUBSCRIPTION
+	SHARD_SUBSCRIPTION
+)
+
+func pubsubIndex(t subscriptionType) map[string]map[*subscriber]bool {
+	switch t {
+	case PATTERN_SUBSCRIPTION:
+		return pubsub.patterns
+	case SHARD_SUBSCRIPTION:
+		return pubsub.shardChannels
+	default:
+		return pubsub.channels
+	}
+}
+
+func (s *subscriber) subscriptions(t subscriptionType) map[string]bool {
+	switch t {
+	case PATTERN_SUBSCRIPTION:
+		return s.patterns
+	case SHARD_SUBSCRIPTION:
+		return s.shardChannels
+	default:
+		return s.channels
+	}
+}
+
+// replyCount is the number of subscriptions reported by the confirmations of
+// the given type, where shard channels are counted on their own
+func (s *subscriber) replyCount(t subscriptionType) int {
+	if t == SHARD_SUBSCRIPTION {
+		return len(s.shardChannels)
+	}
+	return len(s.channels) + len(s.patterns)
+}
+
+// subscribeCommand builds the handlers of SUBSCRIBE, PSUBSCRIBE and
+// SSUBSCRIBE, which confirm each subscription through the subscriber queue
+// while holding the lock, so that no message published to it can come before
+func subscribeCommand(kind string, t subscriptionType) commandHandler {
+	return func(cmd []resp.Resp, c *client) ([]byte, error) {
+		if c.subscriber == nil {
+			c.subscriber = newSubscriber(c)
+		}
+		s := c.subscriber
+
+		pubsub.Lock()
+		defer pubsub.Unlock()
+
+		index, subscriptions := pubsubIndex(t), s.subscriptions(t)
+		for _, arg := range cmd {
+			name := arg.Content.(string)
+			if !subscriptions[name] {
+				subscriptions[name] = true
+				s.count.Add(1)
+				if index[name] == nil {
+					index[name] = map[*subscriber]bool{}
+				}
+				index[name][s] = true
+			}
+			s.send(pubsubReply(c.resp3.Load(), kind, name, s.replyCount(t)))
+		}
+		return nil, nil
+	}
+}
+
+// unsubscribeCommand builds the handlers of UNSUBSCRIBE, PUNSUBSCRIBE and
+// SUNSUBSCRIBE, which remove every subscription of their type without
+// arguments
+func unsubscribeCommand(kind string, t subscriptionType) commandHandler {
+	return func(cmd []resp.Resp, c *client) ([]byte, error) {
+		s := c.subscriber
+		if s == nil {
+			return pubsubReply(c.resp3.Load(), kind, nil, 0), nil
+		}
+
+		pubsub.Lock()
+		defer pubsub.Unlock()
+
+		var names []string
+		for _, arg := range cmd {
+			names = append(names, arg.Content.(string))
+		}
+		if len(names) == 0 {
+			for name := range s.subscriptions(t) {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+		}
+		if len(names) == 0 {
+			s.send(pubsubReply(c.resp3.Load(), kind, nil, s.replyCount(t)))
+		}
+
+		for _, name := range names {
+			s.unsubscribeLocked(name, t)
+			s.send(pubsubReply(c.resp3.Load(), kind, name, s.replyCount(t)))
+		}
+		return nil, nil
+	}
+}
+
+func (s *subscriber) unsubscribeLocked(name string, t subscriptionType) {
+	index, subscriptions := pubsubIndex(t), s.subscriptions(t)
+	if !subscriptions[name] {
+		return
+	}
+
+	delete(subscriptions, name)
+	s.count.Add(-1)
+	delete(index[name], s)
+	if len(index[name]) == 0 {
+		delete(index, name)
+	}
+}
+
+// removeSubscriber drops the subscriptions of a client that went away
+func removeSubscriber(s *subscriber) {
+	pubsub.Lock()
+	for _, t := range []subscriptionType{CHANNEL_SUBSCRIPTION, PATTERN_SUBSCRIPTION, SHARD_SUBSCRIPTION} {
+		for name := range s.subscriptions(t) {
+			s.unsubscribeLocked(name, t)
+		}
+	}
+	pubsub.Unlock()
+
+	s.close()
+}
+
+// PUBLISH channel message queues the message for the subscribers of the
+// channel and of the matching patterns, and replies with how many got it.
+// Masters also replicate it, for the subscribers of their replicas.
+func handleCommandPublish(cmd []resp.Resp, c *client) ([]byte, error) {
+	channel, message := cmd[0].Content.(string), cmd[1].Content.(string)
+	propagate(append([]resp.Resp{{Content: "PUBLISH", DataType: resp.STRING}}, cmd...))
+
+	pubsub.RLock()
+	defer pubsub.RUnlock()
+
+	receivers := 0
+	if subscribers := pubsub.channels[channel]; len(subscribers) > 0 {
+		msg := pubsubMessage{kind: "message", args: []any{channel, message}}
+		for s := range subscribers {
+			s.send(msg.encoded(s.c.resp3.Load()))
+			receivers++
+		}
+	}
+	for pattern, subscribers := range pubsub.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		msg := pubsubMessage{kind: "pmessage", args: []any{pattern, channel, message}}
+		for s := range subscribers {
+			s.send(msg.encoded(s.c.resp3.Load()))
+			receivers++
+		}
+	}
+	return resp.AppendInteger(nil, int64(receivers)), nil
+}
+
+// SPUBLISH shardchannel message is PUBLISH for the subscribers of a shard
+// channel, which patterns don't match
+func handleCommandSpublish(cmd []resp.Resp, c *client) ([]byte, error) {
+	channel, message := cmd[0].Content.(string), cmd[1].Content.(string)
+	propagate(append([]resp.Resp{{Content: "SPUBLISH", DataType: resp.STRING}}, cmd...))
+
+	pubsub.RLock()
+	defer pubsub.RUnlock()
+
+	msg := pubsubMessage{kind: "smessage", args: []any{channel, message}}
+	subscribers := pubsub.shardChannels[channel]
+	for s := range subscribers {
+		s.send(msg.encoded(s.c.resp3.Load()))
+	}
+	return resp.AppendInteger(nil, int64(len(subscribers))), nil
+}
+
+// pubsubMessage encodes a published message at most once for each protocol
+// used by its subscribers
+type pubsubMessage struct {
+	kind         string
+	args         []any
+	resp2, resp3 []byte
+}
+
+func (m *pubsubMessage) encoded(resp3 bool) []byte {
+	if resp3 {
+		if m.resp3 == nil {
+			m.resp3 = pubsubReply(true, m.kind, m.args...)
+		}
+		return m.resp3
+	}
+	if m.resp2 == nil {
+		m.resp2 = pubsubReply(false, m.kind, m.args...)
+	}
+	return m.resp2
+}
+
+// parseClientOutputBufferLimit parses the limits of client-output-buffer-limit
+// for pubsub clients, given as groups of class, hard limit, soft limit and
+// soft seconds. Limits of other classes are only validated.
+func parseClientOutputBufferLimit(value string) (hard, soft, softSeconds int64, err error) {
+	hard, soft, softSeconds = -1, -1, -1
+	fields := strings.Fields(value)
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return 0, 0, 0, fmt.Errorf("wrong number of arguments")
+	}
+
+	for i := 0; i < len(fields); i += 4 {
+		class := strings.ToLower(fields[i])
+		if class != "normal" && class != "replica" && class != "slave" && class != "pubsub" {
+			return 0, 0, 0, fmt.Errorf("invalid client class '%s'", fields[i])
+		}
+		h, err := parseMemory(fields[i+1])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		s, err := parseMemory(fields[i+2])
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		seconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || seconds < 0 {
+			return 0, 0, 0, fmt.Errorf("invalid soft limit seconds '%s'", fields[i+3])
+		}
+		if class == "pubsub" {
+			hard, soft, softSeconds = h, s, seconds
+		}
+	}
+	return hard, soft, softSeconds, nil
+}
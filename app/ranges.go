@@ -0,0 +1,41 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// parseRange parses the start and stop arguments of range commands such as
+// GETRANGE. Errors are the reply to send.
+func parseRange(start, stop resp.Resp) (int, int, error) {
+	from, err := strconv.Atoi(start.Content.(string))
+	if err != nil {
+		return 0, 0, resp.ErrNotInteger
+	}
+	to, err := strconv.Atoi(stop.Content.(string))
+	if err != nil {
+		return 0, 0, resp.ErrNotInteger
+	}
+	return from, to, nil
+}
+
+// normalizeRange turns the inclusive start and stop indexes of a range
+// command into indexes within a sequence of the given length. Negative
+// indexes count from the end, -1 being the last element, and indexes past
+// either end are clamped to it. It returns false if the range is empty,
+// e.g. when start is after stop or past the end.
+func normalizeRange(start, stop, length int) (int, int, bool) {
+	if start < 0 {
+		start += length
+	}
+	if stop < 0 {
+		stop += length
+	}
+	start = max(start, 0)
+	stop = min(stop, length-1)
+	if start > stop {
+		return 0, 0, false
+	}
+	return start, stop, true
+}
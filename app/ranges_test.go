@@ -0,0 +1,36 @@
+package main
+
+import "testing"
+
+func TestNormalizeRange(t *testing.T) {
+	tests := []struct {
+		name                string
+		start, stop, length int
+		wantStart, wantStop int
+		wantOk              bool
+	}{
+		{"whole", 0, 4, 5, 0, 4, true},
+		{"middle", 1, 3, 5, 1, 3, true},
+		{"single", 2, 2, 5, 2, 2, true},
+		{"last", -1, -1, 5, 4, 4, true},
+		{"negative", -3, -2, 5, 2, 3, true},
+		{"mixed", 1, -2, 5, 1, 3, true},
+		{"whole with -1", 0, -1, 5, 0, 4, true},
+		{"stop past the end", 2, 100, 5, 2, 4, true},
+		{"start before the start", -100, 1, 5, 0, 1, true},
+		{"both clamped", -100, 100, 5, 0, 4, true},
+		{"start after stop", 3, 1, 5, 0, 0, false},
+		{"negative start after stop", -1, -2, 5, 0, 0, false},
+		{"start past the end", 5, 10, 5, 0, 0, false},
+		{"stop before the start", -100, -6, 5, 0, 0, false},
+		{"empty sequence", 0, -1, 0, 0, 0, false},
+		{"empty sequence from 0 to 0", 0, 0, 0, 0, 0, false},
+	}
+	for _, test := range tests {
+		start, stop, ok := normalizeRange(test.start, test.stop, test.length)
+		if start != test.wantStart || stop != test.wantStop || ok != test.wantOk {
+			t.Errorf("%s: normalizeRange(%d, %d, %d) = %d, %d, %v, want %d, %d, %v", test.name,
+				test.start, test.stop, test.length, start, stop, ok, test.wantStart, test.wantStop, test.wantOk)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/rdb"
+)
+
+type dumpedStreamEntry struct {
+	ID     string   `json:"id"`
+	Fields []string `json:"fields"`
+}
+
+type dumpedKey struct {
+	DB       int    `json:"db"`
+	Key      string `json:"key"`
+	Type     string `json:"type"`
+	ExpireAt int64  `json:"expire_at_ms,omitempty"`
+	TTL      int64  `json:"ttl_ms"`
+	Value    any    `json:"value"`
+}
+
+// rdbDump prints every key of a dump as a JSON line: rdb-dump <file>
+func rdbDump(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: rdb-dump <file>")
+		return 1
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	r := rdb.NewReader(f)
+	if err := r.ReadHeader(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	out := json.NewEncoder(os.Stdout)
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			return 0
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+
+		out.Encode(dumpKey(entry))
+	}
+}
+
+func dumpKey(entry *rdb.Entry) dumpedKey {
+	dumped := dumpedKey{DB: entry.DB, Key: entry.Key, TTL: -1}
+	if !entry.Expire.IsZero() {
+		dumped.ExpireAt = entry.Expire.UnixMilli()
+		dumped.TTL = max(time.Until(entry.Expire).Milliseconds(), 0)
+	}
+
+	switch value := entry.Value.(type) {
+	case string:
+		dumped.Type, dumped.Value = "string", value
+	case *rdb.Stream:
+		entries := make([]dumpedStreamEntry, 0, len(value.Entries))
+		for _, e := range value.Entries {
+			entries = append(entries, dumpedStreamEntry{
+				ID:     fmt.Sprintf("%d-%d", e.ID.Ms, e.ID.Seq),
+				Fields: e.Fields,
+			})
+		}
+		dumped.Type, dumped.Value = "stream", entries
+	case *rdb.Hash:
+		fields := make(map[string]string, len(value.Fields)/2)
+		for i := 0; i+1 < len(value.Fields); i += 2 {
+			fields[value.Fields[i]] = value.Fields[i+1]
+		}
+		dumped.Type, dumped.Value = "hash", fields
+	case *rdb.Module:
+		dumped.Type, dumped.Value = value.Name, value.Payload
+	}
+	return dumped
+}
+
+// checkRdb validates a dump, in the spirit of redis-check-rdb: --check-rdb <file>
+func checkRdb(args []string) int {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "usage: --check-rdb <file>")
+		return 1
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer f.Close()
+
+	fmt.Printf("[offset 0] Checking RDB file %s\n", args[0])
+	r := rdb.NewReader(f)
+	if err := r.ReadHeader(); err != nil {
+		return reportRdbError(r, err)
+	}
+	fmt.Printf("[offset %d] RDB version %d\n", r.Offset(), r.Version)
+
+	keys, expires := 0, 0
+	for {
+		entry, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return reportRdbError(r, err)
+		}
+
+		keys++
+		if !entry.Expire.IsZero() {
+			expires++
+		}
+	}
+
+	for key, value := range r.Aux {
+		fmt.Printf("[info] AUX FIELD %s = '%s'\n", key, value)
+	}
+	fmt.Printf("[offset %d] Checksum OK\n", r.Offset())
+	fmt.Printf("[info] %d keys read\n[info] %d expires\n", keys, expires)
+	fmt.Println("\\o/ RDB looks OK! \\o/")
+	return 0
+}
+
+func reportRdbError(r *rdb.Reader, err error) int {
+	fmt.Println("--- RDB ERROR DETECTED ---")
+	fmt.Printf("[offset %d] %s\n", r.Offset(), err)
+	return 1
+}
@@ -0,0 +1,741 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/replication"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/telemetry"
+)
+
+// Link of a replica with its master, nil on a master. It is replaced on the
+// executor, while INFO, ROLE and the middlewares read it from any connection.
+var masterLink atomic.Pointer[replication.Link]
+
+const (
+	DEFAULT_REPLICA_PRIORITY = 100
+	DEFAULT_REPL_TIMEOUT     = 60
+	// Delays between attempts to synchronize with the master, doubling after
+	// each failure up to the maximum
+	REPL_RETRY_MIN_DELAY = time.Second
+	REPL_RETRY_MAX_DELAY = 30 * time.Second
+)
+
+// isMaster reports whether the node is a master, as opposed to a replica
+func (n *nodeInfo) isMaster() bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.role == MASTER
+}
+
+// replicationRole returns the role of the node, with the address of its
+// master on a replica
+func (n *nodeInfo) replicationRole() (nodeRole, string) {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.role, n.masterHost
+}
+
+// replID is the ID of the replication history started by this master
+func (n *nodeInfo) replID() string {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.id
+}
+
+// connectToMaster replicates node.masterHost until the link is replaced or
+// closed by a promotion. A failed synchronization, or the loss of the
+// connection once synchronized, is retried with a growing delay, the link
+// staying down in the meantime.
+func connectToMaster() {
+	_, masterHost := node.replicationRole()
+	port := node.port
+	if announced, ok := config.get("replica-announce-port"); ok && announced != "" {
+		port = announced
+	}
+	link := replication.NewLink(masterHost, port)
+	link.Password, _ = config.get("masterauth")
+	link.AnnounceIP, _ = config.get("replica-announce-ip")
+	link.Timeout = replTimeout()
+	link.Dial = func(addr string) (net.Conn, error) {
+		conn, err := net.DialTimeout("tcp", addr, link.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		return traceConn(conn), nil
+	}
+	masterLink.Store(link)
+
+	delay := REPL_RETRY_MIN_DELAY
+	for masterLink.Load() == link {
+		span := tracer.StartSpan("replication.handshake", telemetry.SPAN_KIND_CLIENT)
+		span.SetString("net.peer.name", masterHost)
+
+		conn, err := syncWithMaster(link)
+		span.End(err)
+		if err == nil {
+			delay = REPL_RETRY_MIN_DELAY
+			node.masterConn = conn
+			handleClientConn(conn, true)
+			fmt.Println("connection with master lost")
+		} else {
+			fmt.Println("error synchronizing with master node, ", err)
+		}
+		// The link was closed on purpose if another one replaced it
+		if masterLink.Load() != link {
+			return
+		}
+		link.Close()
+
+		fmt.Printf("retrying to synchronize with master in %s\n", delay)
+		time.Sleep(delay)
+		delay = min(delay*2, REPL_RETRY_MAX_DELAY)
+	}
+}
+
+// replTimeout is the repl-timeout parameter, how long the master may take to
+// answer each step of the synchronization
+func replTimeout() time.Duration {
+	seconds := DEFAULT_REPL_TIMEOUT
+	if value, ok := config.get("repl-timeout"); ok {
+		if n, err := strconv.Atoi(value); err == nil {
+			seconds = n
+		}
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// replicateFrom turns this node into a replica of the master at addr,
+// dropping the link with its previous master if any
+func replicateFrom(addr string) {
+	if link := masterLink.Swap(nil); link != nil {
+		link.Close()
+	}
+	// Replicas of this node would otherwise miss the dataset of the new
+	// master, as replication isn't chained
+	node.replicasMu.Lock()
+	for _, replica := range node.replicas {
+		replica.Close()
+	}
+	node.replicas = nil
+	node.replicasMu.Unlock()
+
+	node.mu.Lock()
+	node.role = SLAVE
+	node.masterHost = addr
+	node.mu.Unlock()
+	go connectToMaster()
+}
+
+// promoteToMaster stops replicating and starts a new replication history,
+// keeping the dataset received so far
+func promoteToMaster() {
+	if link := masterLink.Swap(nil); link != nil {
+		link.Close()
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	node.role = MASTER
+	node.masterHost = ""
+	node.id = generateRandomId()
+}
+
+// replicaOffset is the offset of the master's replication stream processed
+// by this replica
+func replicaOffset() int64 {
+	if link := masterLink.Load(); link != nil {
+		return link.ReplOffset()
+	}
+	return 0
+}
+
+// syncWithMaster drives the link through the handshake and the transfer of
+// the master's dataset, which replaces the keyspace.
+func syncWithMaster(link *replication.Link) (net.Conn, error) {
+	if err := link.Connect(); err != nil {
+		return nil, err
+	}
+	if err := link.Handshake(); err != nil {
+		return nil, err
+	}
+
+	dump, err := link.ReadDump()
+	if err != nil {
+		return nil, err
+	}
+	// The size is only known when the master didn't stream the dump
+	var size int64
+	if limited, ok := dump.(*io.LimitedReader); ok {
+		size = limited.N
+	}
+	// Loading lasts until the new dataset is in place, so that no client
+	// sees the old one in between
+	loaded, err := readRdb(startLoading(dump, size))
+	defer stopLoading()
+	if err != nil {
+		return nil, err
+	}
+	// Whatever follows the end of the dataset within the advertised size,
+	// e.g. padding, must not be taken for propagated commands
+	if _, err := io.Copy(io.Discard, dump); err != nil {
+		return nil, err
+	}
+	cache.Replace(loaded)
+
+	return link.Established(), nil
+}
+
+// Commands a replica runs while its link with the master is down even with
+// replica-serve-stale-data set to no, as they don't read the dataset
+var staleCommands = map[string]bool{
+	"auth":      true,
+	"ping":      true,
+	"info":      true,
+	"role":      true,
+	"config":    true,
+	"replconf":  true,
+	"replicaof": true,
+	"slaveof":   true,
+	"multi":     true,
+	"exec":      true,
+	"discard":   true,
+	"monitor":   true,
+	"slowlog":   true,
+	"lolwut":    true,
+	"time":      true,
+}
+
+// staleDataMiddleware refuses commands on a replica that lost its master,
+// when replica-serve-stale-data is no, instead of serving data that may be
+// out of date
+func staleDataMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if !node.isMaster() && !c.fromMaster && !staleCommands[entry.name] &&
+		masterLinkStatus() != "up" && !serveStaleData() {
+		return nil, resp.NewError("MASTERDOWN", "Link with MASTER is down and replica-serve-stale-data is set to 'no'.")
+	}
+	return next()
+}
+
+func serveStaleData() bool {
+	for _, name := range []string{"replica-serve-stale-data", "slave-serve-stale-data"} {
+		if value, ok := config.get(name); ok {
+			return value != "no"
+		}
+	}
+	return true
+}
+
+// readOnlyReplicaMiddleware rejects writes from clients on a replica unless
+// replica-read-only is no. Writes accepted by a writable replica only change
+// its own dataset, as a replica propagates nothing.
+func readOnlyReplicaMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	if !node.isMaster() && !c.fromMaster && entry.hasFlag(FLAG_WRITE) && replicaReadOnly() {
+		return nil, resp.NewError("READONLY", "You can't write against a read only replica.")
+	}
+	return next()
+}
+
+func replicaReadOnly() bool {
+	for _, name := range []string{"replica-read-only", "slave-read-only"} {
+		if value, ok := config.get(name); ok {
+			return value != "no"
+		}
+	}
+	return true
+}
+
+func replicaMustRespond(input *resp.Resp) bool {
+	if input.DataType != resp.ARRAY {
+		return false
+	}
+
+	cmd := input.Content.([]resp.Resp)
+	return len(cmd) >= 2 && cmd[0].Content == "REPLCONF" && cmd[1].Content == "GETACK"
+}
+
+// WAIT numreplicas timeout blocks until numreplicas replicas acknowledged
+// every write made so far, or until the timeout in milliseconds elapsed, and
+// replies with the number of replicas that did
+func handleCommandWait(cmd []resp.Resp, c *client) ([]byte, error) {
+	numReplicas, err := strconv.Atoi(cmd[0].Content.(string))
+	if err != nil {
+		return nil, resp.ErrNotInteger
+	}
+	timeout, err := strconv.ParseInt(cmd[1].Content.(string), 10, 64)
+	if err != nil {
+		return nil, resp.NewError("ERR", "timeout is not an integer or out of range")
+	}
+	if timeout < 0 {
+		return nil, resp.NewError("ERR", "timeout is negative")
+	}
+	if !node.isMaster() {
+		return nil, resp.NewError("ERR", "WAIT cannot be used with replica instances.")
+	}
+
+	target := masterOffset()
+	acked := func() int {
+		n := 0
+		for _, replica := range node.replicaList() {
+			if replica.ackOffset.Load() >= target {
+				n++
+			}
+		}
+		return n
+	}
+	if n := acked(); n >= numReplicas {
+		return resp.AppendInteger(nil, int64(n)), nil
+	}
+
+	reply := func() []byte {
+		return resp.AppendInteger(nil, int64(acked()))
+	}
+	out, err := blockClient(c, &blockedClient{
+		serve: func() []byte {
+			if acked() >= numReplicas {
+				return reply()
+			}
+			return nil
+		},
+		timeout: reply,
+	}, time.Duration(timeout)*time.Millisecond)
+
+	// Asked once the client is registered, so that no acknowledgement is
+	// missed
+	if c.blocked != nil {
+		propagate([]resp.Resp{
+			{Content: "REPLCONF", DataType: resp.STRING},
+			{Content: "GETACK", DataType: resp.STRING},
+			{Content: "*", DataType: resp.STRING},
+		})
+	}
+	return out, err
+}
+
+func replicationInfo() string {
+	var sb strings.Builder
+	role, masterHost := node.replicationRole()
+	fmt.Fprintf(&sb, "role:%s\n", role)
+
+	if role != MASTER {
+		host, port, _ := net.SplitHostPort(masterHost)
+		state := replication.STATE_CONNECT
+		lastIO := int64(-1)
+		replID := ""
+		if link := masterLink.Load(); link != nil {
+			state = link.State()
+			replID = link.ReplID()
+			if state == replication.STATE_CONNECTED {
+				lastIO = int64(time.Since(link.LastIO()).Seconds())
+			}
+		}
+		syncInProgress := 0
+		if state == replication.STATE_SYNC {
+			syncInProgress = 1
+		}
+
+		fmt.Fprintf(&sb, "master_host:%s\nmaster_port:%s\n", host, port)
+		fmt.Fprintf(&sb, "master_link_status:%s\n", masterLinkStatus())
+		fmt.Fprintf(&sb, "master_last_io_seconds_ago:%d\n", lastIO)
+		fmt.Fprintf(&sb, "master_sync_in_progress:%d\n", syncInProgress)
+		fmt.Fprintf(&sb, "master_sync_state:%s\n", linkState())
+		fmt.Fprintf(&sb, "slave_read_repl_offset:%d\n", replicaOffset())
+		fmt.Fprintf(&sb, "slave_repl_offset:%d\n", replicaOffset())
+		fmt.Fprintf(&sb, "slave_priority:%d\n", replicaPriority())
+		fmt.Fprintf(&sb, "slave_read_only:%d\n", boolToInt(replicaReadOnly()))
+		sb.WriteString("replica_announced:1\n")
+		sb.WriteString("connected_slaves:0\n")
+		fmt.Fprintf(&sb, "master_replid:%s\n", replID)
+		fmt.Fprintf(&sb, "master_repl_offset:%d\n", replicaOffset())
+		return sb.String()
+	}
+
+	replicas := node.replicaList()
+	fmt.Fprintf(&sb, "connected_slaves:%d\n", len(replicas))
+	for i, replica := range replicas {
+		state := "wait_bgsave"
+		if replica.isOnline() {
+			state = "online"
+		}
+		fmt.Fprintf(&sb, "slave%d:ip=%s,port=%s,state=%s,offset=%d,lag=%d\n",
+			i, replica.ip, replica.port, state, replica.ackOffset.Load(), replica.lag())
+	}
+	sb.WriteString("master_failover_state:no-failover\n")
+	fmt.Fprintf(&sb, "master_replid:%s\n", node.replID())
+	fmt.Fprintf(&sb, "master_replid2:%s\n", strings.Repeat("0", 40))
+	fmt.Fprintf(&sb, "master_repl_offset:%d\n", masterOffset())
+	sb.WriteString("second_repl_offset:-1\n")
+	if backlog := node.backlog.Load(); backlog != nil {
+		fmt.Fprintf(&sb, "repl_backlog_active:1\nrepl_backlog_size:%d\nrepl_backlog_first_byte_offset:%d\nrepl_backlog_histlen:%d\n",
+			backlog.Size(), backlog.FirstOffset(), backlog.HistLen())
+	} else {
+		sb.WriteString("repl_backlog_active:0\n")
+	}
+	return sb.String()
+}
+
+// replicaPriority is the replica-priority announced to Sentinel, which
+// promotes the replicas with the lowest priority first and never those with
+// a priority of 0
+func replicaPriority() int {
+	for _, name := range []string{"replica-priority", "slave-priority"} {
+		if value, ok := config.get(name); ok {
+			if n, err := strconv.Atoi(value); err == nil {
+				return n
+			}
+		}
+	}
+	return DEFAULT_REPLICA_PRIORITY
+}
+
+// REPLICAOF host port | NO ONE changes the master of this node at runtime, as
+// Sentinel does to promote a replica and reconfigure the others
+func handleCommandReplicaOf(cmd []resp.Resp, c *client) ([]byte, error) {
+	if clusterState != nil {
+		return nil, resp.NewError("ERR", "REPLICAOF not allowed in cluster mode.")
+	}
+
+	host, port := cmd[0].Content.(string), cmd[1].Content.(string)
+	if strings.EqualFold(host, "no") && strings.EqualFold(port, "one") {
+		if !node.isMaster() {
+			promoteToMaster()
+			config.set("replicaof", "")
+			fmt.Println("MASTER MODE enabled")
+		}
+		return OK_RESP, nil
+	}
+
+	if n, err := strconv.Atoi(port); err != nil || n <= 0 || n > 65535 {
+		return nil, resp.NewError("ERR", "Invalid master port")
+	}
+	addr := net.JoinHostPort(host, port)
+	if role, masterHost := node.replicationRole(); role == SLAVE && masterHost == addr {
+		return resp.AppendSimpleString(nil, "OK Already connected to specified master"), nil
+	}
+
+	replicateFrom(addr)
+	config.set("replicaof", host+" "+port)
+	fmt.Printf("REPLICAOF %s enabled\n", addr)
+	return OK_RESP, nil
+}
+
+// ROLE replies with the role of this node and its replication state
+func handleCommandRole(cmd []resp.Resp, c *client) ([]byte, error) {
+	if role, masterHost := node.replicationRole(); role != MASTER {
+		host, port, _ := net.SplitHostPort(masterHost)
+		portNumber, _ := strconv.Atoi(port)
+		return resp.AppendArray(nil, []resp.Resp{
+			{Content: "slave", DataType: resp.STRING},
+			{Content: host, DataType: resp.STRING},
+			{Content: portNumber, DataType: resp.INTEGER},
+			{Content: linkState(), DataType: resp.STRING},
+			{Content: int(replicaOffset()), DataType: resp.INTEGER},
+		}), nil
+	}
+
+	attached := node.replicaList()
+	replicas := make([]resp.Resp, 0, len(attached))
+	for _, replica := range attached {
+		replicas = append(replicas, resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+			{Content: replica.ip, DataType: resp.STRING},
+			{Content: replica.port, DataType: resp.STRING},
+			{Content: strconv.FormatInt(replica.ackOffset.Load(), 10), DataType: resp.STRING},
+		}})
+	}
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "master", DataType: resp.STRING},
+		{Content: int(masterOffset()), DataType: resp.INTEGER},
+		{Content: replicas, DataType: resp.ARRAY},
+	}), nil
+}
+
+func handleCommandReplConfig(cmd []resp.Resp, c *client) ([]byte, error) {
+	subCmd := strings.ToLower(cmd[0].Content.(string))
+	switch {
+	case subCmd == "listening-port" && len(cmd) > 1:
+		c.listeningPort = cmd[1].Content.(string)
+		return OK_RESP, nil
+	case subCmd == "ip-address" && len(cmd) > 1:
+		c.announcedIP = cmd[1].Content.(string)
+		return OK_RESP, nil
+	case subCmd == "capa":
+		return OK_RESP, nil
+	case subCmd == "ack" && len(cmd) > 1:
+		// Acknowledgements aren't replied to
+		if offset, err := strconv.ParseInt(cmd[1].Content.(string), 10, 64); err == nil && c.replica != nil {
+			c.replica.ackOffset.Store(offset)
+			c.replica.lastAck.Store(time.Now().Unix())
+			signalReplicaAck()
+		}
+		return nil, nil
+	}
+
+	if subCmd == "getack" {
+		return resp.AppendArray(nil, []resp.Resp{
+			{Content: "REPLCONF", DataType: resp.STRING},
+			{Content: "ACK", DataType: resp.STRING},
+			{Content: strconv.FormatInt(replicaOffset(), 10), DataType: resp.STRING},
+		}), nil
+	}
+
+	return nil, nil
+}
+
+func handleCommandSync(cmd []resp.Resp, c *client) ([]byte, error) {
+	span := tracer.StartSpan("replication.fullresync", telemetry.SPAN_KIND_SERVER)
+	span.SetString("net.peer.name", c.conn.RemoteAddr().String())
+
+	// PSYNC runs on the executor, so no write can happen between taking the
+	// snapshot and registering the replica. Writes propagated while the dump
+	// is generated are held back until it has been sent.
+	replBacklog()
+	resync := fmt.Sprintf("FULLRESYNC %s %d", node.replID(), masterOffset())
+	snapshot := cache.BeginSnapshot()
+	replica := newReplicaConn(c)
+	c.replica = replica
+	node.replicasMu.Lock()
+	node.replicas = append(node.replicas, replica)
+	node.replicasMu.Unlock()
+
+	go func() {
+		defer cache.EndSnapshot(snapshot)
+
+		var dump bytes.Buffer
+		err := writeRdb(&dump, snapshot)
+		if err == nil {
+			encoder := resp.NewEncoder(c.conn)
+			encoder.WriteSimpleString(resync)
+			encoder.WriteRdb(dump.Bytes())
+			err = encoder.Flush()
+		}
+		if err != nil {
+			fmt.Println("error sending the dataset to replica, ", err)
+		}
+		span.SetInt("rdb.size", dump.Len())
+		span.End(err)
+
+		replica.online()
+	}()
+
+	return nil, nil
+}
+
+// replicaConn buffers the commands propagated to a replica until the initial
+// dump has been transferred. It also keeps the address the replica announced
+// and the offset it last acknowledged, for INFO.
+type replicaConn struct {
+	net.Conn
+	mu      sync.Mutex
+	ready   bool
+	pending []byte
+
+	ip        string
+	port      string
+	ackOffset atomic.Int64
+	// Unix time in seconds of the last REPLCONF ACK
+	lastAck atomic.Int64
+}
+
+func newReplicaConn(c *client) *replicaConn {
+	ip, _, _ := net.SplitHostPort(c.conn.RemoteAddr().String())
+	if c.announcedIP != "" {
+		ip = c.announcedIP
+	}
+	replica := &replicaConn{Conn: c.conn, ip: ip, port: c.listeningPort}
+	replica.lastAck.Store(time.Now().Unix())
+	return replica
+}
+
+// removeReplica stops propagating to a replica whose connection closed
+func removeReplica(r *replicaConn) {
+	node.replicasMu.Lock()
+	defer node.replicasMu.Unlock()
+
+	node.replicas = slices.DeleteFunc(node.replicas, func(other *replicaConn) bool {
+		return other == r
+	})
+}
+
+// replicaList returns the replicas attached to this master
+func (n *nodeInfo) replicaList() []*replicaConn {
+	n.replicasMu.Lock()
+	defer n.replicasMu.Unlock()
+
+	return slices.Clone(n.replicas)
+}
+
+func (r *replicaConn) isOnline() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ready
+}
+
+// lag is the number of seconds since the replica last acknowledged
+func (r *replicaConn) lag() int64 {
+	return time.Now().Unix() - r.lastAck.Load()
+}
+
+func (r *replicaConn) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.ready {
+		r.pending = append(r.pending, p...)
+		return len(p), nil
+	}
+	return r.Conn.Write(p)
+}
+
+func (r *replicaConn) online() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ready = true
+	if len(r.pending) > 0 {
+		r.Conn.Write(r.pending)
+		r.pending = nil
+	}
+}
+
+func encodeCmd(cmd []resp.Resp) []byte {
+	return resp.AppendArray(nil, cmd)
+}
+
+// propagateAs replaces what gets replicated for the command being executed by
+// c with the given command, e.g. a relative EXPIRE becomes a PEXPIREAT so the
+// replicas don't compute a different deadline. It can be called several times
+// to replicate multiple commands, or with no arguments to replicate nothing.
+func (c *client) propagateAs(args ...string) {
+	if c.effects == nil {
+		c.effects = [][]resp.Resp{}
+	}
+
+	if len(args) == 0 {
+		return
+	}
+
+	effect := make([]resp.Resp, 0, len(args))
+	for _, arg := range args {
+		effect = append(effect, resp.Resp{Content: arg, DataType: resp.STRING})
+	}
+	c.effects = append(c.effects, effect)
+}
+
+// propagateEffects replicates a successfully executed write command, using the
+// effects recorded by its handler when there are any.
+func propagateEffects(cmd []resp.Resp, c *client) {
+	effects := c.effects
+	if effects == nil {
+		effects = [][]resp.Resp{cmd}
+	}
+
+	for _, effect := range effects {
+		propagate(effect)
+	}
+}
+
+// expireKey is the handler of the expired keys found by lookups and by the
+// active expire cycle. A master deletes them and replicates the deletion,
+// while a replica only hides them until the DEL of its master arrives, so
+// that it never drops a key on its own, e.g. because its clock is ahead.
+//
+// The DEL is propagated right away, while a write is only propagated once its
+// handler returned, after the keyspace was unlocked. What keeps them in order
+// is datasetLock: lookups only run on the executor, which propagates a write
+// before releasing the lock, or holding it for reading, so a key can't be
+// found expired between a write and its propagation.
+func expireKey(key string, active bool) bool {
+	if !node.isMaster() {
+		return false
+	}
+
+	if active {
+		counters.expiredKeysActive.Add(1)
+	} else {
+		counters.expiredKeysLazy.Add(1)
+	}
+	propagate([]resp.Resp{
+		{Content: "DEL", DataType: resp.STRING},
+		{Content: key, DataType: resp.STRING},
+	})
+	return true
+}
+
+func propagate(cmd []resp.Resp) {
+	if !node.isMaster() {
+		return
+	}
+
+	node.replicasMu.Lock()
+	defer node.replicasMu.Unlock()
+
+	// The stream goes to the backlog even without replicas, so that the
+	// offset keeps counting every write
+	encoded := resp.AppendArray(nil, cmd)
+	replBacklog().Write(encoded)
+	for _, replica := range node.replicas {
+		replica.Write(encoded)
+	}
+}
+
+// replBacklog returns the backlog, created with the first write propagated or
+// the first replica
+func replBacklog() *replication.Backlog {
+	if backlog := node.backlog.Load(); backlog != nil {
+		return backlog
+	}
+	node.backlog.CompareAndSwap(nil, replication.NewBacklog(backlogSize()))
+	return node.backlog.Load()
+}
+
+// masterOffset is the number of bytes of the replication stream produced so
+// far
+func masterOffset() int64 {
+	backlog := node.backlog.Load()
+	if backlog == nil {
+		return 0
+	}
+	return backlog.Offset()
+}
+
+func backlogSize() int {
+	if value, ok := config.get("repl-backlog-size"); ok {
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			return n
+		}
+	}
+	return replication.DEFAULT_BACKLOG_SIZE
+}
+
+// linkState is the progress of the synchronization with the master, as ROLE
+// reports it: connect, connecting during the handshake, sync or connected
+func linkState() string {
+	link := masterLink.Load()
+	if link == nil {
+		return replication.STATE_CONNECT.String()
+	}
+	if link.State() == replication.STATE_HANDSHAKE {
+		return "connecting"
+	}
+	return link.State().String()
+}
+
+func masterLinkStatus() string {
+	if link := masterLink.Load(); link != nil && link.State() == replication.STATE_CONNECTED {
+		return "up"
+	}
+	return "down"
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// attachReplica plays a replica going through the handshake, and returns it
+// along with the offset the master announced
+func attachReplica(t *testing.T) (*testClient, int64) {
+	replica := newTestClient(t)
+	replica.do(t, "REPLCONF listening-port 6380")
+	replica.send(t, "PSYNC ? -1")
+	fields := strings.Fields(replica.receive(t).Content.(string))
+	if len(fields) != 3 || fields[0] != "FULLRESYNC" {
+		t.Fatalf("PSYNC replied with %v, want FULLRESYNC", fields)
+	}
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dump, err := replica.decoder.DecodeRdb()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, dump); err != nil {
+		t.Fatal(err)
+	}
+	return replica, offset
+}
+
+// readUntilGetAck reads the replication stream up to a REPLCONF GETACK and
+// returns the number of bytes received before it and its own size
+func readUntilGetAck(t *testing.T, replica *testClient) (int64, int64) {
+	var received int64
+	for {
+		cmd := replica.receive(t)
+		size := int64(len(resp.AppendValue(nil, cmd)))
+		if args := cmd.Content.([]resp.Resp); len(args) == 3 && args[0].Content == "REPLCONF" && args[1].Content == "GETACK" {
+			return received, size
+		}
+		received += size
+	}
+}
+
+func TestWaitGetAckOffset(t *testing.T) {
+	writer := newTestClient(t)
+	writer.do(t, "SET getack:before v")
+	// Writes count even before the first replica attaches
+	before := masterOffset()
+	if before == 0 {
+		t.Fatal("master offset still 0 after a write without replicas")
+	}
+
+	replica, offset := attachReplica(t)
+	if offset != before {
+		t.Fatalf("FULLRESYNC at offset %d, want %d", offset, before)
+	}
+
+	writer.do(t, "SET getack:after v")
+	// An acknowledgement one byte short of the write doesn't count
+	writer.send(t, "WAIT 1 200")
+	received, getAckSize := readUntilGetAck(t, replica)
+	replica.send(t, "REPLCONF ACK "+strconv.FormatInt(offset+received-1, 10))
+	if reply := writer.receive(t); reply.Content != 0 {
+		t.Fatalf("WAIT with a replica behind = %v, want 0", reply.Content)
+	}
+	offset += received + getAckSize
+
+	// The GETACK itself is part of the stream the replica has to acknowledge
+	writer.send(t, "WAIT 1 5000")
+	received, getAckSize = readUntilGetAck(t, replica)
+	replica.send(t, "REPLCONF ACK "+strconv.FormatInt(offset+received, 10))
+	if reply := writer.receive(t); reply.Content != 1 {
+		t.Fatalf("WAIT with a replica up to date = %v, want 1", reply.Content)
+	}
+	if got, want := masterOffset(), offset+received+getAckSize; got != want {
+		t.Fatalf("master offset %d, want %d", got, want)
+	}
+}
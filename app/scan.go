@@ -0,0 +1,111 @@
+package main
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/glob"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+const SCAN_DEFAULT_COUNT = 10
+
+// scanArgs are the arguments shared by the SCAN family of commands
+type scanArgs struct {
+	cursor   uint64
+	pattern  string
+	count    int
+	typeName string
+	noValues bool
+}
+
+// parseScanArgs parses a cursor followed by options. MATCH and COUNT are
+// accepted by every command, TYPE and NOVALUES only when listed in extra.
+// Errors are the reply to send.
+func parseScanArgs(args []resp.Resp, extra ...string) (scanArgs, error) {
+	parsed := scanArgs{count: SCAN_DEFAULT_COUNT}
+	cursor, err := strconv.ParseUint(args[0].Content.(string), 10, 64)
+	if err != nil {
+		return parsed, resp.NewError("ERR", "invalid cursor")
+	}
+	parsed.cursor = cursor
+
+	for i := 1; i < len(args); i++ {
+		option := strings.ToLower(args[i].Content.(string))
+		if option != "match" && option != "count" && !slices.Contains(extra, option) {
+			return parsed, resp.ErrSyntax
+		}
+
+		// NOVALUES is the only flag, the other options take a value
+		if option == "novalues" {
+			parsed.noValues = true
+			continue
+		}
+		if i+1 == len(args) {
+			return parsed, resp.ErrSyntax
+		}
+		i++
+		value := args[i].Content.(string)
+
+		switch option {
+		case "match":
+			parsed.pattern = value
+		case "count":
+			parsed.count, err = strconv.Atoi(value)
+			if err != nil {
+				return parsed, resp.ErrNotInteger
+			}
+			if parsed.count < 1 {
+				return parsed, resp.ErrSyntax
+			}
+		case "type":
+			parsed.typeName = value
+		}
+	}
+	return parsed, nil
+}
+
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+func handleCommandScan(cmd []resp.Resp, c *client) ([]byte, error) {
+	args, err := parseScanArgs(cmd, "type")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, next := cache.Scan(args.cursor, args.count)
+
+	matched := []resp.Resp{}
+	for _, key := range keys {
+		if args.pattern != "" && !glob.Match(args.pattern, key) {
+			continue
+		}
+
+		entry, ok := cache.Get(key)
+		if !ok || entry.Expired() || (args.typeName != "" && !strings.EqualFold(entry.TypeName(), args.typeName)) {
+			continue
+		}
+		matched = append(matched, resp.Resp{Content: key, DataType: resp.STRING})
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: strconv.FormatUint(next, 10), DataType: resp.STRING},
+		{Content: matched, DataType: resp.ARRAY},
+	}), nil
+}
+
+// KEYS pattern replies with every key matching the glob-style pattern at
+// once, reading the whole keyspace, where SCAN goes through it in steps
+func handleCommandKeys(cmd []resp.Resp, c *client) ([]byte, error) {
+	pattern := cmd[0].Content.(string)
+
+	matched := []resp.Resp{}
+	cache.Iterate(func(key string, entry store.Entry) bool {
+		if !entry.Expired() && glob.Match(pattern, key) {
+			matched = append(matched, resp.Resp{Content: key, DataType: resp.STRING})
+		}
+		return true
+	})
+	return resp.AppendArray(nil, matched), nil
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/search"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+const SEARCH_DEFAULT_LIMIT = 10
+
+// Search indexes by name. They only live in memory, and are rebuilt from the
+// keyspace when created.
+var searchIndexes = struct {
+	sync.RWMutex
+	byName map[string]*search.Index
+}{byName: make(map[string]*search.Index)}
+
+// searchListener keeps the indexes up to date as hashes change
+type searchListener struct{}
+
+func (searchListener) Changed(key string, entry *store.Entry) {
+	searchIndexes.RLock()
+	defer searchIndexes.RUnlock()
+
+	for _, idx := range searchIndexes.byName {
+		if !idx.Covers(key) {
+			continue
+		}
+		if hash, ok := indexableHash(entry); ok {
+			idx.Update(key, hash.Fields())
+		} else {
+			idx.Remove(key)
+		}
+	}
+}
+
+func (searchListener) Reset() {
+	searchIndexes.RLock()
+	defer searchIndexes.RUnlock()
+
+	for _, idx := range searchIndexes.byName {
+		idx.Clear()
+	}
+}
+
+func indexableHash(entry *store.Entry) (*store.Hash, bool) {
+	if entry == nil || entry.Type != store.TYPE_HASH {
+		return nil, false
+	}
+	return entry.Value.(*store.Hash), true
+}
+
+func lookupIndex(name string) (*search.Index, bool) {
+	searchIndexes.RLock()
+	defer searchIndexes.RUnlock()
+
+	idx, ok := searchIndexes.byName[name]
+	return idx, ok
+}
+
+// FT.CREATE index [ON HASH] [PREFIX count prefix ...] SCHEMA field type
+// [SEPARATOR sep] [SORTABLE] ...
+func handleCommandFTCreate(cmd []resp.Resp, c *client) ([]byte, error) {
+	name := cmd[0].Content.(string)
+	if _, ok := lookupIndex(name); ok {
+		return nil, resp.NewError("ERR", "Index already exists")
+	}
+
+	var prefixes []string
+	args := cmd[1:]
+	for len(args) > 0 && !strings.EqualFold(args[0].Content.(string), "SCHEMA") {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "ON":
+			if len(args) < 2 || !strings.EqualFold(args[1].Content.(string), "HASH") {
+				return nil, resp.NewError("ERR", "only HASH indexes are supported")
+			}
+			args = args[2:]
+		case "PREFIX":
+			if len(args) < 2 {
+				return nil, resp.ErrSyntax
+			}
+			n, err := strconv.Atoi(args[1].Content.(string))
+			if err != nil || n < 0 || len(args) < 2+n {
+				return nil, resp.NewError("ERR", "bad arguments for PREFIX")
+			}
+			for _, prefix := range args[2 : 2+n] {
+				prefixes = append(prefixes, prefix.Content.(string))
+			}
+			args = args[2+n:]
+		default:
+			return nil, resp.NewError("ERR", "unknown argument '"+args[0].Content.(string)+"'")
+		}
+	}
+	if len(args) < 3 {
+		return nil, resp.NewError("ERR", "Fields arguments are missing")
+	}
+
+	var fields []search.Field
+	for args = args[1:]; len(args) > 0; {
+		if len(args) < 2 {
+			return nil, resp.NewError("ERR", "Field type is missing")
+		}
+		fieldType, ok := search.ParseFieldType(args[1].Content.(string))
+		if !ok {
+			return nil, resp.NewError("ERR", "Invalid field type for field '"+args[0].Content.(string)+"'")
+		}
+
+		f := search.Field{Name: args[0].Content.(string), Type: fieldType, Separator: search.DEFAULT_TAG_SEPARATOR}
+		args = args[2:]
+		for len(args) > 0 {
+			option := strings.ToUpper(args[0].Content.(string))
+			if option == "SORTABLE" {
+				f.Sortable = true
+				args = args[1:]
+			} else if option == "SEPARATOR" && fieldType == search.FIELD_TAG && len(args) > 1 && len(args[1].Content.(string)) == 1 {
+				f.Separator = args[1].Content.(string)[0]
+				args = args[2:]
+			} else {
+				break
+			}
+		}
+		fields = append(fields, f)
+	}
+
+	// Running as a write, no key changes while the existing hashes are
+	// indexed and the index is registered
+	idx := search.NewIndex(name, prefixes, fields)
+	cache.Iterate(func(key string, entry store.Entry) bool {
+		if hash, ok := indexableHash(&entry); ok && !entry.Expired() && idx.Covers(key) {
+			idx.Update(key, hash.Fields())
+		}
+		return true
+	})
+
+	searchIndexes.Lock()
+	searchIndexes.byName[name] = idx
+	searchIndexes.Unlock()
+
+	return OK_RESP, nil
+}
+
+// FT.DROPINDEX index, which keeps the indexed hashes
+func handleCommandFTDropIndex(cmd []resp.Resp, c *client) ([]byte, error) {
+	searchIndexes.Lock()
+	defer searchIndexes.Unlock()
+
+	name := cmd[0].Content.(string)
+	if _, ok := searchIndexes.byName[name]; !ok {
+		return nil, resp.NewError("ERR", "Unknown Index name")
+	}
+	delete(searchIndexes.byName, name)
+	return OK_RESP, nil
+}
+
+func handleCommandFTList(cmd []resp.Resp, c *client) ([]byte, error) {
+	searchIndexes.RLock()
+	names := make([]string, 0, len(searchIndexes.byName))
+	for name := range searchIndexes.byName {
+		names = append(names, name)
+	}
+	searchIndexes.RUnlock()
+
+	sort.Strings(names)
+	reply := make([]resp.Resp, 0, len(names))
+	for _, name := range names {
+		reply = append(reply, resp.Resp{Content: name, DataType: resp.STRING})
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// FT.INFO index, a subset of the RediSearch fields
+func handleCommandFTInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	idx, ok := lookupIndex(cmd[0].Content.(string))
+	if !ok {
+		return nil, resp.NewError("ERR", "Unknown Index name")
+	}
+
+	prefixes := make([]resp.Resp, 0, len(idx.Prefixes))
+	for _, prefix := range idx.Prefixes {
+		prefixes = append(prefixes, resp.Resp{Content: prefix, DataType: resp.STRING})
+	}
+
+	attributes := make([]resp.Resp, 0, len(idx.Fields))
+	for _, f := range idx.Fields {
+		attribute := []resp.Resp{
+			{Content: "identifier", DataType: resp.STRING},
+			{Content: f.Name, DataType: resp.STRING},
+			{Content: "type", DataType: resp.STRING},
+			{Content: f.Type.String(), DataType: resp.STRING},
+		}
+		if f.Sortable {
+			attribute = append(attribute, resp.Resp{Content: "SORTABLE", DataType: resp.STRING})
+		}
+		attributes = append(attributes, resp.Resp{Content: attribute, DataType: resp.ARRAY})
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "index_name", DataType: resp.STRING},
+		{Content: idx.Name, DataType: resp.STRING},
+		{Content: "index_definition", DataType: resp.STRING},
+		{Content: []resp.Resp{
+			{Content: "key_type", DataType: resp.STRING},
+			{Content: "HASH", DataType: resp.STRING},
+			{Content: "prefixes", DataType: resp.STRING},
+			{Content: prefixes, DataType: resp.ARRAY},
+		}, DataType: resp.ARRAY},
+		{Content: "attributes", DataType: resp.STRING},
+		{Content: attributes, DataType: resp.ARRAY},
+		{Content: "num_docs", DataType: resp.STRING},
+		{Content: idx.NumDocs(), DataType: resp.INTEGER},
+	}), nil
+}
+
+// FT.SEARCH index query [NOCONTENT] [RETURN count field ...]
+// [SORTBY field [ASC|DESC]] [LIMIT offset num]
+func handleCommandFTSearch(cmd []resp.Resp, c *client) ([]byte, error) {
+	idx, ok := lookupIndex(cmd[0].Content.(string))
+	if !ok {
+		return nil, resp.NewError("ERR", cmd[0].Content.(string)+": no such index")
+	}
+
+	query, err := search.ParseQuery(cmd[1].Content.(string))
+	if err != nil {
+		return nil, resp.NewError("ERR", err.Error())
+	}
+
+	opts := search.SearchOptions{Limit: SEARCH_DEFAULT_LIMIT}
+	noContent := false
+	var returnFields []string
+	for args := cmd[2:]; len(args) > 0; {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "NOCONTENT":
+			noContent = true
+			args = args[1:]
+		case "RETURN":
+			n := -1
+			if len(args) > 1 {
+				n, _ = strconv.Atoi(args[1].Content.(string))
+			}
+			if n < 0 || len(args) < 2+n {
+				return nil, resp.NewError("ERR", "bad arguments for RETURN")
+			}
+			returnFields = make([]string, 0, n)
+			for _, f := range args[2 : 2+n] {
+				returnFields = append(returnFields, f.Content.(string))
+			}
+			args = args[2+n:]
+		case "SORTBY":
+			if len(args) < 2 {
+				return nil, resp.NewError("ERR", "bad arguments for SORTBY")
+			}
+			opts.SortBy = args[1].Content.(string)
+			args = args[2:]
+			if len(args) > 0 {
+				switch strings.ToUpper(args[0].Content.(string)) {
+				case "ASC":
+					args = args[1:]
+				case "DESC":
+					opts.Desc = true
+					args = args[1:]
+				}
+			}
+		case "LIMIT":
+			if len(args) < 3 {
+				return nil, resp.NewError("ERR", "bad arguments for LIMIT")
+			}
+			offset, errOffset := strconv.Atoi(args[1].Content.(string))
+			limit, errLimit := strconv.Atoi(args[2].Content.(string))
+			if errOffset != nil || errLimit != nil || offset < 0 || limit < 0 {
+				return nil, resp.NewError("ERR", "bad arguments for LIMIT")
+			}
+			opts.Offset, opts.Limit = offset, limit
+			args = args[3:]
+		default:
+			return nil, resp.NewError("ERR", "unknown argument '"+args[0].Content.(string)+"'")
+		}
+	}
+
+	total, keys, err := idx.Search(query, opts)
+	if err != nil {
+		return nil, resp.NewError("ERR", err.Error())
+	}
+
+	reply := []resp.Resp{{Content: total, DataType: resp.INTEGER}}
+	for _, key := range keys {
+		reply = append(reply, resp.Resp{Content: key, DataType: resp.STRING})
+		if noContent {
+			continue
+		}
+
+		hash, _, _ := cache.GetHash(key)
+		reply = append(reply, resp.Resp{Content: documentFields(hash, returnFields), DataType: resp.ARRAY})
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// documentFields returns the fields of a search result, all of them unless
+// RETURN selected some.
+func documentFields(hash *store.Hash, selected []string) []resp.Resp {
+	fields := []resp.Resp{}
+	if hash == nil {
+		return fields
+	}
+
+	if selected == nil {
+		for _, s := range hash.Fields() {
+			fields = append(fields, resp.Resp{Content: s, DataType: resp.STRING})
+		}
+		return fields
+	}
+
+	for _, name := range selected {
+		if value, ok := hash.Get(name); ok {
+			fields = append(fields,
+				resp.Resp{Content: name, DataType: resp.STRING},
+				resp.Resp{Content: value, DataType: resp.STRING},
+			)
+		}
+	}
+	return fields
+}
@@ -1,211 +1,243 @@
 package main
 
 import (
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"math/rand/v2"
 	"net"
 	"os"
+	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/codecrafters-io/redis-starter-go/internal/utils"
+	"github.com/codecrafters-io/redis-starter-go/internal/replication"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/internal/telemetry"
+)
+
+const REDIS_VERSION = "7.2.0"
+
+const (
+	// Size of the buffer connections are read into
+	READ_BUFFER_SIZE = 16 * 1024
+	// Maximum size of a command that is still being received
+	MAX_QUERY_BUFFER = 1024 * 1024 * 1024
+	// Query buffers larger than this are released once empty
+	MAX_IDLE_QUERY_BUFFER = 32 * 1024
+	// Replies at least this large aren't batched with the others
+	LARGE_REPLY_SIZE = 64 * 1024
+	// Size of the writes replies are sent with
+	REPLY_CHUNK_SIZE = 64 * 1024
 )
 
 type nodeRole string
 
 const (
-	MASTER       nodeRole = "master"
-	SLAVE        nodeRole = "slave"
-	EMPTY_RDB             = `524544495330303131fa0972656469732d76657205372e322e30fa0a72656469732d62697473c040fa056374696d65c26d08bc65fa08757365642d6d656dc2b0c41000fa08616f662d62617365c000fff06e3bfec0ff5aa2`
-	ENTRY_STRING          = iota
-	ENTRY_STREAM
+	MASTER nodeRole = "master"
+	SLAVE  nodeRole = "slave"
 )
 
 type nodeInfo struct {
-	id         string
-	offset     int
 	port       string
-	role       nodeRole
-	masterHost string
 	masterConn net.Conn
-	replicas   []net.Conn
-}
+	backlog    atomic.Pointer[replication.Backlog]
 
-type cacheEntryType int
+	// Guards replicas. propagate holds it while writing to the backlog and
+	// the replicas, so that they all get the stream in the same order, even
+	// as the DELs of expired keys are propagated from any connection.
+	replicasMu sync.Mutex
+	replicas   []*replicaConn
 
-func (t cacheEntryType) String() string {
-	switch t {
-	case ENTRY_STRING:
-		return "string"
-	case ENTRY_STREAM:
-		return "stream"
-	default:
-		return ""
-	}
+	// Guards the fields below, changed on the executor by REPLICAOF and
+	// failovers while any connection may read them
+	mu         sync.RWMutex
+	id         string
+	role       nodeRole
+	masterHost string
 }
 
-type cacheEntry struct {
-	value     any
-	exp       time.Time
-	entryType cacheEntryType
-}
+var (
+	node      nodeInfo
+	cache     *store.Keyspace
+	config    safeConfig
+	NULL_RESP = []byte("$-1\r\n")
+	// Reply of the commands that succeed without a result
+	OK_RESP = []byte("+OK\r\n")
+	// Reply of commands with an array result when there is none
+	NULL_ARRAY_RESP = []byte("*-1\r\n")
+	// Identifies this run of the server, so that a restart can be detected
+	runID     string
+	startTime time.Time
+)
 
-type safeCache struct {
-	sync.RWMutex
-	stored map[string]cacheEntry
-}
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "rdb-dump" {
+		os.Exit(rdbDump(os.Args[2:]))
+	}
 
-func (c *safeCache) getKey(key string) (cacheEntry, bool) {
-	c.RWMutex.RLock()
-	defer c.RWMutex.RUnlock()
+	if len(os.Args) > 1 && os.Args[1] == "--check-rdb" {
+		os.Exit(checkRdb(os.Args[2:]))
+	}
 
-	entry, ok := c.stored[key]
-	return entry, ok
-}
+	if len(os.Args) > 1 && os.Args[1] == "--pipe" {
+		os.Exit(pipeMode(os.Args[2:]))
+	}
 
-func (c *safeCache) setKey(key string, val any, exp time.Time, entryType cacheEntryType) cacheEntry {
-	c.RWMutex.Lock()
-	defer c.RWMutex.Unlock()
+	initializeServer(os.Args[1:])
+	// Before anything reads from a connection, the master link included
+	initConnLimit()
 
-	entry := cacheEntry{
-		value:     val,
-		exp:       exp,
-		entryType: entryType,
+	bind, _ := config.get("bind")
+	listener, err := listen(bind, node.port)
+	if err != nil {
+		fmt.Printf("failed to bind to port %s, %s\n", node.port, err)
+		os.Exit(1)
 	}
+	defer listener.Close()
 
-	c.stored[key] = entry
-	return entry
-}
-
-func (c *safeCache) deleteKey(key string) {
-	c.RWMutex.Lock()
-	defer c.RWMutex.Unlock()
+	if err := initKeyspace(); err != nil {
+		fmt.Println("error creating the keyspace, ", err)
+		os.Exit(1)
+	}
 
-	delete(c.stored, key)
-}
+	if err := loadModules(); err != nil {
+		fmt.Println("error loading modules, ", err)
+		os.Exit(1)
+	}
 
-type streamId struct {
-	msTime         int
-	sequenceNumber int
-}
+	if err := initCluster(); err != nil {
+		fmt.Println("error loading cluster config, ", err)
+		os.Exit(1)
+	}
 
-func (s *Stream) streamIdFromString(id string) streamId {
-	splitted := strings.Split(id, "-")
-	if len(splitted) < 2 {
-		return streamId{int(time.Now().UnixMilli()), 0}
+	// Set before anything that may trace runs, like the sync with the master
+	// started below
+	if endpoint := otelEndpoint(); endpoint != "" {
+		tracer = telemetry.New(endpoint, "redis-starter-go")
 	}
 
-	ms, _ := strconv.Atoi(splitted[0])
-	seq := 0
-	if splitted[1] == "*" {
-		prev := s.top()
-		if ms == 0 {
-			seq = 1
+	// The dump is loaded while clients are already accepted, which get
+	// -LOADING until it is done. Module types must be registered first, for
+	// their values to be read.
+	loading.Store(true)
+	go func() {
+		if err := loadDataFromDisk(); err != nil {
+			fmt.Println("fatal error loading the DB, ", err)
+			os.Exit(1)
 		}
-		if prev != nil && prev.id.msTime == ms {
-			seq = prev.id.sequenceNumber + 1
+		// The master's dataset replaces the local one, so there's no
+		// point in syncing before it's loaded
+		if !node.isMaster() {
+			connectToMaster()
 		}
-	} else {
-		seq, _ = strconv.Atoi(splitted[1])
-	}
-
-	return streamId{
-		ms,
-		seq,
-	}
-}
+	}()
 
-func (id streamId) String() string {
-	return fmt.Sprintf("%d-%d", id.msTime, id.sequenceNumber)
-}
+	fmt.Printf("started redis server on port %s\n", node.port)
 
-type streamEntry struct {
-	id streamId
-}
+	go watchConfigReloads()
+	go activeExpireCycle()
+	go saveCron()
+	initWorkerPool()
 
-type Stream struct {
-	entries []streamEntry
-}
+	if port, ok := config.get("health-port"); ok {
+		go serveHealth(port)
+	}
 
-func (s *Stream) append(input string) (streamId, error) {
-	id := s.streamIdFromString(input)
-	if id.msTime < 0 || id.sequenceNumber < 0 || (id.msTime == 0 && id.sequenceNumber == 0) {
-		return id, errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	if port, ok := config.get("pprof-port"); ok {
+		go servePprof(port)
 	}
 
-	latest := s.top()
-	if latest == nil || latest.id.msTime < id.msTime || (latest.id.msTime == id.msTime && latest.id.sequenceNumber < id.sequenceNumber) {
-		s.entries = append(s.entries, streamEntry{id})
-		return id, nil
+	if model, _ := config.get("io-model"); model == "epoll" {
+		if err := serveEventLoop(listener); err != nil {
+			fmt.Println("Error running the event loop: ", err.Error())
+			os.Exit(1)
+		}
 	}
 
-	return id, errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
-}
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			fmt.Println("Error accepting connection: ", err.Error())
+			os.Exit(1)
+		}
 
-func (s *Stream) top() *streamEntry {
-	if len(s.entries) == 0 {
-		return nil
+		counters.totalConnectionsReceived.Add(1)
+		go handleClientConn(traceConn(conn), false)
 	}
-
-	return &s.entries[len(s.entries)-1]
 }
 
-var (
-	node      nodeInfo
-	cache     safeCache
-	config    map[string]string
-	NULL_RESP = []byte("$-1\r\n")
-)
+// initKeyspace creates the empty keyspace with the configured engine
+func initKeyspace() error {
+	engine, err := newEngine()
+	if err != nil {
+		return err
+	}
+	cache = store.New(engine)
+	cache.AddListener(searchListener{})
+	cache.SetExpireHandler(expireKey)
+	cache.AddListener(readyKeysListener{})
+	return nil
+}
 
-func main() {
-	initializeServer(os.Args[1:])
+func initializeServer(args []string) {
+	config = safeConfig{values: map[string]string{}}
+	node = nodeInfo{}
+	runID = generateRandomId()
+	startTime = time.Now()
 
-	listener, err := net.Listen("tcp", "0.0.0.0:"+node.port)
+	commandLine, err := parseArgs(args)
 	if err != nil {
-		fmt.Printf("failed to bind to port %s\n", node.port)
+		fmt.Printf("error parsing the command line, %s\nrun with --help to list the options\n", err)
 		os.Exit(1)
 	}
-	defer listener.Close()
-
-	cache = safeCache{
-		stored: make(map[string]cacheEntry),
+	if commandLine.help {
+		printUsage(os.Stdout)
+		os.Exit(0)
 	}
-
-	fmt.Printf("started redis server on port %s\n", node.port)
-
-	if node.role == SLAVE {
-		go connectToMaster()
+	if commandLine.version {
+		printVersion(os.Stdout)
+		os.Exit(0)
 	}
 
-	for {
-		conn, err := listener.Accept()
+	var options []configOption
+	if commandLine.configFile != "" {
+		configFile = commandLine.configFile
+		fromFile, err := parseConfigFile(configFile)
 		if err != nil {
-			fmt.Println("Error accepting connection: ", err.Error())
+			fmt.Println("error reading config file, ", err)
 			os.Exit(1)
 		}
+		options = fromFile
+	}
 
-		go handleClientConn(conn, false)
+	for _, option := range commandLine.options {
+		options = append(options, option)
+		commandLineOptions[option.name] = true
 	}
-}
 
-func initializeServer(args []string) {
-	config = map[string]string{}
-	node = nodeInfo{}
-	for i := 0; i+1 < len(args); i += 2 {
-		switch flag := args[i][2:]; flag {
+	for _, option := range options {
+		switch option.name {
 		case "port":
-			node.port = args[i+1]
+			node.port = option.value
 		case "replicaof":
-			host := strings.SplitN(args[i+1], " ", 2)
+			host := strings.SplitN(option.value, " ", 2)
 			node.masterHost = strings.Join(host, ":")
-		default:
-			config[args[i][2:]] = args[i+1]
+		case "loadmodule":
+			modulePaths = append(modulePaths, option.value)
+		case "rename-command":
+			if err := renameCommand(option.value); err != nil {
+				fmt.Println("error reading config, ", err)
+				os.Exit(1)
+			}
 		}
+		applyConfig(option.name, option.value)
 	}
 
 	if node.port == "" {
@@ -220,54 +252,15 @@ func initializeServer(args []string) {
 	}
 }
 
-func connectToMaster() {
-	conn, err := net.Dial("tcp", node.masterHost)
-	if err != nil {
-		fmt.Println("error connecting to master node, ", err)
-		os.Exit(1)
-	}
-
-	node.masterConn = conn
-
-	// Step 1 PING
-	encodedPing := encodeCmd([]utils.Resp{{Content: "PING", DataType: utils.STRING}})
-	conn.Write(encodedPing)
-
-	response := make([]byte, 1024)
-	conn.Read(response)
-
-	// Step 2 REPLCONF
-	encodedPort := encodeCmd([]utils.Resp{
-		{Content: "REPLCONF", DataType: utils.STRING},
-		{Content: "listening-port", DataType: utils.STRING},
-		{Content: node.port, DataType: utils.STRING},
-	})
-	conn.Write(encodedPort)
-	conn.Read(response)
-
-	encodedCapa := encodeCmd([]utils.Resp{
-		{Content: "REPLCONF", DataType: utils.STRING},
-		{Content: "capa", DataType: utils.STRING},
-		{Content: "psync2", DataType: utils.STRING},
-	})
-	conn.Write(encodedCapa)
-	conn.Read(response)
-
-	encodedSync := encodeCmd([]utils.Resp{
-		{Content: "PSYNC", DataType: utils.STRING},
-		{Content: "?", DataType: utils.STRING},
-		{Content: "-1", DataType: utils.STRING},
-	})
-	conn.Write(encodedSync)
-	handleClientConn(conn, true)
-}
-
 func handleClientConn(conn net.Conn, fromMaster bool) {
 	defer conn.Close()
 
+	c := newClient(conn, fromMaster)
+	defer removeClient(c)
+
 	fmt.Printf("new connection from %s\n", conn.RemoteAddr().String())
 
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, READ_BUFFER_SIZE)
 	for {
 		n, err := conn.Read(buffer)
 		if err != nil {
@@ -279,229 +272,657 @@ func handleClientConn(conn net.Conn, fromMaster bool) {
 			return
 		}
 
-		for nParsed := 0; nParsed < n; {
-			parsed, offset, err := utils.ParseResp(buffer[nParsed:n])
-			nParsed += offset - 1
-			if err != nil {
-				// TOOD write error
-				fmt.Printf("Error parsing input from client %s\n", err)
+		if err := c.handleInput(buffer[:n]); err != nil {
+			fmt.Printf("Error parsing input from client %s\n", err)
+			return
+		}
+	}
+}
+
+// handleInput executes the commands read from the client connection and
+// writes back their replies, all at once for pipelined commands. A command
+// split across reads is kept until the rest of it arrives. A protocol error is
+// replied to and returned, and the connection should then be closed, as it is
+// after a panic outside of a command.
+func (c *client) handleInput(input []byte) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("panic handling input from %s: %v\n%s", clientAddr(c), r, debug.Stack())
+			err = errors.New("internal error")
+		}
+	}()
+
+	counters.totalNetInputBytes.Add(int64(len(input)))
+
+	// Deferred before acquiring a connection slot, so that the slot is
+	// released by the time the replies are written
+	var replies []byte
+	defer func() {
+		c.writeReplies(replies)
+		if c.killed {
+			c.kill()
+		}
+	}()
+
+	connLimit.acquire()
+	defer connLimit.release()
+
+	query := input
+	if len(c.query) > 0 {
+		c.query = append(c.query, input...)
+		query = c.query
+	}
+
+	for len(query) > 0 && !c.killed {
+		parsed, n, err := c.parser.Parse(query)
+		if errors.Is(err, resp.ErrIncomplete) {
+			query = query[n:]
+			break
+		}
+		if err != nil {
+			replies = append(replies, resp.EncodeError(resp.NewError("ERR", err.Error()))...)
+			return err
+		}
+		query = query[n:]
+
+		out, err := executeRequest(&parsed, c)
+		if c.blocked != nil {
+			var input []byte
+			if out, input, err = c.waitUnblocked(); err != nil {
+				// The client went away while blocked
+				c.killed = true
 				break
 			}
-
-			out, err := handleCommand(&parsed, conn)
-			if err != nil {
-				fmt.Println("Error handling command", err)
-				continue
+			if len(input) > 0 {
+				query = append(query[:len(query):len(query)], input...)
 			}
+		}
+		if err != nil {
+			fmt.Println("Error handling command", err)
+			continue
+		}
 
-			if !fromMaster || replicaMustRespond(&parsed) {
-				conn.Write(out)
+		if !c.fromMaster || replicaMustRespond(&parsed) {
+			if len(out) < LARGE_REPLY_SIZE {
+				replies = append(replies, out...)
+			} else {
+				// Written as is instead of being copied after the previous
+				// replies, with the connection slot given back meanwhile
+				connLimit.release()
+				c.writeReplies(replies)
+				c.writeReplies(out)
+				connLimit.acquire()
+				replies = replies[:0]
 			}
+		}
 
-			if node.role == SLAVE {
-				node.offset += offset - 1
+		// The offset acknowledged with GETACK only counts the commands
+		// received before it, on the link with the master
+		if c.fromMaster {
+			if link := masterLink.Load(); link != nil {
+				link.Processed(c.parser.Size())
 			}
 		}
 	}
+
+	if len(query)+c.parser.Pending() > MAX_QUERY_BUFFER {
+		return errors.New("query buffer limit exceeded")
+	}
+	// The remaining bytes may point into the caller's buffer, which is reused
+	// for the next read. Bytes already in the query buffer are only moved
+	// once a command or some of its arguments were consumed, as a large
+	// argument takes many reads.
+	switch {
+	case len(query) == 0 && cap(c.query) > MAX_IDLE_QUERY_BUFFER:
+		c.query = nil
+	case len(c.query) == 0 || len(query) != len(c.query):
+		c.query = append(c.query[:0], query...)
+	}
+	c.updateInputMemory()
+	return nil
 }
 
-func replicaMustRespond(input *utils.Resp) bool {
-	if input.DataType != utils.ARRAY {
-		return false
+// writeReplies writes replies to the client in chunks, so that the output of a
+// large reply is accounted as it is sent
+func (c *client) writeReplies(replies []byte) {
+	if c.subscriber != nil {
+		if len(replies) > 0 {
+			c.subscriber.send(slices.Clone(replies))
+		}
+		return
 	}
 
-	cmd := input.Content.([]utils.Resp)
-	return cmd[0].Content == "REPLCONF" && cmd[1].Content == "GETACK"
+	for len(replies) > 0 {
+		chunk := replies[:min(len(replies), REPLY_CHUNK_SIZE)]
+		written, err := c.conn.Write(chunk)
+		counters.totalNetOutputBytes.Add(int64(written))
+		if err != nil {
+			return
+		}
+		replies = replies[len(chunk):]
+	}
 }
 
-func handleCommand(input *utils.Resp, conn net.Conn) ([]byte, error) {
-	if input.DataType != utils.ARRAY {
+func handleCommand(input *resp.Resp, c *client) ([]byte, error) {
+	if input.DataType != resp.ARRAY {
 		return nil, errors.New("invalid client input, was expecting array")
 	}
 
-	cmd := input.Content.([]utils.Resp)
-	switch strings.ToUpper(cmd[0].Content.(string)) {
-	case "PING":
-		return utils.EncodeResp("PONG", utils.SIMPLE_STRING)
-	case "ECHO":
-		return utils.EncodeResp(cmd[1].Content.(string), utils.STRING)
-	case "GET":
-		return handleCommandGet(cmd[1:])
-	case "SET":
-		return handleCommandSet(cmd[1:])
-	case "CONFIG":
-		return handleCommandConfig(cmd[1:])
-	case "INFO":
-		return handleCommandInfo(cmd[1:])
-	case "REPLCONF":
-		return handleCommandReplConfig(cmd[1:])
-	case "PSYNC":
-		return handleCommandSync(cmd[1:], conn)
-	case "WAIT":
-		return handleCommandWait(cmd[1:])
-	case "TYPE":
-		return handleCommandType(cmd[1:])
-	case "XADD":
-		return handleCommandStreamAdd(cmd[1:])
-	default:
+	cmd := input.Content.([]resp.Resp)
+	for _, arg := range cmd {
+		if _, ok := arg.Content.(string); !ok {
+			return nil, resp.NewError("ERR", "Protocol error: expected bulk string arguments")
+		}
+	}
+
+	if len(cmd) == 0 {
 		return nil, nil
 	}
+
+	entry, ok := lookupCommand(cmd[0].Content.(string))
+	if c.multi && (!ok || !entry.hasFlag(FLAG_NO_QUEUE)) {
+		return queueCommand(cmd, c)
+	}
+
+	if !ok {
+		return resp.EncodeError(unknownCommandError(cmd)), nil
+	}
+
+	if !entry.checkArity(len(cmd)) {
+		stats.recordRejected(entry.name)
+		return resp.EncodeError(arityError(entry.name)), nil
+	}
+
+	return dispatch(entry, cmd, c)
 }
 
-func handleCommandStreamAdd(cmd []utils.Resp) ([]byte, error) {
-	if len(cmd) < 2 {
-		return nil, errors.New("error SET, was expecting more arguments")
+func isErrorReply(out []byte) bool {
+	return len(out) > 0 && out[0] == resp.ERROR
+}
+
+// PING [message] replies PONG, or the message as a bulk string. RESP2
+// subscribers get a pong array instead, as replies can't be told apart from
+// messages otherwise.
+func handleCommandPing(cmd []resp.Resp, c *client) ([]byte, error) {
+	message := ""
+	if len(cmd) > 0 {
+		message = cmd[0].Content.(string)
+	}
+
+	if c.subscribed() && !c.resp3.Load() {
+		return pubsubReply(false, "pong", message), nil
 	}
+	if len(cmd) > 0 {
+		return resp.AppendBulkString(nil, message), nil
+	}
+	return resp.AppendSimpleString(nil, "PONG"), nil
+}
 
+func handleCommandEcho(cmd []resp.Resp, c *client) ([]byte, error) {
+	return resp.AppendBulkString(nil, cmd[0].Content.(string)), nil
+}
+
+func handleCommandTime(cmd []resp.Resp, c *client) ([]byte, error) {
+	now := time.Now()
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: strconv.FormatInt(now.Unix(), 10), DataType: resp.STRING},
+		{Content: strconv.Itoa(now.Nanosecond() / 1000), DataType: resp.STRING},
+	}), nil
+}
+
+// XADD key id field value [field value ...] appends an entry to a stream,
+// creating it if needed, and replies with the ID of the entry. The ID is *
+// to generate it, <ms>-* to generate only its sequence number, or explicit.
+func handleCommandStreamAdd(cmd []resp.Resp, c *client) ([]byte, error) {
 	key := cmd[0].Content.(string)
 	id := cmd[1].Content.(string)
+	if len(cmd[2:])%2 != 0 {
+		return nil, arityError("xadd")
+	}
+	fields := make([]string, 0, len(cmd[2:]))
+	for _, arg := range cmd[2:] {
+		fields = append(fields, arg.Content.(string))
+	}
+
+	stream, ok, err := cache.GetStream(key)
+	if err != nil {
+		return nil, err
+	}
 
-	stream, ok := cache.getKey(key)
+	var streamId store.StreamID
 	if !ok {
-		stream = cache.setKey(key,
-			&Stream{make([]streamEntry, 0, 1)},
-			time.Time{},
-			ENTRY_STREAM)
+		// The stream is only created once the ID is known to be valid
+		stream = store.NewStream()
+		if streamId, err = stream.Append(id, fields); err != nil {
+			return nil, err
+		}
+		cache.Set(key, stream, time.Time{}, store.TYPE_STREAM)
+	} else {
+		err = cache.Modify(key, func() (err error) {
+			streamId, err = stream.Append(id, fields)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	streamId, err := stream.value.(*Stream).append(id)
-	if err != nil {
-		return utils.EncodeResp(err.Error(), utils.ERROR)
+	if strings.Contains(id, "*") {
+		effect := []string{"XADD", key, streamId.String()}
+		for _, arg := range cmd[2:] {
+			effect = append(effect, arg.Content.(string))
+		}
+		c.propagateAs(effect...)
 	}
-	return utils.EncodeResp(streamId.String(), utils.STRING)
+	return resp.AppendBulkString(nil, streamId.String()), nil
 }
 
-func handleCommandSet(cmd []utils.Resp) ([]byte, error) {
-	if len(cmd) < 2 {
-		return nil, errors.New("error SET, was expecting more arguments")
+// XRANGE key start end [COUNT count] replies with the entries of a stream
+// between two IDs, both included. - and + are the smallest and greatest IDs,
+// an ID without sequence number means the first or last one of that
+// millisecond, and an ID prefixed with ( is excluded.
+func handleCommandStreamRange(cmd []resp.Resp, c *client) ([]byte, error) {
+	start, err := parseStreamBound(cmd[1].Content.(string), true)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseStreamBound(cmd[2].Content.(string), false)
+	if err != nil {
+		return nil, err
 	}
 
-	var exp time.Time
-	if len(cmd) >= 4 && cmd[3].DataType == utils.STRING {
-		content, err := strconv.Atoi(cmd[3].Content.(string))
-		if err == nil {
-			exp = time.Now().Add(time.Millisecond * time.Duration(content))
+	count := -1
+	for i := 3; i < len(cmd); i += 2 {
+		if !strings.EqualFold(cmd[i].Content.(string), "count") || i+1 == len(cmd) {
+			return nil, resp.ErrSyntax
 		}
+		n, err := strconv.Atoi(cmd[i+1].Content.(string))
+		if err != nil {
+			return nil, resp.ErrNotInteger
+		}
+		count = max(n, 0)
+	}
+
+	stream, ok, err := cache.GetStream(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
 	}
-	cache.setKey(cmd[0].Content.(string), cmd[1].Content.(string), exp, ENTRY_STRING)
 
-	if node.role == MASTER {
-		bcast, err := utils.EncodeResp(
-			append([]utils.Resp{{
-				Content: "SET", DataType: utils.STRING,
-			}}, cmd...), utils.ARRAY)
+	reply := []resp.Resp{}
+	if ok {
+		for _, entry := range stream.Range(start, end, count) {
+			reply = append(reply, encodeStreamEntry(entry))
+		}
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// replies with the entries of each stream added after the given ID, $ being
+// the last ID of the stream. With BLOCK, a client finding no such entry
+// waits for one to be added, for up to the timeout or forever if it is 0.
+func handleCommandStreamRead(cmd []resp.Resp, c *client) ([]byte, error) {
+	count, block := -1, int64(-1)
+	i := 0
+	for ; i < len(cmd); i += 2 {
+		option := strings.ToLower(cmd[i].Content.(string))
+		if option == "streams" {
+			break
+		}
+		if (option != "count" && option != "block") || i+1 == len(cmd) {
+			return nil, resp.ErrSyntax
+		}
+
+		n, err := strconv.ParseInt(cmd[i+1].Content.(string), 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, resp.ErrNotInteger
 		}
-		for _, replica := range node.replicas {
-			replica.Write(bcast)
+		if option == "count" {
+			// As in Redis, a count of zero or less means no limit
+			count = int(n)
+			if n <= 0 {
+				count = -1
+			}
+		} else if n < 0 {
+			return nil, resp.NewError("ERR", "timeout is negative")
+		} else {
+			block = n
 		}
 	}
 
-	return utils.EncodeResp("OK", utils.SIMPLE_STRING)
-}
-
-func handleCommandGet(cmd []utils.Resp) ([]byte, error) {
-	if len(cmd) < 1 {
-		return nil, errors.New("error GET, was expecting more arguments")
+	streams := cmd[min(i+1, len(cmd)):]
+	if i == len(cmd) || len(streams) == 0 {
+		return nil, resp.ErrSyntax
+	}
+	if len(streams)%2 != 0 {
+		return nil, resp.NewError("ERR", "Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
 	}
 
-	key := cmd[0].Content.(string)
-	stored, ok := cache.getKey(key)
+	keys := make([]string, len(streams)/2)
+	ids := make([]store.StreamID, len(keys))
+	for j := range keys {
+		keys[j] = streams[j].Content.(string)
+		stream, ok, err := cache.GetStream(keys[j])
+		if err != nil {
+			return nil, err
+		}
 
-	if !ok {
-		return NULL_RESP, nil
+		if id := streams[len(keys)+j].Content.(string); id == "$" {
+			if ok {
+				ids[j] = stream.LastID()
+			}
+		} else if ids[j], err = store.ParseStreamID(id, 0); err != nil {
+			return nil, err
+		}
 	}
 
-	if !stored.exp.IsZero() && time.Now().After(stored.exp) {
-		cache.deleteKey(key)
-		return NULL_RESP, nil
+	read := func() ([]byte, error) {
+		reply := []resp.Resp{}
+		for j, key := range keys {
+			// The key may have been replaced by another type while blocked
+			stream, ok, err := cache.GetStream(key)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				continue
+			}
+			entries := stream.After(ids[j], count)
+			if len(entries) == 0 {
+				continue
+			}
+
+			encoded := make([]resp.Resp, 0, len(entries))
+			for _, entry := range entries {
+				encoded = append(encoded, encodeStreamEntry(entry))
+			}
+			reply = append(reply, resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+				{Content: key, DataType: resp.STRING},
+				{Content: encoded, DataType: resp.ARRAY},
+			}})
+		}
+		if len(reply) == 0 {
+			return nil, nil
+		}
+		return resp.AppendArray(nil, reply), nil
 	}
 
-	return utils.EncodeResp(stored.value, utils.STRING)
+	if out, err := read(); err != nil || out != nil || block < 0 {
+		if err == nil && out == nil {
+			out = NULL_ARRAY_RESP
+		}
+		return out, err
+	}
+	return blockClient(c, &blockedClient{
+		keys: keys,
+		serve: func() []byte {
+			out, err := read()
+			if err != nil {
+				return resp.EncodeError(err)
+			}
+			return out
+		},
+		timeout: func() []byte { return NULL_ARRAY_RESP },
+	}, time.Duration(block)*time.Millisecond)
 }
 
-func handleCommandWait(cmd []utils.Resp) ([]byte, error) {
-	return utils.EncodeResp(len(node.replicas), utils.INTEGER)
+// xreadKeys returns the keys of a full XREAD command, the first half of the
+// arguments following STREAMS
+func xreadKeys(cmd []resp.Resp) []string {
+	for i := 1; i < len(cmd); i++ {
+		if strings.EqualFold(cmd[i].Content.(string), "streams") {
+			streams := cmd[i+1:]
+			keys := make([]string, 0, len(streams)/2)
+			for _, arg := range streams[:len(streams)/2] {
+				keys = append(keys, arg.Content.(string))
+			}
+			return keys
+		}
+	}
+	return nil
 }
 
-func handleCommandInfo(cmd []utils.Resp) ([]byte, error) {
-	if len(cmd) == 0 || cmd[0].Content != "replication" {
-		return NULL_RESP, nil
+// parseStreamBound parses the start or end of a stream range
+func parseStreamBound(s string, isStart bool) (store.StreamID, error) {
+	switch s {
+	case "-":
+		return store.StreamID{}, nil
+	case "+":
+		return store.StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}, nil
 	}
 
-	resp := fmt.Sprintf("role:%s\n", node.role)
+	exclusive := strings.HasPrefix(s, "(")
+	defaultSeq := uint64(0)
+	if !isStart {
+		defaultSeq = math.MaxUint64
+	}
+	id, err := store.ParseStreamID(strings.TrimPrefix(s, "("), defaultSeq)
+	if err != nil || !exclusive {
+		return id, err
+	}
 
-	if node.role == MASTER {
-		resp = fmt.Sprintf("%smaster_replid:%s\nmaster_repl_offset:%d\n", resp, node.id, node.offset)
+	// The bound excluded is the one next to it, in the range
+	if isStart {
+		if id.Seq < math.MaxUint64 {
+			return store.StreamID{Ms: id.Ms, Seq: id.Seq + 1}, nil
+		}
+		if id.Ms < math.MaxUint64 {
+			return store.StreamID{Ms: id.Ms + 1}, nil
+		}
+		return id, resp.NewError("ERR", "invalid start ID for the interval")
+	}
+	if id.Seq > 0 {
+		return store.StreamID{Ms: id.Ms, Seq: id.Seq - 1}, nil
+	}
+	if id.Ms > 0 {
+		return store.StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, nil
 	}
+	return id, resp.NewError("ERR", "invalid end ID for the interval")
+}
 
-	return utils.EncodeResp(resp, utils.STRING)
+// encodeStreamEntry returns an entry as streams commands reply with it: its
+// ID followed by the array of its fields and values
+func encodeStreamEntry(entry store.StreamEntry) resp.Resp {
+	fields := make([]resp.Resp, 0, len(entry.Fields))
+	for _, field := range entry.Fields {
+		fields = append(fields, resp.Resp{Content: field, DataType: resp.STRING})
+	}
+	return resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+		{Content: entry.ID.String(), DataType: resp.STRING},
+		{Content: fields, DataType: resp.ARRAY},
+	}}
 }
 
-func handleCommandReplConfig(cmd []utils.Resp) ([]byte, error) {
-	subCmd := strings.ToLower(cmd[0].Content.(string))
-	if subCmd == "listening-port" || subCmd == "capa" {
-		return utils.EncodeResp("OK", utils.SIMPLE_STRING)
+func handleCommandSet(cmd []resp.Resp, c *client) ([]byte, error) {
+	key, value := cmd[0].Content.(string), cmd[1].Content.(string)
+
+	var exp time.Time
+	relative := false
+	for i := 2; i < len(cmd); i++ {
+		opt := strings.ToUpper(cmd[i].Content.(string))
+		if (opt != "EX" && opt != "PX" && opt != "EXAT" && opt != "PXAT") || i+1 == len(cmd) || !exp.IsZero() {
+			return nil, resp.ErrSyntax
+		}
+
+		i++
+		n, err := strconv.ParseInt(cmd[i].Content.(string), 10, 64)
+		if err != nil || n <= 0 {
+			return nil, resp.NewError("ERR", "invalid expire time in 'set' command")
+		}
+
+		unit := time.Second
+		if opt[0] == 'P' {
+			unit = time.Millisecond
+		}
+		relative = !strings.HasSuffix(opt, "AT")
+		if exp, err = expireTime(n, unit, !relative, "set"); err != nil {
+			return nil, err
+		}
+	}
+	cache.Set(key, interned.intern(value), exp, store.TYPE_STRING)
+
+	if relative {
+		c.propagateAs("SET", key, value, "PXAT", strconv.FormatInt(exp.UnixMilli(), 10))
 	}
 
-	if subCmd == "getack" {
-		return utils.EncodeResp([]utils.Resp{
-			{Content: "REPLCONF", DataType: utils.STRING},
-			{Content: "ACK", DataType: utils.STRING},
-			{Content: strconv.Itoa(node.offset), DataType: utils.STRING},
-		}, utils.ARRAY)
+	return OK_RESP, nil
+}
+
+func handleCommandDel(cmd []resp.Resp, c *client) ([]byte, error) {
+	deleted, found := 0, 0
+	for _, arg := range cmd {
+		key := arg.Content.(string)
+		if entry, ok := cache.Get(key); ok {
+			if !entry.Expired() {
+				deleted++
+			}
+			found++
+			cache.Delete(key)
+		}
 	}
 
-	return nil, nil
+	// Expired keys aren't counted, but replicas keep them until deleted by
+	// their master
+	if found == 0 {
+		c.propagateAs()
+	}
+	return resp.AppendInteger(nil, int64(deleted)), nil
 }
 
-func handleCommandSync(cmd []utils.Resp, conn net.Conn) ([]byte, error) {
-	resync, err := utils.EncodeResp(
-		fmt.Sprintf("FULLRESYNC %s %d", node.id, node.offset),
-		utils.SIMPLE_STRING,
-	)
+func handleCommandGet(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	value, ok, err := cache.GetString(key)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = conn.Write(resync)
+	if !ok {
+		counters.keyspaceMisses.Add(1)
+		return NULL_RESP, nil
+	}
+
+	counters.keyspaceHits.Add(1)
+	return resp.AppendBulkString(nil, value), nil
+}
+
+// GETRANGE key start end returns the substring of the value between the
+// given offsets, both included
+func handleCommandGetRange(cmd []resp.Resp, c *client) ([]byte, error) {
+	start, end, err := parseRange(cmd[1], cmd[2])
 	if err != nil {
 		return nil, err
 	}
 
-	decoded, err := hex.DecodeString(EMPTY_RDB)
+	value, _, err := cache.GetString(cmd[0].Content.(string))
 	if err != nil {
 		return nil, err
 	}
 
-	node.replicas = append(node.replicas, conn)
-	return utils.EncodeRdb(decoded), nil
+	start, end, ok := normalizeRange(start, end, len(value))
+	if !ok {
+		return resp.AppendBulkString(nil, ""), nil
+	}
+	return resp.AppendBulkString(nil, value[start:end+1]), nil
+}
+
+type infoSection struct {
+	name      string
+	title     string
+	isDefault bool
+	render    func() string
 }
 
-func handleCommandConfig(cmd []utils.Resp) ([]byte, error) {
-	if len(cmd) < 2 || cmd[0].Content != "GET" {
-		return NULL_RESP, nil
+var infoSections = []infoSection{
+	{"server", "Server", true, serverInfo},
+	{"memory", "Memory", true, memoryInfo},
+	{"persistence", "Persistence", true, persistenceInfo},
+	{"stats", "Stats", true, statsInfo},
+	{"replication", "Replication", true, replicationInfo},
+	{"keyspace", "Keyspace", true, keyspaceInfo},
+	{"commandstats", "Commandstats", false, stats.commandStatsInfo},
+	{"latencystats", "Latencystats", false, stats.latencyStatsInfo},
+}
+
+func handleCommandInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	requested := map[string]bool{}
+	for _, arg := range cmd {
+		requested[strings.ToLower(arg.Content.(string))] = true
 	}
 
-	entry, ok := config[cmd[1].Content.(string)]
-	if !ok {
-		return NULL_RESP, nil
+	all := requested["all"] || requested["everything"]
+	defaults := len(cmd) == 0 || requested["default"]
+
+	var sb strings.Builder
+	for _, section := range infoSections {
+		if !all && !requested[section.name] && !(defaults && section.isDefault) {
+			continue
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteString("\n")
+		}
+		fmt.Fprintf(&sb, "# %s\n%s", section.title, section.render())
+	}
+
+	// Sections are written with \n, while clients such as Sentinel split
+	// the reply on \r\n as Redis uses
+	return resp.AppendBulkString(nil, strings.ReplaceAll(sb.String(), "\n", "\r\n")), nil
+}
+
+func serverInfo() string {
+	mode := "standalone"
+	if clusterState != nil {
+		mode = "cluster"
+	}
+	return fmt.Sprintf("redis_version:%s\n"+
+		"redis_mode:%s\n"+
+		"process_id:%d\n"+
+		"run_id:%s\n"+
+		"tcp_port:%s\n"+
+		"uptime_in_seconds:%d\n",
+		REDIS_VERSION, mode, os.Getpid(), runID, node.port, int64(time.Since(startTime).Seconds()))
+}
+
+func keyspaceInfo() string {
+	keys, expires, avgTTL := cache.Stats()
+	if keys == 0 {
+		return ""
 	}
 
-	return utils.EncodeResp([]utils.Resp{cmd[1], {Content: entry, DataType: utils.STRING}}, utils.ARRAY)
+	return fmt.Sprintf("db0:keys=%d,expires=%d,avg_ttl=%d\n", keys, expires, avgTTL)
 }
 
-func handleCommandType(cmd []utils.Resp) ([]byte, error) {
+func handleCommandConfig(cmd []resp.Resp, c *client) ([]byte, error) {
+	if len(cmd) == 1 && strings.ToUpper(cmd[0].Content.(string)) == "RESETSTAT" {
+		stats.reset()
+		counters.reset()
+		return OK_RESP, nil
+	}
+
+	if len(cmd) > 0 && strings.ToUpper(cmd[0].Content.(string)) == "SET" {
+		return configSet(cmd[1:])
+	}
+
+	if len(cmd) > 0 && strings.ToUpper(cmd[0].Content.(string)) == "GET" {
+		return configGet(cmd[1:])
+	}
+
+	return NULL_RESP, nil
+}
+
+func handleCommandType(cmd []resp.Resp, c *client) ([]byte, error) {
 	key := cmd[0].Content.(string)
 
-	val, ok := cache.getKey(key)
+	val, ok := cache.Get(key)
 
-	if !ok {
-		return utils.EncodeResp("none", utils.SIMPLE_STRING)
+	if !ok || val.Expired() {
+		counters.keyspaceMisses.Add(1)
+		return resp.AppendSimpleString(nil, "none"), nil
 	}
 
-	return utils.EncodeResp(val.entryType.String(), utils.STRING)
+	counters.keyspaceHits.Add(1)
+
+	return resp.AppendBulkString(nil, val.TypeName()), nil
 }
 
 func generateRandomId() string {
@@ -512,12 +933,3 @@ func generateRandomId() string {
 	}
 	return string(b)
 }
-
-func encodeCmd(cmd []utils.Resp) []byte {
-	encodedPing, err := utils.EncodeResp(cmd, utils.ARRAY)
-	if err != nil {
-		fmt.Println("error encoding ping, ", err)
-		os.Exit(1)
-	}
-	return encodedPing
-}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+var testServer struct {
+	sync.Once
+	addr string
+	err  error
+}
+
+// startTestServer starts a master listening on a random loopback port, shared
+// by every test of the package, and returns its address
+func startTestServer(tb testing.TB) string {
+	tb.Helper()
+	testServer.Do(func() {
+		initializeServer([]string{"--bind", "127.0.0.1", "--port", "0"})
+		if testServer.err = initKeyspace(); testServer.err != nil {
+			return
+		}
+
+		listener, err := listen("127.0.0.1", "0")
+		if err != nil {
+			testServer.err = err
+			return
+		}
+		testServer.addr = listener.Addr().String()
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				go handleClientConn(conn, false)
+			}
+		}()
+	})
+	if testServer.err != nil {
+		tb.Fatal(testServer.err)
+	}
+	return testServer.addr
+}
+
+type testClient struct {
+	conn    net.Conn
+	encoder *resp.Encoder
+	decoder *resp.Decoder
+}
+
+func newTestClient(tb testing.TB) *testClient {
+	tb.Helper()
+	conn, err := net.Dial("tcp", startTestServer(tb))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return &testClient{conn, resp.NewEncoder(conn), resp.NewDecoder(conn)}
+}
+
+// send writes a command without waiting for its reply
+func (tc *testClient) send(tb testing.TB, command string) {
+	tb.Helper()
+	tc.encoder.WriteCommand(strings.Fields(command)...)
+	if err := tc.encoder.Flush(); err != nil {
+		tb.Fatal(err)
+	}
+}
+
+func (tc *testClient) receive(tb testing.TB) resp.Resp {
+	tb.Helper()
+	reply, err := tc.decoder.Decode()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return reply
+}
+
+// do sends a command, with its arguments separated by spaces, and returns
+// its reply
+func (tc *testClient) do(tb testing.TB, command string) resp.Resp {
+	tb.Helper()
+	tc.send(tb, command)
+	return tc.receive(tb)
+}
+
+// BenchmarkPipelinedSetGet measures the throughput of a client sending SETs
+// and GETs in pipelines of 16 commands, like redis-benchmark -P 16
+func BenchmarkPipelinedSetGet(b *testing.B) {
+	const pipeline = 16
+	tc := newTestClient(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := 0; j < pipeline/2; j++ {
+			key := fmt.Sprintf("key:%d", (i*pipeline+j)%10000)
+			tc.encoder.WriteCommand("SET", key, "xxx")
+			tc.encoder.WriteCommand("GET", key)
+		}
+		if err := tc.encoder.Flush(); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < pipeline; j++ {
+			if reply := tc.receive(b); reply.DataType == resp.ERROR {
+				b.Fatal(reply.Content)
+			}
+		}
+	}
+	b.ReportMetric(float64(b.N*pipeline)/b.Elapsed().Seconds(), "commands/s")
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/sketch"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+)
+
+// Type names of count-min sketches and Top-K, as used by RedisBloom
+const (
+	CMS_TYPE_NAME  = "CMSk-TYPE"
+	TOPK_TYPE_NAME = "TopK-TYPE"
+)
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   CMS_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			s, err := sketch.UnmarshalCountMinSketch(data)
+			if err != nil {
+				return nil, err
+			}
+			return &cmsValue{s}, nil
+		},
+	})
+	store.RegisterModuleType(store.ModuleType{
+		Name:   TOPK_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			t, err := sketch.UnmarshalTopK(data)
+			if err != nil {
+				return nil, err
+			}
+			return &topkValue{t}, nil
+		},
+	})
+}
+
+type cmsValue struct {
+	*sketch.CountMinSketch
+}
+
+func (v *cmsValue) TypeName() string {
+	return CMS_TYPE_NAME
+}
+
+func (v *cmsValue) Clone() store.ModuleValue {
+	return &cmsValue{v.CountMinSketch.Clone()}
+}
+
+func (v *cmsValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.CountMinSketch)) + v.Size()
+}
+
+type topkValue struct {
+	*sketch.TopK
+}
+
+func (v *topkValue) TypeName() string {
+	return TOPK_TYPE_NAME
+}
+
+func (v *topkValue) Clone() store.ModuleValue {
+	return &topkValue{v.TopK.Clone()}
+}
+
+func (v *topkValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.TopK)) + v.Size()
+}
+
+func getCMS(key string) (*cmsValue, error) {
+	value, ok, err := cache.GetModule(key, CMS_TYPE_NAME)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "CMS: key does not exist")
+	}
+	return value.(*cmsValue), nil
+}
+
+func getTopK(key string) (*topkValue, error) {
+	value, ok, err := cache.GetModule(key, TOPK_TYPE_NAME)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "TopK: key does not exist")
+	}
+	return value.(*topkValue), nil
+}
+
+// createSketch stores a new sketch unless the key exists
+func createSketch(key string, value store.ModuleValue, prefix string) ([]byte, error) {
+	if entry, ok := cache.Get(key); ok && !entry.Expired() {
+		return nil, resp.NewError("ERR", prefix+": key already exists")
+	}
+	cache.Set(key, value, time.Time{}, store.TYPE_MODULE)
+	return OK_RESP, nil
+}
+
+// CMS.INITBYDIM key width depth
+func handleCommandCMSInitByDim(cmd []resp.Resp, c *client) ([]byte, error) {
+	width, errWidth := strconv.ParseUint(cmd[1].Content.(string), 10, 64)
+	depth, errDepth := strconv.ParseUint(cmd[2].Content.(string), 10, 64)
+	if errWidth != nil || errDepth != nil || width == 0 || depth == 0 {
+		return nil, resp.NewError("ERR", "CMS: invalid width/depth")
+	}
+	return createSketch(cmd[0].Content.(string), &cmsValue{sketch.NewCountMinSketch(width, depth)}, "CMS")
+}
+
+// CMS.INITBYPROB key error probability
+func handleCommandCMSInitByProb(cmd []resp.Resp, c *client) ([]byte, error) {
+	errorRate, err := strconv.ParseFloat(cmd[1].Content.(string), 64)
+	if err != nil || errorRate <= 0 || errorRate >= 1 {
+		return nil, resp.NewError("ERR", "CMS: invalid overestimation value")
+	}
+	probability, err := strconv.ParseFloat(cmd[2].Content.(string), 64)
+	if err != nil || probability <= 0 || probability >= 1 {
+		return nil, resp.NewError("ERR", "CMS: invalid prob value")
+	}
+
+	width, depth := sketch.DimensionsForError(errorRate, probability)
+	return createSketch(cmd[0].Content.(string), &cmsValue{sketch.NewCountMinSketch(width, depth)}, "CMS")
+}
+
+// CMS.INCRBY key item increment [item increment ...]
+func handleCommandCMSIncrBy(cmd []resp.Resp, c *client) ([]byte, error) {
+	if len(cmd)%2 == 0 {
+		return nil, resp.NewError("ERR", "wrong number of arguments for 'cms.incrby' command")
+	}
+
+	key := cmd[0].Content.(string)
+	s, err := getCMS(key)
+	if err != nil {
+		return nil, err
+	}
+
+	increments := make([]uint64, 0, len(cmd)/2)
+	for i := 2; i < len(cmd); i += 2 {
+		n, err := strconv.ParseUint(cmd[i].Content.(string), 10, 64)
+		if err != nil {
+			return nil, resp.NewError("ERR", "CMS: Cannot parse number")
+		}
+		increments = append(increments, n)
+	}
+
+	estimates := make([]resp.Resp, 0, len(increments))
+	cache.Modify(key, func() error {
+		for i, n := range increments {
+			estimate := s.IncrBy(cmd[1+2*i].Content.(string), n)
+			estimates = append(estimates, resp.Resp{Content: int(estimate), DataType: resp.INTEGER})
+		}
+		return nil
+	})
+	return resp.AppendArray(nil, estimates), nil
+}
+
+// CMS.QUERY key item [item ...]
+func handleCommandCMSQuery(cmd []resp.Resp, c *client) ([]byte, error) {
+	s, err := getCMS(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	estimates := make([]resp.Resp, 0, len(cmd)-1)
+	for _, item := range cmd[1:] {
+		estimates = append(estimates, resp.Resp{Content: int(s.Query(item.Content.(string))), DataType: resp.INTEGER})
+	}
+	return resp.AppendArray(nil, estimates), nil
+}
+
+// CMS.INFO key
+func handleCommandCMSInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	s, err := getCMS(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "width", DataType: resp.SIMPLE_STRING},
+		{Content: int(s.Width), DataType: resp.INTEGER},
+		{Content: "depth", DataType: resp.SIMPLE_STRING},
+		{Content: int(s.Depth), DataType: resp.INTEGER},
+		{Content: "count", DataType: resp.SIMPLE_STRING},
+		{Content: int(s.Count), DataType: resp.INTEGER},
+	}), nil
+}
+
+// TOPK.RESERVE key topk [width depth decay]
+func handleCommandTopKReserve(cmd []resp.Resp, c *client) ([]byte, error) {
+	k, err := strconv.ParseUint(cmd[1].Content.(string), 10, 64)
+	if err != nil || k == 0 {
+		return nil, resp.NewError("ERR", "TopK: invalid k")
+	}
+
+	width, depth, decay := uint64(sketch.DEFAULT_TOPK_WIDTH), uint64(sketch.DEFAULT_TOPK_DEPTH), sketch.DEFAULT_TOPK_DECAY
+	switch len(cmd) {
+	case 2:
+	case 5:
+		var errWidth, errDepth error
+		width, errWidth = strconv.ParseUint(cmd[2].Content.(string), 10, 64)
+		depth, errDepth = strconv.ParseUint(cmd[3].Content.(string), 10, 64)
+		if errWidth != nil || errDepth != nil || width == 0 || depth == 0 {
+			return nil, resp.NewError("ERR", "TopK: invalid width/depth")
+		}
+		decay, err = strconv.ParseFloat(cmd[4].Content.(string), 64)
+		if err != nil || decay <= 0 || decay > 1 {
+			return nil, resp.NewError("ERR", "TopK: invalid decay value. must be '<= 1' & '> 0'")
+		}
+	default:
+		return nil, resp.NewError("ERR", "wrong number of arguments for 'topk.reserve' command")
+	}
+
+	return createSketch(cmd[0].Content.(string), &topkValue{sketch.NewTopK(k, width, depth, decay)}, "TopK")
+}
+
+// TOPK.ADD key item [item ...]
+func handleCommandTopKAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	t, err := getTopK(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var res bytes.Buffer
+	encoder := resp.NewEncoder(&res)
+	encoder.WriteArrayHeader(len(cmd) - 1)
+	cache.Modify(key, func() error {
+		for _, item := range cmd[1:] {
+			if expelled, ok := t.IncrBy(item.Content.(string), 1); ok {
+				encoder.WriteBulkString(expelled)
+			} else {
+				encoder.WriteNull()
+			}
+		}
+		return nil
+	})
+
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return res.Bytes(), nil
+}
+
+// TOPK.QUERY key item [item ...]
+func handleCommandTopKQuery(cmd []resp.Resp, c *client) ([]byte, error) {
+	t, err := getTopK(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	found := make([]resp.Resp, 0, len(cmd)-1)
+	for _, item := range cmd[1:] {
+		found = append(found, resp.Resp{Content: boolToInt(t.Contains(item.Content.(string))), DataType: resp.INTEGER})
+	}
+	return resp.AppendArray(nil, found), nil
+}
+
+// TOPK.LIST key [WITHCOUNT]
+func handleCommandTopKList(cmd []resp.Resp, c *client) ([]byte, error) {
+	withCount := false
+	if len(cmd) > 1 {
+		if !strings.EqualFold(cmd[1].Content.(string), "WITHCOUNT") {
+			return nil, resp.ErrSyntax
+		}
+		withCount = true
+	}
+
+	t, err := getTopK(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []resp.Resp
+	for _, hitter := range t.List() {
+		items = append(items, resp.Resp{Content: hitter.Item, DataType: resp.STRING})
+		if withCount {
+			items = append(items, resp.Resp{Content: int(hitter.Count), DataType: resp.INTEGER})
+		}
+	}
+	return resp.AppendArray(nil, items), nil
+}
+
+// TOPK.INFO key
+func handleCommandTopKInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	t, err := getTopK(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "k", DataType: resp.SIMPLE_STRING},
+		{Content: int(t.K), DataType: resp.INTEGER},
+		{Content: "width", DataType: resp.SIMPLE_STRING},
+		{Content: int(t.Width), DataType: resp.INTEGER},
+		{Content: "depth", DataType: resp.SIMPLE_STRING},
+		{Content: int(t.Depth), DataType: resp.INTEGER},
+		{Content: "decay", DataType: resp.SIMPLE_STRING},
+		{Content: strconv.FormatFloat(t.Decay, 'f', -1, 64), DataType: resp.STRING},
+	}), nil
+}
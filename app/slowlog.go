@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+const (
+	SLOWLOG_DEFAULT_SLOWER_THAN = 10000
+	SLOWLOG_DEFAULT_MAX_LEN     = 128
+	// Arguments beyond these limits are summarized, as in Redis
+	SLOWLOG_MAX_ARGS       = 32
+	SLOWLOG_MAX_ARG_LENGTH = 128
+)
+
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+	// Set for commands recorded because they exceeded the watchdog timeout
+	watchdog bool
+}
+
+// slowlogRegistry keeps the most recent commands that took longer than
+// slowlog-log-slower-than microseconds, newest first.
+type slowlogRegistry struct {
+	sync.Mutex
+	entries []slowlogEntry
+	nextID  int64
+
+	// A negative value disables the slow log, zero logs every command
+	slowerThan atomic.Int64
+	maxLen     atomic.Int64
+}
+
+var slowlog = newSlowlog()
+
+func newSlowlog() *slowlogRegistry {
+	s := &slowlogRegistry{}
+	s.slowerThan.Store(SLOWLOG_DEFAULT_SLOWER_THAN)
+	s.maxLen.Store(SLOWLOG_DEFAULT_MAX_LEN)
+	return s
+}
+
+func slowlogMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	start := time.Now()
+	out, err := next()
+
+	elapsed := time.Since(start)
+	flagged := watchdog.slowlog.Load() && watchdogExceeded(elapsed)
+	threshold := slowlog.slowerThan.Load()
+	if !entry.hasFlag(FLAG_SENSITIVE) && (flagged || (threshold >= 0 && elapsed.Microseconds() >= threshold)) {
+		slowlog.add(start, elapsed, cmd, c, flagged)
+	}
+	return out, err
+}
+
+func (s *slowlogRegistry) add(start time.Time, elapsed time.Duration, cmd []resp.Resp, c *client, watchdog bool) {
+	args := make([]string, 0, min(len(cmd), SLOWLOG_MAX_ARGS))
+	for i, arg := range cmd {
+		if i == SLOWLOG_MAX_ARGS-1 && len(cmd) > SLOWLOG_MAX_ARGS {
+			args = append(args, fmt.Sprintf("... (%d more arguments)", len(cmd)-i))
+			break
+		}
+
+		value := arg.Content.(string)
+		if len(value) > SLOWLOG_MAX_ARG_LENGTH {
+			value = fmt.Sprintf("%s... (%d more bytes)", value[:SLOWLOG_MAX_ARG_LENGTH], len(value)-SLOWLOG_MAX_ARG_LENGTH)
+		}
+		args = append(args, value)
+	}
+
+	addr := ""
+	if c.conn != nil {
+		addr = c.conn.RemoteAddr().String()
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	s.entries = append([]slowlogEntry{{s.nextID, start, elapsed, args, addr, c.clientName(), watchdog}}, s.entries...)
+	s.nextID++
+	s.trimLocked()
+}
+
+func (s *slowlogRegistry) trimLocked() {
+	if maxLen := int(max(s.maxLen.Load(), 0)); len(s.entries) > maxLen {
+		s.entries = s.entries[:maxLen]
+	}
+}
+
+// SLOWLOG GET [count] | LEN | RESET
+func handleCommandSlowlog(cmd []resp.Resp, c *client) ([]byte, error) {
+	subCmd := strings.ToLower(cmd[0].Content.(string))
+	switch {
+	case subCmd == "get" && len(cmd) <= 2:
+		count := 10
+		if len(cmd) == 2 {
+			n, err := strconv.Atoi(cmd[1].Content.(string))
+			if err != nil || n < -1 {
+				return nil, resp.NewError("ERR", "count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		return slowlog.get(count)
+	case subCmd == "len" && len(cmd) == 1:
+		slowlog.Lock()
+		defer slowlog.Unlock()
+		return resp.AppendInteger(nil, int64(len(slowlog.entries))), nil
+	case subCmd == "reset" && len(cmd) == 1:
+		slowlog.Lock()
+		defer slowlog.Unlock()
+		slowlog.entries = nil
+		return OK_RESP, nil
+	default:
+		return nil, resp.NewError("ERR", "unknown subcommand or wrong number of arguments for '"+cmd[0].Content.(string)+"'. Try SLOWLOG HELP.")
+	}
+}
+
+// get replies with up to count entries, or all of them if count is -1
+func (s *slowlogRegistry) get(count int) ([]byte, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if count < 0 || count > len(s.entries) {
+		count = len(s.entries)
+	}
+
+	reply := make([]resp.Resp, 0, count)
+	for _, entry := range s.entries[:count] {
+		args := make([]resp.Resp, 0, len(entry.args))
+		for _, arg := range entry.args {
+			args = append(args, resp.Resp{Content: arg, DataType: resp.STRING})
+		}
+
+		fields := []resp.Resp{
+			{Content: int(entry.id), DataType: resp.INTEGER},
+			{Content: int(entry.time.Unix()), DataType: resp.INTEGER},
+			{Content: int(entry.duration.Microseconds()), DataType: resp.INTEGER},
+			{Content: args, DataType: resp.ARRAY},
+			{Content: entry.addr, DataType: resp.STRING},
+			{Content: entry.name, DataType: resp.STRING},
+		}
+		// An extra field, which clients reading the usual six ignore
+		if entry.watchdog {
+			fields = append(fields, resp.Resp{Content: "watchdog", DataType: resp.STRING})
+		}
+		reply = append(reply, resp.Resp{DataType: resp.ARRAY, Content: fields})
+	}
+	return resp.AppendArray(nil, reply), nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Number of recent samples kept per command to compute latency percentiles.
+const LATENCY_SAMPLES = 1024
+
+var latencyPercentiles = []float64{50, 99, 99.9}
+
+type serverCounters struct {
+	keyspaceHits             atomic.Int64
+	keyspaceMisses           atomic.Int64
+	totalCommandsProcessed   atomic.Int64
+	totalConnectionsReceived atomic.Int64
+	totalNetInputBytes       atomic.Int64
+	totalNetOutputBytes      atomic.Int64
+	expiredKeysLazy          atomic.Int64
+	expiredKeysActive        atomic.Int64
+	evictedKeys              atomic.Int64
+	evictedClients           atomic.Int64
+}
+
+var counters serverCounters
+
+func (c *serverCounters) reset() {
+	c.keyspaceHits.Store(0)
+	c.keyspaceMisses.Store(0)
+	c.totalCommandsProcessed.Store(0)
+	c.totalConnectionsReceived.Store(0)
+	c.totalNetInputBytes.Store(0)
+	c.totalNetOutputBytes.Store(0)
+	c.expiredKeysLazy.Store(0)
+	c.expiredKeysActive.Store(0)
+	c.evictedKeys.Store(0)
+	c.evictedClients.Store(0)
+}
+
+func (c *serverCounters) info() string {
+	return fmt.Sprintf("total_connections_received:%d\n"+
+		"total_commands_processed:%d\n"+
+		"total_net_input_bytes:%d\n"+
+		"total_net_output_bytes:%d\n"+
+		"keyspace_hits:%d\n"+
+		"keyspace_misses:%d\n"+
+		"expired_keys:%d\n"+
+		"expired_keys_lazy:%d\n"+
+		"expired_keys_active:%d\n"+
+		"expired_stale_perc:%.2f\n"+
+		"evicted_keys:%d\n"+
+		"evicted_clients:%d\n",
+		c.totalConnectionsReceived.Load(),
+		c.totalCommandsProcessed.Load(),
+		c.totalNetInputBytes.Load(),
+		c.totalNetOutputBytes.Load(),
+		c.keyspaceHits.Load(),
+		c.keyspaceMisses.Load(),
+		c.expiredKeysLazy.Load()+c.expiredKeysActive.Load(),
+		c.expiredKeysLazy.Load(),
+		c.expiredKeysActive.Load(),
+		expiredStalePerc(),
+		c.evictedKeys.Load(),
+		c.evictedClients.Load(),
+	)
+}
+
+func statsInfo() string {
+	return counters.info() + pool.info() + connLimit.info()
+}
+
+type commandStats struct {
+	calls         int64
+	usec          int64
+	failedCalls   int64
+	rejectedCalls int64
+	samples       []int64
+	next          int
+}
+
+func (s *commandStats) addSample(usec int64) {
+	if len(s.samples) < LATENCY_SAMPLES {
+		s.samples = append(s.samples, usec)
+		return
+	}
+
+	s.samples[s.next] = usec
+	s.next = (s.next + 1) % LATENCY_SAMPLES
+}
+
+func percentile(sorted []int64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	idx := int(float64(len(sorted))*p/100+0.5) - 1
+	idx = max(0, min(idx, len(sorted)-1))
+	return float64(sorted[idx])
+}
+
+type statsRegistry struct {
+	sync.Mutex
+	commands map[string]*commandStats
+}
+
+var stats = statsRegistry{
+	commands: make(map[string]*commandStats),
+}
+
+func (r *statsRegistry) get(name string) *commandStats {
+	s, ok := r.commands[name]
+	if !ok {
+		s = &commandStats{}
+		r.commands[name] = s
+	}
+	return s
+}
+
+func (r *statsRegistry) record(name string, elapsed time.Duration, failed bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	s := r.get(name)
+	usec := elapsed.Microseconds()
+	s.calls++
+	s.usec += usec
+	if failed {
+		s.failedCalls++
+	}
+	s.addSample(usec)
+}
+
+// recordRejected counts a call refused before execution, e.g. because of a
+// wrong number of arguments.
+func (r *statsRegistry) recordRejected(name string) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.get(name).rejectedCalls++
+}
+
+func (r *statsRegistry) reset() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.commands = make(map[string]*commandStats)
+}
+
+func (r *statsRegistry) sortedNames() []string {
+	names := make([]string, 0, len(r.commands))
+	for name := range r.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// cmdstat_<name>:calls=<n>,usec=<n>,usec_per_call=<n>,rejected_calls=<n>,failed_calls=<n>
+func (r *statsRegistry) commandStatsInfo() string {
+	r.Lock()
+	defer r.Unlock()
+
+	var sb strings.Builder
+	for _, name := range r.sortedNames() {
+		s := r.commands[name]
+		usecPerCall := 0.0
+		if s.calls > 0 {
+			usecPerCall = float64(s.usec) / float64(s.calls)
+		}
+		fmt.Fprintf(&sb, "cmdstat_%s:calls=%d,usec=%d,usec_per_call=%.2f,rejected_calls=%d,failed_calls=%d\n",
+			name, s.calls, s.usec, usecPerCall, s.rejectedCalls, s.failedCalls)
+	}
+	return sb.String()
+}
+
+// latency_percentiles_usec_<name>:p50=<n>,p99=<n>,p99.9=<n>
+func (r *statsRegistry) latencyStatsInfo() string {
+	r.Lock()
+	defer r.Unlock()
+
+	var sb strings.Builder
+	for _, name := range r.sortedNames() {
+		s := r.commands[name]
+		sorted := slices.Clone(s.samples)
+		slices.Sort(sorted)
+
+		values := make([]string, 0, len(latencyPercentiles))
+		for _, p := range latencyPercentiles {
+			values = append(values, fmt.Sprintf("p%s=%.3f", formatPercentile(p), percentile(sorted, p)))
+		}
+		fmt.Fprintf(&sb, "latency_percentiles_usec_%s:%s\n", name, strings.Join(values, ","))
+	}
+	return sb.String()
+}
+
+func formatPercentile(p float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.3f", p), "0"), ".")
+}
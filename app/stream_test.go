@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+func TestXReadCount(t *testing.T) {
+	tc := newTestClient(t)
+	tc.do(t, "DEL counted")
+	tc.do(t, "XADD counted 1-1 a 1")
+	tc.do(t, "XADD counted 1-2 b 2")
+
+	for count, want := range map[string]int{"0": 2, "-1": 2, "1": 1} {
+		reply := tc.do(t, "XREAD COUNT "+count+" STREAMS counted 0")
+		streams, ok := reply.Content.([]resp.Resp)
+		if !ok || len(streams) != 1 {
+			t.Fatalf("XREAD COUNT %s = %v, want one stream", count, reply.Content)
+		}
+		entries := streams[0].Content.([]resp.Resp)[1].Content.([]resp.Resp)
+		if len(entries) != want {
+			t.Fatalf("XREAD COUNT %s returned %d entries, want %d", count, len(entries), want)
+		}
+	}
+}
+
+func TestXReadWrongType(t *testing.T) {
+	tc := newTestClient(t)
+	tc.do(t, "DEL replaced")
+
+	// Whether SET runs before XREAD blocks or while it's blocked, the
+	// reply is the same
+	tc.send(t, "XREAD BLOCK 0 STREAMS replaced $")
+	newTestClient(t).do(t, "SET replaced v")
+	reply := tc.receive(t)
+	if reply.DataType != resp.ERROR || !strings.HasPrefix(reply.Content.(string), "WRONGTYPE") {
+		t.Fatalf("XREAD of a key that became a string = %v, want -WRONGTYPE", reply.Content)
+	}
+}
+
+func TestXAddExhaustedStream(t *testing.T) {
+	tc := newTestClient(t)
+	tc.do(t, "DEL exhausted")
+	if reply := tc.do(t, "XADD exhausted 18446744073709551615-18446744073709551615 f v"); reply.DataType == resp.ERROR {
+		t.Fatalf("XADD of the last possible ID = %v", reply.Content)
+	}
+
+	for _, id := range []string{"*", "18446744073709551615-*", "1-1"} {
+		reply := tc.do(t, "XADD exhausted "+id+" f v")
+		if want := "ERR The stream has exhausted the last possible ID, unable to add more items"; reply.Content != want {
+			t.Fatalf("XADD %s after the last possible ID = %v, want -%s", id, reply.Content, want)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/internal/timeseries"
+)
+
+// Type name of time series, as used by RedisTimeSeries
+const TIMESERIES_TYPE_NAME = "TSDB-TYPE"
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   TIMESERIES_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			series, err := timeseries.Unmarshal(data)
+			if err != nil {
+				return nil, err
+			}
+			return &seriesValue{series}, nil
+		},
+	})
+}
+
+type seriesValue struct {
+	*timeseries.Series
+}
+
+func (v *seriesValue) TypeName() string {
+	return TIMESERIES_TYPE_NAME
+}
+
+func (v *seriesValue) Clone() store.ModuleValue {
+	return &seriesValue{v.Series.Clone()}
+}
+
+func (v *seriesValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.Series)) +
+		cap(v.Samples)*int(unsafe.Sizeof(timeseries.Sample{})) +
+		len(v.Rules)*int(unsafe.Sizeof(timeseries.Rule{}))
+}
+
+func getSeries(key string) (*seriesValue, bool, error) {
+	value, ok, err := cache.GetModule(key, TIMESERIES_TYPE_NAME)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*seriesValue), true, nil
+}
+
+func formatSample(sample timeseries.Sample) resp.Resp {
+	return resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+		{Content: int(sample.Timestamp), DataType: resp.INTEGER},
+		{Content: strconv.FormatFloat(sample.Value, 'f', -1, 64), DataType: resp.SIMPLE_STRING},
+	}}
+}
+
+// seriesOptions holds the options shared by TS.CREATE and TS.ADD
+type seriesOptions struct {
+	retention   int64
+	policy      timeseries.DuplicatePolicy
+	onDuplicate timeseries.DuplicatePolicy
+}
+
+func parseSeriesOptions(args []resp.Resp, allowOnDuplicate bool) (seriesOptions, error) {
+	var opts seriesOptions
+	for ; len(args) > 0; args = args[2:] {
+		if len(args) < 2 {
+			return opts, resp.NewError("ERR", "TSDB: wrong number of arguments")
+		}
+
+		value := args[1].Content.(string)
+		switch option := strings.ToUpper(args[0].Content.(string)); {
+		case option == "RETENTION":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return opts, resp.NewError("ERR", "TSDB: invalid RETENTION value")
+			}
+			opts.retention = n
+		case option == "DUPLICATE_POLICY":
+			policy, ok := timeseries.ParseDuplicatePolicy(value)
+			if !ok {
+				return opts, resp.NewError("ERR", "TSDB: Unknown DUPLICATE_POLICY")
+			}
+			opts.policy = policy
+		case option == "ON_DUPLICATE" && allowOnDuplicate:
+			policy, ok := timeseries.ParseDuplicatePolicy(value)
+			if !ok {
+				return opts, resp.NewError("ERR", "TSDB: Unknown ON_DUPLICATE policy")
+			}
+			opts.onDuplicate = policy
+		default:
+			return opts, resp.NewError("ERR", "TSDB: unknown option '"+args[0].Content.(string)+"'")
+		}
+	}
+	return opts, nil
+}
+
+// TS.CREATE key [RETENTION ms] [DUPLICATE_POLICY policy]
+func handleCommandTSCreate(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	opts, err := parseSeriesOptions(cmd[1:], false)
+	if err != nil {
+		return nil, err
+	}
+
+	if entry, ok := cache.Get(key); ok && !entry.Expired() {
+		return nil, resp.NewError("ERR", "TSDB: key already exists")
+	}
+	cache.Set(key, &seriesValue{timeseries.New(opts.retention, opts.policy)}, time.Time{}, store.TYPE_MODULE)
+	return OK_RESP, nil
+}
+
+// TS.ADD key timestamp|* value [RETENTION ms] [DUPLICATE_POLICY policy]
+// [ON_DUPLICATE policy]. The series is created if needed.
+func handleCommandTSAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+
+	var ts int64
+	if cmd[1].Content == "*" {
+		ts = time.Now().UnixMilli()
+	} else {
+		var err error
+		if ts, err = strconv.ParseInt(cmd[1].Content.(string), 10, 64); err != nil || ts < 0 {
+			return nil, resp.NewError("ERR", "TSDB: invalid timestamp")
+		}
+	}
+
+	value, err := strconv.ParseFloat(cmd[2].Content.(string), 64)
+	if err != nil || math.IsNaN(value) {
+		return nil, resp.NewError("ERR", "TSDB: invalid value")
+	}
+
+	opts, err := parseSeriesOptions(cmd[3:], true)
+	if err != nil {
+		return nil, err
+	}
+
+	series, ok, err := getSeries(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		series = &seriesValue{timeseries.New(opts.retention, opts.policy)}
+		cache.Set(key, series, time.Time{}, store.TYPE_MODULE)
+	}
+
+	var closed map[*timeseries.Rule]timeseries.Sample
+	err = cache.Modify(key, func() (err error) {
+		closed, err = series.Add(timeseries.Sample{Timestamp: ts, Value: value}, opts.onDuplicate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Replicas apply the compaction rules themselves
+	for rule, sample := range closed {
+		if dest, ok, _ := getSeries(rule.DestKey); ok {
+			cache.Modify(rule.DestKey, func() error {
+				_, err := dest.Add(sample, timeseries.POLICY_LAST)
+				return err
+			})
+		}
+	}
+
+	if cmd[1].Content == "*" {
+		args := []string{"TS.ADD", key, strconv.FormatInt(ts, 10)}
+		for _, arg := range cmd[2:] {
+			args = append(args, arg.Content.(string))
+		}
+		c.propagateAs(args...)
+	}
+	return resp.AppendInteger(nil, ts), nil
+}
+
+// TS.GET key
+func handleCommandTSGet(cmd []resp.Resp, c *client) ([]byte, error) {
+	series, ok, err := getSeries(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "TSDB: the key does not exist")
+	}
+
+	last, ok := series.Last()
+	if !ok {
+		return resp.AppendArray(nil, []resp.Resp{}), nil
+	}
+	return resp.AppendValue(nil, formatSample(last)), nil
+}
+
+func parseRangeBound(s string, open int64) (int64, bool) {
+	switch s {
+	case "-", "+":
+		return open, true
+	}
+	ts, err := strconv.ParseInt(s, 10, 64)
+	return ts, err == nil
+}
+
+// TS.RANGE key from to [COUNT count] [AGGREGATION aggregator bucketDuration]
+func handleCommandTSRange(cmd []resp.Resp, c *client) ([]byte, error) {
+	from, okFrom := parseRangeBound(cmd[1].Content.(string), math.MinInt64)
+	to, okTo := parseRangeBound(cmd[2].Content.(string), math.MaxInt64)
+	if !okFrom || !okTo {
+		return nil, resp.NewError("ERR", "TSDB: invalid timestamp")
+	}
+
+	count := -1
+	var (
+		aggregation timeseries.Aggregation
+		bucket      int64
+	)
+	for args := cmd[3:]; len(args) > 0; {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "COUNT":
+			if len(args) < 2 {
+				return nil, resp.NewError("ERR", "TSDB: wrong number of arguments")
+			}
+			n, err := strconv.Atoi(args[1].Content.(string))
+			if err != nil || n < 0 {
+				return nil, resp.NewError("ERR", "TSDB: Couldn't parse COUNT")
+			}
+			count = n
+			args = args[2:]
+		case "AGGREGATION":
+			if len(args) < 3 {
+				return nil, resp.NewError("ERR", "TSDB: wrong number of arguments")
+			}
+			var ok bool
+			if aggregation, ok = timeseries.ParseAggregation(args[1].Content.(string)); !ok {
+				return nil, resp.NewError("ERR", "TSDB: Unknown aggregation type")
+			}
+			n, err := strconv.ParseInt(args[2].Content.(string), 10, 64)
+			if err != nil || n <= 0 {
+				return nil, resp.NewError("ERR", "TSDB: bucketDuration must be greater than zero")
+			}
+			bucket = n
+			args = args[3:]
+		default:
+			return nil, resp.NewError("ERR", "TSDB: unknown option '"+args[0].Content.(string)+"'")
+		}
+	}
+
+	series, ok, err := getSeries(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "TSDB: the key does not exist")
+	}
+
+	samples := series.Range(from, to)
+	if aggregation != "" {
+		samples = timeseries.Aggregate(samples, aggregation, bucket)
+	}
+	if count >= 0 && count < len(samples) {
+		samples = samples[:count]
+	}
+
+	reply := make([]resp.Resp, 0, len(samples))
+	for _, sample := range samples {
+		reply = append(reply, formatSample(sample))
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// TS.CREATERULE sourceKey destKey AGGREGATION aggregator bucketDuration
+func handleCommandTSCreateRule(cmd []resp.Resp, c *client) ([]byte, error) {
+	srcKey, destKey := cmd[0].Content.(string), cmd[1].Content.(string)
+	if !strings.EqualFold(cmd[2].Content.(string), "AGGREGATION") {
+		return nil, resp.NewError("ERR", "TSDB: AGGREGATION is required")
+	}
+	aggregation, ok := timeseries.ParseAggregation(cmd[3].Content.(string))
+	if !ok {
+		return nil, resp.NewError("ERR", "TSDB: Unknown aggregation type")
+	}
+	bucket, err := strconv.ParseInt(cmd[4].Content.(string), 10, 64)
+	if err != nil || bucket <= 0 {
+		return nil, resp.NewError("ERR", "TSDB: bucketDuration must be greater than zero")
+	}
+	if srcKey == destKey {
+		return nil, resp.NewError("ERR", "TSDB: the source key and destination key should be different")
+	}
+
+	src, okSrc, errSrc := getSeries(srcKey)
+	_, okDest, errDest := getSeries(destKey)
+	if errSrc != nil || errDest != nil {
+		return nil, store.ErrWrongType
+	}
+	if !okSrc || !okDest {
+		return nil, resp.NewError("ERR", "TSDB: the key does not exist")
+	}
+
+	err = cache.Modify(srcKey, func() error {
+		return src.AddRule(destKey, aggregation, bucket)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return OK_RESP, nil
+}
+
+// TS.DELETERULE sourceKey destKey
+func handleCommandTSDeleteRule(cmd []resp.Resp, c *client) ([]byte, error) {
+	srcKey := cmd[0].Content.(string)
+	src, ok, err := getSeries(srcKey)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "TSDB: the key does not exist")
+	}
+
+	deleted := false
+	cache.Modify(srcKey, func() error {
+		deleted = src.DeleteRule(cmd[1].Content.(string))
+		return nil
+	})
+	if !deleted {
+		return nil, resp.NewError("ERR", "TSDB: compaction rule does not exist")
+	}
+	return OK_RESP, nil
+}
+
+// TS.INFO key
+func handleCommandTSInfo(cmd []resp.Resp, c *client) ([]byte, error) {
+	series, ok, err := getSeries(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "TSDB: the key does not exist")
+	}
+
+	first, last := 0, 0
+	if len(series.Samples) > 0 {
+		first, last = int(series.Samples[0].Timestamp), int(series.Samples[len(series.Samples)-1].Timestamp)
+	}
+
+	rules := make([]resp.Resp, 0, len(series.Rules))
+	for _, rule := range series.Rules {
+		rules = append(rules, resp.Resp{DataType: resp.ARRAY, Content: []resp.Resp{
+			{Content: rule.DestKey, DataType: resp.STRING},
+			{Content: int(rule.Bucket), DataType: resp.INTEGER},
+			{Content: strings.ToUpper(string(rule.Aggregation)), DataType: resp.SIMPLE_STRING},
+		}})
+	}
+
+	return resp.AppendArray(nil, []resp.Resp{
+		{Content: "totalSamples", DataType: resp.SIMPLE_STRING},
+		{Content: len(series.Samples), DataType: resp.INTEGER},
+		{Content: "memoryUsage", DataType: resp.SIMPLE_STRING},
+		{Content: series.MemoryUsage(), DataType: resp.INTEGER},
+		{Content: "firstTimestamp", DataType: resp.SIMPLE_STRING},
+		{Content: first, DataType: resp.INTEGER},
+		{Content: "lastTimestamp", DataType: resp.SIMPLE_STRING},
+		{Content: last, DataType: resp.INTEGER},
+		{Content: "retentionTime", DataType: resp.SIMPLE_STRING},
+		{Content: int(series.Retention), DataType: resp.INTEGER},
+		{Content: "duplicatePolicy", DataType: resp.SIMPLE_STRING},
+		{Content: string(series.DuplicatePolicy), DataType: resp.STRING},
+		{Content: "rules", DataType: resp.SIMPLE_STRING},
+		{Content: rules, DataType: resp.ARRAY},
+	}), nil
+}
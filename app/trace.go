@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+)
+
+// Enabled with --trace-proto yes or at runtime with DEBUG TRACE-PROTO yes|no
+var traceProto atomic.Bool
+
+// tracingConn logs the raw RESP exchanged over a connection, escaped so that
+// frames fit on one line. Inbound data is logged as it is read from the socket,
+// so pipelined frames may show up together.
+type tracingConn struct {
+	net.Conn
+}
+
+func traceConn(conn net.Conn) net.Conn {
+	if _, ok := conn.(*tracingConn); ok {
+		return conn
+	}
+	return &tracingConn{conn}
+}
+
+func (c *tracingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	traceInput(c.RemoteAddr(), b[:n])
+	return n, err
+}
+
+// traceInput logs data read from a connection without going through its Read
+// method, as the event loop does.
+func traceInput(addr net.Addr, b []byte) {
+	if len(b) > 0 && traceProto.Load() {
+		fmt.Printf("[trace] %s <- %s\n", addr, strconv.Quote(string(b)))
+	}
+}
+
+func (c *tracingConn) Write(b []byte) (int, error) {
+	if len(b) > 0 && traceProto.Load() {
+		fmt.Printf("[trace] %s -> %s\n", c.RemoteAddr(), strconv.Quote(string(b)))
+	}
+	return c.Conn.Write(b)
+}
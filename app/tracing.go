@@ -0,0 +1,37 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/telemetry"
+)
+
+// nil unless an OTLP endpoint is configured, in which case every executed
+// command and replication event produces a span.
+var tracer *telemetry.Tracer
+
+func otelEndpoint() string {
+	if endpoint, ok := config.get("otel-endpoint"); ok {
+		return endpoint
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
+}
+
+func endCommandSpan(span *telemetry.Span, entry *command, cmd []resp.Resp, out []byte, err error) {
+	if span == nil {
+		return
+	}
+
+	span.SetString("db.system", "redis")
+	span.SetString("db.operation", strings.ToUpper(entry.name))
+	span.SetInt("db.redis.key_count", len(entry.keys(cmd)))
+	span.SetInt("db.redis.reply_size", len(out))
+
+	if err == nil && isErrorReply(out) {
+		err = errors.New(strings.TrimSpace(string(out[1:])))
+	}
+	span.End(err)
+}
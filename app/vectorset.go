@@ -0,0 +1,278 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+	"github.com/codecrafters-io/redis-starter-go/internal/store"
+	"github.com/codecrafters-io/redis-starter-go/internal/vectorset"
+)
+
+// Type name of vector sets, as reported by Redis 8
+const VECTORSET_TYPE_NAME = "vectorset"
+
+// Number of results of VSIM without COUNT
+const DEFAULT_VSIM_COUNT = 10
+
+func init() {
+	store.RegisterModuleType(store.ModuleType{
+		Name:   VECTORSET_TYPE_NAME,
+		EncVer: 0,
+		Decode: func(encver int, data []byte) (store.ModuleValue, error) {
+			s, err := vectorset.Unmarshal(data)
+			if err != nil {
+				return nil, err
+			}
+			return &vectorSetValue{s}, nil
+		},
+	})
+}
+
+type vectorSetValue struct {
+	*vectorset.Set
+}
+
+func (v *vectorSetValue) TypeName() string {
+	return VECTORSET_TYPE_NAME
+}
+
+func (v *vectorSetValue) Clone() store.ModuleValue {
+	return &vectorSetValue{v.Set.Clone()}
+}
+
+func (v *vectorSetValue) MemoryUsage() int {
+	return int(unsafe.Sizeof(*v.Set)) + v.Size()
+}
+
+func getVectorSet(key string) (*vectorSetValue, bool, error) {
+	value, ok, err := cache.GetModule(key, VECTORSET_TYPE_NAME)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*vectorSetValue), true, nil
+}
+
+// parseVector parses a vector given as FP32 blob or VALUES num v1 ... vn,
+// returning the arguments that follow
+func parseVector(args []resp.Resp) ([]float32, []resp.Resp, error) {
+	if len(args) < 2 {
+		return nil, nil, resp.ErrSyntax
+	}
+
+	switch strings.ToUpper(args[0].Content.(string)) {
+	case "FP32":
+		vector, ok := vectorset.ParseFP32([]byte(args[1].Content.(string)))
+		if !ok {
+			return nil, nil, resp.NewError("ERR", "invalid vector specification")
+		}
+		return vector, args[2:], nil
+	case "VALUES":
+		n, err := strconv.Atoi(args[1].Content.(string))
+		if err != nil || n <= 0 || n > len(args)-2 {
+			return nil, nil, resp.NewError("ERR", "invalid vector specification")
+		}
+		vector := make([]float32, n)
+		for i := range vector {
+			x, err := strconv.ParseFloat(args[2+i].Content.(string), 32)
+			if err != nil {
+				return nil, nil, resp.NewError("ERR", "invalid vector specification")
+			}
+			vector[i] = float32(x)
+		}
+		return vector, args[2+n:], nil
+	default:
+		return nil, nil, resp.ErrSyntax
+	}
+}
+
+// VADD key (FP32 blob | VALUES num value ...) element [CAS]
+// [NOQUANT | Q8 | BIN] [EF build-exploration-factor] [M numlinks]
+//
+// Vectors are always kept as float32 and searched by brute force, so the
+// quantization and graph options are accepted but have no effect.
+func handleCommandVAdd(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	if strings.EqualFold(cmd[1].Content.(string), "REDUCE") {
+		return nil, resp.NewError("ERR", "REDUCE is not supported")
+	}
+
+	vector, rest, err := parseVector(cmd[1:])
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) == 0 {
+		return nil, resp.ErrSyntax
+	}
+	element := rest[0].Content.(string)
+
+	for args := rest[1:]; len(args) > 0; {
+		switch strings.ToUpper(args[0].Content.(string)) {
+		case "CAS", "NOQUANT", "Q8", "BIN":
+			args = args[1:]
+		case "EF", "M":
+			if len(args) < 2 {
+				return nil, resp.ErrSyntax
+			}
+			if n, err := strconv.Atoi(args[1].Content.(string)); err != nil || n <= 0 {
+				return nil, resp.NewError("ERR", "invalid "+strings.ToUpper(args[0].Content.(string))+" value")
+			}
+			args = args[2:]
+		default:
+			return nil, resp.ErrSyntax
+		}
+	}
+
+	set, ok, err := getVectorSet(key)
+	if err != nil {
+		return nil, err
+	}
+	if ok && set.Dim != len(vector) {
+		_, err := set.Add(element, vector)
+		return nil, err
+	}
+	if !ok {
+		set = &vectorSetValue{vectorset.New(len(vector))}
+		cache.Set(key, set, time.Time{}, store.TYPE_MODULE)
+	}
+
+	added := false
+	cache.Modify(key, func() (err error) {
+		added, err = set.Add(element, vector)
+		return err
+	})
+	return resp.AppendInteger(nil, int64(boolToInt(added))), nil
+}
+
+// VSIM key (ELE element | FP32 blob | VALUES num value ...) [WITHSCORES]
+// [COUNT num] [EF search-exploration-factor] [METRIC COSINE | L2]
+func handleCommandVSim(cmd []resp.Resp, c *client) ([]byte, error) {
+	set, ok, err := getVectorSet(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		query   []float32
+		rest    []resp.Resp
+		element string
+	)
+	if strings.EqualFold(cmd[1].Content.(string), "ELE") {
+		if len(cmd) < 3 {
+			return nil, resp.ErrSyntax
+		}
+		element, rest = cmd[2].Content.(string), cmd[3:]
+	} else if query, rest, err = parseVector(cmd[1:]); err != nil {
+		return nil, err
+	}
+
+	withScores := false
+	count := DEFAULT_VSIM_COUNT
+	metric := vectorset.METRIC_COSINE
+	for len(rest) > 0 {
+		option := strings.ToUpper(rest[0].Content.(string))
+		if option == "WITHSCORES" {
+			withScores = true
+			rest = rest[1:]
+			continue
+		}
+		if len(rest) < 2 {
+			return nil, resp.ErrSyntax
+		}
+
+		value := rest[1].Content.(string)
+		switch option {
+		case "COUNT":
+			if count, err = strconv.Atoi(value); err != nil || count <= 0 {
+				return nil, resp.NewError("ERR", "invalid COUNT")
+			}
+		case "EF":
+			if n, err := strconv.Atoi(value); err != nil || n <= 0 {
+				return nil, resp.NewError("ERR", "invalid EF")
+			}
+		case "METRIC":
+			if metric, ok = vectorset.ParseMetric(value); !ok {
+				return nil, resp.NewError("ERR", "unknown METRIC, expected COSINE or L2")
+			}
+		default:
+			return nil, resp.ErrSyntax
+		}
+		rest = rest[2:]
+	}
+
+	if set == nil {
+		return resp.AppendArray(nil, []resp.Resp{}), nil
+	}
+	if query == nil {
+		if query, ok = set.Get(element); !ok {
+			return nil, resp.NewError("ERR", "element not found in set")
+		}
+	}
+
+	results, err := set.Search(query, count, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	reply := make([]resp.Resp, 0, 2*len(results))
+	for _, result := range results {
+		reply = append(reply, resp.Resp{Content: result.Element, DataType: resp.STRING})
+		if withScores {
+			reply = append(reply, resp.Resp{Content: strconv.FormatFloat(result.Score, 'f', -1, 64), DataType: resp.STRING})
+		}
+	}
+	return resp.AppendArray(nil, reply), nil
+}
+
+// VREM key element
+func handleCommandVRem(cmd []resp.Resp, c *client) ([]byte, error) {
+	key := cmd[0].Content.(string)
+	set, ok, err := getVectorSet(key)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		c.propagateAs()
+		return resp.AppendInteger(nil, 0), nil
+	}
+
+	removed := false
+	cache.Modify(key, func() error {
+		removed = set.Remove(cmd[1].Content.(string))
+		return nil
+	})
+
+	if set.Len() == 0 {
+		cache.Delete(key)
+	}
+	if !removed {
+		c.propagateAs()
+	}
+	return resp.AppendInteger(nil, int64(boolToInt(removed))), nil
+}
+
+// VDIM key
+func handleCommandVDim(cmd []resp.Resp, c *client) ([]byte, error) {
+	set, ok, err := getVectorSet(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, resp.NewError("ERR", "key does not exist")
+	}
+	return resp.AppendInteger(nil, int64(set.Dim)), nil
+}
+
+// VCARD key
+func handleCommandVCard(cmd []resp.Resp, c *client) ([]byte, error) {
+	set, ok, err := getVectorSet(cmd[0].Content.(string))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return resp.AppendInteger(nil, 0), nil
+	}
+	return resp.AppendInteger(nil, int64(set.Len())), nil
+}
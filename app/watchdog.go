@@ -0,0 +1,78 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Size of the buffer the stacks of all goroutines are dumped to when a
+// command hangs
+const WATCHDOG_STACK_BUFFER_SIZE = 1024 * 1024
+
+// The command watchdog reports commands running for longer than
+// command-watchdog-timeout milliseconds, which is disabled when zero. A
+// command still running when the timeout elapses is logged with the stacks
+// of all goroutines, to find where it hangs. One that completes after it is
+// logged with its duration, and recorded in the slow log with a watchdog
+// flag if command-watchdog-slowlog is set.
+var watchdog struct {
+	timeout atomic.Int64
+	slowlog atomic.Bool
+}
+
+// watchdogExceeded reports whether a command that ran for elapsed has to be
+// reported
+func watchdogExceeded(elapsed time.Duration) bool {
+	timeout := watchdog.timeout.Load()
+	return timeout > 0 && elapsed >= time.Duration(timeout)*time.Millisecond
+}
+
+func watchdogMiddleware(entry *command, cmd []resp.Resp, c *client, next func() ([]byte, error)) ([]byte, error) {
+	timeout := watchdog.timeout.Load()
+	if timeout <= 0 {
+		return next()
+	}
+
+	start := time.Now()
+	timer := time.AfterFunc(time.Duration(timeout)*time.Millisecond, func() {
+		stack := make([]byte, WATCHDOG_STACK_BUFFER_SIZE)
+		stack = stack[:runtime.Stack(stack, true)]
+		fmt.Printf("watchdog: '%s' from %s still running after %dms, args digest %s, goroutines:\n%s\n",
+			entry.name, clientAddr(c), time.Since(start).Milliseconds(), argsDigest(cmd), stack)
+	})
+	out, err := next()
+	timer.Stop()
+
+	if elapsed := time.Since(start); watchdogExceeded(elapsed) {
+		fmt.Printf("watchdog: '%s' from %s took %dms, args digest %s\n",
+			entry.name, clientAddr(c), elapsed.Milliseconds(), argsDigest(cmd))
+	}
+	return out, err
+}
+
+func clientAddr(c *client) string {
+	if c.conn == nil {
+		return "internal client"
+	}
+	return fmt.Sprintf("%s (id=%d)", c.conn.RemoteAddr(), c.id)
+}
+
+// argsDigest identifies the arguments of a command without logging them,
+// as they may be large or hold sensitive data
+func argsDigest(cmd []resp.Resp) string {
+	h := sha1.New()
+	for _, arg := range cmd {
+		value := arg.Content.(string)
+		h.Write([]byte(strconv.Itoa(len(value))))
+		h.Write([]byte{':'})
+		h.Write([]byte(value))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+const WORKER_QUEUE_SIZE = 1024
+
+type commandResult struct {
+	out []byte
+	err error
+}
+
+type commandJob struct {
+	input *resp.Resp
+	c     *client
+}
+
+// workerPool executes commands on a fixed number of goroutines, so that
+// connection readers only block on a channel while their command waits in the
+// queue. Readers wait for the result before parsing the next command, which
+// keeps replies in order for every connection.
+type workerPool struct {
+	size int
+	jobs chan commandJob
+
+	queueFullEvents atomic.Int64
+	maxQueueDepth   atomic.Int64
+	executed        atomic.Int64
+}
+
+// nil when commands are executed by the connection goroutines themselves
+var pool *workerPool
+
+func newWorkerPool(size int) *workerPool {
+	p := &workerPool{
+		size: size,
+		jobs: make(chan commandJob, WORKER_QUEUE_SIZE),
+	}
+
+	for range size {
+		go p.work()
+	}
+	return p
+}
+
+func (p *workerPool) work() {
+	for job := range p.jobs {
+		out, err := handleCommand(job.input, job.c)
+		p.executed.Add(1)
+		job.c.results <- commandResult{out, err}
+	}
+}
+
+func (p *workerPool) execute(input *resp.Resp, c *client) ([]byte, error) {
+	if c.results == nil {
+		c.results = make(chan commandResult, 1)
+	}
+
+	job := commandJob{input, c}
+	select {
+	case p.jobs <- job:
+	default:
+		// Queue full: the reader blocks until a worker frees a slot
+		p.queueFullEvents.Add(1)
+		p.jobs <- job
+	}
+
+	depth := int64(len(p.jobs))
+	for {
+		current := p.maxQueueDepth.Load()
+		if depth <= current || p.maxQueueDepth.CompareAndSwap(current, depth) {
+			break
+		}
+	}
+
+	res := <-c.results
+	return res.out, res.err
+}
+
+func (p *workerPool) info() string {
+	if p == nil {
+		return "worker_pool_size:0\n"
+	}
+
+	return fmt.Sprintf("worker_pool_size:%d\n"+
+		"worker_queue_depth:%d\n"+
+		"worker_queue_max_depth:%d\n"+
+		"worker_queue_full_events:%d\n"+
+		"worker_executed_commands:%d\n",
+		p.size, len(p.jobs), p.maxQueueDepth.Load(), p.queueFullEvents.Load(), p.executed.Load())
+}
+
+// executeRequest runs a parsed request through the pool when there is one
+func executeRequest(input *resp.Resp, c *client) ([]byte, error) {
+	if pool == nil {
+		return handleCommand(input, c)
+	}
+	return pool.execute(input, c)
+}
+
+func initWorkerPool() {
+	value, ok := config.get("worker-threads")
+	if !ok {
+		return
+	}
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		fmt.Printf("invalid worker-threads value '%s'\n", value)
+		return
+	}
+
+	if size > 0 {
+		pool = newWorkerPool(size)
+	}
+}
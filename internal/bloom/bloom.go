@@ -0,0 +1,168 @@
+// Package bloom implements scalable Bloom filters: a chain of fixed size
+// filters, each one larger and with a tighter error rate than the previous,
+// added whenever the last one is full.
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+const (
+	DEFAULT_ERROR_RATE = 0.01
+	DEFAULT_CAPACITY   = 100
+	DEFAULT_EXPANSION  = 2
+
+	// Error rate of each new sub-filter relative to the previous one, so that
+	// the compound error rate stays under the requested one
+	TIGHTENING_RATIO = 0.5
+)
+
+var ErrFull = resp.NewError("ERR", "non scaling filter is full")
+
+// filter is a fixed size Bloom filter
+type filter struct {
+	bits []uint64
+	// Number of bits actually used, which may be less than 64 * len(bits)
+	size     uint64
+	hashes   uint64
+	capacity uint64
+	count    uint64
+}
+
+func newFilter(capacity uint64, errorRate float64) *filter {
+	// Optimal number of bits and hash functions for the error rate
+	ln2 := math.Ln2
+	size := uint64(math.Ceil(-float64(capacity) * math.Log(errorRate) / (ln2 * ln2)))
+	size = max(size, 64)
+	hashes := uint64(math.Ceil(-math.Log2(errorRate)))
+
+	return &filter{
+		bits:     make([]uint64, (size+63)/64),
+		size:     size,
+		hashes:   max(hashes, 1),
+		capacity: capacity,
+	}
+}
+
+// hash returns two independent hashes of the item, combined to derive the
+// positions of all the hash functions (Kirsch-Mitzenmacher)
+func hash(item string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	h1 := h.Sum64()
+	h.Write([]byte{0xff})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+func (f *filter) test(h1, h2 uint64) bool {
+	for i := uint64(0); i < f.hashes; i++ {
+		pos := (h1 + i*h2) % f.size
+		if f.bits[pos/64]&(1<<(pos%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *filter) set(h1, h2 uint64) {
+	for i := uint64(0); i < f.hashes; i++ {
+		pos := (h1 + i*h2) % f.size
+		f.bits[pos/64] |= 1 << (pos % 64)
+	}
+	f.count++
+}
+
+type Filter struct {
+	ErrorRate float64
+	// Growth factor of the capacity of each new sub-filter, zero when the
+	// filter doesn't scale
+	Expansion uint64
+
+	filters []*filter
+}
+
+func New(errorRate float64, capacity uint64, expansion uint64) *Filter {
+	return &Filter{
+		ErrorRate: errorRate,
+		Expansion: expansion,
+		filters:   []*filter{newFilter(capacity, errorRate*TIGHTENING_RATIO)},
+	}
+}
+
+// Add inserts an item, returning false if it may have been added before
+func (f *Filter) Add(item string) (bool, error) {
+	h1, h2 := hash(item)
+	if f.test(h1, h2) {
+		return false, nil
+	}
+
+	last := f.filters[len(f.filters)-1]
+	if last.count >= last.capacity {
+		if f.Expansion == 0 {
+			return false, ErrFull
+		}
+		errorRate := f.ErrorRate * math.Pow(TIGHTENING_RATIO, float64(len(f.filters)+1))
+		last = newFilter(last.capacity*f.Expansion, errorRate)
+		f.filters = append(f.filters, last)
+	}
+	last.set(h1, h2)
+	return true, nil
+}
+
+func (f *Filter) Exists(item string) bool {
+	return f.test(hash(item))
+}
+
+func (f *Filter) test(h1, h2 uint64) bool {
+	for _, sub := range f.filters {
+		if sub.test(h1, h2) {
+			return true
+		}
+	}
+	return false
+}
+
+// Capacity returns how many items can be added before the filter scales again
+func (f *Filter) Capacity() uint64 {
+	var total uint64
+	for _, sub := range f.filters {
+		total += sub.capacity
+	}
+	return total
+}
+
+func (f *Filter) Count() uint64 {
+	var total uint64
+	for _, sub := range f.filters {
+		total += sub.count
+	}
+	return total
+}
+
+func (f *Filter) NumFilters() int {
+	return len(f.filters)
+}
+
+// Size returns the number of bytes used by the bit arrays
+func (f *Filter) Size() int {
+	size := 0
+	for _, sub := range f.filters {
+		size += 8 * len(sub.bits)
+	}
+	return size
+}
+
+func (f *Filter) Clone() *Filter {
+	clone := *f
+	clone.filters = make([]*filter, len(f.filters))
+	for i, sub := range f.filters {
+		copied := *sub
+		copied.bits = append([]uint64(nil), sub.bits...)
+		clone.filters[i] = &copied
+	}
+	return &clone
+}
@@ -0,0 +1,66 @@
+package bloom
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCorrupted = errors.New("corrupted bloom filter")
+
+// MarshalBinary encodes the parameters of the filter with varints, followed
+// by each sub-filter and its bits
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	buf := binary.LittleEndian.AppendUint64(nil, math.Float64bits(f.ErrorRate))
+	buf = binary.AppendUvarint(buf, f.Expansion)
+
+	buf = binary.AppendUvarint(buf, uint64(len(f.filters)))
+	for _, sub := range f.filters {
+		buf = binary.AppendUvarint(buf, sub.size)
+		buf = binary.AppendUvarint(buf, sub.hashes)
+		buf = binary.AppendUvarint(buf, sub.capacity)
+		buf = binary.AppendUvarint(buf, sub.count)
+		for _, word := range sub.bits {
+			buf = binary.LittleEndian.AppendUint64(buf, word)
+		}
+	}
+	return buf, nil
+}
+
+func Unmarshal(data []byte) (*Filter, error) {
+	if len(data) < 8 {
+		return nil, errCorrupted
+	}
+	f := &Filter{ErrorRate: math.Float64frombits(binary.LittleEndian.Uint64(data))}
+	data = data[8:]
+
+	corrupted := false
+	uvarint := func() uint64 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			corrupted = true
+			return 0
+		}
+		data = data[size:]
+		return n
+	}
+
+	f.Expansion = uvarint()
+	for n := uvarint(); n > 0 && !corrupted; n-- {
+		sub := &filter{size: uvarint(), hashes: uvarint(), capacity: uvarint(), count: uvarint()}
+		words := (sub.size + 63) / 64
+		if corrupted || sub.size == 0 || words > uint64(len(data))/8 {
+			return nil, errCorrupted
+		}
+		sub.bits = make([]uint64, words)
+		for i := range sub.bits {
+			sub.bits[i] = binary.LittleEndian.Uint64(data[8*i:])
+		}
+		data = data[8*words:]
+		f.filters = append(f.filters, sub)
+	}
+	if corrupted || len(f.filters) == 0 {
+		return nil, errCorrupted
+	}
+	return f, nil
+}
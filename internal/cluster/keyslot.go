@@ -0,0 +1,50 @@
+package cluster
+
+import "strings"
+
+// Number of hash slots the keyspace is split into
+const SLOTS = 16384
+
+// CRC16-CCITT (XModem), as used by Redis Cluster to map keys to slots
+var crc16Table [256]uint16
+
+func init() {
+	for i := range crc16Table {
+		crc := uint16(i) << 8
+		for range 8 {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		crc16Table[i] = crc
+	}
+}
+
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc = crc<<8 ^ crc16Table[byte(crc>>8)^s[i]]
+	}
+	return crc
+}
+
+// KeySlot returns the hash slot of a key. When the key has a hash tag, i.e. a
+// non-empty substring between its first { and the following }, only the tag
+// is hashed, so that keys sharing a tag are served by the same node.
+func KeySlot(key string) int {
+	return int(crc16(hashTag(key))) & (SLOTS - 1)
+}
+
+func hashTag(key string) string {
+	start := strings.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := strings.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
@@ -0,0 +1,266 @@
+package cluster
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// formatSlots renders slots as ranges of consecutive slots, e.g. 0-5460
+func formatSlots(slots []int) []string {
+	var ranges []string
+	for i := 0; i < len(slots); {
+		j := i
+		for j+1 < len(slots) && slots[j+1] == slots[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(slots[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", slots[i], slots[j]))
+		}
+		i = j + 1
+	}
+	return ranges
+}
+
+// NodeLine renders a node as a line of CLUSTER NODES:
+//
+//	<id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+//
+// Slots being migrated are listed too for this node, as [slot->-id] and
+// [slot-<-id].
+func (s *State) NodeLine(n *Node) string {
+	flags := "master"
+	if !n.IsMaster() {
+		flags = "slave"
+	}
+	if n.Myself {
+		flags = "myself," + flags
+	}
+	master := n.MasterID
+	if master == "" {
+		master = "-"
+	}
+
+	fields := []string{
+		n.ID,
+		fmt.Sprintf("%s:%d@%d", n.Host, n.Port, n.BusPort),
+		flags,
+		master,
+		"0",
+		"0",
+		strconv.FormatUint(n.ConfigEpoch, 10),
+		"connected",
+	}
+	fields = append(fields, formatSlots(s.Slots(n))...)
+
+	if n.Myself {
+		for slot := range SLOTS {
+			if to, ok := s.migrating[slot]; ok {
+				fields = append(fields, fmt.Sprintf("[%d->-%s]", slot, to.ID))
+			}
+			if from, ok := s.importing[slot]; ok {
+				fields = append(fields, fmt.Sprintf("[%d-<-%s]", slot, from.ID))
+			}
+		}
+	}
+	return strings.Join(fields, " ")
+}
+
+// ParsedNode is a node read from a CLUSTER NODES line, with the slots it
+// serves and, for this node, the slots being migrated by ID of the other node
+type ParsedNode struct {
+	Node      *Node
+	Slots     []int
+	Migrating map[int]string
+	Importing map[int]string
+}
+
+var errBadLine = errors.New("invalid node line")
+
+func ParseNodeLine(line string) (*ParsedNode, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 8 {
+		return nil, errBadLine
+	}
+
+	n := &Node{ID: fields[0]}
+	addr, busPort, _ := strings.Cut(fields[1], "@")
+	// The bus port may be followed by a hostname
+	busPort, _, _ = strings.Cut(busPort, ",")
+	host, port, ok := strings.Cut(addr, ":")
+	if !ok {
+		return nil, errBadLine
+	}
+	n.Host = host
+	var err error
+	if n.Port, err = strconv.Atoi(port); err != nil {
+		return nil, errBadLine
+	}
+	if n.BusPort, err = strconv.Atoi(busPort); err != nil {
+		n.BusPort = n.Port
+	}
+
+	for _, flag := range strings.Split(fields[2], ",") {
+		if flag == "myself" {
+			n.Myself = true
+		}
+	}
+	if fields[3] != "-" {
+		n.MasterID = fields[3]
+	}
+	if n.ConfigEpoch, err = strconv.ParseUint(fields[6], 10, 64); err != nil {
+		return nil, errBadLine
+	}
+
+	parsed := &ParsedNode{Node: n, Migrating: make(map[int]string), Importing: make(map[int]string)}
+	for _, field := range fields[8:] {
+		if strings.HasPrefix(field, "[") {
+			inner := strings.Trim(field, "[]")
+			if slot, id, ok := strings.Cut(inner, "->-"); ok {
+				if n, err := strconv.Atoi(slot); err == nil {
+					parsed.Migrating[n] = id
+				}
+			} else if slot, id, ok := strings.Cut(inner, "-<-"); ok {
+				if n, err := strconv.Atoi(slot); err == nil {
+					parsed.Importing[n] = id
+				}
+			}
+			continue
+		}
+
+		first, last, isRange := strings.Cut(field, "-")
+		start, err := strconv.Atoi(first)
+		end := start
+		if isRange && err == nil {
+			end, err = strconv.Atoi(last)
+		}
+		if err != nil || checkSlot(start) != nil || checkSlot(end) != nil {
+			return nil, errBadLine
+		}
+		for slot := start; slot <= end; slot++ {
+			parsed.Slots = append(parsed.Slots, slot)
+		}
+	}
+	return parsed, nil
+}
+
+// Save writes the state as a nodes.conf file: the CLUSTER NODES lines
+// followed by the epochs. The file is replaced atomically, and synced along
+// with its directory before Save returns, as a vote or an epoch bump must not
+// be forgotten by a node that crashes right after.
+func (s *State) Save(path string) error {
+	var sb strings.Builder
+	for _, n := range s.Nodes() {
+		sb.WriteString(s.NodeLine(n))
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "vars currentEpoch %d lastVoteEpoch %d\n", s.CurrentEpoch, s.LastVoteEpoch)
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(sb.String()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	dir, err := os.Open(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
+
+// Load reads a nodes.conf file written by Save
+func Load(path string) (*State, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		parsed []*ParsedNode
+		myself *ParsedNode
+		vars   []string
+	)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "vars ") {
+			vars = strings.Fields(text)[1:]
+			continue
+		}
+
+		p, err := ParseNodeLine(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		parsed = append(parsed, p)
+		if p.Node.Myself {
+			myself = p
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if myself == nil {
+		return nil, fmt.Errorf("%s: no line for this node", path)
+	}
+
+	s := New(myself.Node)
+	for _, p := range parsed {
+		s.AddNode(p.Node)
+	}
+	for _, p := range parsed {
+		for _, slot := range p.Slots {
+			s.slots[slot] = p.Node
+		}
+	}
+	for slot, id := range myself.Migrating {
+		if n, ok := s.nodes[id]; ok {
+			s.migrating[slot] = n
+		}
+	}
+	for slot, id := range myself.Importing {
+		if n, ok := s.nodes[id]; ok {
+			s.importing[slot] = n
+		}
+	}
+
+	for i := 0; i+1 < len(vars); i += 2 {
+		n, err := strconv.ParseUint(vars[i+1], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch vars[i] {
+		case "currentEpoch":
+			s.CurrentEpoch = n
+		case "lastVoteEpoch":
+			s.LastVoteEpoch = n
+		}
+	}
+	return s, nil
+}
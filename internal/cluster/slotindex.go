@@ -0,0 +1,65 @@
+package cluster
+
+import "sync"
+
+// SlotIndex keeps the keys of each slot, so that the keys of a slot can be
+// counted and listed without scanning the whole keyspace
+type SlotIndex struct {
+	mu    sync.RWMutex
+	slots [SLOTS]map[string]struct{}
+}
+
+func NewSlotIndex() *SlotIndex {
+	return &SlotIndex{}
+}
+
+func (idx *SlotIndex) Add(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	slot := KeySlot(key)
+	if idx.slots[slot] == nil {
+		idx.slots[slot] = make(map[string]struct{})
+	}
+	idx.slots[slot][key] = struct{}{}
+}
+
+func (idx *SlotIndex) Remove(key string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	slot := KeySlot(key)
+	delete(idx.slots[slot], key)
+	if len(idx.slots[slot]) == 0 {
+		idx.slots[slot] = nil
+	}
+}
+
+func (idx *SlotIndex) Clear() {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	idx.slots = [SLOTS]map[string]struct{}{}
+}
+
+func (idx *SlotIndex) Count(slot int) int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	return len(idx.slots[slot])
+}
+
+// Keys returns up to count keys of a slot, in no particular order
+func (idx *SlotIndex) Keys(slot, count int) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	keys := make([]string, 0, min(count, len(idx.slots[slot])))
+	for key := range idx.slots[slot] {
+		if len(keys) == count {
+			break
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
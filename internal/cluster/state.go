@@ -0,0 +1,245 @@
+// Package cluster holds the view a node has of the cluster: the known nodes,
+// which of them serves each hash slot, and the slots being migrated, along
+// with the nodes.conf file it is persisted to.
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type Node struct {
+	ID   string
+	Host string
+	Port int
+	// Port other nodes talk to this one on
+	BusPort int
+
+	Myself bool
+	// ID of the master of a replica, empty for masters
+	MasterID    string
+	ConfigEpoch uint64
+}
+
+func (n *Node) IsMaster() bool {
+	return n.MasterID == ""
+}
+
+func (n *Node) Addr() string {
+	return fmt.Sprintf("%s:%d", n.Host, n.Port)
+}
+
+// NewNodeID returns a random ID of 40 hex characters
+func NewNodeID() string {
+	buf := make([]byte, 20)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+type State struct {
+	sync.RWMutex
+	Myself        *Node
+	CurrentEpoch  uint64
+	LastVoteEpoch uint64
+
+	nodes map[string]*Node
+	slots [SLOTS]*Node
+	// Slots of this node being moved to another node, and slots of another
+	// node being moved to this one
+	migrating map[int]*Node
+	importing map[int]*Node
+}
+
+func New(myself *Node) *State {
+	myself.Myself = true
+	return &State{
+		Myself:    myself,
+		nodes:     map[string]*Node{myself.ID: myself},
+		migrating: make(map[int]*Node),
+		importing: make(map[int]*Node),
+	}
+}
+
+// Node returns a known node by ID
+func (s *State) Node(id string) (*Node, bool) {
+	n, ok := s.nodes[id]
+	return n, ok
+}
+
+// AddNode adds a node to the table, or returns the known one with that ID
+func (s *State) AddNode(n *Node) *Node {
+	if known, ok := s.nodes[n.ID]; ok {
+		return known
+	}
+	s.nodes[n.ID] = n
+	return n
+}
+
+// Nodes returns the known nodes, sorted by ID
+func (s *State) Nodes() []*Node {
+	nodes := make([]*Node, 0, len(s.nodes))
+	for _, n := range s.nodes {
+		nodes = append(nodes, n)
+	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+	return nodes
+}
+
+// Owner returns the node serving a slot, nil if it is unassigned
+func (s *State) Owner(slot int) *Node {
+	return s.slots[slot]
+}
+
+// Slots returns the slots served by a node, in order
+func (s *State) Slots(n *Node) []int {
+	var slots []int
+	for slot, owner := range s.slots {
+		if owner == n {
+			slots = append(slots, slot)
+		}
+	}
+	return slots
+}
+
+func (s *State) AssignedSlots() int {
+	assigned := 0
+	for _, owner := range s.slots {
+		if owner != nil {
+			assigned++
+		}
+	}
+	return assigned
+}
+
+func checkSlot(slot int) error {
+	if slot < 0 || slot >= SLOTS {
+		return resp.NewError("ERR", "Invalid or out of range slot")
+	}
+	return nil
+}
+
+// AddSlots assigns unassigned slots to this node
+func (s *State) AddSlots(slots []int) error {
+	for _, slot := range slots {
+		if err := checkSlot(slot); err != nil {
+			return err
+		}
+		if s.slots[slot] != nil {
+			return resp.Errorf("ERR", "Slot %d is already busy", slot)
+		}
+	}
+	for _, slot := range slots {
+		s.slots[slot] = s.Myself
+		delete(s.importing, slot)
+	}
+	return nil
+}
+
+// DelSlots makes slots unassigned, whichever node served them
+func (s *State) DelSlots(slots []int) error {
+	for _, slot := range slots {
+		if err := checkSlot(slot); err != nil {
+			return err
+		}
+		if s.slots[slot] == nil {
+			return resp.Errorf("ERR", "Slot %d is already unassigned", slot)
+		}
+	}
+	for _, slot := range slots {
+		s.slots[slot] = nil
+		delete(s.migrating, slot)
+		delete(s.importing, slot)
+	}
+	return nil
+}
+
+// SetOwner assigns a slot to a node, ending any migration of it
+func (s *State) SetOwner(slot int, n *Node) {
+	s.slots[slot] = n
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+}
+
+func (s *State) SetMigrating(slot int, to *Node) error {
+	if s.slots[slot] != s.Myself {
+		return resp.Errorf("ERR", "I'm not the owner of hash slot %d", slot)
+	}
+	s.migrating[slot] = to
+	return nil
+}
+
+func (s *State) SetImporting(slot int, from *Node) error {
+	if s.slots[slot] == s.Myself {
+		return resp.Errorf("ERR", "I'm already the owner of hash slot %d", slot)
+	}
+	s.importing[slot] = from
+	return nil
+}
+
+// SetStable cancels the migration of a slot
+func (s *State) SetStable(slot int) {
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+}
+
+func (s *State) Migrating(slot int) (*Node, bool) {
+	n, ok := s.migrating[slot]
+	return n, ok
+}
+
+func (s *State) Importing(slot int) (*Node, bool) {
+	n, ok := s.importing[slot]
+	return n, ok
+}
+
+// BumpEpoch gives this node a config epoch greater than any other, so that
+// its view of its slots wins over the others'
+func (s *State) BumpEpoch() {
+	s.CurrentEpoch++
+	s.Myself.ConfigEpoch = s.CurrentEpoch
+}
+
+// Promote makes this node, a replica, the owner of the slots of its master
+// with the given config epoch. The old master becomes its replica.
+func (s *State) Promote(epoch uint64) {
+	old, ok := s.nodes[s.Myself.MasterID]
+	s.Myself.MasterID = ""
+	s.CurrentEpoch = max(s.CurrentEpoch, epoch)
+	s.Myself.ConfigEpoch = epoch
+	if !ok {
+		return
+	}
+
+	for slot, owner := range s.slots {
+		if owner == old {
+			s.slots[slot] = s.Myself
+		}
+	}
+	old.MasterID = s.Myself.ID
+}
+
+// Claim applies the slots another node announced it serves. A node takes a
+// slot over when it's unassigned or served by a node of lower config epoch.
+// Slots it no longer announces are unassigned.
+func (s *State) Claim(n *Node, slots []int) {
+	s.CurrentEpoch = max(s.CurrentEpoch, n.ConfigEpoch)
+
+	claimed := make(map[int]bool, len(slots))
+	for _, slot := range slots {
+		claimed[slot] = true
+		owner := s.slots[slot]
+		if owner == n || owner == nil || owner.ConfigEpoch < n.ConfigEpoch {
+			s.slots[slot] = n
+		}
+	}
+	for slot, owner := range s.slots {
+		if owner == n && !claimed[slot] {
+			s.slots[slot] = nil
+		}
+	}
+}
@@ -0,0 +1,257 @@
+// Package cuckoo implements scalable cuckoo filters, which unlike Bloom
+// filters support deleting items and counting how many times they were added.
+package cuckoo
+
+import (
+	"hash/fnv"
+	"math/bits"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+const (
+	DEFAULT_CAPACITY       = 1024
+	DEFAULT_BUCKET_SIZE    = 2
+	DEFAULT_MAX_ITERATIONS = 20
+	DEFAULT_EXPANSION      = 1
+
+	MAX_BUCKET_SIZE = 255
+)
+
+var ErrFull = resp.NewError("ERR", "Filter is full")
+
+// Empty slots are zero, fingerprints never are
+type fingerprint uint8
+
+type subFilter struct {
+	numBuckets uint64
+	// numBuckets buckets of bucketSize slots, one after another
+	slots []fingerprint
+}
+
+func newSubFilter(numBuckets, bucketSize uint64) *subFilter {
+	return &subFilter{numBuckets: numBuckets, slots: make([]fingerprint, numBuckets*bucketSize)}
+}
+
+type Filter struct {
+	BucketSize    uint64
+	MaxIterations uint64
+	// Growth factor of the size of each new sub-filter, zero when the filter
+	// doesn't scale
+	Expansion uint64
+
+	Inserted uint64
+	Deleted  uint64
+
+	filters []*subFilter
+	// Incremented on every eviction, to pick the slot to evict
+	// deterministically so that replicas end up with the same filter
+	evictions uint64
+}
+
+func nextPowerOfTwo(n uint64) uint64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len64(n-1)
+}
+
+func New(capacity, bucketSize, maxIterations, expansion uint64) *Filter {
+	// The alternate bucket of an item is found with a xor, which only stays in
+	// range with a power of two number of buckets
+	numBuckets := nextPowerOfTwo(max(capacity/bucketSize, 1))
+	if expansion > 0 {
+		expansion = nextPowerOfTwo(expansion)
+	}
+	return &Filter{
+		BucketSize:    bucketSize,
+		MaxIterations: maxIterations,
+		Expansion:     expansion,
+		filters:       []*subFilter{newSubFilter(numBuckets, bucketSize)},
+	}
+}
+
+type itemHash struct {
+	fp   fingerprint
+	hash uint64
+}
+
+func hashItem(item string) itemHash {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	sum := h.Sum64()
+	return itemHash{fp: fingerprint(sum>>32%255 + 1), hash: sum}
+}
+
+func (sub *subFilter) index(h itemHash) uint64 {
+	return h.hash & (sub.numBuckets - 1)
+}
+
+// altIndex returns the other bucket a fingerprint can be stored in, which is
+// derived from the fingerprint alone so that evicted ones can be moved
+func (sub *subFilter) altIndex(i uint64, fp fingerprint) uint64 {
+	return (i ^ uint64(fp)*0x5bd1e995) & (sub.numBuckets - 1)
+}
+
+func (f *Filter) bucket(sub *subFilter, i uint64) []fingerprint {
+	return sub.slots[i*f.BucketSize : (i+1)*f.BucketSize]
+}
+
+func (f *Filter) insertInBucket(sub *subFilter, i uint64, fp fingerprint) bool {
+	for j, slot := range f.bucket(sub, i) {
+		if slot == 0 {
+			f.bucket(sub, i)[j] = fp
+			return true
+		}
+	}
+	return false
+}
+
+func (f *Filter) insert(h itemHash) error {
+	// Free slots in any sub-filter come first
+	for n := len(f.filters) - 1; n >= 0; n-- {
+		sub := f.filters[n]
+		i := sub.index(h)
+		if f.insertInBucket(sub, i, h.fp) || f.insertInBucket(sub, sub.altIndex(i, h.fp), h.fp) {
+			return nil
+		}
+	}
+
+	sub := f.filters[len(f.filters)-1]
+	if f.relocate(sub, sub.index(h), h.fp) {
+		return nil
+	}
+
+	if f.Expansion == 0 {
+		return ErrFull
+	}
+	sub = newSubFilter(sub.numBuckets*f.Expansion, f.BucketSize)
+	f.filters = append(f.filters, sub)
+	f.insertInBucket(sub, sub.index(h), h.fp)
+	return nil
+}
+
+// relocate makes room for a fingerprint by moving others to their alternate
+// buckets, undoing the moves when it can't within MaxIterations
+func (f *Filter) relocate(sub *subFilter, i uint64, fp fingerprint) bool {
+	type move struct {
+		slot     uint64
+		previous fingerprint
+	}
+	var moves []move
+
+	for n := uint64(0); n < f.MaxIterations; n++ {
+		slot := i*f.BucketSize + f.evictions%f.BucketSize
+		f.evictions++
+
+		moves = append(moves, move{slot, sub.slots[slot]})
+		fp, sub.slots[slot] = sub.slots[slot], fp
+
+		i = sub.altIndex(i, fp)
+		if f.insertInBucket(sub, i, fp) {
+			return true
+		}
+	}
+
+	for n := len(moves) - 1; n >= 0; n-- {
+		sub.slots[moves[n].slot] = moves[n].previous
+	}
+	return false
+}
+
+// Add inserts an item, even if it was added before
+func (f *Filter) Add(item string) error {
+	if err := f.insert(hashItem(item)); err != nil {
+		return err
+	}
+	f.Inserted++
+	return nil
+}
+
+// AddNX inserts an item unless it may have been added before
+func (f *Filter) AddNX(item string) (bool, error) {
+	if f.Exists(item) {
+		return false, nil
+	}
+	return true, f.Add(item)
+}
+
+// Count returns how many times an item may have been added, which can be
+// more than it was due to fingerprint collisions
+func (f *Filter) Count(item string) int {
+	h := hashItem(item)
+	count := 0
+	for _, sub := range f.filters {
+		i1 := sub.index(h)
+		i2 := sub.altIndex(i1, h.fp)
+		for _, slot := range f.bucket(sub, i1) {
+			if slot == h.fp {
+				count++
+			}
+		}
+		if i2 == i1 {
+			continue
+		}
+		for _, slot := range f.bucket(sub, i2) {
+			if slot == h.fp {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func (f *Filter) Exists(item string) bool {
+	return f.Count(item) > 0
+}
+
+// Delete removes one occurrence of an item, reporting whether it was found.
+// Deleting an item that wasn't added may remove another one.
+func (f *Filter) Delete(item string) bool {
+	h := hashItem(item)
+	for n := len(f.filters) - 1; n >= 0; n-- {
+		sub := f.filters[n]
+		i1 := sub.index(h)
+		for _, i := range []uint64{i1, sub.altIndex(i1, h.fp)} {
+			bucket := f.bucket(sub, i)
+			for j, slot := range bucket {
+				if slot == h.fp {
+					bucket[j] = 0
+					f.Deleted++
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func (f *Filter) NumFilters() int {
+	return len(f.filters)
+}
+
+func (f *Filter) NumBuckets() uint64 {
+	var total uint64
+	for _, sub := range f.filters {
+		total += sub.numBuckets
+	}
+	return total
+}
+
+// Size returns the number of bytes used by the buckets
+func (f *Filter) Size() int {
+	size := 0
+	for _, sub := range f.filters {
+		size += len(sub.slots)
+	}
+	return size
+}
+
+func (f *Filter) Clone() *Filter {
+	clone := *f
+	clone.filters = make([]*subFilter, len(f.filters))
+	for i, sub := range f.filters {
+		clone.filters[i] = &subFilter{numBuckets: sub.numBuckets, slots: append([]fingerprint(nil), sub.slots...)}
+	}
+	return &clone
+}
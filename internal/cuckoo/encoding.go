@@ -0,0 +1,69 @@
+package cuckoo
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/bits"
+)
+
+var errCorrupted = errors.New("corrupted cuckoo filter")
+
+// MarshalBinary encodes the parameters and counters of the filter with
+// varints, followed by the buckets of each sub-filter
+func (f *Filter) MarshalBinary() ([]byte, error) {
+	var buf []byte
+	for _, n := range []uint64{f.BucketSize, f.MaxIterations, f.Expansion, f.Inserted, f.Deleted, f.evictions} {
+		buf = binary.AppendUvarint(buf, n)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(f.filters)))
+	for _, sub := range f.filters {
+		buf = binary.AppendUvarint(buf, sub.numBuckets)
+		for _, slot := range sub.slots {
+			buf = append(buf, byte(slot))
+		}
+	}
+	return buf, nil
+}
+
+func Unmarshal(data []byte) (*Filter, error) {
+	corrupted := false
+	uvarint := func() uint64 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			corrupted = true
+			return 0
+		}
+		data = data[size:]
+		return n
+	}
+
+	f := &Filter{
+		BucketSize:    uvarint(),
+		MaxIterations: uvarint(),
+		Expansion:     uvarint(),
+		Inserted:      uvarint(),
+		Deleted:       uvarint(),
+		evictions:     uvarint(),
+	}
+	if corrupted || f.BucketSize == 0 || f.BucketSize > MAX_BUCKET_SIZE {
+		return nil, errCorrupted
+	}
+
+	for n := uvarint(); n > 0 && !corrupted; n-- {
+		numBuckets := uvarint()
+		if corrupted || bits.OnesCount64(numBuckets) != 1 || numBuckets > uint64(len(data))/f.BucketSize {
+			return nil, errCorrupted
+		}
+		sub := newSubFilter(numBuckets, f.BucketSize)
+		for i := range sub.slots {
+			sub.slots[i] = fingerprint(data[i])
+		}
+		data = data[len(sub.slots):]
+		f.filters = append(f.filters, sub)
+	}
+	if corrupted || len(f.filters) == 0 {
+		return nil, errCorrupted
+	}
+	return f, nil
+}
@@ -0,0 +1,127 @@
+// Package glob implements the pattern matching used by Redis in KEYS, SCAN
+// MATCH, PSUBSCRIBE and friends: * matches any sequence, ? any single byte,
+// [...] a byte class (with ^ negation and a-z ranges) and \ escapes the
+// following byte.
+package glob
+
+// Match reports whether s matches pattern
+func Match(pattern, s string) bool {
+	var skipLonger bool
+	return match(pattern, s, false, &skipLonger)
+}
+
+// MatchNoCase reports whether s matches pattern ignoring ASCII case
+func MatchNoCase(pattern, s string) bool {
+	var skipLonger bool
+	return match(pattern, s, true, &skipLonger)
+}
+
+// match sets skipLonger when a * failed with every suffix of s. An enclosing *
+// can then only hand the rest of the pattern shorter suffixes, which would
+// fail as well, so it gives up instead of backtracking exponentially, as
+// Redis does in stringmatchlen.
+func match(pattern, s string, nocase bool, skipLonger *bool) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for len(pattern) > 1 && pattern[1] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 1 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if match(pattern[1:], s[i:], nocase, skipLonger) {
+					return true
+				}
+				if *skipLonger {
+					return false
+				}
+			}
+			*skipLonger = true
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+
+			var matched bool
+			matched, pattern = matchClass(pattern[1:], s[0], nocase)
+			if !matched {
+				return false
+			}
+			s = s[1:]
+			// matchClass leaves the pattern at the closing bracket
+		case '\\':
+			if len(pattern) >= 2 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || !equal(pattern[0], s[0], nocase) {
+				return false
+			}
+			s = s[1:]
+		}
+		pattern = pattern[1:]
+	}
+	return len(s) == 0
+}
+
+// matchClass matches c against the class at the start of pattern, right after
+// the opening bracket, and returns the pattern positioned at the closing
+// bracket. An unterminated class extends to the end of the pattern, as in
+// Redis.
+func matchClass(pattern string, c byte, nocase bool) (bool, string) {
+	negate := len(pattern) > 0 && pattern[0] == '^'
+	if negate {
+		pattern = pattern[1:]
+	}
+
+	matched := false
+	for len(pattern) > 0 && pattern[0] != ']' {
+		switch {
+		case pattern[0] == '\\' && len(pattern) >= 2:
+			pattern = pattern[1:]
+			matched = matched || equal(pattern[0], c, nocase)
+		case len(pattern) >= 3 && pattern[1] == '-':
+			start, end := pattern[0], pattern[2]
+			if start > end {
+				start, end = end, start
+			}
+			if nocase {
+				start, end, c = lower(start), lower(end), lower(c)
+			}
+			matched = matched || (c >= start && c <= end)
+			pattern = pattern[2:]
+		default:
+			matched = matched || equal(pattern[0], c, nocase)
+		}
+		pattern = pattern[1:]
+	}
+
+	if len(pattern) == 0 {
+		// Keep the caller's pattern[1:] from going out of bounds
+		pattern = "]"
+	}
+	return matched != negate, pattern
+}
+
+func equal(a, b byte, nocase bool) bool {
+	if nocase {
+		return lower(a) == lower(b)
+	}
+	return a == b
+}
+
+func lower(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+	return c
+}
@@ -0,0 +1,105 @@
+package glob
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"abc", "ab", false},
+		{"abc", "abcd", false},
+
+		{"*", "", true},
+		{"*", "anything", true},
+		{"a*", "a", true},
+		{"a*", "abc", true},
+		{"a*", "ba", false},
+		{"*c", "abc", true},
+		{"*c", "abd", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"a**c", "abc", true},
+		{"*b*", "abc", true},
+		{"*b*", "acd", false},
+		{"user:*:name", "user:42:name", true},
+		{"user:*:name", "user:42:email", false},
+
+		{"?", "a", true},
+		{"?", "", false},
+		{"?", "ab", false},
+		{"h?llo", "hello", true},
+		{"h?llo", "hllo", false},
+		{"*?", "", false},
+		{"*?", "a", true},
+
+		{"h[ae]llo", "hello", true},
+		{"h[ae]llo", "hallo", true},
+		{"h[ae]llo", "hillo", false},
+		{"h[^e]llo", "hallo", true},
+		{"h[^e]llo", "hello", false},
+		{"h[a-b]llo", "hbllo", true},
+		{"h[a-b]llo", "hcllo", false},
+		{"h[b-a]llo", "hallo", true},
+		{"[a-c-e]", "e", true},
+		{"[\\]]", "]", true},
+		{"[\\^]", "^", true},
+		{"[^\\]]", "]", false},
+		{"[]", "a", false},
+		{"[abc", "a", true},
+		{"[abc", "d", false},
+		{"[a-", "a", true},
+
+		{"h\\*llo", "h*llo", true},
+		{"h\\*llo", "hello", false},
+		{"\\?", "?", true},
+		{"\\?", "a", false},
+		{"\\[a]", "[a]", true},
+		{"a\\", "a\\", true},
+		{"\\", "\\", true},
+
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 64), false},
+		{"*a*a*a*a*a*a*a*a*b", strings.Repeat("a", 64) + "b", true},
+		{"a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*a*c", strings.Repeat("a", 200) + "b", false},
+	}
+	for _, test := range tests {
+		if got := Match(test.pattern, test.s); got != test.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", test.pattern, test.s, got, test.want)
+		}
+	}
+}
+
+func TestMatchNoCase(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"hello", "HeLLo", true},
+		{"H*O", "hello", true},
+		{"h[A-E]llo", "hello", true},
+		{"h[a-e]llo", "HELLO", true},
+		{"h[^E]llo", "hello", false},
+		{"h\\Ello", "hello", true},
+		{"hello", "hellp", false},
+	}
+	for _, test := range tests {
+		if got := MatchNoCase(test.pattern, test.s); got != test.want {
+			t.Errorf("MatchNoCase(%q, %q) = %v, want %v", test.pattern, test.s, got, test.want)
+		}
+	}
+}
+
+func BenchmarkMatchBacktracking(b *testing.B) {
+	s := strings.Repeat("a", 64)
+	for i := 0; i < b.N; i++ {
+		Match("*a*a*a*a*a*a*a*a*b", s)
+	}
+}
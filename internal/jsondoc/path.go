@@ -0,0 +1,267 @@
+package jsondoc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type segmentKind int
+
+const (
+	// .key or ['key']
+	SEGMENT_KEY segmentKind = iota
+	// [index], negative indexes counting from the end
+	SEGMENT_INDEX
+	// .* or [*]
+	SEGMENT_WILDCARD
+	// .., which applies the next segment to every descendant as well
+	SEGMENT_RECURSIVE
+)
+
+type segment struct {
+	kind  segmentKind
+	key   string
+	index int
+}
+
+// Path is a parsed JSONPath. Paths starting with $ can match any number of
+// values, while legacy paths (starting with a dot or a key) match at most one.
+type Path struct {
+	Raw      string
+	Legacy   bool
+	segments []segment
+}
+
+// IsRoot reports whether the path points to the whole document
+func (p *Path) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+func ParsePath(s string) (*Path, error) {
+	p := &Path{Raw: s}
+	rest := s
+	if strings.HasPrefix(rest, "$") {
+		rest = rest[1:]
+	} else {
+		p.Legacy = true
+		if rest == "." {
+			rest = ""
+		} else if rest != "" && rest[0] != '.' && rest[0] != '[' {
+			rest = "." + rest
+		}
+	}
+
+	for rest != "" {
+		var (
+			seg segment
+			err error
+		)
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			seg.kind = SEGMENT_RECURSIVE
+			rest = rest[1:]
+		case rest[0] == '.':
+			seg, rest, err = parseDotted(rest[1:])
+		case rest[0] == '[':
+			seg, rest, err = parseBracket(rest[1:])
+		default:
+			err = fmt.Errorf("unexpected '%c'", rest[0])
+		}
+		if err != nil {
+			return nil, resp.Errorf("ERR", "invalid JSONPath '%s': %s", s, err)
+		}
+		p.segments = append(p.segments, seg)
+	}
+
+	if n := len(p.segments); n > 0 && p.segments[n-1].kind == SEGMENT_RECURSIVE {
+		return nil, resp.Errorf("ERR", "invalid JSONPath '%s': .. must be followed by a key", s)
+	}
+	return p, nil
+}
+
+func parseDotted(s string) (segment, string, error) {
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		end = len(s)
+	}
+	name := s[:end]
+	switch name {
+	case "":
+		return segment{}, "", errors.New("empty key")
+	case "*":
+		return segment{kind: SEGMENT_WILDCARD}, s[end:], nil
+	}
+	return segment{kind: SEGMENT_KEY, key: name}, s[end:], nil
+}
+
+func parseBracket(s string) (segment, string, error) {
+	end := strings.IndexByte(s, ']')
+	if end < 0 {
+		return segment{}, "", errors.New("missing ]")
+	}
+	inner, rest := strings.TrimSpace(s[:end]), s[end+1:]
+
+	if inner == "*" {
+		return segment{kind: SEGMENT_WILDCARD}, rest, nil
+	}
+	if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') {
+		// The closing bracket may be part of the quoted key
+		quote := inner[0]
+		close := strings.IndexByte(s[1:], quote)
+		if close < 0 {
+			return segment{}, "", errors.New("unterminated string")
+		}
+		key := s[1 : close+1]
+		rest = strings.TrimLeft(s[close+2:], " ")
+		if !strings.HasPrefix(rest, "]") {
+			return segment{}, "", errors.New("missing ]")
+		}
+		return segment{kind: SEGMENT_KEY, key: key}, rest[1:], nil
+	}
+
+	index, err := strconv.Atoi(inner)
+	if err != nil {
+		return segment{}, "", fmt.Errorf("invalid index '%s'", inner)
+	}
+	return segment{kind: SEGMENT_INDEX, index: index}, rest, nil
+}
+
+// Match is a value found by a path, along with where it is in the document so
+// that it can be replaced or deleted. Parent is nil for the root.
+type Match struct {
+	Value  any
+	Parent any
+	Key    string
+	Index  int
+}
+
+// Find returns the values the path matches in the document
+func (p *Path) Find(root any) []Match {
+	matches := []Match{{Value: root}}
+	for i := 0; i < len(p.segments); i++ {
+		seg := p.segments[i]
+		if seg.kind == SEGMENT_RECURSIVE {
+			var all []Match
+			for _, m := range matches {
+				all = descendants(m, all)
+			}
+			matches = all
+			continue
+		}
+
+		var next []Match
+		for _, m := range matches {
+			next = children(m.Value, seg, next)
+		}
+		matches = next
+	}
+	return matches
+}
+
+// descendants appends m and every value nested in it, in document order
+func descendants(m Match, out []Match) []Match {
+	out = append(out, m)
+	for _, child := range children(m.Value, segment{kind: SEGMENT_WILDCARD}, nil) {
+		out = descendants(child, out)
+	}
+	return out
+}
+
+func children(value any, seg segment, out []Match) []Match {
+	switch v := value.(type) {
+	case *Object:
+		switch seg.kind {
+		case SEGMENT_KEY:
+			if child, ok := v.values[seg.key]; ok {
+				out = append(out, Match{Value: child, Parent: v, Key: seg.key})
+			}
+		case SEGMENT_WILDCARD:
+			for _, key := range v.keys {
+				out = append(out, Match{Value: v.values[key], Parent: v, Key: key})
+			}
+		}
+	case *Array:
+		switch seg.kind {
+		case SEGMENT_INDEX:
+			index := seg.index
+			if index < 0 {
+				index += len(v.Items)
+			}
+			if index >= 0 && index < len(v.Items) {
+				out = append(out, Match{Value: v.Items[index], Parent: v, Index: index})
+			}
+		case SEGMENT_WILDCARD:
+			for i, item := range v.Items {
+				out = append(out, Match{Value: item, Parent: v, Index: i})
+			}
+		}
+	}
+	return out
+}
+
+// Set replaces the values the path matches. When nothing matches and the path
+// ends with a key, the key is added to the objects matched by the rest of the
+// path. It returns the number of values set and whether the root was
+// replaced, in which case newRoot is the document to keep.
+func (p *Path) Set(root any, value any) (newRoot any, set int) {
+	matches := p.Find(root)
+	if len(matches) == 0 {
+		last := len(p.segments) - 1
+		if last < 0 || p.segments[last].kind != SEGMENT_KEY {
+			return root, 0
+		}
+
+		parents := (&Path{segments: p.segments[:last]}).Find(root)
+		for _, m := range parents {
+			if obj, ok := m.Value.(*Object); ok {
+				obj.Set(p.segments[last].key, Clone(value))
+				set++
+			}
+		}
+		return root, set
+	}
+
+	for _, m := range matches {
+		switch parent := m.Parent.(type) {
+		case nil:
+			root = Clone(value)
+		case *Object:
+			parent.Set(m.Key, Clone(value))
+		case *Array:
+			parent.Items[m.Index] = Clone(value)
+		}
+		set++
+	}
+	return root, set
+}
+
+// Delete removes the values the path matches, returning how many there were.
+// Deleting the root is reported but left to the caller.
+func (p *Path) Delete(root any) (deleted int, rootDeleted bool) {
+	matches := p.Find(root)
+
+	// Array items are removed from the last one, so that the indexes of the
+	// remaining matches stay valid
+	for i := len(matches) - 1; i >= 0; i-- {
+		m := matches[i]
+		switch parent := m.Parent.(type) {
+		case nil:
+			rootDeleted = true
+		case *Object:
+			if !parent.Delete(m.Key) {
+				continue
+			}
+		case *Array:
+			if m.Index >= len(parent.Items) || parent.Items[m.Index] != m.Value {
+				continue
+			}
+			parent.Items = append(parent.Items[:m.Index], parent.Items[m.Index+1:]...)
+		}
+		deleted++
+	}
+	return deleted, rootDeleted
+}
@@ -0,0 +1,264 @@
+// Package jsondoc implements parsed JSON documents that keep the order of
+// object keys, along with JSONPath queries to read and modify them in place.
+//
+// Values are nil, bool, json.Number, string, *Object or *Array.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type Object struct {
+	keys   []string
+	values map[string]any
+}
+
+func NewObject() *Object {
+	return &Object{values: make(map[string]any)}
+}
+
+func (o *Object) Len() int {
+	return len(o.keys)
+}
+
+func (o *Object) Keys() []string {
+	return o.keys
+}
+
+func (o *Object) Get(key string) (any, bool) {
+	value, ok := o.values[key]
+	return value, ok
+}
+
+// Set adds a key at the end, or replaces its value in place if it exists
+func (o *Object) Set(key string, value any) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *Object) Delete(key string) bool {
+	if _, ok := o.values[key]; !ok {
+		return false
+	}
+
+	delete(o.values, key)
+	for i, k := range o.keys {
+		if k == key {
+			o.keys = append(o.keys[:i], o.keys[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+type Array struct {
+	Items []any
+}
+
+// Parse parses a single JSON value
+func Parse(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	value, err := parseValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("trailing characters after JSON value")
+	}
+	return value, nil
+}
+
+func parseValue(dec *json.Decoder) (any, error) {
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		obj := NewObject()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key.(string), value)
+		}
+		_, err = dec.Token()
+		return obj, err
+	case '[':
+		arr := &Array{}
+		for dec.More() {
+			value, err := parseValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			arr.Items = append(arr.Items, value)
+		}
+		_, err = dec.Token()
+		return arr, err
+	default:
+		return nil, fmt.Errorf("unexpected '%s'", delim)
+	}
+}
+
+// TypeName returns the type of a value as reported by JSON.TYPE
+func TypeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		if strings.ContainsAny(string(v), ".eE") {
+			return "number"
+		}
+		return "integer"
+	case string:
+		return "string"
+	case *Object:
+		return "object"
+	case *Array:
+		return "array"
+	default:
+		return ""
+	}
+}
+
+// Clone returns a deep copy of a value
+func Clone(value any) any {
+	switch v := value.(type) {
+	case *Object:
+		obj := &Object{keys: make([]string, len(v.keys)), values: make(map[string]any, len(v.values))}
+		copy(obj.keys, v.keys)
+		for key, value := range v.values {
+			obj.values[key] = Clone(value)
+		}
+		return obj
+	case *Array:
+		arr := &Array{Items: make([]any, len(v.Items))}
+		for i, item := range v.Items {
+			arr.Items[i] = Clone(item)
+		}
+		return arr
+	default:
+		return value
+	}
+}
+
+// Format controls how values are serialized, as with the INDENT, NEWLINE and
+// SPACE options of JSON.GET. The zero value gives compact JSON.
+type Format struct {
+	Indent  string
+	Newline string
+	Space   string
+}
+
+func Marshal(value any, format Format) []byte {
+	var buf bytes.Buffer
+	format.write(&buf, value, 0)
+	return buf.Bytes()
+}
+
+func (f Format) newline(buf *bytes.Buffer, depth int) {
+	buf.WriteString(f.Newline)
+	for range depth {
+		buf.WriteString(f.Indent)
+	}
+}
+
+func (f Format) write(buf *bytes.Buffer, value any, depth int) {
+	switch v := value.(type) {
+	case nil:
+		buf.WriteString("null")
+	case bool:
+		if v {
+			buf.WriteString("true")
+		} else {
+			buf.WriteString("false")
+		}
+	case json.Number:
+		buf.WriteString(string(v))
+	case string:
+		writeString(buf, v)
+	case *Object:
+		buf.WriteByte('{')
+		for i, key := range v.keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			f.newline(buf, depth+1)
+			writeString(buf, key)
+			buf.WriteByte(':')
+			buf.WriteString(f.Space)
+			f.write(buf, v.values[key], depth+1)
+		}
+		if len(v.keys) > 0 {
+			f.newline(buf, depth)
+		}
+		buf.WriteByte('}')
+	case *Array:
+		buf.WriteByte('[')
+		for i, item := range v.Items {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			f.newline(buf, depth+1)
+			f.write(buf, item, depth+1)
+		}
+		if len(v.Items) > 0 {
+			f.newline(buf, depth)
+		}
+		buf.WriteByte(']')
+	}
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	var encoded bytes.Buffer
+	enc := json.NewEncoder(&encoded)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	buf.Write(bytes.TrimSuffix(encoded.Bytes(), []byte{'\n'}))
+}
+
+// Size estimates the memory used by a value
+func Size(value any) int {
+	switch v := value.(type) {
+	case json.Number:
+		return 16 + len(v)
+	case string:
+		return 16 + len(v)
+	case *Object:
+		size := 64
+		for key, value := range v.values {
+			size += 2*(16+len(key)) + 8 + Size(value)
+		}
+		return size
+	case *Array:
+		size := 24
+		for _, item := range v.Items {
+			size += Size(item)
+		}
+		return size
+	default:
+		return 16
+	}
+}
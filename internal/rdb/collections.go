@@ -0,0 +1,208 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Lengths of the scores of TYPE_ZSET standing for special values
+const (
+	ZSET_SCORE_NAN     = 253
+	ZSET_SCORE_POS_INF = 254
+	ZSET_SCORE_NEG_INF = 255
+)
+
+func parseZiplistStrings(buf []byte) ([]string, error) {
+	values, err := parseZiplist(buf)
+	return lpStrings(values), err
+}
+
+func parseListpackStrings(buf []byte) ([]string, error) {
+	values, err := parseListpack(buf)
+	return lpStrings(values), err
+}
+
+func lpStrings(values []lpValue) []string {
+	strs := make([]string, len(values))
+	for i, v := range values {
+		strs[i] = v.String()
+	}
+	return strs
+}
+
+// readEncoded reads a blob holding a whole value and decodes it with parse
+func (r *Reader) readEncoded(parse func([]byte) ([]string, error)) ([]string, error) {
+	blob, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse([]byte(blob))
+}
+
+func (r *Reader) readEncodedHash(parse func([]byte) ([]string, error)) (*Hash, error) {
+	fields, err := r.readEncoded(parse)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields)%2 != 0 {
+		return nil, errors.New("hash with a field without value")
+	}
+	return &Hash{Fields: fields}, nil
+}
+
+// readStringList reads the elements of a list or the members of a set, both
+// stored as a length followed by plain strings
+func (r *Reader) readStringList(valueType byte) (any, error) {
+	n, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	strs := make([]string, 0, min(n, MAX_PREALLOC/16))
+	for range n {
+		s, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+
+	if valueType == TYPE_SET {
+		return &Set{Members: strs}, nil
+	}
+	return &List{Elements: strs}, nil
+}
+
+func (r *Reader) readEncodedList(parse func([]byte) ([]string, error)) (*List, error) {
+	elements, err := r.readEncoded(parse)
+	if err != nil {
+		return nil, err
+	}
+	return &List{Elements: elements}, nil
+}
+
+// readQuicklist reads a list split into nodes, which are ziplists in the first
+// version and either listpacks or single large elements in the second
+func (r *Reader) readQuicklist(valueType byte) (*List, error) {
+	nodes, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &List{}
+	for range nodes {
+		container := uint64(QUICKLIST_NODE_CONTAINER_PACKED)
+		if valueType == TYPE_LIST_QUICKLIST_2 {
+			if container, err = r.readPlainLength(); err != nil {
+				return nil, err
+			}
+		}
+
+		blob, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var elements []string
+		switch {
+		case container == QUICKLIST_NODE_CONTAINER_PLAIN:
+			elements = []string{blob}
+		case container != QUICKLIST_NODE_CONTAINER_PACKED:
+			return nil, fmt.Errorf("unknown quicklist node container %d", container)
+		case valueType == TYPE_LIST_QUICKLIST_2:
+			elements, err = parseListpackStrings([]byte(blob))
+		default:
+			elements, err = parseZiplistStrings([]byte(blob))
+		}
+		if err != nil {
+			return nil, err
+		}
+		l.Elements = append(l.Elements, elements...)
+	}
+	return l, nil
+}
+
+func (r *Reader) readEncodedSet(parse func([]byte) ([]string, error)) (*Set, error) {
+	members, err := r.readEncoded(parse)
+	if err != nil {
+		return nil, err
+	}
+	return &Set{Members: members}, nil
+}
+
+// readZSet reads a sorted set stored as members each followed by its score,
+// as a string in the first version and as a binary double in the second
+func (r *Reader) readZSet(valueType byte) (*ZSet, error) {
+	n, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	z := &ZSet{Members: make([]ZMember, 0, min(n, MAX_PREALLOC/32))}
+	for range n {
+		member, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var score float64
+		if valueType == TYPE_ZSET_2 {
+			buf, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			score = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+		} else if score, err = r.readStringScore(); err != nil {
+			return nil, err
+		}
+		z.Members = append(z.Members, ZMember{member, score})
+	}
+	return z, nil
+}
+
+func (r *Reader) readStringScore() (float64, error) {
+	n, err := r.readByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch n {
+	case ZSET_SCORE_NAN:
+		return math.NaN(), nil
+	case ZSET_SCORE_POS_INF:
+		return math.Inf(1), nil
+	case ZSET_SCORE_NEG_INF:
+		return math.Inf(-1), nil
+	}
+
+	buf, err := r.read(int(n))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(buf), 64)
+}
+
+// readEncodedZSet reads a sorted set whose members and scores alternate in a
+// single blob
+func (r *Reader) readEncodedZSet(parse func([]byte) ([]string, error)) (*ZSet, error) {
+	values, err := r.readEncoded(parse)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("sorted set member without score")
+	}
+
+	z := &ZSet{Members: make([]ZMember, 0, len(values)/2)}
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		z.Members = append(z.Members, ZMember{values[i], score})
+	}
+	return z, nil
+}
@@ -0,0 +1,12 @@
+package rdb
+
+import "hash/crc64"
+
+// Redis checksums dumps with the CRC-64/Jones variant: reflected, zero initial
+// value and no final xor. hash/crc64 inverts the crc before and after each
+// update, so the inversions are undone around it.
+var jonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+func crcUpdate(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, jonesTable, p)
+}
@@ -0,0 +1,74 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+var ErrBadDump = errors.New("DUMP payload version or checksum are wrong")
+
+// Dump serializes a value the way DUMP does: its type and RDB encoding,
+// followed by the RDB version and a checksum of the whole, both little endian.
+// The value is a string, *Hash, *Stream or *Module.
+func Dump(value any) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf)
+
+	switch v := value.(type) {
+	case string:
+		w.writeByte(TYPE_STRING)
+		w.writeString(v)
+	case *Hash:
+		w.writeByte(TYPE_HASH)
+		w.writeHash(v)
+	case *Stream:
+		w.writeByte(TYPE_STREAM_LISTPACKS)
+		w.writeStream(v)
+	case *Module:
+		id, err := moduleID(v.Name, v.EncVer)
+		if err != nil {
+			return nil, err
+		}
+		w.writeByte(TYPE_MODULE_2)
+		w.writeModule(id, v)
+	default:
+		return nil, fmt.Errorf("can't dump values of type %T", value)
+	}
+
+	w.write(binary.LittleEndian.AppendUint16(nil, VERSION))
+	checksum := binary.LittleEndian.AppendUint64(nil, w.crc)
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err := w.w.Flush(); err != nil {
+		return nil, err
+	}
+	return append(buf.Bytes(), checksum...), nil
+}
+
+// Restore decodes a value serialized by Dump, or by DUMP on a Redis server of
+// the same or an older RDB version.
+func Restore(payload []byte) (any, error) {
+	if len(payload) < 10 {
+		return nil, ErrBadDump
+	}
+
+	body, footer := payload[:len(payload)-8], payload[len(payload)-8:]
+	if crcUpdate(0, body) != binary.LittleEndian.Uint64(footer) {
+		return nil, ErrBadDump
+	}
+	version := binary.LittleEndian.Uint16(body[len(body)-2:])
+	if version > VERSION {
+		return nil, ErrBadDump
+	}
+
+	r := NewReader(bytes.NewReader(body[:len(body)-2]))
+	r.Version = int(version)
+	valueType, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	return r.readValue(valueType)
+}
@@ -0,0 +1,232 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"strconv"
+)
+
+// Listpack element encodings
+const (
+	LP_7BIT_UINT      = 0x00
+	LP_6BIT_STR       = 0x80
+	LP_13BIT_INT      = 0xC0
+	LP_12BIT_STR      = 0xE0
+	LP_16BIT_INT      = 0xF1
+	LP_24BIT_INT      = 0xF2
+	LP_32BIT_INT      = 0xF3
+	LP_64BIT_INT      = 0xF4
+	LP_32BIT_STR      = 0xF0
+	LP_EOF            = 0xFF
+	LP_HEADER_SIZE    = 6
+	LP_BACKLEN_MAXLEN = 5
+)
+
+var errInvalidListpack = errors.New("invalid listpack")
+
+// listpack builds a listpack blob: a header with the total size and number of
+// elements, the elements each followed by their encoded length, and an EOF.
+type listpack struct {
+	buf   []byte
+	count int
+}
+
+func newListpack() *listpack {
+	return &listpack{buf: make([]byte, LP_HEADER_SIZE, 64)}
+}
+
+func (lp *listpack) appendEncoded(entry []byte) {
+	lp.buf = append(lp.buf, entry...)
+	lp.buf = append(lp.buf, encodeBacklen(len(entry))...)
+	lp.count++
+}
+
+func (lp *listpack) appendInt(v int64) {
+	var entry []byte
+	switch {
+	case v >= 0 && v <= 127:
+		entry = []byte{byte(v)}
+	case v >= -4096 && v <= 4095:
+		u := uint16(v) & 0x1FFF
+		entry = []byte{LP_13BIT_INT | byte(u>>8), byte(u)}
+	case v >= -(1<<15) && v < 1<<15:
+		entry = binary.LittleEndian.AppendUint16([]byte{LP_16BIT_INT}, uint16(v))
+	case v >= -(1<<23) && v < 1<<23:
+		u := uint32(v)
+		entry = []byte{LP_24BIT_INT, byte(u), byte(u >> 8), byte(u >> 16)}
+	case v >= -(1<<31) && v < 1<<31:
+		entry = binary.LittleEndian.AppendUint32([]byte{LP_32BIT_INT}, uint32(v))
+	default:
+		entry = binary.LittleEndian.AppendUint64([]byte{LP_64BIT_INT}, uint64(v))
+	}
+	lp.appendEncoded(entry)
+}
+
+func (lp *listpack) appendString(s string) {
+	var entry []byte
+	switch n := len(s); {
+	case n < 64:
+		entry = []byte{LP_6BIT_STR | byte(n)}
+	case n < 4096:
+		entry = []byte{LP_12BIT_STR | byte(n>>8), byte(n)}
+	default:
+		entry = binary.LittleEndian.AppendUint32([]byte{LP_32BIT_STR}, uint32(n))
+	}
+	lp.appendEncoded(append(entry, s...))
+}
+
+func (lp *listpack) bytes() []byte {
+	buf := append(lp.buf[:len(lp.buf):len(lp.buf)], LP_EOF)
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(buf)))
+	count := lp.count
+	if count > 0xFFFF {
+		// The count is unknown and must be computed by walking the elements
+		count = 0xFFFF
+	}
+	binary.LittleEndian.PutUint16(buf[4:], uint16(count))
+	return buf
+}
+
+// The length of an element is stored after it so that the listpack can be
+// walked backwards: 7 bits per byte, the most significant ones first.
+func encodeBacklen(l int) []byte {
+	switch {
+	case l <= 127:
+		return []byte{byte(l)}
+	case l < 16383:
+		return []byte{byte(l >> 7), byte(l&127) | 128}
+	case l < 2097151:
+		return []byte{byte(l >> 14), byte((l>>7)&127) | 128, byte(l&127) | 128}
+	case l < 268435455:
+		return []byte{byte(l >> 21), byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	default:
+		return []byte{byte(l >> 28), byte((l>>21)&127) | 128, byte((l>>14)&127) | 128, byte((l>>7)&127) | 128, byte(l&127) | 128}
+	}
+}
+
+func backlenSize(l int) int {
+	switch {
+	case l <= 127:
+		return 1
+	case l < 16383:
+		return 2
+	case l < 2097151:
+		return 3
+	case l < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// lpValue is a listpack element, which is either a string or an integer.
+type lpValue struct {
+	str   string
+	num   int64
+	isNum bool
+}
+
+func (v lpValue) String() string {
+	if v.isNum {
+		return strconv.FormatInt(v.num, 10)
+	}
+	return v.str
+}
+
+func (v lpValue) Int() (int64, error) {
+	if v.isNum {
+		return v.num, nil
+	}
+	return strconv.ParseInt(v.str, 10, 64)
+}
+
+// parseListpack decodes every element of a listpack blob
+func parseListpack(buf []byte) ([]lpValue, error) {
+	if len(buf) < LP_HEADER_SIZE+1 || int(binary.LittleEndian.Uint32(buf)) != len(buf) {
+		return nil, errInvalidListpack
+	}
+
+	values := make([]lpValue, 0, binary.LittleEndian.Uint16(buf[4:]))
+	for i := LP_HEADER_SIZE; ; {
+		if i >= len(buf) {
+			return nil, errInvalidListpack
+		}
+		if buf[i] == LP_EOF {
+			return values, nil
+		}
+
+		value, size, err := parseListpackElement(buf[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		i += size + backlenSize(size)
+	}
+}
+
+// parseListpackElement returns the element at the start of buf and the size
+// of its encoding, excluding the backlen.
+func parseListpackElement(buf []byte) (lpValue, int, error) {
+	need := func(n int) bool { return len(buf) >= n }
+	enc := buf[0]
+	switch {
+	case enc&0x80 == LP_7BIT_UINT:
+		return lpValue{num: int64(enc & 0x7F), isNum: true}, 1, nil
+	case enc&0xC0 == LP_6BIT_STR:
+		n := int(enc & 0x3F)
+		if !need(1 + n) {
+			break
+		}
+		return lpValue{str: string(buf[1 : 1+n])}, 1 + n, nil
+	case enc&0xE0 == LP_13BIT_INT:
+		if !need(2) {
+			break
+		}
+		u := uint16(enc&0x1F)<<8 | uint16(buf[1])
+		v := int64(u)
+		if u >= 1<<12 {
+			v -= 1 << 13
+		}
+		return lpValue{num: v, isNum: true}, 2, nil
+	case enc&0xF0 == LP_12BIT_STR:
+		if !need(2) {
+			break
+		}
+		n := int(enc&0x0F)<<8 | int(buf[1])
+		if !need(2 + n) {
+			break
+		}
+		return lpValue{str: string(buf[2 : 2+n])}, 2 + n, nil
+	case enc == LP_32BIT_STR:
+		if !need(5) {
+			break
+		}
+		n := int(binary.LittleEndian.Uint32(buf[1:]))
+		if !need(5 + n) {
+			break
+		}
+		return lpValue{str: string(buf[5 : 5+n])}, 5 + n, nil
+	case enc == LP_16BIT_INT:
+		if !need(3) {
+			break
+		}
+		return lpValue{num: int64(int16(binary.LittleEndian.Uint16(buf[1:]))), isNum: true}, 3, nil
+	case enc == LP_24BIT_INT:
+		if !need(4) {
+			break
+		}
+		u := int32(uint32(buf[1])<<8|uint32(buf[2])<<16|uint32(buf[3])<<24) >> 8
+		return lpValue{num: int64(u), isNum: true}, 4, nil
+	case enc == LP_32BIT_INT:
+		if !need(5) {
+			break
+		}
+		return lpValue{num: int64(int32(binary.LittleEndian.Uint32(buf[1:]))), isNum: true}, 5, nil
+	case enc == LP_64BIT_INT:
+		if !need(9) {
+			break
+		}
+		return lpValue{num: int64(binary.LittleEndian.Uint64(buf[1:])), isNum: true}, 9, nil
+	}
+	return lpValue{}, 0, errInvalidListpack
+}
@@ -0,0 +1,55 @@
+package rdb
+
+import "errors"
+
+var errInvalidLZF = errors.New("invalid LZF compressed string")
+
+// lzfDecompress expands data compressed with LZF, as Redis does for long
+// strings, into a buffer of the original length. A control byte below 32
+// starts a run of that many literal bytes plus one, any other is a
+// back-reference: a length in its 3 high bits, extended by the next byte when
+// they are all set, and an offset in its 5 low bits and the following byte.
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	out := make([]byte, 0, outLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+
+		if ctrl < 32 {
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errInvalidLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errInvalidLZF
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errInvalidLZF
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errInvalidLZF
+		}
+		// The reference may overlap the bytes being written
+		for j := 0; j < n; j++ {
+			out = append(out, out[ref+j])
+		}
+	}
+
+	if len(out) != outLen {
+		return nil, errInvalidLZF
+	}
+	return out, nil
+}
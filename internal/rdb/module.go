@@ -0,0 +1,154 @@
+package rdb
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Characters allowed in module type names, whose index is their 6 bit code
+const MODULE_NAME_CHARSET = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-_"
+
+const (
+	// Module type names are exactly this long
+	MODULE_NAME_LENGTH = 9
+	// Bits of the module id holding the encoding version
+	MODULE_ENCVER_BITS = 10
+)
+
+// Opcodes preceding every value of a module type, so that dumps can be parsed
+// without knowing the type
+const (
+	MODULE_OPCODE_EOF    = 0
+	MODULE_OPCODE_SINT   = 1
+	MODULE_OPCODE_UINT   = 2
+	MODULE_OPCODE_FLOAT  = 3
+	MODULE_OPCODE_DOUBLE = 4
+	MODULE_OPCODE_STRING = 5
+)
+
+// Module is a value of a type implemented by a module. Types of this server
+// store their whole value as a single string.
+type Module struct {
+	Name    string
+	EncVer  int
+	Payload []byte
+}
+
+func moduleID(name string, encver int) (uint64, error) {
+	if len(name) != MODULE_NAME_LENGTH {
+		return 0, fmt.Errorf("module type name '%s' must be %d characters long", name, MODULE_NAME_LENGTH)
+	}
+
+	var id uint64
+	for i := 0; i < len(name); i++ {
+		code := strings.IndexByte(MODULE_NAME_CHARSET, name[i])
+		if code < 0 {
+			return 0, fmt.Errorf("invalid character in module type name '%s'", name)
+		}
+		id = id<<6 | uint64(code)
+	}
+	return id<<MODULE_ENCVER_BITS | uint64(encver&(1<<MODULE_ENCVER_BITS-1)), nil
+}
+
+func moduleName(id uint64) (string, int) {
+	encver := int(id & (1<<MODULE_ENCVER_BITS - 1))
+	id >>= MODULE_ENCVER_BITS
+
+	name := make([]byte, MODULE_NAME_LENGTH)
+	for i := MODULE_NAME_LENGTH - 1; i >= 0; i-- {
+		name[i] = MODULE_NAME_CHARSET[id&63]
+		id >>= 6
+	}
+	return string(name), encver
+}
+
+func (w *Writer) WriteModule(key string, m *Module, exp time.Time) error {
+	id, err := moduleID(m.Name, m.EncVer)
+	if err != nil {
+		return err
+	}
+
+	w.writeKeyPrefix(key, TYPE_MODULE_2, exp)
+	w.writeModule(id, m)
+	return w.err
+}
+
+func (w *Writer) writeModule(id uint64, m *Module) {
+	w.writeLength(id)
+	w.writeLength(MODULE_OPCODE_STRING)
+	w.writeString(string(m.Payload))
+	w.writeLength(MODULE_OPCODE_EOF)
+}
+
+func (r *Reader) readModule() (*Module, error) {
+	id, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Module{}
+	m.Name, m.EncVer = moduleName(id)
+	for {
+		opcode, err := r.readPlainLength()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case MODULE_OPCODE_EOF:
+			if m.Payload == nil {
+				return nil, fmt.Errorf("empty value of module type %s", m.Name)
+			}
+			return m, nil
+		case MODULE_OPCODE_STRING:
+			if m.Payload != nil {
+				return nil, fmt.Errorf("unsupported encoding of module type %s", m.Name)
+			}
+			s, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			m.Payload = []byte(s)
+		default:
+			return nil, fmt.Errorf("unsupported encoding of module type %s", m.Name)
+		}
+	}
+}
+
+// skipModuleAux skips the auxiliary data a module saved along the keys, which
+// is made of the module id, when it was saved, and values preceded by their
+// opcode
+func (r *Reader) skipModuleAux() error {
+	// Module id, then the opcode and value of the when field
+	for range 3 {
+		if _, err := r.readPlainLength(); err != nil {
+			return err
+		}
+	}
+
+	for {
+		opcode, err := r.readPlainLength()
+		if err != nil {
+			return err
+		}
+
+		switch opcode {
+		case MODULE_OPCODE_EOF:
+			return nil
+		case MODULE_OPCODE_SINT, MODULE_OPCODE_UINT:
+			_, err = r.readPlainLength()
+		case MODULE_OPCODE_FLOAT:
+			_, err = r.read(4)
+		case MODULE_OPCODE_DOUBLE:
+			_, err = r.read(8)
+		case MODULE_OPCODE_STRING:
+			_, err = r.readString()
+		default:
+			return fmt.Errorf("unknown module opcode %d in auxiliary data", opcode)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
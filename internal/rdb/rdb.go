@@ -0,0 +1,108 @@
+package rdb
+
+const (
+	MAGIC   = "REDIS"
+	VERSION = 11
+
+	OP_FUNCTION2     = 0xF5
+	OP_MODULE_AUX    = 0xF7
+	OP_IDLE          = 0xF8
+	OP_FREQ          = 0xF9
+	OP_AUX           = 0xFA
+	OP_RESIZEDB      = 0xFB
+	OP_EXPIRETIME_MS = 0xFC
+	OP_EXPIRETIME    = 0xFD
+	OP_SELECTDB      = 0xFE
+	OP_EOF           = 0xFF
+
+	TYPE_STRING             = 0
+	TYPE_LIST               = 1
+	TYPE_SET                = 2
+	TYPE_ZSET               = 3
+	TYPE_HASH               = 4
+	TYPE_ZSET_2             = 5
+	TYPE_MODULE_2           = 7
+	TYPE_HASH_ZIPMAP        = 9
+	TYPE_LIST_ZIPLIST       = 10
+	TYPE_SET_INTSET         = 11
+	TYPE_ZSET_ZIPLIST       = 12
+	TYPE_HASH_ZIPLIST       = 13
+	TYPE_LIST_QUICKLIST     = 14
+	TYPE_STREAM_LISTPACKS   = 15
+	TYPE_HASH_LISTPACK      = 16
+	TYPE_ZSET_LISTPACK      = 17
+	TYPE_LIST_QUICKLIST_2   = 18
+	TYPE_STREAM_LISTPACKS_2 = 19
+	TYPE_SET_LISTPACK       = 20
+	TYPE_STREAM_LISTPACKS_3 = 21
+)
+
+// Containers of the nodes of a TYPE_LIST_QUICKLIST_2 list
+const (
+	QUICKLIST_NODE_CONTAINER_PLAIN  = 1
+	QUICKLIST_NODE_CONTAINER_PACKED = 2
+)
+
+// Special string encodings, flagged with LEN_ENCV in the length
+const (
+	ENC_INT8  = 0
+	ENC_INT16 = 1
+	ENC_INT32 = 2
+	ENC_LZF   = 3
+)
+
+// Flags of the entries stored in stream listpacks
+const (
+	STREAM_ITEM_FLAG_NONE       = 0
+	STREAM_ITEM_FLAG_DELETED    = 1
+	STREAM_ITEM_FLAG_SAMEFIELDS = 2
+)
+
+type Hash struct {
+	// Field names and values, alternated
+	Fields []string
+}
+
+// List, Set and ZSet are only read, from dumps made by Redis, as this server
+// has no such types
+type List struct {
+	Elements []string
+}
+
+type Set struct {
+	Members []string
+}
+
+type ZMember struct {
+	Member string
+	Score  float64
+}
+
+type ZSet struct {
+	Members []ZMember
+}
+
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// Field names and values, alternated
+	Fields []string
+}
+
+type Stream struct {
+	Entries []StreamEntry
+	LastID  StreamID
+}
+
+// Length encodings, stored in the two most significant bits of the first byte
+const (
+	LEN_6BIT  = 0
+	LEN_14BIT = 1
+	LEN_32BIT = 0x80
+	LEN_64BIT = 0x81
+	LEN_ENCV  = 3
+)
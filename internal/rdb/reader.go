@@ -0,0 +1,588 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+var ErrChecksum = errors.New("wrong RDB checksum")
+
+// Entry is a key read from a dump. Value is a string, *Hash, *Stream,
+// *Module, *List, *Set or *ZSet depending on Type, whatever its encoding, and
+// a zero Expire means the key doesn't expire.
+type Entry struct {
+	DB     int
+	Key    string
+	Type   byte
+	Value  any
+	Expire time.Time
+}
+
+// Reader decodes a dump produced by Writer or by Redis itself
+type Reader struct {
+	r       *bufio.Reader
+	crc     uint64
+	offset  int64
+	db      int
+	Version int
+	Aux     map[string]string
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{
+		r:   bufio.NewReader(r),
+		Aux: map[string]string{},
+	}
+}
+
+// Lengths above this are read incrementally, so that a corrupted length
+// doesn't allocate a huge buffer up front.
+const MAX_PREALLOC = 1 << 20
+
+func (r *Reader) read(n int) ([]byte, error) {
+	var buf []byte
+	if n <= MAX_PREALLOC {
+		buf = make([]byte, n)
+		read, err := io.ReadFull(r.r, buf)
+		r.offset += int64(read)
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+	} else {
+		var b bytes.Buffer
+		read, err := io.CopyN(&b, r.r, int64(n))
+		r.offset += read
+		if err != nil {
+			return nil, unexpectedEOF(err)
+		}
+		buf = b.Bytes()
+	}
+
+	r.crc = crcUpdate(r.crc, buf)
+	return buf, nil
+}
+
+func unexpectedEOF(err error) error {
+	if errors.Is(err, io.EOF) {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Offset returns the number of bytes consumed so far, which points right
+// after the faulty data when an error is returned.
+func (r *Reader) Offset() int64 {
+	return r.offset
+}
+
+func (r *Reader) readByte() (byte, error) {
+	buf, err := r.read(1)
+	if err != nil {
+		return 0, err
+	}
+	return buf[0], nil
+}
+
+// readLength returns a length, or the special encoding of the string that
+// follows when encoded is true.
+func (r *Reader) readLength() (n uint64, encoded bool, err error) {
+	b, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+
+	switch b >> 6 {
+	case LEN_6BIT:
+		return uint64(b & 0x3F), false, nil
+	case LEN_14BIT:
+		next, err := r.readByte()
+		return uint64(b&0x3F)<<8 | uint64(next), false, err
+	case LEN_ENCV:
+		return uint64(b & 0x3F), true, nil
+	}
+
+	switch b {
+	case LEN_32BIT:
+		buf, err := r.read(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(buf)), false, nil
+	case LEN_64BIT:
+		buf, err := r.read(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(buf), false, nil
+	}
+	return 0, false, fmt.Errorf("unknown length encoding %x", b)
+}
+
+func (r *Reader) readPlainLength() (uint64, error) {
+	n, encoded, err := r.readLength()
+	if err == nil && encoded {
+		err = errors.New("unexpected encoded length")
+	}
+	return n, err
+}
+
+func (r *Reader) readString() (string, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return "", err
+	}
+
+	if !encoded {
+		buf, err := r.read(int(n))
+		return string(buf), err
+	}
+
+	switch n {
+	case ENC_INT8:
+		b, err := r.readByte()
+		return strconv.Itoa(int(int8(b))), err
+	case ENC_INT16:
+		buf, err := r.read(2)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int16(binary.LittleEndian.Uint16(buf)))), nil
+	case ENC_INT32:
+		buf, err := r.read(4)
+		if err != nil {
+			return "", err
+		}
+		return strconv.Itoa(int(int32(binary.LittleEndian.Uint32(buf)))), nil
+	case ENC_LZF:
+		clen, err := r.readPlainLength()
+		if err != nil {
+			return "", err
+		}
+		ulen, err := r.readPlainLength()
+		if err != nil {
+			return "", err
+		}
+		compressed, err := r.read(int(clen))
+		if err != nil {
+			return "", err
+		}
+		buf, err := lzfDecompress(compressed, int(ulen))
+		return string(buf), err
+	}
+	return "", fmt.Errorf("unsupported string encoding %d", n)
+}
+
+// ReadHeader checks the magic string and reads the version
+func (r *Reader) ReadHeader() error {
+	buf, err := r.read(9)
+	if err != nil {
+		return err
+	}
+
+	if string(buf[:5]) != MAGIC {
+		return errors.New("wrong signature trying to load DB from file")
+	}
+
+	r.Version, err = strconv.Atoi(string(buf[5:]))
+	if err != nil || r.Version < 1 || r.Version > VERSION {
+		return fmt.Errorf("can't handle RDB format version %s", buf[5:])
+	}
+	return nil
+}
+
+// Next returns the next key of the dump, or io.EOF once the end of the dump
+// has been reached and its checksum verified.
+func (r *Reader) Next() (*Entry, error) {
+	var expire time.Time
+	for {
+		opcode, err := r.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		switch opcode {
+		case OP_AUX:
+			key, err := r.readString()
+			if err != nil {
+				return nil, err
+			}
+			if r.Aux[key], err = r.readString(); err != nil {
+				return nil, err
+			}
+		case OP_SELECTDB:
+			db, err := r.readPlainLength()
+			if err != nil {
+				return nil, err
+			}
+			r.db = int(db)
+		case OP_RESIZEDB:
+			if _, err := r.readPlainLength(); err != nil {
+				return nil, err
+			}
+			if _, err := r.readPlainLength(); err != nil {
+				return nil, err
+			}
+		case OP_EXPIRETIME_MS:
+			buf, err := r.read(8)
+			if err != nil {
+				return nil, err
+			}
+			expire = time.UnixMilli(int64(binary.LittleEndian.Uint64(buf)))
+		case OP_EXPIRETIME:
+			buf, err := r.read(4)
+			if err != nil {
+				return nil, err
+			}
+			expire = time.Unix(int64(binary.LittleEndian.Uint32(buf)), 0)
+		case OP_IDLE:
+			if _, err := r.readPlainLength(); err != nil {
+				return nil, err
+			}
+		case OP_FREQ:
+			if _, err := r.readByte(); err != nil {
+				return nil, err
+			}
+		case OP_FUNCTION2:
+			// The code of a function library, which can't run here
+			if _, err := r.readString(); err != nil {
+				return nil, err
+			}
+		case OP_MODULE_AUX:
+			if err := r.skipModuleAux(); err != nil {
+				return nil, err
+			}
+		case OP_EOF:
+			return nil, r.verifyChecksum()
+		default:
+			return r.readEntry(opcode, expire)
+		}
+	}
+}
+
+func (r *Reader) verifyChecksum() error {
+	expected := r.crc
+	if r.Version < 5 {
+		return io.EOF
+	}
+
+	buf, err := r.read(8)
+	if err != nil {
+		return err
+	}
+
+	// A zero checksum means checksums were disabled when saving
+	checksum := binary.LittleEndian.Uint64(buf)
+	if checksum != 0 && checksum != expected {
+		return ErrChecksum
+	}
+	return io.EOF
+}
+
+func (r *Reader) readEntry(valueType byte, expire time.Time) (*Entry, error) {
+	key, err := r.readString()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &Entry{DB: r.db, Key: key, Type: valueType, Expire: expire}
+	if entry.Value, err = r.readValue(valueType); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func (r *Reader) readValue(valueType byte) (any, error) {
+	switch valueType {
+	case TYPE_STRING:
+		return r.readString()
+	case TYPE_HASH:
+		return r.readHash()
+	case TYPE_HASH_ZIPMAP:
+		return r.readEncodedHash(parseZipmap)
+	case TYPE_HASH_ZIPLIST:
+		return r.readEncodedHash(parseZiplistStrings)
+	case TYPE_HASH_LISTPACK:
+		return r.readEncodedHash(parseListpackStrings)
+	case TYPE_LIST, TYPE_SET:
+		return r.readStringList(valueType)
+	case TYPE_LIST_ZIPLIST:
+		return r.readEncodedList(parseZiplistStrings)
+	case TYPE_LIST_QUICKLIST, TYPE_LIST_QUICKLIST_2:
+		return r.readQuicklist(valueType)
+	case TYPE_SET_INTSET:
+		return r.readEncodedSet(parseIntset)
+	case TYPE_SET_LISTPACK:
+		return r.readEncodedSet(parseListpackStrings)
+	case TYPE_ZSET, TYPE_ZSET_2:
+		return r.readZSet(valueType)
+	case TYPE_ZSET_ZIPLIST:
+		return r.readEncodedZSet(parseZiplistStrings)
+	case TYPE_ZSET_LISTPACK:
+		return r.readEncodedZSet(parseListpackStrings)
+	case TYPE_STREAM_LISTPACKS, TYPE_STREAM_LISTPACKS_2, TYPE_STREAM_LISTPACKS_3:
+		return r.readStream(valueType)
+	case TYPE_MODULE_2:
+		return r.readModule()
+	default:
+		return nil, fmt.Errorf("unsupported value type %d", valueType)
+	}
+}
+
+func (r *Reader) readHash() (*Hash, error) {
+	n, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	h := &Hash{Fields: make([]string, 0, min(2*n, MAX_PREALLOC/16))}
+	for range 2 * n {
+		s, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		h.Fields = append(h.Fields, s)
+	}
+	return h, nil
+}
+
+func (r *Reader) readStream(valueType byte) (*Stream, error) {
+	nodes, err := r.readPlainLength()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stream{}
+	for range nodes {
+		nodeKey, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		if len(nodeKey) != 16 {
+			return nil, errors.New("stream node key entry is not the size of a stream ID")
+		}
+
+		blob, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		master := StreamID{
+			Ms:  binary.BigEndian.Uint64([]byte(nodeKey)),
+			Seq: binary.BigEndian.Uint64([]byte(nodeKey[8:])),
+		}
+		if s.Entries, err = appendStreamNode(s.Entries, master, blob); err != nil {
+			return nil, err
+		}
+	}
+
+	// Number of entries, which is known from the nodes already
+	if _, err := r.readPlainLength(); err != nil {
+		return nil, err
+	}
+	if s.LastID.Ms, err = r.readPlainLength(); err != nil {
+		return nil, err
+	}
+	if s.LastID.Seq, err = r.readPlainLength(); err != nil {
+		return nil, err
+	}
+	if valueType >= TYPE_STREAM_LISTPACKS_2 {
+		// First entry ID, max deleted entry ID and entries added, which are
+		// known from the entries as there is no XDEL or trimming
+		for range 5 {
+			if _, err := r.readPlainLength(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Consumer groups are read and dropped, as XREADGROUP isn't supported
+	if err := r.skipStreamGroups(valueType); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (r *Reader) skipStreamGroups(valueType byte) error {
+	skipLengths := func(n int) error {
+		for range n {
+			if _, err := r.readPlainLength(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	groups, err := r.readPlainLength()
+	if err != nil {
+		return err
+	}
+	for range groups {
+		// Name, then last delivered ID
+		if _, err := r.readString(); err != nil {
+			return err
+		}
+		if err := skipLengths(2); err != nil {
+			return err
+		}
+		if valueType >= TYPE_STREAM_LISTPACKS_2 {
+			// Entries read
+			if err := skipLengths(1); err != nil {
+				return err
+			}
+		}
+
+		// Pending entries: raw ID, delivery time and delivery count
+		pending, err := r.readPlainLength()
+		if err != nil {
+			return err
+		}
+		for range pending {
+			if _, err := r.read(16 + 8); err != nil {
+				return err
+			}
+			if err := skipLengths(1); err != nil {
+				return err
+			}
+		}
+
+		consumers, err := r.readPlainLength()
+		if err != nil {
+			return err
+		}
+		for range consumers {
+			if _, err := r.readString(); err != nil {
+				return err
+			}
+			// Seen time, then active time since the third version
+			times := 1
+			if valueType >= TYPE_STREAM_LISTPACKS_3 {
+				times = 2
+			}
+			if _, err := r.read(8 * times); err != nil {
+				return err
+			}
+
+			// Raw IDs of the entries pending for the consumer
+			pending, err := r.readPlainLength()
+			if err != nil {
+				return err
+			}
+			if _, err := r.read(16 * int(pending)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// appendStreamNode decodes the entries of a stream listpack whose IDs are
+// relative to the master ID.
+func appendStreamNode(entries []StreamEntry, master StreamID, blob string) ([]StreamEntry, error) {
+	values, err := parseListpack([]byte(blob))
+	if err != nil {
+		return nil, err
+	}
+
+	pos := 0
+	next := func() (lpValue, error) {
+		if pos >= len(values) {
+			return lpValue{}, errInvalidListpack
+		}
+		pos++
+		return values[pos-1], nil
+	}
+	nextInt := func() (int64, error) {
+		v, err := next()
+		if err != nil {
+			return 0, err
+		}
+		return v.Int()
+	}
+
+	count, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+	numMasterFields, err := nextInt()
+	if err != nil {
+		return nil, err
+	}
+
+	masterFields := make([]string, numMasterFields)
+	for i := range masterFields {
+		v, err := next()
+		if err != nil {
+			return nil, err
+		}
+		masterFields[i] = v.String()
+	}
+	// Master entry terminator
+	if _, err := next(); err != nil {
+		return nil, err
+	}
+
+	for range count + deleted {
+		flags, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		msDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+		seqDiff, err := nextInt()
+		if err != nil {
+			return nil, err
+		}
+
+		var fields []string
+		if flags&STREAM_ITEM_FLAG_SAMEFIELDS != 0 {
+			fields = make([]string, 0, 2*len(masterFields))
+			for _, field := range masterFields {
+				v, err := next()
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, field, v.String())
+			}
+		} else {
+			numFields, err := nextInt()
+			if err != nil {
+				return nil, err
+			}
+			fields = make([]string, 0, 2*numFields)
+			for range 2 * numFields {
+				v, err := next()
+				if err != nil {
+					return nil, err
+				}
+				fields = append(fields, v.String())
+			}
+		}
+
+		// lp-count, used to walk the listpack backwards
+		if _, err := next(); err != nil {
+			return nil, err
+		}
+
+		if flags&STREAM_ITEM_FLAG_DELETED != 0 {
+			continue
+		}
+		entries = append(entries, StreamEntry{
+			ID:     StreamID{master.Ms + uint64(msDiff), master.Seq + uint64(seqDiff)},
+			Fields: fields,
+		})
+	}
+
+	return entries, nil
+}
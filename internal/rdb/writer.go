@@ -0,0 +1,173 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Writer serializes a dataset in the RDB format, keeping track of the running
+// checksum written at the end of the dump.
+type Writer struct {
+	w   *bufio.Writer
+	crc uint64
+	err error
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) write(p []byte) {
+	if w.err != nil {
+		return
+	}
+
+	w.crc = crcUpdate(w.crc, p)
+	_, w.err = w.w.Write(p)
+}
+
+func (w *Writer) writeByte(b byte) {
+	w.write([]byte{b})
+}
+
+func (w *Writer) writeLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		w.writeByte(byte(n))
+	case n < 1<<14:
+		w.write([]byte{byte(n>>8) | LEN_14BIT<<6, byte(n)})
+	case n <= 0xFFFFFFFF:
+		buf := []byte{LEN_32BIT, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(buf[1:], uint32(n))
+		w.write(buf)
+	default:
+		buf := []byte{LEN_64BIT, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(buf[1:], n)
+		w.write(buf)
+	}
+}
+
+func (w *Writer) writeString(s string) {
+	w.writeLength(uint64(len(s)))
+	w.write([]byte(s))
+}
+
+// WriteHeader writes the magic string, version and auxiliary fields
+func (w *Writer) WriteHeader(aux map[string]string) error {
+	w.write([]byte(fmt.Sprintf("%s%04d", MAGIC, VERSION)))
+	for key, value := range aux {
+		w.writeByte(OP_AUX)
+		w.writeString(key)
+		w.writeString(value)
+	}
+	return w.err
+}
+
+// SelectDB starts the section of database index, with size hints for the
+// number of keys and keys with an expiration.
+func (w *Writer) SelectDB(index, keys, expires int) error {
+	w.writeByte(OP_SELECTDB)
+	w.writeLength(uint64(index))
+	w.writeByte(OP_RESIZEDB)
+	w.writeLength(uint64(keys))
+	w.writeLength(uint64(expires))
+	return w.err
+}
+
+func (w *Writer) writeKeyPrefix(key string, valueType byte, exp time.Time) {
+	if !exp.IsZero() {
+		buf := make([]byte, 9)
+		buf[0] = OP_EXPIRETIME_MS
+		binary.LittleEndian.PutUint64(buf[1:], uint64(exp.UnixMilli()))
+		w.write(buf)
+	}
+	w.writeByte(valueType)
+	w.writeString(key)
+}
+
+// WriteString writes a string key. A zero exp means no expiration.
+func (w *Writer) WriteString(key, value string, exp time.Time) error {
+	w.writeKeyPrefix(key, TYPE_STRING, exp)
+	w.writeString(value)
+	return w.err
+}
+
+// WriteHash writes a hash key with the plain encoding, one string per field
+// and value.
+func (w *Writer) WriteHash(key string, h *Hash, exp time.Time) error {
+	w.writeKeyPrefix(key, TYPE_HASH, exp)
+	w.writeHash(h)
+	return w.err
+}
+
+func (w *Writer) writeHash(h *Hash) {
+	w.writeLength(uint64(len(h.Fields) / 2))
+	for _, s := range h.Fields {
+		w.writeString(s)
+	}
+}
+
+// Close writes the EOF opcode and the checksum, and flushes the dump.
+func (w *Writer) Close() error {
+	w.writeByte(OP_EOF)
+	if w.err != nil {
+		return w.err
+	}
+
+	checksum := make([]byte, 8)
+	binary.LittleEndian.PutUint64(checksum, w.crc)
+	if _, err := w.w.Write(checksum); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
+
+// WriteStream writes a stream key. Every entry gets its own listpack, using
+// its fields as the master fields so that the entry only stores the values.
+func (w *Writer) WriteStream(key string, s *Stream, exp time.Time) error {
+	w.writeKeyPrefix(key, TYPE_STREAM_LISTPACKS, exp)
+	w.writeStream(s)
+	return w.err
+}
+
+func (w *Writer) writeStream(s *Stream) {
+	w.writeLength(uint64(len(s.Entries)))
+
+	for _, entry := range s.Entries {
+		nodeKey := make([]byte, 16)
+		binary.BigEndian.PutUint64(nodeKey, entry.ID.Ms)
+		binary.BigEndian.PutUint64(nodeKey[8:], entry.ID.Seq)
+		w.writeString(string(nodeKey))
+
+		numFields := len(entry.Fields) / 2
+		lp := newListpack()
+		// Master entry: count, deleted, number of fields, fields, terminator
+		lp.appendInt(1)
+		lp.appendInt(0)
+		lp.appendInt(int64(numFields))
+		for i := 0; i < numFields; i++ {
+			lp.appendString(entry.Fields[2*i])
+		}
+		lp.appendInt(0)
+
+		// Entry: flags, ms and seq diffs with the master ID, values, lp-count
+		lp.appendInt(STREAM_ITEM_FLAG_SAMEFIELDS)
+		lp.appendInt(0)
+		lp.appendInt(0)
+		for i := 0; i < numFields; i++ {
+			lp.appendString(entry.Fields[2*i+1])
+		}
+		lp.appendInt(int64(numFields + 3))
+
+		w.writeString(string(lp.bytes()))
+	}
+
+	w.writeLength(uint64(len(s.Entries)))
+	w.writeLength(s.LastID.Ms)
+	w.writeLength(s.LastID.Seq)
+	// No consumer groups
+	w.writeLength(0)
+}
@@ -0,0 +1,184 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	errInvalidZiplist = errors.New("invalid ziplist")
+	errInvalidIntset  = errors.New("invalid intset")
+	errInvalidZipmap  = errors.New("invalid zipmap")
+)
+
+// Ziplist layout, the encoding of small lists, hashes and sorted sets before
+// listpacks replaced it
+const (
+	ZIPLIST_HEADER_SIZE = 10
+	ZIPLIST_END         = 0xFF
+	// A previous entry length of this value is followed by the 4 byte length
+	ZIPLIST_BIG_PREVLEN = 0xFE
+)
+
+// parseZiplist decodes every entry of a ziplist blob. An entry starts with
+// the length of the previous one, then its encoding, which is either the
+// length of a string or the type of an integer.
+func parseZiplist(buf []byte) ([]lpValue, error) {
+	if len(buf) < ZIPLIST_HEADER_SIZE+1 || int(binary.LittleEndian.Uint32(buf)) != len(buf) {
+		return nil, errInvalidZiplist
+	}
+
+	values := make([]lpValue, 0, binary.LittleEndian.Uint16(buf[8:]))
+	for i := ZIPLIST_HEADER_SIZE; ; {
+		if i >= len(buf) {
+			return nil, errInvalidZiplist
+		}
+		if buf[i] == ZIPLIST_END {
+			return values, nil
+		}
+
+		if buf[i] == ZIPLIST_BIG_PREVLEN {
+			i += 5
+		} else {
+			i++
+		}
+		if i >= len(buf) {
+			return nil, errInvalidZiplist
+		}
+
+		value, size, err := parseZiplistEntry(buf[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		i += size
+	}
+}
+
+// parseZiplistEntry returns the entry at the start of buf, right after the
+// previous entry length, and the size of its encoding and content
+func parseZiplistEntry(buf []byte) (lpValue, int, error) {
+	need := func(n int) bool { return len(buf) >= n }
+	enc := buf[0]
+
+	str := func(header, n int) (lpValue, int, error) {
+		if !need(header + n) {
+			return lpValue{}, 0, errInvalidZiplist
+		}
+		return lpValue{str: string(buf[header : header+n])}, header + n, nil
+	}
+	switch enc >> 6 {
+	case 0:
+		return str(1, int(enc&0x3F))
+	case 1:
+		if !need(2) {
+			break
+		}
+		return str(2, int(enc&0x3F)<<8|int(buf[1]))
+	case 2:
+		if !need(5) {
+			break
+		}
+		return str(5, int(binary.BigEndian.Uint32(buf[1:])))
+	}
+
+	switch {
+	case enc == 0xC0 && need(3):
+		return num(int64(int16(binary.LittleEndian.Uint16(buf[1:])))), 3, nil
+	case enc == 0xD0 && need(5):
+		return num(int64(int32(binary.LittleEndian.Uint32(buf[1:])))), 5, nil
+	case enc == 0xE0 && need(9):
+		return num(int64(binary.LittleEndian.Uint64(buf[1:]))), 9, nil
+	case enc == 0xF0 && need(4):
+		v := int32(uint32(buf[1])<<8|uint32(buf[2])<<16|uint32(buf[3])<<24) >> 8
+		return num(int64(v)), 4, nil
+	case enc == 0xFE && need(2):
+		return num(int64(int8(buf[1]))), 2, nil
+	case enc >= 0xF1 && enc <= 0xFD:
+		// Immediate values from 0 to 12
+		return num(int64(enc&0x0F) - 1), 1, nil
+	}
+	return lpValue{}, 0, errInvalidZiplist
+}
+
+// parseIntset decodes a sorted set of integers: the size of the integers,
+// their number, then the integers themselves, all little endian
+func parseIntset(buf []byte) ([]string, error) {
+	if len(buf) < 8 {
+		return nil, errInvalidIntset
+	}
+	width := int(binary.LittleEndian.Uint32(buf))
+	n := int(binary.LittleEndian.Uint32(buf[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(buf) != 8+n*width {
+		return nil, errInvalidIntset
+	}
+
+	members := make([]string, n)
+	for i := range members {
+		v := buf[8+i*width:]
+		switch width {
+		case 2:
+			members[i] = num(int64(int16(binary.LittleEndian.Uint16(v)))).String()
+		case 4:
+			members[i] = num(int64(int32(binary.LittleEndian.Uint32(v)))).String()
+		default:
+			members[i] = num(int64(binary.LittleEndian.Uint64(v))).String()
+		}
+	}
+	return members, nil
+}
+
+func num(v int64) lpValue {
+	return lpValue{num: v, isNum: true}
+}
+
+// parseZipmap decodes the fields and values of a zipmap, the encoding of
+// small hashes in dumps of old versions. Each length takes a byte, or 5 when
+// the first one is 254, and values are followed by unused bytes.
+func parseZipmap(buf []byte) ([]string, error) {
+	if len(buf) < 2 {
+		return nil, errInvalidZipmap
+	}
+
+	var fields []string
+	i := 1
+	readLen := func() (int, bool) {
+		if i >= len(buf) || buf[i] == 0xFF {
+			return 0, false
+		}
+		if buf[i] < 254 {
+			i++
+			return int(buf[i-1]), true
+		}
+		if i+5 > len(buf) {
+			return 0, false
+		}
+		n := int(binary.LittleEndian.Uint32(buf[i+1:]))
+		i += 5
+		return n, true
+	}
+
+	for i < len(buf) && buf[i] != 0xFF {
+		n, ok := readLen()
+		if !ok || i+n > len(buf) {
+			return nil, errInvalidZipmap
+		}
+		field := string(buf[i : i+n])
+		i += n
+
+		n, ok = readLen()
+		if !ok || i+1+n > len(buf) {
+			return nil, errInvalidZipmap
+		}
+		free := int(buf[i])
+		i++
+		value := string(buf[i : i+n])
+		i += n + free
+
+		fields = append(fields, field, value)
+	}
+	if i >= len(buf) {
+		return nil, errInvalidZipmap
+	}
+	return fields, nil
+}
@@ -0,0 +1,85 @@
+package replication
+
+import "sync"
+
+const DEFAULT_BACKLOG_SIZE = 1024 * 1024
+
+// Backlog keeps the last bytes of the replication stream in a circular
+// buffer, so that a replica that lost its link can resume from its offset
+// instead of loading a whole dump again. Its offset is the master replication
+// offset: the number of bytes ever propagated.
+type Backlog struct {
+	sync.Mutex
+	buf    []byte
+	offset int64
+	// Number of valid bytes in buf
+	histlen int
+}
+
+func NewBacklog(size int) *Backlog {
+	return &Backlog{buf: make([]byte, size)}
+}
+
+func (b *Backlog) Write(p []byte) {
+	b.Lock()
+	defer b.Unlock()
+
+	b.offset += int64(len(p))
+	if len(p) > len(b.buf) {
+		p = p[len(p)-len(b.buf):]
+	}
+
+	start := int((b.offset - int64(len(p))) % int64(len(b.buf)))
+	n := copy(b.buf[start:], p)
+	copy(b.buf, p[n:])
+	b.histlen = min(b.histlen+len(p), len(b.buf))
+}
+
+func (b *Backlog) Offset() int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.offset
+}
+
+// FirstOffset returns the offset of the oldest byte still in the backlog,
+// which starts at 1 as in Redis.
+func (b *Backlog) FirstOffset() int64 {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.offset - int64(b.histlen) + 1
+}
+
+func (b *Backlog) Size() int {
+	return len(b.buf)
+}
+
+func (b *Backlog) HistLen() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.histlen
+}
+
+// ReadFrom returns the stream from offset on, or false if it isn't in the
+// backlog anymore. offset is the replica's offset, so the first byte returned
+// is the one at offset+1.
+func (b *Backlog) ReadFrom(offset int64) ([]byte, bool) {
+	b.Lock()
+	defer b.Unlock()
+
+	if offset > b.offset || offset < b.offset-int64(b.histlen) {
+		return nil, false
+	}
+
+	n := int(b.offset - offset)
+	out := make([]byte, 0, n)
+	start := int(offset % int64(len(b.buf)))
+	end := start + n
+	if end <= len(b.buf) {
+		return append(out, b.buf[start:end]...), true
+	}
+	out = append(out, b.buf[start:]...)
+	return append(out, b.buf[:end-len(b.buf)]...), true
+}
@@ -0,0 +1,83 @@
+package replication
+
+import "testing"
+
+func TestBacklog(t *testing.T) {
+	b := NewBacklog(8)
+	if _, ok := b.ReadFrom(1); ok {
+		t.Fatal("read past the end of an empty backlog")
+	}
+	if data, ok := b.ReadFrom(0); !ok || len(data) != 0 {
+		t.Fatalf("ReadFrom(0) of an empty backlog = %q, %v", data, ok)
+	}
+
+	b.Write([]byte("abcde"))
+	if b.Offset() != 5 || b.HistLen() != 5 || b.FirstOffset() != 1 {
+		t.Fatalf("offset %d, histlen %d, first offset %d after writing 5 bytes",
+			b.Offset(), b.HistLen(), b.FirstOffset())
+	}
+
+	tests := []struct {
+		offset int64
+		want   string
+		ok     bool
+	}{
+		{0, "abcde", true},
+		{2, "cde", true},
+		{5, "", true},
+		{6, "", false},
+		{-1, "", false},
+	}
+	for _, test := range tests {
+		data, ok := b.ReadFrom(test.offset)
+		if ok != test.ok || string(data) != test.want {
+			t.Errorf("ReadFrom(%d) = %q, %v, want %q, %v", test.offset, data, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestBacklogWrapsAround(t *testing.T) {
+	b := NewBacklog(8)
+	b.Write([]byte("abcde"))
+	b.Write([]byte("fghij"))
+
+	if b.Offset() != 10 || b.HistLen() != 8 || b.FirstOffset() != 3 {
+		t.Fatalf("offset %d, histlen %d, first offset %d after writing 10 bytes",
+			b.Offset(), b.HistLen(), b.FirstOffset())
+	}
+	if _, ok := b.ReadFrom(1); ok {
+		t.Fatal("read bytes that were overwritten")
+	}
+
+	tests := []struct {
+		offset int64
+		want   string
+	}{
+		{2, "cdefghij"},
+		{5, "fghij"},
+		{7, "hij"},
+		{10, ""},
+	}
+	for _, test := range tests {
+		data, ok := b.ReadFrom(test.offset)
+		if !ok || string(data) != test.want {
+			t.Errorf("ReadFrom(%d) = %q, %v, want %q", test.offset, data, ok, test.want)
+		}
+	}
+}
+
+func TestBacklogWriteLargerThanBuffer(t *testing.T) {
+	b := NewBacklog(4)
+	b.Write([]byte("ab"))
+	b.Write([]byte("cdefghij"))
+
+	if b.Offset() != 10 || b.HistLen() != 4 {
+		t.Fatalf("offset %d, histlen %d after writing 10 bytes", b.Offset(), b.HistLen())
+	}
+	if data, ok := b.ReadFrom(6); !ok || string(data) != "ghij" {
+		t.Fatalf("ReadFrom(6) = %q, %v, want the last 4 bytes", data, ok)
+	}
+	if _, ok := b.ReadFrom(5); ok {
+		t.Fatal("read a byte that didn't fit in the backlog")
+	}
+}
@@ -0,0 +1,288 @@
+// Package replication implements the replica side of the link with a master,
+// as an explicit state machine, and the backlog a master keeps of the stream
+// it propagates to its replicas.
+package replication
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type State int32
+
+const (
+	// Connecting to the master
+	STATE_CONNECT State = iota
+	// Exchanging PING, REPLCONF and PSYNC
+	STATE_HANDSHAKE
+	// Receiving the dump of the master's dataset
+	STATE_SYNC
+	// Receiving the stream of propagated commands
+	STATE_CONNECTED
+)
+
+func (s State) String() string {
+	switch s {
+	case STATE_CONNECT:
+		return "connect"
+	case STATE_HANDSHAKE:
+		return "handshake"
+	case STATE_SYNC:
+		return "sync"
+	case STATE_CONNECTED:
+		return "connected"
+	default:
+		return ""
+	}
+}
+
+// Link is the connection of a replica to its master. It goes through the
+// states in order: Connect, Handshake, then ReadDump and Established once the
+// dump was loaded. Replies are read through a Decoder, so data the master
+// sends right after a reply is kept for the next step.
+type Link struct {
+	MasterAddr    string
+	ListeningPort string
+	// Password sent with AUTH before the handshake, if any
+	Password string
+	// Address the master should list this replica with, when it isn't the
+	// one the connection comes from
+	AnnounceIP string
+	// Dial opens the connection to the master, net.Dial over TCP by default
+	Dial func(addr string) (net.Conn, error)
+	// Longest the master may take to answer a step of the handshake, or to
+	// send more of the dump, until the link is established. No limit when
+	// zero.
+	Timeout time.Duration
+
+	state   atomic.Int32
+	conn    net.Conn
+	decoder *resp.Decoder
+	// Unix time in seconds of the last read from the master once connected
+	lastIO atomic.Int64
+
+	// Guards replID and offset, written by a new handshake while ROLE, INFO
+	// or REPLCONF GETACK read them
+	mu sync.Mutex
+	// Replication ID and offset the master announced with FULLRESYNC
+	replID string
+	offset int64
+	// Bytes of the replication stream processed since the FULLRESYNC
+	processed atomic.Int64
+}
+
+func NewLink(masterAddr, listeningPort string) *Link {
+	return &Link{
+		MasterAddr:    masterAddr,
+		ListeningPort: listeningPort,
+		Dial: func(addr string) (net.Conn, error) {
+			return net.Dial("tcp", addr)
+		},
+	}
+}
+
+func (l *Link) State() State {
+	return State(l.state.Load())
+}
+
+func (l *Link) setState(s State) {
+	l.state.Store(int32(s))
+}
+
+func (l *Link) expect(s State) error {
+	if current := l.State(); current != s {
+		return fmt.Errorf("replication link is in state %s, was expecting %s", current, s)
+	}
+	return nil
+}
+
+func (l *Link) Connect() error {
+	if err := l.expect(STATE_CONNECT); err != nil {
+		return err
+	}
+
+	conn, err := l.Dial(l.MasterAddr)
+	if err != nil {
+		return err
+	}
+
+	l.conn = conn
+	l.decoder = resp.NewDecoder(&timeoutReader{l})
+	l.setState(STATE_HANDSHAKE)
+	return nil
+}
+
+// timeoutReader reads from the master with the timeout of the link until it
+// is established. The replication stream may then stay idle for any time.
+type timeoutReader struct {
+	link *Link
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	l := r.link
+	if l.Timeout > 0 && l.State() != STATE_CONNECTED {
+		l.conn.SetReadDeadline(time.Now().Add(l.Timeout))
+	}
+	return l.conn.Read(p)
+}
+
+// Handshake pings the master, announces the replica's port and capabilities
+// and asks for a full resynchronization.
+func (l *Link) Handshake() error {
+	if err := l.expect(STATE_HANDSHAKE); err != nil {
+		return err
+	}
+
+	var steps []handshakeStep
+	if l.Password != "" {
+		steps = append(steps, handshakeStep{[]string{"AUTH", l.Password}, "OK"})
+	}
+	steps = append(steps, []handshakeStep{
+		{[]string{"PING"}, "PONG"},
+		{[]string{"REPLCONF", "listening-port", l.ListeningPort}, "OK"},
+	}...)
+	if l.AnnounceIP != "" {
+		steps = append(steps, handshakeStep{[]string{"REPLCONF", "ip-address", l.AnnounceIP}, "OK"})
+	}
+	steps = append(steps, handshakeStep{[]string{"REPLCONF", "capa", "eof", "capa", "psync2"}, "OK"})
+	for _, step := range steps {
+		reply, err := l.call(step.cmd...)
+		if err != nil {
+			return err
+		}
+		if reply != step.expected {
+			return fmt.Errorf("unexpected reply to %s: %q", step.cmd[0], reply)
+		}
+	}
+
+	reply, err := l.call("PSYNC", "?", "-1")
+	if err != nil {
+		return err
+	}
+
+	fields := strings.Fields(reply)
+	if len(fields) != 3 || fields[0] != "FULLRESYNC" {
+		return fmt.Errorf("unexpected reply to PSYNC: %q", reply)
+	}
+	offset, err := strconv.ParseInt(fields[2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid offset in FULLRESYNC: %q", fields[2])
+	}
+
+	l.mu.Lock()
+	l.replID, l.offset = fields[1], offset
+	l.processed.Store(0)
+	l.mu.Unlock()
+	l.setState(STATE_SYNC)
+	return nil
+}
+
+// handshakeStep is a command sent during the handshake and its expected reply
+type handshakeStep struct {
+	cmd      []string
+	expected string
+}
+
+// call sends a command and returns its status reply
+func (l *Link) call(args ...string) (string, error) {
+	if l.Timeout > 0 {
+		l.conn.SetWriteDeadline(time.Now().Add(l.Timeout))
+	}
+	encoder := resp.NewEncoder(l.conn)
+	encoder.WriteCommand(args...)
+	if err := encoder.Flush(); err != nil {
+		return "", err
+	}
+
+	reply, err := l.decoder.Decode()
+	if err != nil {
+		return "", err
+	}
+
+	switch reply.DataType {
+	case resp.SIMPLE_STRING:
+		return reply.Content.(string), nil
+	case resp.ERROR:
+		return "", fmt.Errorf("master replied to %s with error: %s", args[0], reply.Content)
+	default:
+		return "", fmt.Errorf("unexpected reply to %s: %v", args[0], reply.Content)
+	}
+}
+
+// ReadDump returns a reader for the dump following FULLRESYNC, which must be
+// consumed entirely before calling Established.
+func (l *Link) ReadDump() (io.Reader, error) {
+	if err := l.expect(STATE_SYNC); err != nil {
+		return nil, err
+	}
+	return l.decoder.DecodeRdb()
+}
+
+// Established marks the link as connected and returns the connection to read
+// the propagated commands from, including those already buffered.
+func (l *Link) Established() net.Conn {
+	l.conn.SetDeadline(time.Time{})
+	l.setState(STATE_CONNECTED)
+	l.lastIO.Store(time.Now().Unix())
+	return &bufferedConn{l.conn, l.decoder, l}
+}
+
+// Processed records that n bytes of commands received from the master were
+// applied. Only the replication stream counts, not the dump before it.
+func (l *Link) Processed(n int) {
+	l.processed.Add(int64(n))
+}
+
+// ReplOffset is the master replication offset this replica reached: the
+// offset of the FULLRESYNC plus the bytes processed since
+func (l *Link) ReplOffset() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.offset + l.processed.Load()
+}
+
+// ReplID is the replication ID the master announced with FULLRESYNC, empty
+// until the first handshake
+func (l *Link) ReplID() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.replID
+}
+
+// LastIO returns when data was last received from the master
+func (l *Link) LastIO() time.Time {
+	return time.Unix(l.lastIO.Load(), 0)
+}
+
+// Close drops the connection, leaving the link ready to connect again
+func (l *Link) Close() error {
+	l.setState(STATE_CONNECT)
+	if l.conn == nil {
+		return nil
+	}
+	return l.conn.Close()
+}
+
+// bufferedConn reads through the decoder used during the handshake, which
+// may hold commands the master propagated right after the dump.
+type bufferedConn struct {
+	net.Conn
+	reader io.Reader
+	link   *Link
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	n, err := c.reader.Read(p)
+	if n > 0 {
+		c.link.lastIO.Store(time.Now().Unix())
+	}
+	return n, err
+}
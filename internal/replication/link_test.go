@@ -0,0 +1,301 @@
+package replication
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// fakeMaster answers each command it receives with the reply given for it,
+// after checking it is the expected one
+type fakeMaster struct {
+	t       *testing.T
+	conn    net.Conn
+	decoder *resp.Decoder
+	encoder *resp.Encoder
+}
+
+// newTestLink returns a link whose Dial connects it to a fake master
+func newTestLink(t *testing.T) (*Link, *fakeMaster) {
+	link := NewLink("master:6379", "6380")
+	return link, dialFakeMaster(t, link)
+}
+
+// dialFakeMaster makes the next Dial of the link connect it to a new fake
+// master
+func dialFakeMaster(t *testing.T, link *Link) *fakeMaster {
+	replicaSide, masterSide := net.Pipe()
+	t.Cleanup(func() {
+		replicaSide.Close()
+		masterSide.Close()
+	})
+
+	link.Dial = func(addr string) (net.Conn, error) {
+		if addr != "master:6379" {
+			t.Errorf("dialed %s, want master:6379", addr)
+		}
+		return replicaSide, nil
+	}
+	return &fakeMaster{t, masterSide, resp.NewDecoder(masterSide), resp.NewEncoder(masterSide)}
+}
+
+// expect reads a command and checks it is want, with the arguments separated
+// by spaces
+func (m *fakeMaster) expect(want string) bool {
+	cmd, err := m.decoder.Decode()
+	if err != nil {
+		m.t.Errorf("reading %s: %s", want, err)
+		return false
+	}
+
+	var args []string
+	for _, arg := range cmd.Content.([]resp.Resp) {
+		args = append(args, arg.Content.(string))
+	}
+	if got := strings.Join(args, " "); got != want {
+		m.t.Errorf("master received %q, want %q", got, want)
+		return false
+	}
+	return true
+}
+
+func (m *fakeMaster) reply(write func(e *resp.Encoder)) {
+	write(m.encoder)
+	if err := m.encoder.Flush(); err != nil {
+		m.t.Error(err)
+	}
+}
+
+// handshake plays the master side of a successful handshake, then sends the
+// dump and a propagated command right after it
+func (m *fakeMaster) handshake(firstCommands ...string) {
+	steps := append(firstCommands,
+		"PING",
+		"REPLCONF listening-port 6380",
+		"REPLCONF capa eof capa psync2",
+	)
+	for _, step := range steps {
+		if !m.expect(step) {
+			return
+		}
+		reply := "OK"
+		if step == "PING" {
+			reply = "PONG"
+		}
+		m.reply(func(e *resp.Encoder) { e.WriteSimpleString(reply) })
+	}
+
+	if !m.expect("PSYNC ? -1") {
+		return
+	}
+	m.reply(func(e *resp.Encoder) {
+		e.WriteSimpleString("FULLRESYNC 8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb 42")
+		e.WriteRdb([]byte("REDIS0011-dump"))
+		e.WriteCommand("SET", "a", "1")
+	})
+}
+
+func TestLinkStates(t *testing.T) {
+	link, master := newTestLink(t)
+	go master.handshake()
+
+	if state := link.State(); state != STATE_CONNECT {
+		t.Fatalf("new link in state %s, want connect", state)
+	}
+	if _, err := link.ReadDump(); err == nil {
+		t.Fatal("ReadDump succeeded before connecting")
+	}
+
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if state := link.State(); state != STATE_HANDSHAKE {
+		t.Fatalf("connected link in state %s, want handshake", state)
+	}
+	if err := link.Connect(); err == nil {
+		t.Fatal("Connect succeeded twice")
+	}
+
+	if err := link.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	if state := link.State(); state != STATE_SYNC {
+		t.Fatalf("link in state %s after the handshake, want sync", state)
+	}
+	if link.ReplID() != "8371b4fb1155b71f4a04d3e1bc3e18c4a990aeeb" || link.ReplOffset() != 42 {
+		t.Fatalf("FULLRESYNC read as %s %d", link.ReplID(), link.ReplOffset())
+	}
+
+	dump, err := link.ReadDump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(dump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "REDIS0011-dump" {
+		t.Fatalf("dump read as %q", data)
+	}
+
+	conn := link.Established()
+	if state := link.State(); state != STATE_CONNECTED {
+		t.Fatalf("established link in state %s, want connected", state)
+	}
+	// The command was buffered by the handshake along with the dump
+	propagated, err := resp.NewDecoder(conn).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args := propagated.Content.([]resp.Resp); len(args) != 3 || args[0].Content != "SET" {
+		t.Fatalf("propagated command read as %v", propagated.Content)
+	}
+
+	link.Processed(31)
+	if offset := link.ReplOffset(); offset != 42+31 {
+		t.Fatalf("ReplOffset = %d, want 73", offset)
+	}
+
+	if err := link.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if state := link.State(); state != STATE_CONNECT {
+		t.Fatalf("closed link in state %s, want connect", state)
+	}
+}
+
+// establish takes the link through a successful handshake with the master
+func establish(t *testing.T, link *Link, master *fakeMaster) {
+	go master.handshake()
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := link.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	dump, err := link.ReadDump()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(io.Discard, dump); err != nil {
+		t.Fatal(err)
+	}
+	link.Established()
+}
+
+// The offset acknowledged with GETACK restarts from the one of the
+// FULLRESYNC after a reconnection, while INFO and ROLE may be reading it
+func TestLinkOffsetAfterReconnect(t *testing.T) {
+	link, master := newTestLink(t)
+	establish(t, link, master)
+	link.Processed(31)
+	link.Processed(14)
+	if offset := link.ReplOffset(); offset != 42+31+14 {
+		t.Fatalf("ReplOffset = %d, want 87", offset)
+	}
+
+	done := make(chan struct{})
+	defer func() { <-done }()
+	stop := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				link.ReplID()
+				link.ReplOffset()
+			}
+		}
+	}()
+	defer close(stop)
+
+	link.Close()
+	establish(t, link, dialFakeMaster(t, link))
+	if offset := link.ReplOffset(); offset != 42 {
+		t.Fatalf("ReplOffset = %d after reconnecting, want 42", offset)
+	}
+}
+
+func TestLinkAuth(t *testing.T) {
+	link, master := newTestLink(t)
+	link.Password = "secret"
+	go master.handshake("AUTH secret")
+
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := link.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLinkHandshakeError(t *testing.T) {
+	link, master := newTestLink(t)
+	go func() {
+		if master.expect("PING") {
+			master.reply(func(e *resp.Encoder) { e.WriteError("NOAUTH Authentication required.") })
+		}
+	}()
+
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	err := link.Handshake()
+	if err == nil || !strings.Contains(err.Error(), "NOAUTH") {
+		t.Fatalf("Handshake returned %v, want the NOAUTH error", err)
+	}
+	if state := link.State(); state != STATE_HANDSHAKE {
+		t.Fatalf("link in state %s after a failed handshake, want handshake", state)
+	}
+}
+
+func TestLinkUnexpectedPsyncReply(t *testing.T) {
+	link, master := newTestLink(t)
+	go func() {
+		for _, step := range []string{"PING", "REPLCONF listening-port 6380", "REPLCONF capa eof capa psync2"} {
+			if !master.expect(step) {
+				return
+			}
+			reply := "OK"
+			if step == "PING" {
+				reply = "PONG"
+			}
+			master.reply(func(e *resp.Encoder) { e.WriteSimpleString(reply) })
+		}
+		if master.expect("PSYNC ? -1") {
+			master.reply(func(e *resp.Encoder) { e.WriteSimpleString("CONTINUE") })
+		}
+	}()
+
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	if err := link.Handshake(); err == nil {
+		t.Fatal("Handshake accepted CONTINUE")
+	}
+}
+
+func TestLinkTimeout(t *testing.T) {
+	link, master := newTestLink(t)
+	link.Timeout = 50 * time.Millisecond
+	// Reads the PING but never answers it
+	go master.expect("PING")
+
+	if err := link.Connect(); err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	err := link.Handshake()
+	if err == nil {
+		t.Fatal("Handshake succeeded without replies")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Handshake gave up after %s, with a timeout of 50ms", elapsed)
+	}
+}
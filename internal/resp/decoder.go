@@ -0,0 +1,180 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Decoder reads values from an io.Reader. It reads ahead, so once done with
+// the values the rest of the stream has to be read through the Decoder too.
+type Decoder struct {
+	r *bufio.Reader
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Read reads the raw bytes following the last decoded value
+func (d *Decoder) Read(p []byte) (int, error) {
+	return d.r.Read(p)
+}
+
+// Decode reads the next value, with the same limits as ParseResp
+func (d *Decoder) Decode() (Resp, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return Resp{}, err
+	}
+	if len(line) == 0 {
+		return Resp{}, errors.New("Protocol error: empty line")
+	}
+
+	switch line[0] {
+	case SIMPLE_STRING, ERROR:
+		return Resp{Content: string(line[1:]), DataType: RespType(line[0])}, nil
+	case INTEGER:
+		val, err := strconv.Atoi(string(line[1:]))
+		if err != nil {
+			return Resp{}, fmt.Errorf("Protocol error: invalid integer '%s'", line[1:])
+		}
+		return Resp{Content: val, DataType: INTEGER}, nil
+	case STRING:
+		return d.decodeString(line[1:])
+	case ARRAY:
+		return d.decodeArray(line[1:])
+	default:
+		return Resp{}, fmt.Errorf("Protocol error: unexpected type byte '%c'", line[0])
+	}
+}
+
+// readLine reads up to the next \r\n, which isn't included
+func (d *Decoder) readLine() ([]byte, error) {
+	line, err := d.r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return nil, errors.New("Protocol error: line not terminated by CRLF")
+	}
+	return line[:len(line)-2], nil
+}
+
+func decodeLength(line []byte, limit int64, invalidErr error) (int, error) {
+	length, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || length < -1 || length > limit {
+		return 0, invalidErr
+	}
+	return int(length), nil
+}
+
+func (d *Decoder) decodeString(line []byte) (Resp, error) {
+	resp := Resp{DataType: STRING}
+	length, err := decodeLength(line, MaxBulkLength.Load(), errInvalidBulkLength)
+	if err != nil || length < 0 {
+		return resp, err
+	}
+
+	buf := make([]byte, length+2)
+	if _, err := io.ReadFull(d.r, buf); err != nil {
+		return resp, err
+	}
+	if buf[length] != '\r' || buf[length+1] != '\n' {
+		return resp, errors.New("Protocol error: bulk string not terminated by CRLF")
+	}
+
+	resp.Content = string(buf[:length])
+	return resp, nil
+}
+
+func (d *Decoder) decodeArray(line []byte) (Resp, error) {
+	resp := Resp{DataType: ARRAY}
+	length, err := decodeLength(line, MaxMultibulkLength.Load(), errInvalidMultibulkLength)
+	if err != nil || length < 0 {
+		return resp, err
+	}
+
+	elements := make([]Resp, 0, min(length, 1024))
+	for ; length > 0; length-- {
+		element, err := d.Decode()
+		if err != nil {
+			return resp, err
+		}
+		elements = append(elements, element)
+	}
+
+	resp.Content = elements
+	return resp, nil
+}
+
+// DecodeRdb reads the header of a dump sent after FULLRESYNC and returns a
+// reader for its contents, which must be consumed before decoding again. The
+// dump is either preceded by its size, or, when the master streams it
+// without knowing the size up front, delimited by a random EOF mark sent
+// before and after it.
+func (d *Decoder) DecodeRdb() (io.Reader, error) {
+	line, err := d.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != STRING {
+		return nil, errors.New("was expecting a dump")
+	}
+
+	if mark, ok := bytes.CutPrefix(line[1:], []byte("EOF:")); ok {
+		if len(mark) != RDB_EOF_MARK_LENGTH {
+			return nil, fmt.Errorf("invalid dump EOF mark '%s'", mark)
+		}
+		return &eofReader{r: d.r, mark: mark}, nil
+	}
+
+	size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil || size < 0 {
+		return nil, fmt.Errorf("invalid dump size '%s'", line[1:])
+	}
+	return io.LimitReader(d.r, size), nil
+}
+
+// Length of the mark delimiting a dump streamed with $EOF:<mark>
+const RDB_EOF_MARK_LENGTH = 40
+
+// eofReader reads a dump up to the mark ending it, which is consumed but not
+// returned. Bytes that could be the start of the mark are held back until
+// enough is buffered to tell, so nothing after the mark is ever read.
+type eofReader struct {
+	r    *bufio.Reader
+	mark []byte
+	done bool
+}
+
+func (e *eofReader) Read(p []byte) (int, error) {
+	if e.done {
+		return 0, io.EOF
+	}
+
+	buffered, err := e.r.Peek(max(e.r.Buffered(), len(e.mark)))
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return 0, err
+	}
+
+	available := len(buffered) - len(e.mark) + 1
+	if i := bytes.Index(buffered, e.mark); i >= 0 {
+		available = i
+	}
+	if available == 0 {
+		e.done = true
+		e.r.Discard(len(e.mark))
+		return 0, io.EOF
+	}
+
+	n := copy(p, buffered[:available])
+	e.r.Discard(n)
+	return n, nil
+}
@@ -0,0 +1,97 @@
+package resp
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// EncodeResp encodes a single reply, val holding the Go type matching the
+// given type.
+//
+// Deprecated: use an Encoder, or the Append functions for a reply built in
+// memory.
+func EncodeResp(val any, valType RespType) ([]byte, error) {
+	return AppendValue(nil, Resp{Content: val, DataType: valType}), nil
+}
+
+// The Append functions append a reply to b and return the extended buffer, as
+// the ones of strconv do, for replies built in memory rather than written to
+// a connection by an Encoder.
+
+func AppendSimpleString(b []byte, s string) []byte {
+	b = append(b, SIMPLE_STRING)
+	b = append(b, s...)
+	return append(b, CLRF...)
+}
+
+func AppendError(b []byte, s string) []byte {
+	b = append(b, ERROR)
+	b = append(b, s...)
+	return append(b, CLRF...)
+}
+
+func AppendBulkString(b []byte, s string) []byte {
+	b = appendHeader(b, STRING, int64(len(s)))
+	b = append(b, s...)
+	return append(b, CLRF...)
+}
+
+// AppendNull appends the null bulk string
+func AppendNull(b []byte) []byte {
+	return append(b, "$-1\r\n"...)
+}
+
+func AppendInteger(b []byte, n int64) []byte {
+	return appendHeader(b, INTEGER, n)
+}
+
+// AppendArrayHeader starts an array of n elements, which have to be appended
+// next.
+func AppendArrayHeader(b []byte, n int) []byte {
+	return appendHeader(b, ARRAY, int64(n))
+}
+
+// AppendArray appends an array of values, see AppendValue
+func AppendArray(b []byte, elements []Resp) []byte {
+	b = AppendArrayHeader(b, len(elements))
+	for _, element := range elements {
+		b = AppendValue(b, element)
+	}
+	return b
+}
+
+// AppendValue appends a value given as a Resp, e.g. an element of a reply
+// built as a tree. A bulk string without content is the null one.
+func AppendValue(b []byte, v Resp) []byte {
+	switch v.DataType {
+	case SIMPLE_STRING:
+		return AppendSimpleString(b, v.Content.(string))
+	case ERROR:
+		return AppendError(b, v.Content.(string))
+	case INTEGER:
+		return AppendInteger(b, int64(v.Content.(int)))
+	case STRING:
+		if v.Content == nil {
+			return AppendNull(b)
+		}
+		return AppendBulkString(b, v.Content.(string))
+	case ARRAY:
+		elements, _ := v.Content.([]Resp)
+		return AppendArray(b, elements)
+	default:
+		return b
+	}
+}
+
+// appendHeader appends a type byte followed by a number and \r\n
+func appendHeader(b []byte, t RespType, n int64) []byte {
+	b = append(b, byte(t))
+	b = strconv.AppendInt(b, n, 10)
+	return append(b, CLRF...)
+}
+
+// EncodeRdb encodes a dump as sent after FULLRESYNC, which is a bulk string
+// without the trailing \r\n.
+func EncodeRdb(content []byte) []byte {
+	return []byte(fmt.Sprintf("$%d\r\n%s", len(content), content))
+}
@@ -0,0 +1,139 @@
+package resp
+
+import (
+	"bufio"
+	"io"
+)
+
+// Encoder writes replies to an io.Writer, with one method per reply type.
+// Writes are buffered until Flush is called. After the first error every
+// method is a no-op, and the error is returned by Flush.
+type Encoder struct {
+	w   *bufio.Writer
+	err error
+	// Scratch space for formatting lengths and integers
+	num []byte
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+func (e *Encoder) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *Encoder) writeString(s string) {
+	if e.err == nil {
+		_, e.err = e.w.WriteString(s)
+	}
+}
+
+// writeHeader writes a type byte followed by a number and \r\n
+func (e *Encoder) writeHeader(t RespType, n int64) {
+	e.num = appendHeader(e.num[:0], t, n)
+	e.write(e.num)
+}
+
+func (e *Encoder) WriteSimpleString(s string) {
+	e.write([]byte{SIMPLE_STRING})
+	e.writeString(s)
+	e.write(CLRF)
+}
+
+func (e *Encoder) WriteError(s string) {
+	e.write([]byte{ERROR})
+	e.writeString(s)
+	e.write(CLRF)
+}
+
+func (e *Encoder) WriteBulkString(s string) {
+	e.writeHeader(STRING, int64(len(s)))
+	e.writeString(s)
+	e.write(CLRF)
+}
+
+func (e *Encoder) WriteBulkBytes(b []byte) {
+	e.writeHeader(STRING, int64(len(b)))
+	e.write(b)
+	e.write(CLRF)
+}
+
+// WriteNull writes the null bulk string
+func (e *Encoder) WriteNull() {
+	e.writeString("$-1\r\n")
+}
+
+func (e *Encoder) WriteInteger(n int64) {
+	e.writeHeader(INTEGER, n)
+}
+
+// WriteArrayHeader starts an array of n elements, which have to be written
+// next.
+func (e *Encoder) WriteArrayHeader(n int) {
+	e.writeHeader(ARRAY, int64(n))
+}
+
+// WriteMapHeader starts a RESP3 map of n pairs, which have to be written next
+// as alternating keys and values.
+func (e *Encoder) WriteMapHeader(n int) {
+	e.writeHeader(MAP, int64(n))
+}
+
+// WritePushHeader starts a RESP3 push frame of n elements, the out of band
+// data of a connection, such as pub/sub messages.
+func (e *Encoder) WritePushHeader(n int) {
+	e.writeHeader(PUSH, int64(n))
+}
+
+// WriteCommand writes a command as an array of bulk strings
+func (e *Encoder) WriteCommand(args ...string) {
+	e.WriteArrayHeader(len(args))
+	for _, arg := range args {
+		e.WriteBulkString(arg)
+	}
+}
+
+// WriteValue writes an already parsed value back
+func (e *Encoder) WriteValue(v Resp) {
+	switch v.DataType {
+	case SIMPLE_STRING:
+		e.WriteSimpleString(v.Content.(string))
+	case ERROR:
+		e.WriteError(v.Content.(string))
+	case INTEGER:
+		e.WriteInteger(int64(v.Content.(int)))
+	case STRING:
+		if v.Content == nil {
+			e.WriteNull()
+		} else {
+			e.WriteBulkString(v.Content.(string))
+		}
+	case ARRAY:
+		elements, _ := v.Content.([]Resp)
+		e.WriteArrayHeader(len(elements))
+		for _, element := range elements {
+			e.WriteValue(element)
+		}
+	}
+}
+
+// WriteRaw writes an already encoded value, e.g. a reply to nest in an array
+func (e *Encoder) WriteRaw(b []byte) {
+	e.write(b)
+}
+
+// WriteRdb writes a dump as sent after FULLRESYNC, see EncodeRdb
+func (e *Encoder) WriteRdb(dump []byte) {
+	e.writeHeader(STRING, int64(len(dump)))
+	e.write(dump)
+}
+
+func (e *Encoder) Flush() error {
+	if e.err == nil {
+		e.err = e.w.Flush()
+	}
+	return e.err
+}
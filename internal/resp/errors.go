@@ -0,0 +1,61 @@
+package resp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Error is an error meant for the client, sent as an error reply. Code is
+// the first word of the reply, which clients rely on to tell errors apart,
+// e.g. to follow a MOVED redirection.
+type Error struct {
+	Code    string
+	Message string
+}
+
+func NewError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Code + " " + e.Message
+}
+
+// Errorf returns an error with a message formatted as by fmt.Sprintf
+func Errorf(code, format string, args ...any) *Error {
+	return NewError(code, fmt.Sprintf(format, args...))
+}
+
+// Errors with a fixed message
+var (
+	ErrSyntax     = NewError("ERR", "syntax error")
+	ErrNotInteger = NewError("ERR", "value is not an integer or out of range")
+	ErrWrongType  = NewError("WRONGTYPE", "Operation against a key holding the wrong kind of value")
+	ErrNoAuth     = NewError("NOAUTH", "Authentication required.")
+	ErrExecAbort  = NewError("EXECABORT", "Transaction discarded because of previous errors.")
+	ErrLoading    = NewError("LOADING", "Redis is loading the dataset in memory")
+	ErrOOM        = NewError("OOM", "command not allowed when used memory > 'maxmemory'.")
+	ErrCrossSlot  = NewError("CROSSSLOT", "Keys in request don't hash to the same slot")
+	ErrBusyKey    = NewError("BUSYKEY", "Target key name already exists.")
+)
+
+// Moved redirects a client to the node serving slot
+func Moved(slot int, addr string) *Error {
+	return NewError("MOVED", fmt.Sprintf("%d %s", slot, addr))
+}
+
+// Ask redirects a client to the node slot is being migrated to, for the
+// next command only
+func Ask(slot int, addr string) *Error {
+	return NewError("ASK", fmt.Sprintf("%d %s", slot, addr))
+}
+
+// EncodeError encodes an error reply for err, with the generic ERR code
+// unless it wraps an *Error
+func EncodeError(err error) []byte {
+	var replyErr *Error
+	if !errors.As(err, &replyErr) {
+		replyErr = NewError("ERR", err.Error())
+	}
+	return AppendError(nil, replyErr.Error())
+}
@@ -0,0 +1,259 @@
+// Package resp implements the Redis serialization protocol: parsing requests
+// from a buffer or an io.Reader, and encoding replies.
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	SIMPLE_STRING = '+'
+	STRING        = '$'
+	INTEGER       = ':'
+	ARRAY         = '*'
+	ERROR         = '-'
+
+	// RESP3 types, only written to clients that switched with HELLO 3
+	MAP  = '%'
+	PUSH = '>'
+)
+
+var CLRF = []byte{'\r', '\n'}
+
+type RespType byte
+
+type Resp struct {
+	Content  any
+	DataType RespType
+}
+
+// Returned by ParseResp when the buffer ends before the value does, so the
+// caller has to read more data and try again.
+var ErrIncomplete = errors.New("incomplete resp")
+
+// Errors of lengths that aren't numbers or are over the limits, with the
+// messages Redis replies with
+var (
+	errInvalidBulkLength      = errors.New("Protocol error: invalid bulk length")
+	errInvalidMultibulkLength = errors.New("Protocol error: invalid multibulk length")
+)
+
+const (
+	DEFAULT_MAX_BULK_LENGTH      = 512 * 1024 * 1024
+	DEFAULT_MAX_MULTIBULK_LENGTH = 1024 * 1024
+)
+
+// MaxBulkLength is the proto-max-bulk-len config, the size of the largest bulk
+// string accepted by ParseResp and Decoder, and MaxMultibulkLength the
+// proto-max-multibulk-len config, the number of elements of the largest array.
+// Values over them are rejected as soon as their length is read, before
+// anything is allocated for them.
+var (
+	MaxBulkLength      atomic.Int64
+	MaxMultibulkLength atomic.Int64
+)
+
+func init() {
+	MaxBulkLength.Store(DEFAULT_MAX_BULK_LENGTH)
+	MaxMultibulkLength.Store(DEFAULT_MAX_MULTIBULK_LENGTH)
+}
+
+// ParseResp parses the value at the start of buf and returns it along with the
+// number of bytes it takes.
+func ParseResp(buf []byte) (Resp, int, error) {
+	resp := Resp{}
+	if len(buf) == 0 {
+		return resp, 0, ErrIncomplete
+	}
+
+	var (
+		n   int
+		err error
+	)
+	switch buf[0] {
+	case SIMPLE_STRING, ERROR:
+		resp, n, err = parseSimpleString(buf[1:])
+		resp.DataType = RespType(buf[0])
+	case STRING:
+		resp, n, err = parseString(buf[1:])
+	case INTEGER:
+		resp, n, err = parseInteger(buf[1:])
+	case ARRAY:
+		resp, n, err = parseArray(buf[1:])
+	default:
+		return resp, 0, fmt.Errorf("Protocol error: unexpected type byte '%c'", buf[0])
+	}
+	return resp, n + 1, err
+}
+
+// readLine returns the data up to the next \r\n and the bytes it takes,
+// terminator included.
+func readLine(buf []byte) ([]byte, int, error) {
+	i := bytes.Index(buf, CLRF)
+	if i < 0 {
+		return nil, 0, ErrIncomplete
+	}
+	return buf[:i], i + 2, nil
+}
+
+// readLength reads the length of a bulk string or an array, failing with
+// invalidErr if it's not a number between -1 and limit
+func readLength(buf []byte, limit int64, invalidErr error) (int, int, error) {
+	line, n, err := readLine(buf)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	length, err := strconv.ParseInt(string(line), 10, 64)
+	if err != nil || length < -1 || length > limit {
+		return 0, 0, invalidErr
+	}
+	return int(length), n, nil
+}
+
+// +<data>\r\n
+func parseSimpleString(buf []byte) (Resp, int, error) {
+	line, n, err := readLine(buf)
+	if err != nil {
+		return Resp{}, 0, err
+	}
+	return Resp{Content: string(line), DataType: SIMPLE_STRING}, n, nil
+}
+
+// <length>\r\n<data>\r\n
+func parseString(buf []byte) (Resp, int, error) {
+	resp := Resp{DataType: STRING}
+	length, i, err := readLength(buf, MaxBulkLength.Load(), errInvalidBulkLength)
+	if err != nil || length < 0 {
+		return resp, i, err
+	}
+
+	if i+length+2 > len(buf) {
+		return resp, 0, ErrIncomplete
+	}
+	if buf[i+length] != '\r' || buf[i+length+1] != '\n' {
+		return resp, 0, errors.New("Protocol error: bulk string not terminated by CRLF")
+	}
+
+	resp.Content = string(buf[i : i+length])
+	return resp, i + length + 2, nil
+}
+
+// <value>\r\n
+func parseInteger(buf []byte) (Resp, int, error) {
+	line, n, err := readLine(buf)
+	if err != nil {
+		return Resp{}, 0, err
+	}
+
+	val, err := strconv.Atoi(string(line))
+	if err != nil {
+		return Resp{}, 0, fmt.Errorf("Protocol error: invalid integer '%s'", line)
+	}
+	return Resp{Content: val, DataType: INTEGER}, n, nil
+}
+
+// <number-of-elements>\r\n<element-1>...<element-n>
+func parseArray(buf []byte) (Resp, int, error) {
+	resp := Resp{DataType: ARRAY}
+	length, i, err := readLength(buf, MaxMultibulkLength.Load(), errInvalidMultibulkLength)
+	if err != nil || length < 0 {
+		return resp, i, err
+	}
+
+	parsed := make([]Resp, 0, min(length, 1024))
+	for ; length > 0; length-- {
+		element, n, err := ParseResp(buf[i:])
+		if err != nil {
+			return resp, 0, err
+		}
+		parsed = append(parsed, element)
+		i += n
+	}
+
+	resp.Content = parsed
+	return resp, i, nil
+}
+
+// RequestParser parses the requests of a connection from the data received so
+// far. The elements of an array that arrived in part are kept between calls,
+// so that a large request received over many reads is parsed once instead of
+// from its start again after every read.
+type RequestParser struct {
+	// Elements of the array being parsed, nil when there is none
+	pending []Resp
+	// Elements the pending array still lacks
+	remaining int
+	// Bytes of the current request consumed so far
+	size int
+}
+
+// Parse parses the request at the start of buf, returning it along with the
+// number of bytes of buf consumed. These are also returned with ErrIncomplete,
+// for the elements the parser keeps: the caller must drop them and only give
+// the bytes that follow in the next call.
+func (p *RequestParser) Parse(buf []byte) (Resp, int, error) {
+	i := 0
+	if p.pending == nil {
+		// Only arrays can be large, other values are parsed again as a whole
+		if len(buf) == 0 || buf[0] != ARRAY {
+			resp, n, err := ParseResp(buf)
+			if err != nil {
+				return resp, 0, err
+			}
+			p.size = n
+			return resp, n, nil
+		}
+
+		length, n, err := readLength(buf[1:], MaxMultibulkLength.Load(), errInvalidMultibulkLength)
+		if err != nil {
+			return Resp{}, 0, err
+		}
+		i = n + 1
+		p.size = 0
+		if length < 0 {
+			p.size = i
+			return Resp{DataType: ARRAY}, i, nil
+		}
+		p.pending = make([]Resp, 0, min(length, 1024))
+		p.remaining = length
+	}
+
+	for ; p.remaining > 0; p.remaining-- {
+		element, n, err := ParseResp(buf[i:])
+		if errors.Is(err, ErrIncomplete) {
+			p.size += i
+			return Resp{}, i, err
+		}
+		if err != nil {
+			p.pending = nil
+			return Resp{}, 0, err
+		}
+		p.pending = append(p.pending, element)
+		i += n
+	}
+
+	resp := Resp{Content: p.pending, DataType: ARRAY}
+	p.pending = nil
+	p.size += i
+	return resp, i, nil
+}
+
+// Size returns the size of the last request parsed, which may have been
+// received over many calls
+func (p *RequestParser) Size() int {
+	return p.size
+}
+
+// Pending returns the bytes consumed so far of a request not received in
+// full yet
+func (p *RequestParser) Pending() int {
+	if p.pending == nil {
+		return 0
+	}
+	return p.size
+}
@@ -0,0 +1,134 @@
+package resp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+// A pipeline of 16 commands, as sent by redis-benchmark -P 16
+var pipeline = bytes.Repeat([]byte("*3\r\n$3\r\nSET\r\n$16\r\nkey:000000000042\r\n$3\r\nxxx\r\n"), 16)
+
+func BenchmarkParseResp(b *testing.B) {
+	b.SetBytes(int64(len(pipeline)))
+	for i := 0; i < b.N; i++ {
+		for buf := pipeline; len(buf) > 0; {
+			_, n, err := ParseResp(buf)
+			if err != nil {
+				b.Fatal(err)
+			}
+			buf = buf[n:]
+		}
+	}
+}
+
+func BenchmarkDecoder(b *testing.B) {
+	b.SetBytes(int64(len(pipeline)))
+	r := bytes.NewReader(pipeline)
+	d := NewDecoder(r)
+	for i := 0; i < b.N; i++ {
+		r.Reset(pipeline)
+		for j := 0; j < 16; j++ {
+			if _, err := d.Decode(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkAppendArray(b *testing.B) {
+	reply := []Resp{
+		{Content: "field", DataType: STRING},
+		{Content: "value", DataType: STRING},
+		{Content: 42, DataType: INTEGER},
+	}
+	for i := 0; i < b.N; i++ {
+		AppendArray(nil, reply)
+	}
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	var out bytes.Buffer
+	e := NewEncoder(&out)
+	for i := 0; i < b.N; i++ {
+		out.Reset()
+		e.WriteArrayHeader(3)
+		e.WriteBulkString("field")
+		e.WriteBulkString("value")
+		e.WriteInteger(42)
+		if err := e.Flush(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// hset encodes an HSET of n fields, a request large enough to take many reads
+func hset(n int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "*%d\r\n$4\r\nHSET\r\n$3\r\nkey\r\n", 2+2*n)
+	for i := 0; i < n; i++ {
+		field := fmt.Sprintf("field:%d", i)
+		fmt.Fprintf(&buf, "$%d\r\n%s\r\n$5\r\nvalue\r\n", len(field), field)
+	}
+	return buf.Bytes()
+}
+
+// parseInChunks feeds data to a RequestParser in chunks of the given size, as
+// they would arrive from a connection, and returns the requests parsed
+func parseInChunks(tb testing.TB, data []byte, chunk int) []Resp {
+	var (
+		p        RequestParser
+		query    []byte
+		requests []Resp
+	)
+	for len(data) > 0 {
+		n := min(chunk, len(data))
+		query, data = append(query, data[:n]...), data[n:]
+		for len(query) > 0 {
+			request, n, err := p.Parse(query)
+			query = query[n:]
+			if errors.Is(err, ErrIncomplete) {
+				break
+			}
+			if err != nil {
+				tb.Fatal(err)
+			}
+			requests = append(requests, request)
+		}
+		query = append(query[:0:0], query...)
+	}
+	return requests
+}
+
+func TestRequestParserInChunks(t *testing.T) {
+	request := hset(1000)
+	data := append(append(bytes.Clone(pipeline), request...), pipeline...)
+
+	for _, chunk := range []int{1, 7, 100, 4096, len(data)} {
+		var p RequestParser
+		requests := parseInChunks(t, data, chunk)
+		if len(requests) != 33 {
+			t.Fatalf("parsed %d requests in chunks of %d, want 33", len(requests), chunk)
+		}
+		args := requests[16].Content.([]Resp)
+		if len(args) != 2002 || args[2].Content != "field:0" || args[2001].Content != "value" {
+			t.Fatalf("HSET parsed in chunks of %d has %d arguments", chunk, len(args))
+		}
+
+		if _, _, err := p.Parse(request); err != nil || p.Size() != len(request) {
+			t.Fatalf("Size = %d, %v, want %d", p.Size(), err, len(request))
+		}
+	}
+}
+
+// A request of 200k fields arriving over reads of 16KB, parsed in linear time
+func BenchmarkRequestParserInChunks(b *testing.B) {
+	request := hset(200000)
+	b.SetBytes(int64(len(request)))
+	for i := 0; i < b.N; i++ {
+		if requests := parseInChunks(b, request, 16*1024); len(requests) != 1 {
+			b.Fatalf("parsed %d requests, want 1", len(requests))
+		}
+	}
+}
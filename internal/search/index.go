@@ -0,0 +1,266 @@
+// Package search implements secondary indexes over hashes: each index
+// declares a schema of TEXT, NUMERIC and TAG fields and is kept up to date as
+// the hashes under its key prefixes change.
+package search
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+type FieldType int
+
+const (
+	FIELD_TEXT FieldType = iota
+	FIELD_NUMERIC
+	FIELD_TAG
+)
+
+func (t FieldType) String() string {
+	switch t {
+	case FIELD_TEXT:
+		return "TEXT"
+	case FIELD_NUMERIC:
+		return "NUMERIC"
+	case FIELD_TAG:
+		return "TAG"
+	default:
+		return ""
+	}
+}
+
+func ParseFieldType(s string) (FieldType, bool) {
+	switch strings.ToUpper(s) {
+	case "TEXT":
+		return FIELD_TEXT, true
+	case "NUMERIC":
+		return FIELD_NUMERIC, true
+	case "TAG":
+		return FIELD_TAG, true
+	default:
+		return 0, false
+	}
+}
+
+const DEFAULT_TAG_SEPARATOR = ','
+
+type Field struct {
+	Name      string
+	Type      FieldType
+	Sortable  bool
+	Separator byte
+}
+
+// document is what an index holds of a hash: the values of the schema fields
+type document struct {
+	values  map[string]string
+	numbers map[string]float64
+	// Number of occurrences of each term, per TEXT field
+	terms map[string]map[string]int
+}
+
+type keySet map[string]struct{}
+
+type Index struct {
+	sync.RWMutex
+	Name     string
+	Prefixes []string
+	Fields   []Field
+
+	docs map[string]*document
+	// Keys of the documents containing a term or tag, per field
+	postings map[string]map[string]keySet
+}
+
+func NewIndex(name string, prefixes []string, fields []Field) *Index {
+	return &Index{
+		Name:     name,
+		Prefixes: prefixes,
+		Fields:   fields,
+		docs:     make(map[string]*document),
+		postings: make(map[string]map[string]keySet),
+	}
+}
+
+// Covers reports whether a key is under one of the prefixes of the index
+func (idx *Index) Covers(key string) bool {
+	if len(idx.Prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range idx.Prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (idx *Index) field(name string) (Field, bool) {
+	for _, f := range idx.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (idx *Index) NumDocs() int {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	return len(idx.docs)
+}
+
+// Tokenize splits text into lower case terms
+func Tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func splitTags(value string, separator byte) []string {
+	var tags []string
+	for _, tag := range strings.Split(value, string(separator)) {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// Update indexes the fields of a hash, given as alternated names and values,
+// replacing what was indexed for the key before. Hashes without any schema
+// field aren't indexed.
+func (idx *Index) Update(key string, fields []string) {
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.removeLocked(key)
+
+	doc := &document{
+		values:  make(map[string]string),
+		numbers: make(map[string]float64),
+		terms:   make(map[string]map[string]int),
+	}
+	for i := 0; i+1 < len(fields); i += 2 {
+		f, ok := idx.field(fields[i])
+		if !ok {
+			continue
+		}
+
+		value := fields[i+1]
+		switch f.Type {
+		case FIELD_TEXT:
+			counts := make(map[string]int)
+			for _, term := range Tokenize(value) {
+				counts[term]++
+			}
+			doc.terms[f.Name] = counts
+		case FIELD_NUMERIC:
+			n, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				// Like RediSearch, a document with an invalid number isn't indexed
+				return
+			}
+			doc.numbers[f.Name] = n
+		}
+		doc.values[f.Name] = value
+	}
+	if len(doc.values) == 0 {
+		return
+	}
+
+	idx.docs[key] = doc
+	for _, f := range idx.Fields {
+		for _, term := range doc.postingTerms(f) {
+			idx.posting(f.Name, term)[key] = struct{}{}
+		}
+	}
+}
+
+// postingTerms returns the terms or tags of a field the document is listed
+// under
+func (doc *document) postingTerms(f Field) []string {
+	switch f.Type {
+	case FIELD_TEXT:
+		terms := make([]string, 0, len(doc.terms[f.Name]))
+		for term := range doc.terms[f.Name] {
+			terms = append(terms, term)
+		}
+		return terms
+	case FIELD_TAG:
+		if value, ok := doc.values[f.Name]; ok {
+			return splitTags(value, f.Separator)
+		}
+	}
+	return nil
+}
+
+func (idx *Index) posting(field, term string) keySet {
+	byTerm, ok := idx.postings[field]
+	if !ok {
+		byTerm = make(map[string]keySet)
+		idx.postings[field] = byTerm
+	}
+	keys, ok := byTerm[term]
+	if !ok {
+		keys = make(keySet)
+		byTerm[term] = keys
+	}
+	return keys
+}
+
+func (idx *Index) Remove(key string) {
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.removeLocked(key)
+}
+
+func (idx *Index) removeLocked(key string) {
+	doc, ok := idx.docs[key]
+	if !ok {
+		return
+	}
+
+	for _, f := range idx.Fields {
+		for _, term := range doc.postingTerms(f) {
+			keys := idx.postings[f.Name][term]
+			delete(keys, key)
+			if len(keys) == 0 {
+				delete(idx.postings[f.Name], term)
+			}
+		}
+	}
+	delete(idx.docs, key)
+}
+
+// Clear removes every document, e.g. before the keyspace is reloaded
+func (idx *Index) Clear() {
+	idx.Lock()
+	defer idx.Unlock()
+
+	idx.docs = make(map[string]*document)
+	idx.postings = make(map[string]map[string]keySet)
+}
+
+func parseBound(s string) (float64, bool, error) {
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	switch strings.ToLower(s) {
+	case "-inf":
+		return math.Inf(-1), exclusive, nil
+	case "+inf", "inf":
+		return math.Inf(1), exclusive, nil
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid numeric bound '%s'", s)
+	}
+	return n, exclusive, nil
+}
@@ -0,0 +1,337 @@
+package search
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type clauseKind int
+
+const (
+	// *
+	CLAUSE_ALL clauseKind = iota
+	// word, prefix*, (a|b) or @field:word
+	CLAUSE_TERMS
+	// @field:[min max]
+	CLAUSE_RANGE
+	// @field:{a|b}
+	CLAUSE_TAGS
+)
+
+type term struct {
+	text   string
+	prefix bool
+}
+
+type clause struct {
+	kind   clauseKind
+	negate bool
+	// Empty to match terms in any TEXT field
+	field string
+
+	terms []term
+	tags  []string
+
+	min, max                   float64
+	minExclusive, maxExclusive bool
+}
+
+// Query is a parsed search query: clauses separated by spaces, which must all
+// match (or not match, when prefixed with -).
+type Query struct {
+	clauses []clause
+}
+
+func ParseQuery(s string) (*Query, error) {
+	q := &Query{}
+	rest := strings.TrimSpace(s)
+	for rest != "" {
+		var (
+			c   clause
+			err error
+		)
+		if rest[0] == '-' {
+			c.negate = true
+			rest = rest[1:]
+		}
+
+		if strings.HasPrefix(rest, "@") {
+			colon := strings.IndexByte(rest, ':')
+			if colon < 0 {
+				return nil, fmt.Errorf("Syntax error: missing ':' after field in '%s'", rest)
+			}
+			c.field, rest = rest[1:colon], rest[colon+1:]
+		}
+
+		switch {
+		case strings.HasPrefix(rest, "["):
+			rest, err = c.parseRange(rest)
+		case strings.HasPrefix(rest, "{"):
+			rest, err = c.parseTags(rest)
+		case strings.HasPrefix(rest, "("):
+			var group string
+			group, rest, err = enclosed(rest, ')')
+			c.kind = CLAUSE_TERMS
+			for _, word := range strings.Split(group, "|") {
+				c.terms = append(c.terms, parseTerm(word))
+			}
+		default:
+			end := strings.IndexAny(rest, " \t")
+			if end < 0 {
+				end = len(rest)
+			}
+			word := rest[:end]
+			rest = rest[end:]
+			if word == "*" && c.field == "" {
+				c.kind = CLAUSE_ALL
+			} else {
+				c.kind = CLAUSE_TERMS
+				c.terms = []term{parseTerm(word)}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		q.clauses = append(q.clauses, c)
+		rest = strings.TrimSpace(rest)
+	}
+
+	if len(q.clauses) == 0 {
+		return nil, errors.New("Syntax error: empty query")
+	}
+	return q, nil
+}
+
+func parseTerm(word string) term {
+	word = strings.ToLower(strings.TrimSpace(word))
+	if strings.HasSuffix(word, "*") {
+		return term{text: strings.TrimSuffix(word, "*"), prefix: true}
+	}
+	return term{text: word}
+}
+
+// enclosed returns what is between the opening character at the start of s
+// and the given closing one, and what follows.
+func enclosed(s string, closing byte) (string, string, error) {
+	end := strings.IndexByte(s, closing)
+	if end < 0 {
+		return "", "", fmt.Errorf("Syntax error: missing '%c'", closing)
+	}
+	return s[1:end], s[end+1:], nil
+}
+
+func (c *clause) parseRange(s string) (string, error) {
+	inner, rest, err := enclosed(s, ']')
+	if err != nil {
+		return "", err
+	}
+
+	bounds := strings.Fields(inner)
+	if len(bounds) != 2 {
+		return "", fmt.Errorf("Syntax error: invalid numeric range '[%s]'", inner)
+	}
+
+	c.kind = CLAUSE_RANGE
+	if c.min, c.minExclusive, err = parseBound(bounds[0]); err != nil {
+		return "", err
+	}
+	if c.max, c.maxExclusive, err = parseBound(bounds[1]); err != nil {
+		return "", err
+	}
+	return rest, nil
+}
+
+func (c *clause) parseTags(s string) (string, error) {
+	inner, rest, err := enclosed(s, '}')
+	if err != nil {
+		return "", err
+	}
+
+	c.kind = CLAUSE_TAGS
+	for _, tag := range strings.Split(inner, "|") {
+		if tag = strings.ToLower(strings.TrimSpace(tag)); tag != "" {
+			c.tags = append(c.tags, tag)
+		}
+	}
+	return rest, nil
+}
+
+type SearchOptions struct {
+	// Field to sort by, by descending score when empty
+	SortBy string
+	Desc   bool
+	Offset int
+	Limit  int
+}
+
+// Search returns the number of documents matching the query, and the keys of
+// the page of them selected by the options.
+func (idx *Index) Search(q *Query, opts SearchOptions) (int, []string, error) {
+	idx.RLock()
+	defer idx.RUnlock()
+
+	var (
+		matched keySet
+		scores  = make(map[string]float64)
+	)
+	for _, c := range q.clauses {
+		keys, err := idx.evaluate(c, scores)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if matched == nil {
+			if !c.negate {
+				matched = keys
+				continue
+			}
+			matched = idx.allKeys()
+		}
+
+		for key := range matched {
+			if _, ok := keys[key]; ok == c.negate {
+				delete(matched, key)
+			}
+		}
+	}
+
+	results := make([]string, 0, len(matched))
+	for key := range matched {
+		results = append(results, key)
+	}
+
+	if err := idx.sort(results, scores, opts); err != nil {
+		return 0, nil, err
+	}
+
+	total := len(results)
+	start := min(max(opts.Offset, 0), total)
+	end := min(start+max(opts.Limit, 0), total)
+	return total, results[start:end], nil
+}
+
+func (idx *Index) allKeys() keySet {
+	keys := make(keySet, len(idx.docs))
+	for key := range idx.docs {
+		keys[key] = struct{}{}
+	}
+	return keys
+}
+
+// evaluate returns the keys of the documents matching a clause, adding the
+// frequency of matched terms to their score.
+func (idx *Index) evaluate(c clause, scores map[string]float64) (keySet, error) {
+	var f Field
+	if c.field != "" {
+		var ok bool
+		if f, ok = idx.field(c.field); !ok {
+			return nil, fmt.Errorf("Unknown field '%s'", c.field)
+		}
+	}
+
+	keys := make(keySet)
+	switch c.kind {
+	case CLAUSE_ALL:
+		return idx.allKeys(), nil
+	case CLAUSE_TERMS:
+		fields := idx.Fields
+		if c.field != "" {
+			if f.Type == FIELD_TAG {
+				return nil, fmt.Errorf("Field '%s' is a TAG field, use @%s:{...}", f.Name, f.Name)
+			}
+			fields = []Field{f}
+		}
+		for _, f := range fields {
+			if f.Type == FIELD_TEXT {
+				idx.matchTerms(f.Name, c.terms, keys, scores)
+			}
+		}
+	case CLAUSE_RANGE:
+		if f.Type != FIELD_NUMERIC {
+			return nil, fmt.Errorf("Field '%s' is not a NUMERIC field", c.field)
+		}
+		for key, doc := range idx.docs {
+			n, ok := doc.numbers[f.Name]
+			if !ok || n < c.min || n > c.max || (c.minExclusive && n == c.min) || (c.maxExclusive && n == c.max) {
+				continue
+			}
+			keys[key] = struct{}{}
+		}
+	case CLAUSE_TAGS:
+		if f.Type != FIELD_TAG {
+			return nil, fmt.Errorf("Field '%s' is not a TAG field", c.field)
+		}
+		for _, tag := range c.tags {
+			for key := range idx.postings[f.Name][tag] {
+				keys[key] = struct{}{}
+			}
+		}
+	}
+	return keys, nil
+}
+
+func (idx *Index) matchTerms(field string, terms []term, keys keySet, scores map[string]float64) {
+	add := func(indexed string, posting keySet) {
+		for key := range posting {
+			keys[key] = struct{}{}
+			scores[key] += float64(idx.docs[key].terms[field][indexed])
+		}
+	}
+
+	for _, t := range terms {
+		if !t.prefix {
+			add(t.text, idx.postings[field][t.text])
+			continue
+		}
+		for indexed, posting := range idx.postings[field] {
+			if strings.HasPrefix(indexed, t.text) {
+				add(indexed, posting)
+			}
+		}
+	}
+}
+
+func (idx *Index) sort(keys []string, scores map[string]float64, opts SearchOptions) error {
+	if opts.SortBy == "" {
+		sort.Slice(keys, func(i, j int) bool {
+			if scores[keys[i]] != scores[keys[j]] {
+				return scores[keys[i]] > scores[keys[j]]
+			}
+			return keys[i] < keys[j]
+		})
+		return nil
+	}
+
+	f, ok := idx.field(opts.SortBy)
+	if !ok {
+		return fmt.Errorf("Property '%s' not loaded nor in schema", opts.SortBy)
+	}
+
+	// compare orders two documents having the field
+	compare := func(a, b *document) int {
+		if f.Type == FIELD_NUMERIC {
+			return cmp.Compare(a.numbers[f.Name], b.numbers[f.Name])
+		}
+		return strings.Compare(a.values[f.Name], b.values[f.Name])
+	}
+
+	// Documents without the field come last whatever the order
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := idx.docs[keys[i]], idx.docs[keys[j]]
+		_, okA := a.values[f.Name]
+		_, okB := b.values[f.Name]
+		if !okA || !okB {
+			return okA
+		}
+
+		if c := compare(a, b); c != 0 {
+			return (c < 0) != opts.Desc
+		}
+		return keys[i] < keys[j]
+	})
+	return nil
+}
@@ -0,0 +1,81 @@
+// Package sketch implements frequency estimation sketches: count-min
+// sketches, which estimate how many times an item was seen, and Top-K, which
+// tracks the most frequent items with the HeavyKeeper algorithm.
+package sketch
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// hashItem returns two independent hashes of the item, combined to derive the
+// column of each row (Kirsch-Mitzenmacher)
+func hashItem(item string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(item))
+	h1 := h.Sum64()
+	h.Write([]byte{0xff})
+	h2 := h.Sum64() | 1
+	return h1, h2
+}
+
+func column(h1, h2 uint64, row, width uint64) uint64 {
+	return (h1 + row*h2) % width
+}
+
+// CountMinSketch counts items in Depth rows of Width counters, each item
+// incrementing one counter per row. Estimates never undercount.
+type CountMinSketch struct {
+	Width uint64
+	Depth uint64
+	// Sum of all the increments
+	Count uint64
+
+	counters []uint64
+}
+
+func NewCountMinSketch(width, depth uint64) *CountMinSketch {
+	return &CountMinSketch{Width: width, Depth: depth, counters: make([]uint64, width*depth)}
+}
+
+// DimensionsForError returns the dimensions for estimates to overcount by
+// less than errorRate times the total count, with the given probability of
+// exceeding it
+func DimensionsForError(errorRate, probability float64) (uint64, uint64) {
+	width := uint64(math.Ceil(2 / errorRate))
+	depth := uint64(math.Ceil(math.Log10(probability) / math.Log10(0.5)))
+	return width, max(depth, 1)
+}
+
+// IncrBy increments the counters of an item, returning its new estimate
+func (s *CountMinSketch) IncrBy(item string, n uint64) uint64 {
+	h1, h2 := hashItem(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.Depth; row++ {
+		i := row*s.Width + column(h1, h2, row, s.Width)
+		s.counters[i] += n
+		estimate = min(estimate, s.counters[i])
+	}
+	s.Count += n
+	return estimate
+}
+
+func (s *CountMinSketch) Query(item string) uint64 {
+	h1, h2 := hashItem(item)
+	estimate := uint64(math.MaxUint64)
+	for row := uint64(0); row < s.Depth; row++ {
+		estimate = min(estimate, s.counters[row*s.Width+column(h1, h2, row, s.Width)])
+	}
+	return estimate
+}
+
+// Size returns the number of bytes used by the counters
+func (s *CountMinSketch) Size() int {
+	return 8 * len(s.counters)
+}
+
+func (s *CountMinSketch) Clone() *CountMinSketch {
+	clone := *s
+	clone.counters = append([]uint64(nil), s.counters...)
+	return &clone
+}
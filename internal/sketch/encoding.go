@@ -0,0 +1,116 @@
+package sketch
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCorrupted = errors.New("corrupted sketch")
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	n, size := binary.Uvarint(d.buf)
+	if size <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		d.err = errCorrupted
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+// MarshalBinary encodes the dimensions and counters of the sketch as varints
+func (s *CountMinSketch) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(nil, s.Width)
+	buf = binary.AppendUvarint(buf, s.Depth)
+	buf = binary.AppendUvarint(buf, s.Count)
+	for _, counter := range s.counters {
+		buf = binary.AppendUvarint(buf, counter)
+	}
+	return buf, nil
+}
+
+func UnmarshalCountMinSketch(data []byte) (*CountMinSketch, error) {
+	d := &decoder{buf: data}
+	width, depth := d.uvarint(), d.uvarint()
+	// Every counter takes at least a byte
+	if d.err != nil || width == 0 || depth == 0 || width*depth > uint64(len(d.buf)) {
+		return nil, errCorrupted
+	}
+
+	s := NewCountMinSketch(width, depth)
+	s.Count = d.uvarint()
+	for i := range s.counters {
+		s.counters[i] = d.uvarint()
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return s, nil
+}
+
+// MarshalBinary encodes the parameters, buckets and tracked items of the
+// Top-K as varints
+func (t *TopK) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendUvarint(nil, t.K)
+	buf = binary.AppendUvarint(buf, t.Width)
+	buf = binary.AppendUvarint(buf, t.Depth)
+	buf = binary.AppendUvarint(buf, math.Float64bits(t.Decay))
+	buf = binary.AppendUvarint(buf, t.rng)
+
+	for _, b := range t.buckets {
+		buf = binary.AppendUvarint(buf, uint64(b.fingerprint))
+		buf = binary.AppendUvarint(buf, b.count)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(t.top)))
+	for _, hitter := range t.top {
+		buf = binary.AppendUvarint(buf, uint64(len(hitter.Item)))
+		buf = append(buf, hitter.Item...)
+		buf = binary.AppendUvarint(buf, hitter.Count)
+	}
+	return buf, nil
+}
+
+func UnmarshalTopK(data []byte) (*TopK, error) {
+	d := &decoder{buf: data}
+	k, width, depth := d.uvarint(), d.uvarint(), d.uvarint()
+	decay := math.Float64frombits(d.uvarint())
+	// Every bucket takes at least two bytes
+	if d.err != nil || k == 0 || width == 0 || depth == 0 || width*depth > uint64(len(d.buf))/2 {
+		return nil, errCorrupted
+	}
+
+	t := NewTopK(k, width, depth, decay)
+	t.rng = d.uvarint()
+	for i := range t.buckets {
+		t.buckets[i] = bucket{fingerprint: uint32(d.uvarint()), count: d.uvarint()}
+	}
+
+	n := d.uvarint()
+	if n > k {
+		return nil, errCorrupted
+	}
+	for ; n > 0 && d.err == nil; n-- {
+		t.top = append(t.top, HeavyHitter{Item: d.string(), Count: d.uvarint()})
+	}
+	if d.err != nil || t.rng == 0 {
+		return nil, errCorrupted
+	}
+	return t, nil
+}
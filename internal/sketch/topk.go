@@ -0,0 +1,169 @@
+package sketch
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"sort"
+)
+
+const (
+	DEFAULT_TOPK_WIDTH = 8
+	DEFAULT_TOPK_DEPTH = 7
+	DEFAULT_TOPK_DECAY = 0.9
+)
+
+type bucket struct {
+	fingerprint uint32
+	count       uint64
+}
+
+type HeavyHitter struct {
+	Item  string
+	Count uint64
+}
+
+// hitters is a min-heap of the tracked items, by count
+type hitters []HeavyHitter
+
+func (h hitters) Len() int           { return len(h) }
+func (h hitters) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h hitters) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *hitters) Push(x any)        { *h = append(*h, x.(HeavyHitter)) }
+func (h *hitters) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// TopK tracks the K most frequent items. Counts are kept in a HeavyKeeper
+// sketch, where colliding items decay each other's counters so that the
+// frequent ones keep theirs.
+type TopK struct {
+	K     uint64
+	Width uint64
+	Depth uint64
+	Decay float64
+
+	buckets []bucket
+	top     hitters
+	// State of the random generator deciding decays, kept with the sketch so
+	// that replicas make the same decisions
+	rng uint64
+}
+
+func NewTopK(k, width, depth uint64, decay float64) *TopK {
+	return &TopK{
+		K:       k,
+		Width:   width,
+		Depth:   depth,
+		Decay:   decay,
+		buckets: make([]bucket, width*depth),
+		rng:     1,
+	}
+}
+
+func fingerprint(item string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(item))
+	return h.Sum32()
+}
+
+// random returns a number in [0, 1) with xorshift64
+func (t *TopK) random() float64 {
+	t.rng ^= t.rng << 13
+	t.rng ^= t.rng >> 7
+	t.rng ^= t.rng << 17
+	return float64(t.rng>>11) / (1 << 53)
+}
+
+// IncrBy counts an item n times, returning the item expelled from the top
+// list to make room for it, if any
+func (t *TopK) IncrBy(item string, n uint64) (string, bool) {
+	fp := fingerprint(item)
+	h1, h2 := hashItem(item)
+
+	var estimate uint64
+	for row := uint64(0); row < t.Depth; row++ {
+		b := &t.buckets[row*t.Width+column(h1, h2, row, t.Width)]
+		switch {
+		case b.count == 0:
+			b.fingerprint, b.count = fp, n
+		case b.fingerprint == fp:
+			b.count += n
+		default:
+			// Each increment decays the other item with a probability
+			// decreasing with its count, taking over the bucket at zero
+			for left := n; left > 0; left-- {
+				if t.random() < math.Pow(t.Decay, float64(b.count)) {
+					b.count--
+					if b.count == 0 {
+						b.fingerprint, b.count = fp, left
+						break
+					}
+				}
+			}
+		}
+		if b.fingerprint == fp {
+			estimate = max(estimate, b.count)
+		}
+	}
+
+	for i := range t.top {
+		if t.top[i].Item == item {
+			t.top[i].Count = estimate
+			heap.Fix(&t.top, i)
+			return "", false
+		}
+	}
+
+	if uint64(len(t.top)) < t.K {
+		heap.Push(&t.top, HeavyHitter{item, estimate})
+		return "", false
+	}
+	if estimate > t.top[0].Count {
+		expelled := t.top[0].Item
+		t.top[0] = HeavyHitter{item, estimate}
+		heap.Fix(&t.top, 0)
+		return expelled, true
+	}
+	return "", false
+}
+
+func (t *TopK) Contains(item string) bool {
+	for _, hitter := range t.top {
+		if hitter.Item == item {
+			return true
+		}
+	}
+	return false
+}
+
+// List returns the tracked items, most frequent first
+func (t *TopK) List() []HeavyHitter {
+	list := append([]HeavyHitter(nil), t.top...)
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Item < list[j].Item
+	})
+	return list
+}
+
+// Size returns the number of bytes used by the buckets and the items
+func (t *TopK) Size() int {
+	size := 16 * len(t.buckets)
+	for _, hitter := range t.top {
+		size += len(hitter.Item) + 24
+	}
+	return size
+}
+
+func (t *TopK) Clone() *TopK {
+	clone := *t
+	clone.buckets = append([]bucket(nil), t.buckets...)
+	clone.top = append(hitters(nil), t.top...)
+	return &clone
+}
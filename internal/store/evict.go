@@ -0,0 +1,203 @@
+package store
+
+import (
+	"cmp"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Candidates kept by an EvictionPool between evictions
+	EVICTION_POOL_SIZE = 16
+	// Frequency counter of new keys, so that they aren't evicted right away
+	// by the LFU policies before getting a chance to be accessed
+	LFU_INIT_VAL = 5
+	// How hard the frequency counter is to increment, the higher the more
+	// accesses it takes to reach the maximum of 255
+	LFU_LOG_FACTOR = 10
+	// The frequency counter is decremented once per period of this many
+	// minutes without access
+	LFU_DECAY_TIME = 1
+)
+
+type EvictionPolicy int
+
+// Eviction policies, as named by maxmemory-policy
+const (
+	NO_EVICTION EvictionPolicy = iota
+	ALLKEYS_LRU
+	VOLATILE_LRU
+	ALLKEYS_LFU
+	VOLATILE_LFU
+	ALLKEYS_RANDOM
+	VOLATILE_RANDOM
+	VOLATILE_TTL
+)
+
+var evictionPolicies = map[string]EvictionPolicy{
+	"noeviction":      NO_EVICTION,
+	"allkeys-lru":     ALLKEYS_LRU,
+	"volatile-lru":    VOLATILE_LRU,
+	"allkeys-lfu":     ALLKEYS_LFU,
+	"volatile-lfu":    VOLATILE_LFU,
+	"allkeys-random":  ALLKEYS_RANDOM,
+	"volatile-random": VOLATILE_RANDOM,
+	"volatile-ttl":    VOLATILE_TTL,
+}
+
+func ParseEvictionPolicy(name string) (EvictionPolicy, bool) {
+	policy, ok := evictionPolicies[name]
+	return policy, ok
+}
+
+// volatile reports whether the policy only evicts keys with an expiration
+func (p EvictionPolicy) volatile() bool {
+	return p == VOLATILE_LRU || p == VOLATILE_LFU || p == VOLATILE_RANDOM || p == VOLATILE_TTL
+}
+
+// access tracks how recently and how often a key is read, for the LRU and
+// LFU policies. It is updated under the keyspace read lock, hence atomics.
+type access struct {
+	// Unix time in milliseconds of the last access
+	last atomic.Int64
+	// Logarithmic frequency counter, as in Redis: it is incremented with a
+	// probability that decreases as it grows, and decays while the key isn't
+	// accessed
+	counter atomic.Uint32
+}
+
+func newAccess() *access {
+	a := &access{}
+	a.last.Store(time.Now().UnixMilli())
+	a.counter.Store(LFU_INIT_VAL)
+	return a
+}
+
+// touch records an access, which entries without tracking ignore
+func (a *access) touch() {
+	if a == nil {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	counter := a.frequency(now)
+	if counter < math.MaxUint8 {
+		base := max(float64(counter)-LFU_INIT_VAL, 0)
+		if rand.Float64() < 1/(base*LFU_LOG_FACTOR+1) {
+			counter++
+		}
+	}
+	a.counter.Store(counter)
+	a.last.Store(now)
+}
+
+// frequency returns the counter decayed by the time since the last access
+func (a *access) frequency(now int64) uint32 {
+	periods := (now - a.last.Load()) / (LFU_DECAY_TIME * int64(time.Minute/time.Millisecond))
+	return uint32(max(int64(a.counter.Load())-periods, 0))
+}
+
+// evictionScore ranks a key for eviction under policy, the higher the
+// better a candidate it is
+func evictionScore(policy EvictionPolicy, entry Entry, now time.Time) int64 {
+	switch policy {
+	case ALLKEYS_LFU, VOLATILE_LFU:
+		if entry.access == nil {
+			return math.MaxUint8 - LFU_INIT_VAL
+		}
+		return math.MaxUint8 - int64(entry.access.frequency(now.UnixMilli()))
+	case VOLATILE_TTL:
+		return math.MaxInt64 - entry.Exp.UnixMilli()
+	default:
+		if entry.access == nil {
+			return 0
+		}
+		return now.UnixMilli() - entry.access.last.Load()
+	}
+}
+
+// EvictionPool keeps the best candidates found by the samplings of previous
+// evictions, as Redis does, which approximates the LRU or LFU order much
+// better than picking the best of each sample alone.
+type EvictionPool struct {
+	policy EvictionPolicy
+	// Sorted by ascending score, the best candidate last
+	candidates []evictionCandidate
+}
+
+type evictionCandidate struct {
+	key   string
+	score int64
+}
+
+// insert adds a key to the pool, unless the pool is full of better
+// candidates. A key already in the pool gets its score updated.
+func (p *EvictionPool) insert(key string, score int64) {
+	if i := slices.IndexFunc(p.candidates, func(c evictionCandidate) bool { return c.key == key }); i >= 0 {
+		p.candidates = slices.Delete(p.candidates, i, i+1)
+	}
+	if len(p.candidates) == EVICTION_POOL_SIZE {
+		if score <= p.candidates[0].score {
+			return
+		}
+		p.candidates = slices.Delete(p.candidates, 0, 1)
+	}
+
+	i, _ := slices.BinarySearchFunc(p.candidates, score, func(c evictionCandidate, score int64) int {
+		return cmp.Compare(c.score, score)
+	})
+	p.candidates = slices.Insert(p.candidates, i, evictionCandidate{key, score})
+}
+
+// Evict deletes one key chosen by policy, among samples keys sampled at
+// random, and returns it. It returns false when there is nothing left to
+// evict, or when no key with an expiration was sampled for the volatile
+// policies.
+func (k *Keyspace) Evict(policy EvictionPolicy, samples int, pool *EvictionPool) (string, bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	if policy == NO_EVICTION {
+		return "", false
+	}
+	evictable := func(key string) bool {
+		entry, ok := k.engine.Get(key)
+		return ok && (!policy.volatile() || !entry.Exp.IsZero())
+	}
+
+	if policy == ALLKEYS_RANDOM || policy == VOLATILE_RANDOM {
+		for _, key := range k.index.sample(samples) {
+			if evictable(key) {
+				k.deleteLocked(key)
+				return key, true
+			}
+		}
+		return "", false
+	}
+
+	// Scores of different policies can't be compared
+	if pool.policy != policy {
+		pool.policy, pool.candidates = policy, nil
+	}
+	now := time.Now()
+	for _, key := range k.index.sample(samples) {
+		if evictable(key) {
+			entry, _ := k.engine.Get(key)
+			pool.insert(key, evictionScore(policy, entry, now))
+		}
+	}
+
+	// Candidates may have been deleted since they were sampled
+	for len(pool.candidates) > 0 {
+		key := pool.candidates[len(pool.candidates)-1].key
+		pool.candidates = pool.candidates[:len(pool.candidates)-1]
+		if evictable(key) {
+			k.deleteLocked(key)
+			return key, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,194 @@
+package store
+
+import (
+	"maps"
+	"slices"
+	"sync/atomic"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/rdb"
+)
+
+// Thresholds past which hashes convert from listpacks to maps, set from the
+// hash-max-listpack-entries and hash-max-listpack-value configs
+var (
+	HashMaxListpackEntries atomic.Int64
+	HashMaxListpackValue   atomic.Int64
+)
+
+func init() {
+	HashMaxListpackEntries.Store(128)
+	HashMaxListpackValue.Store(64)
+}
+
+// Hash stores small hashes as a flat list of alternated fields and values,
+// which is compact and fast enough to scan linearly, and converts to a map once
+// it grows past hash-max-listpack-entries or gets a value longer than
+// hash-max-listpack-value. Like Redis it never converts back.
+type Hash struct {
+	listpack []string
+	table    map[string]string
+	// Fields of the table, for HSCAN to walk with a stable cursor
+	index scanIndex
+	// Estimated memory used by the fields and values
+	bytes int
+}
+
+func NewHash() *Hash {
+	return &Hash{listpack: make([]string, 0, 2)}
+}
+
+func (h *Hash) Encoding() string {
+	if h.table != nil {
+		return "hashtable"
+	}
+	return "listpack"
+}
+
+func (h *Hash) Len() int {
+	if h.table != nil {
+		return len(h.table)
+	}
+	return len(h.listpack) / 2
+}
+
+func (h *Hash) Get(field string) (string, bool) {
+	if h.table != nil {
+		value, ok := h.table[field]
+		return value, ok
+	}
+
+	for i := 0; i < len(h.listpack); i += 2 {
+		if h.listpack[i] == field {
+			return h.listpack[i+1], true
+		}
+	}
+	return "", false
+}
+
+func (h *Hash) fieldSize(field, value string) int {
+	size := len(field) + len(value) + 2*STRING_OVERHEAD
+	if h.table != nil {
+		size += MAP_SLOT_OVERHEAD
+	}
+	return size
+}
+
+// Set returns whether the field is new
+func (h *Hash) Set(field, value string) bool {
+	if h.table == nil {
+		for i := 0; i < len(h.listpack); i += 2 {
+			if h.listpack[i] == field {
+				h.bytes += len(value) - len(h.listpack[i+1])
+				h.listpack[i+1] = value
+				h.convertIfNeeded(value)
+				return false
+			}
+		}
+
+		h.listpack = append(h.listpack, field, value)
+		h.bytes += h.fieldSize(field, value)
+		h.convertIfNeeded(field, value)
+		return true
+	}
+
+	old, exists := h.table[field]
+	if exists {
+		h.bytes += len(value) - len(old)
+	} else {
+		h.bytes += h.fieldSize(field, value)
+		h.index.add(field)
+	}
+	h.table[field] = value
+	return !exists
+}
+
+func (h *Hash) Del(field string) bool {
+	if h.table != nil {
+		value, exists := h.table[field]
+		if exists {
+			h.bytes -= h.fieldSize(field, value)
+			delete(h.table, field)
+			h.index.remove(field)
+		}
+		return exists
+	}
+
+	for i := 0; i < len(h.listpack); i += 2 {
+		if h.listpack[i] == field {
+			h.bytes -= h.fieldSize(field, h.listpack[i+1])
+			h.listpack = slices.Delete(h.listpack, i, i+2)
+			return true
+		}
+	}
+	return false
+}
+
+func (h *Hash) convertIfNeeded(added ...string) {
+	tooBig := h.Len() > int(HashMaxListpackEntries.Load())
+	for _, s := range added {
+		tooBig = tooBig || len(s) > int(HashMaxListpackValue.Load())
+	}
+	if !tooBig {
+		return
+	}
+
+	h.table = make(map[string]string, h.Len())
+	for i := 0; i < len(h.listpack); i += 2 {
+		h.table[h.listpack[i]] = h.listpack[i+1]
+		h.index.add(h.listpack[i])
+	}
+	h.bytes += len(h.table) * MAP_SLOT_OVERHEAD
+	h.listpack = nil
+}
+
+// Fields returns the fields and values alternated, in insertion order for
+// listpacks.
+func (h *Hash) Fields() []string {
+	if h.table == nil {
+		return slices.Clone(h.listpack)
+	}
+
+	fields := make([]string, 0, 2*len(h.table))
+	for field, value := range h.table {
+		fields = append(fields, field, value)
+	}
+	return fields
+}
+
+// Scan returns fields and values alternated, starting at cursor, at least
+// count fields unless the iteration ends, and the cursor to continue from, 0
+// when the iteration is complete. Like in Redis, listpacks are returned whole
+// in a single call.
+func (h *Hash) Scan(cursor uint64, count int) ([]string, uint64) {
+	if h.table == nil {
+		return h.Fields(), 0
+	}
+
+	fields, next := h.index.scan(cursor, count, nil)
+	scanned := make([]string, 0, 2*len(fields))
+	for _, field := range fields {
+		scanned = append(scanned, field, h.table[field])
+	}
+	return scanned, next
+}
+
+func (h *Hash) clone() *Hash {
+	return &Hash{
+		listpack: slices.Clone(h.listpack),
+		table:    maps.Clone(h.table),
+		index:    h.index.clone(),
+		bytes:    h.bytes,
+	}
+}
+
+func (h *Hash) ToRdb() *rdb.Hash {
+	return &rdb.Hash{Fields: h.Fields()}
+}
+
+func HashFromRdb(h *rdb.Hash) *Hash {
+	hash := NewHash()
+	for i := 0; i+1 < len(h.Fields); i += 2 {
+		hash.Set(h.Fields[i], h.Fields[i+1])
+	}
+	return hash
+}
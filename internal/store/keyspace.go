@@ -0,0 +1,284 @@
+package store
+
+import (
+	"sync"
+	"time"
+)
+
+type Keyspace struct {
+	sync.RWMutex
+	engine    Engine
+	snapshots []*Snapshot
+	// Estimated memory used by the keyspace, kept up to date on every write
+	used int
+	// Stable iteration order for SCAN
+	index     scanIndex
+	listeners []Listener
+	// Changes made to the keys so far, see Changes
+	changes int64
+	// Decides whether an expired key found by a lookup, or by the active
+	// expire cycle, is deleted
+	expireHandler func(key string, active bool) bool
+}
+
+func New(engine Engine) *Keyspace {
+	k := &Keyspace{}
+	k.Replace(engine)
+	return k
+}
+
+// Get returns the raw entry of a key, even if it already expired
+func (k *Keyspace) Get(key string) (Entry, bool) {
+	k.RLock()
+	defer k.RUnlock()
+
+	return k.engine.Get(key)
+}
+
+// SetExpireHandler sets the function called, with the keyspace locked, when
+// a lookup or ExpireCycle finds an expired key, with active set for the
+// latter. The key is only deleted if it returns true, so that a replica can
+// leave its expired keys to the DEL of its master.
+func (k *Keyspace) SetExpireHandler(fn func(key string, active bool) bool) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.expireHandler = fn
+}
+
+// lookup returns the live value of a key, checking it holds the given type.
+// Expired keys are deleted as they are found, unless the expire handler
+// keeps them. The value is returned with the keyspace unlocked, so values
+// modified in place, like hashes, must only be read by the goroutine that
+// makes the writes.
+func (k *Keyspace) lookup(key string, t Type) (any, bool, error) {
+	entry, ok := k.Get(key)
+	if !ok {
+		return nil, false, nil
+	}
+	if entry.Expired() {
+		k.deleteExpired(key)
+		return nil, false, nil
+	}
+	if entry.Type != t {
+		return nil, false, ErrWrongType
+	}
+	entry.access.touch()
+	return entry.Value, true, nil
+}
+
+func (k *Keyspace) GetString(key string) (string, bool, error) {
+	value, ok, err := k.lookup(key, TYPE_STRING)
+	if !ok {
+		return "", ok, err
+	}
+	return value.(string), true, nil
+}
+
+func (k *Keyspace) GetStream(key string) (*Stream, bool, error) {
+	value, ok, err := k.lookup(key, TYPE_STREAM)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*Stream), true, nil
+}
+
+func (k *Keyspace) GetHash(key string) (*Hash, bool, error) {
+	value, ok, err := k.lookup(key, TYPE_HASH)
+	if !ok {
+		return nil, ok, err
+	}
+	return value.(*Hash), true, nil
+}
+
+func (k *Keyspace) Set(key string, val any, exp time.Time, t Type) Entry {
+	k.Lock()
+	defer k.Unlock()
+
+	entry := Entry{
+		Value:  val,
+		Exp:    exp,
+		Type:   t,
+		access: newAccess(),
+	}
+
+	k.preserveLocked(key)
+	if old, ok := k.engine.Get(key); ok {
+		k.used -= old.MemoryUsage(key)
+	} else {
+		k.index.add(key)
+	}
+	k.used += entry.MemoryUsage(key)
+	k.engine.Set(key, entry)
+	k.changes++
+	k.notifyLocked(key, &entry)
+	return entry
+}
+
+// Modify runs fn, which changes the value of an existing key in place, with
+// the keyspace locked, keeping snapshots and memory accounting up to date.
+func (k *Keyspace) Modify(key string, fn func() error) error {
+	k.Lock()
+	defer k.Unlock()
+
+	k.preserveLocked(key)
+	entry, ok := k.engine.Get(key)
+	if ok {
+		k.used -= entry.MemoryUsage(key)
+		defer func() {
+			k.used += entry.MemoryUsage(key)
+			k.changes++
+			k.notifyLocked(key, &entry)
+		}()
+	}
+	return fn()
+}
+
+func (k *Keyspace) deleteExpired(key string) {
+	k.Lock()
+	defer k.Unlock()
+
+	entry, ok := k.engine.Get(key)
+	if !ok || !entry.Expired() {
+		return
+	}
+	if k.expireHandler == nil || k.expireHandler(key, false) {
+		k.deleteLocked(key)
+	}
+}
+
+// ExpireCycle samples up to samples keys at random and deletes those that
+// expired, so that keys nobody reads again don't stay in memory forever. It
+// returns how many of the sampled keys had an expiration, and how many of
+// them were expired.
+func (k *Keyspace) ExpireCycle(samples int) (volatile int, expired int) {
+	k.Lock()
+	defer k.Unlock()
+
+	for _, key := range k.index.sample(samples) {
+		entry, ok := k.engine.Get(key)
+		if !ok || entry.Exp.IsZero() {
+			continue
+		}
+
+		volatile++
+		if entry.Expired() {
+			expired++
+			if k.expireHandler == nil || k.expireHandler(key, true) {
+				k.deleteLocked(key)
+			}
+		}
+	}
+	return volatile, expired
+}
+
+func (k *Keyspace) Delete(key string) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.deleteLocked(key)
+}
+
+func (k *Keyspace) deleteLocked(key string) {
+	k.preserveLocked(key)
+	if old, ok := k.engine.Get(key); ok {
+		k.used -= old.MemoryUsage(key)
+		k.index.remove(key)
+		k.changes++
+		k.notifyLocked(key, nil)
+	}
+	k.engine.Delete(key)
+}
+
+// SetExpiry updates the expiration of an existing key, reporting whether the
+// key was found.
+func (k *Keyspace) SetExpiry(key string, exp time.Time) bool {
+	k.Lock()
+	defer k.Unlock()
+
+	entry, ok := k.engine.Get(key)
+	if !ok || entry.Expired() {
+		return false
+	}
+
+	k.preserveLocked(key)
+	k.changes++
+	return k.engine.Expire(key, exp)
+}
+
+// Changes returns how many times a key was set, modified, deleted or had its
+// expiration changed since the keyspace was created. Replacing the whole
+// keyspace doesn't count, as a loaded dump has nothing new to save.
+func (k *Keyspace) Changes() int64 {
+	k.RLock()
+	defer k.RUnlock()
+
+	return k.changes
+}
+
+// Replace swaps the whole keyspace, e.g. after loading a dump
+func (k *Keyspace) Replace(engine Engine) {
+	k.Lock()
+	defer k.Unlock()
+
+	for _, s := range k.snapshots {
+		for _, key := range s.keys {
+			k.preserveLocked(key)
+		}
+	}
+	k.engine = engine
+	k.used = 0
+	k.index = scanIndex{}
+	for _, l := range k.listeners {
+		l.Reset()
+	}
+	var untracked []string
+	engine.Iterate(func(key string, entry Entry) bool {
+		k.used += entry.MemoryUsage(key)
+		k.index.add(key)
+		k.notifyLocked(key, &entry)
+		if entry.access == nil {
+			untracked = append(untracked, key)
+		}
+		return true
+	})
+	// Entries loaded straight into the engine count as just accessed
+	for _, key := range untracked {
+		entry, _ := engine.Get(key)
+		entry.access = newAccess()
+		engine.Set(key, entry)
+	}
+}
+
+func (k *Keyspace) UsedMemory() int {
+	k.RLock()
+	defer k.RUnlock()
+
+	return k.used
+}
+
+func (k *Keyspace) Stats() (keys int, expires int, avgTTL int64) {
+	k.RLock()
+	defer k.RUnlock()
+
+	now := time.Now()
+	var totalTTL int64
+	k.engine.Iterate(func(key string, entry Entry) bool {
+		if entry.Exp.IsZero() {
+			keys++
+			return true
+		}
+
+		if ttl := entry.Exp.Sub(now).Milliseconds(); ttl > 0 {
+			keys++
+			expires++
+			totalTTL += ttl
+		}
+		return true
+	})
+
+	if expires > 0 {
+		avgTTL = totalTTL / int64(expires)
+	}
+	return keys, expires, avgTTL
+}
@@ -0,0 +1,35 @@
+package store
+
+// Listener is told about every change to the keyspace, e.g. to maintain
+// secondary indexes. It's called with the keyspace locked, so it must not call
+// back into it, and gets the entry itself instead.
+type Listener interface {
+	// Changed is called after a key is set or modified, with a nil entry when
+	// the key was deleted
+	Changed(key string, entry *Entry)
+	// Reset is called when the whole keyspace is replaced, before Changed is
+	// called for each of the new keys
+	Reset()
+}
+
+func (k *Keyspace) AddListener(l Listener) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.listeners = append(k.listeners, l)
+}
+
+func (k *Keyspace) notifyLocked(key string, entry *Entry) {
+	for _, l := range k.listeners {
+		l.Changed(key, entry)
+	}
+}
+
+// Iterate calls fn for every key until it returns false, with the keyspace
+// read locked, so fn must not modify it.
+func (k *Keyspace) Iterate(fn func(key string, entry Entry) bool) {
+	k.RLock()
+	defer k.RUnlock()
+
+	k.engine.Iterate(fn)
+}
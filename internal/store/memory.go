@@ -0,0 +1,30 @@
+package store
+
+import "unsafe"
+
+const (
+	// A string header in a slice or map, without its data
+	STRING_OVERHEAD = int(unsafe.Sizeof(""))
+	// What a map adds to each key and value: the tophash byte and padding
+	MAP_SLOT_OVERHEAD = 8
+	// Every key costs its map slot and entry on top of the key itself
+	KEY_OVERHEAD      = STRING_OVERHEAD + int(unsafe.Sizeof(Entry{})) + int(unsafe.Sizeof(access{})) + MAP_SLOT_OVERHEAD
+	STREAM_ENTRY_SIZE = int(unsafe.Sizeof(StreamEntry{}))
+)
+
+// MemoryUsage estimates the memory used by a key and its value in constant
+// time, using the sizes maintained as values are modified.
+func (e Entry) MemoryUsage(key string) int {
+	size := KEY_OVERHEAD + len(key)
+	switch value := e.Value.(type) {
+	case string:
+		size += len(value)
+	case *Stream:
+		size += int(unsafe.Sizeof(*value)) + value.bytes
+	case *Hash:
+		size += int(unsafe.Sizeof(*value)) + value.bytes
+	case ModuleValue:
+		size += value.MemoryUsage()
+	}
+	return size
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"fmt"
+	"sync"
+)
+
+// ModuleValue is a value of a type beyond the core ones, like JSON documents
+// or probabilistic filters. Such values are modified in place like hashes, so
+// they know how to copy, size and serialize themselves.
+type ModuleValue interface {
+	// TypeName is the 9 character name of the type, reported by TYPE and
+	// used to identify it in dumps
+	TypeName() string
+	Clone() ModuleValue
+	// MemoryUsage returns the bytes used by the value, in constant time
+	MemoryUsage() int
+	MarshalBinary() ([]byte, error)
+}
+
+// ModuleType describes how to load values of a type from a dump
+type ModuleType struct {
+	Name   string
+	EncVer int
+	Decode func(encver int, data []byte) (ModuleValue, error)
+}
+
+var moduleTypes = struct {
+	sync.RWMutex
+	types map[string]ModuleType
+}{types: make(map[string]ModuleType)}
+
+func RegisterModuleType(t ModuleType) {
+	moduleTypes.Lock()
+	defer moduleTypes.Unlock()
+
+	moduleTypes.types[t.Name] = t
+}
+
+func LookupModuleType(name string) (ModuleType, bool) {
+	moduleTypes.RLock()
+	defer moduleTypes.RUnlock()
+
+	t, ok := moduleTypes.types[name]
+	return t, ok
+}
+
+// DecodeModuleValue loads a value of a registered type from a dump
+func DecodeModuleValue(name string, encver int, data []byte) (ModuleValue, error) {
+	t, ok := LookupModuleType(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown module type %s", name)
+	}
+	if encver > t.EncVer {
+		return nil, fmt.Errorf("module type %s encoding version %d is newer than %d", name, encver, t.EncVer)
+	}
+	return t.Decode(encver, data)
+}
+
+// GetModule returns the value of a key holding the module type name
+func (k *Keyspace) GetModule(key string, name string) (ModuleValue, bool, error) {
+	value, ok, err := k.lookup(key, TYPE_MODULE)
+	if !ok {
+		return nil, ok, err
+	}
+	if value.(ModuleValue).TypeName() != name {
+		return nil, false, ErrWrongType
+	}
+	return value.(ModuleValue), true, nil
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"hash/maphash"
+	"math/bits"
+	"math/rand/v2"
+	"slices"
+)
+
+const (
+	SCAN_MIN_BUCKETS    = 4
+	SCAN_MAX_BUCKET_LEN = 2
+)
+
+var scanSeed = maphash.MakeSeed()
+
+// scanIndex spreads the keys over a power of two number of buckets, so SCAN
+// can walk the keyspace with a cursor that stays valid while keys are added
+// and removed, which Go maps don't allow. The cursor is a bucket index with
+// its bits reversed and incremented from the most significant bit, as in
+// Redis: when the table doubles or halves, the buckets already visited map to
+// buckets that are still behind the cursor, so no key that exists during the
+// whole scan is missed (some may be returned twice after a resize).
+type scanIndex struct {
+	buckets [][]string
+	// Number of keys indexed
+	keys int
+}
+
+func (idx *scanIndex) bucket(key string, size int) int {
+	return int(maphash.String(scanSeed, key) & uint64(size-1))
+}
+
+func (idx *scanIndex) add(key string) {
+	if idx.buckets == nil {
+		idx.buckets = make([][]string, SCAN_MIN_BUCKETS)
+	}
+
+	b := idx.bucket(key, len(idx.buckets))
+	idx.buckets[b] = append(idx.buckets[b], key)
+	idx.keys++
+
+	if idx.keys > SCAN_MAX_BUCKET_LEN*len(idx.buckets) {
+		idx.resize(2 * len(idx.buckets))
+	}
+}
+
+func (idx *scanIndex) remove(key string) {
+	if idx.buckets == nil {
+		return
+	}
+
+	b := idx.bucket(key, len(idx.buckets))
+	bucket := idx.buckets[b]
+	for i := range bucket {
+		if bucket[i] == key {
+			bucket[i] = bucket[len(bucket)-1]
+			idx.buckets[b] = bucket[:len(bucket)-1]
+			idx.keys--
+			break
+		}
+	}
+
+	if len(idx.buckets) > SCAN_MIN_BUCKETS && idx.keys < len(idx.buckets)/8 {
+		idx.resize(len(idx.buckets) / 2)
+	}
+}
+
+func (idx *scanIndex) resize(size int) {
+	buckets := make([][]string, size)
+	for _, bucket := range idx.buckets {
+		for _, key := range bucket {
+			b := idx.bucket(key, size)
+			buckets[b] = append(buckets[b], key)
+		}
+	}
+	idx.buckets = buckets
+}
+
+// sample returns up to n keys from consecutive buckets, starting at a random
+// one, which hold keys in random order
+func (idx *scanIndex) sample(n int) []string {
+	if idx.keys == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, n)
+	start := rand.IntN(len(idx.buckets))
+	for i := 0; i < len(idx.buckets) && len(keys) < n; i++ {
+		keys = append(keys, idx.buckets[(start+i)%len(idx.buckets)]...)
+	}
+	return keys[:min(len(keys), n)]
+}
+
+func (idx *scanIndex) clone() scanIndex {
+	if idx.buckets == nil {
+		return scanIndex{}
+	}
+	buckets := make([][]string, len(idx.buckets))
+	for i, bucket := range idx.buckets {
+		buckets[i] = slices.Clone(bucket)
+	}
+	return scanIndex{buckets: buckets, keys: idx.keys}
+}
+
+// scan appends the keys of the buckets starting at cursor until at least count
+// keys were collected, and returns the cursor to continue from, 0 when the
+// iteration is complete.
+func (idx *scanIndex) scan(cursor uint64, count int, keys []string) ([]string, uint64) {
+	if idx.keys == 0 {
+		return keys, 0
+	}
+
+	mask := uint64(len(idx.buckets) - 1)
+	for visited := 0; visited < count; {
+		bucket := idx.buckets[cursor&mask]
+		keys = append(keys, bucket...)
+		visited += max(len(bucket), 1)
+
+		// Increment the reversed cursor
+		cursor |= ^mask
+		cursor = bits.Reverse64(cursor)
+		cursor++
+		cursor = bits.Reverse64(cursor)
+		if cursor == 0 {
+			break
+		}
+	}
+	return keys, cursor
+}
+
+// Scan returns the keys of the buckets starting at cursor, at least count of
+// them unless the iteration ends, and the cursor to continue from, 0 when the
+// iteration is complete. Keys may have expired.
+func (k *Keyspace) Scan(cursor uint64, count int) ([]string, uint64) {
+	k.RLock()
+	defer k.RUnlock()
+
+	return k.index.scan(cursor, count, nil)
+}
@@ -0,0 +1,115 @@
+package store
+
+import "slices"
+
+// Snapshot is a point-in-time view of the keyspace. Rather than copying the
+// whole keyspace, the keys present when the snapshot started are listed, and
+// writers save the previous entry of a key before modifying it while the
+// snapshot is active (copy on write).
+type Snapshot struct {
+	keys    []string
+	expires int
+	// Entries as they were when the snapshot started, nil for keys that didn't
+	// exist at that point
+	saved map[string]*Entry
+}
+
+// frozen returns a copy of the entry that won't change when the live value is
+// modified in place, as streams, hashes and module values are.
+func (e Entry) frozen() Entry {
+	switch value := e.Value.(type) {
+	case *Stream:
+		e.Value = &Stream{entries: slices.Clone(value.entries), lastID: value.lastID, bytes: value.bytes}
+	case *Hash:
+		e.Value = value.clone()
+	case ModuleValue:
+		e.Value = value.Clone()
+	}
+	return e
+}
+
+// BeginSnapshot starts a snapshot, which must be released with EndSnapshot
+func (k *Keyspace) BeginSnapshot() *Snapshot {
+	k.Lock()
+	defer k.Unlock()
+
+	s := &Snapshot{
+		keys:  make([]string, 0, k.engine.Len()),
+		saved: make(map[string]*Entry),
+	}
+	k.engine.Iterate(func(key string, entry Entry) bool {
+		s.keys = append(s.keys, key)
+		if !entry.Exp.IsZero() {
+			s.expires++
+		}
+		return true
+	})
+
+	k.snapshots = append(k.snapshots, s)
+	return s
+}
+
+func (k *Keyspace) EndSnapshot(s *Snapshot) {
+	k.Lock()
+	defer k.Unlock()
+
+	k.snapshots = slices.DeleteFunc(k.snapshots, func(active *Snapshot) bool {
+		return active == s
+	})
+}
+
+// preserveLocked saves the current entry of a key in every active snapshot
+// that didn't save it yet. Must be called with the write lock held, before
+// the key is modified.
+func (k *Keyspace) preserveLocked(key string) {
+	for _, s := range k.snapshots {
+		if _, ok := s.saved[key]; ok {
+			continue
+		}
+
+		if entry, ok := k.engine.Get(key); ok {
+			frozen := entry.frozen()
+			s.saved[key] = &frozen
+		} else {
+			s.saved[key] = nil
+		}
+	}
+}
+
+// Len returns the number of keys in the snapshot, expired ones included
+func (s *Snapshot) Len() int {
+	return len(s.keys)
+}
+
+// Expires returns the number of keys with an expiration in the snapshot
+func (s *Snapshot) Expires() int {
+	return s.expires
+}
+
+// Each calls fn with every entry of the snapshot. The lock is only held while
+// looking up each entry, so writes continue during the iteration. Entries not
+// modified since the snapshot started are frozen before the lock is released,
+// as fn reads them while writers may change the live values in place.
+func (s *Snapshot) Each(k *Keyspace, fn func(key string, entry Entry) error) error {
+	for _, key := range s.keys {
+		k.RLock()
+		entry, ok := k.engine.Get(key)
+		if saved, preserved := s.saved[key]; preserved {
+			entry, ok = Entry{}, saved != nil
+			if saved != nil {
+				entry = *saved
+			}
+		} else if ok {
+			entry = entry.frozen()
+		}
+		k.RUnlock()
+
+		if !ok {
+			continue
+		}
+		if err := fn(key, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
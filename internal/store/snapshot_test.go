@@ -0,0 +1,47 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSnapshotFreezesValuesChangedInPlace(t *testing.T) {
+	k := New(NewMemoryEngine())
+	hash := NewHash()
+	hash.Set("before", "v")
+	k.Set("hash", hash, time.Time{}, TYPE_HASH)
+	stream := NewStream()
+	stream.Append("1-1", []string{"before", "v"})
+	k.Set("stream", stream, time.Time{}, TYPE_STREAM)
+
+	s := k.BeginSnapshot()
+	defer k.EndSnapshot(s)
+
+	err := s.Each(k, func(key string, entry Entry) error {
+		// A write landing while the dump is written, e.g. from the executor
+		// during a BGSAVE, must not show in the entry handed out
+		k.Modify(key, func() error {
+			if key == "hash" {
+				hash.Set("after", "v")
+			} else {
+				stream.Append("2-1", []string{"after", "v"})
+			}
+			return nil
+		})
+
+		switch value := entry.Value.(type) {
+		case *Hash:
+			if value.Len() != 1 {
+				t.Errorf("snapshot of the hash has %d fields, want 1", value.Len())
+			}
+		case *Stream:
+			if value.Len() != 1 || value.LastID() != (StreamID{1, 1}) {
+				t.Errorf("snapshot of the stream has %d entries up to %s, want 1 up to 1-1", value.Len(), value.LastID())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
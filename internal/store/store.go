@@ -0,0 +1,136 @@
+// Package store holds the keyspace: the entries of every key, the storage
+// engine keeping them, and the bookkeeping around it (snapshots for dumps,
+// memory accounting and the SCAN index). Typed accessors check expirations
+// and types, so command handlers never assert on raw values.
+package store
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+var ErrWrongType = resp.ErrWrongType
+
+type Type int
+
+const (
+	TYPE_STRING Type = iota
+	TYPE_STREAM
+	TYPE_HASH
+	// Any ModuleValue, see Entry.TypeName for the actual type
+	TYPE_MODULE
+)
+
+func (t Type) String() string {
+	switch t {
+	case TYPE_STRING:
+		return "string"
+	case TYPE_STREAM:
+		return "stream"
+	case TYPE_HASH:
+		return "hash"
+	case TYPE_MODULE:
+		return "module"
+	default:
+		return ""
+	}
+}
+
+// Entry is the value of a key: a string, *Stream, *Hash or ModuleValue
+// according to Type
+type Entry struct {
+	Value any
+	Exp   time.Time
+	Type  Type
+	// Set by the keyspace for the eviction policies
+	access *access
+}
+
+func (e Entry) Expired() bool {
+	return !e.Exp.IsZero() && time.Now().After(e.Exp)
+}
+
+// TypeName returns the type reported by TYPE, which is the name of the type
+// for module values.
+func (e Entry) TypeName() string {
+	if value, ok := e.Value.(ModuleValue); ok {
+		return value.TypeName()
+	}
+	return e.Type.String()
+}
+
+// Engine is the storage behind the keyspace. Keyspace takes care of the
+// locking, snapshots, memory accounting and SCAN index around it, so engines
+// only need to map keys to entries. Values modified in place (streams, hashes)
+// are owned by the engine once set.
+type Engine interface {
+	Get(key string) (Entry, bool)
+	Set(key string, entry Entry)
+	Delete(key string)
+	// Expire changes the expiration of an existing key, reporting whether it
+	// was found.
+	Expire(key string, exp time.Time) bool
+	Len() int
+	// Iterate calls fn for every entry until it returns false
+	Iterate(fn func(key string, entry Entry) bool)
+}
+
+const DEFAULT_ENGINE = "memory"
+
+// Engines selectable with the storage-engine config, by name
+var Engines = map[string]func() Engine{
+	"memory": NewMemoryEngine,
+}
+
+func NewEngine(name string) (Engine, error) {
+	engine, ok := Engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown storage engine '%s'", name)
+	}
+	return engine(), nil
+}
+
+// memoryEngine keeps the whole dataset in a Go map
+type memoryEngine map[string]Entry
+
+func NewMemoryEngine() Engine {
+	return memoryEngine{}
+}
+
+func (m memoryEngine) Get(key string) (Entry, bool) {
+	entry, ok := m[key]
+	return entry, ok
+}
+
+func (m memoryEngine) Set(key string, entry Entry) {
+	m[key] = entry
+}
+
+func (m memoryEngine) Delete(key string) {
+	delete(m, key)
+}
+
+func (m memoryEngine) Expire(key string, exp time.Time) bool {
+	entry, ok := m[key]
+	if !ok {
+		return false
+	}
+
+	entry.Exp = exp
+	m[key] = entry
+	return true
+}
+
+func (m memoryEngine) Len() int {
+	return len(m)
+}
+
+func (m memoryEngine) Iterate(fn func(key string, entry Entry) bool) {
+	for key, entry := range m {
+		if !fn(key, entry) {
+			return
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package store
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/rdb"
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Errors of the IDs given to XADD, with the messages of Redis
+var (
+	ErrInvalidStreamID  = resp.NewError("ERR", "Invalid stream ID specified as stream command argument")
+	ErrStreamIDZero     = resp.NewError("ERR", "The ID specified in XADD must be greater than 0-0")
+	ErrStreamIDTooSmall = resp.NewError("ERR", "The ID specified in XADD is equal or smaller than the target stream top item")
+	ErrStreamExhausted  = resp.NewError("ERR", "The stream has exhausted the last possible ID, unable to add more items")
+)
+
+type StreamID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+func (id StreamID) String() string {
+	return fmt.Sprintf("%d-%d", id.Ms, id.Seq)
+}
+
+// Less reports whether id comes before other in a stream
+func (id StreamID) Less(other StreamID) bool {
+	return id.Ms < other.Ms || (id.Ms == other.Ms && id.Seq < other.Seq)
+}
+
+// ParseStreamID parses an ID given as <ms>-<seq>, or <ms> alone with seq
+// defaulting to defaultSeq
+func ParseStreamID(s string, defaultSeq uint64) (StreamID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	if !hasSeq {
+		return StreamID{ms, defaultSeq}, nil
+	}
+
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, ErrInvalidStreamID
+	}
+	return StreamID{ms, seq}, nil
+}
+
+type StreamEntry struct {
+	ID StreamID
+	// Field names and values, alternated
+	Fields []string
+}
+
+type Stream struct {
+	entries []StreamEntry
+	// Greatest ID ever added, which new entries must be greater than
+	lastID StreamID
+	// Estimated memory used by the entries
+	bytes int
+}
+
+func NewStream() *Stream {
+	return &Stream{entries: make([]StreamEntry, 0, 1)}
+}
+
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+func (s *Stream) LastID() StreamID {
+	return s.lastID
+}
+
+// nextID resolves the ID given to XADD: * for an ID generated from the
+// current time, <ms>-* for the next sequence number in that millisecond, or
+// an explicit ID, which must be greater than the last one
+func (s *Stream) nextID(input string) (StreamID, error) {
+	last := s.lastID
+	// Whatever the ID given, none can follow the last possible one
+	if last == (StreamID{math.MaxUint64, math.MaxUint64}) {
+		return StreamID{}, ErrStreamExhausted
+	}
+	if input == "*" {
+		ms := max(uint64(time.Now().UnixMilli()), last.Ms)
+		if ms > last.Ms {
+			return StreamID{ms, 0}, nil
+		}
+		if last.Seq == math.MaxUint64 {
+			return StreamID{ms + 1, 0}, nil
+		}
+		return StreamID{ms, last.Seq + 1}, nil
+	}
+
+	if msPart, ok := strings.CutSuffix(input, "-*"); ok {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return StreamID{}, ErrInvalidStreamID
+		}
+		if ms > last.Ms {
+			return StreamID{ms, 0}, nil
+		}
+		if ms < last.Ms || last.Seq == math.MaxUint64 {
+			return StreamID{}, ErrStreamIDTooSmall
+		}
+		return StreamID{ms, last.Seq + 1}, nil
+	}
+
+	id, err := ParseStreamID(input, 0)
+	if err != nil {
+		return StreamID{}, err
+	}
+	if id == (StreamID{}) {
+		return StreamID{}, ErrStreamIDZero
+	}
+	if !last.Less(id) {
+		return StreamID{}, ErrStreamIDTooSmall
+	}
+	return id, nil
+}
+
+// Append adds an entry with the alternated field names and values, under
+// the ID resolved from input as XADD does, and returns that ID
+func (s *Stream) Append(input string, fields []string) (StreamID, error) {
+	id, err := s.nextID(input)
+	if err != nil {
+		return id, err
+	}
+
+	s.entries = append(s.entries, StreamEntry{id, fields})
+	s.lastID = id
+	s.bytes += streamEntrySize(fields)
+	return id, nil
+}
+
+// Range returns the entries with IDs from start to end, both included, at
+// most count of them unless count is negative. Entries are kept in the order
+// of their IDs, so the range is found by binary search.
+func (s *Stream) Range(start, end StreamID, count int) []StreamEntry {
+	entries := s.entries
+	from := sort.Search(len(entries), func(i int) bool { return !entries[i].ID.Less(start) })
+	to := sort.Search(len(entries), func(i int) bool { return end.Less(entries[i].ID) })
+	if from >= to {
+		return nil
+	}
+	if count >= 0 && to-from > count {
+		to = from + count
+	}
+	return entries[from:to]
+}
+
+// After returns the entries with IDs greater than id, at most count of them
+// unless count is negative
+func (s *Stream) After(id StreamID, count int) []StreamEntry {
+	entries := s.entries
+	from := sort.Search(len(entries), func(i int) bool { return id.Less(entries[i].ID) })
+	if count >= 0 && len(entries)-from > count {
+		return entries[from : from+count]
+	}
+	return entries[from:]
+}
+
+func streamEntrySize(fields []string) int {
+	size := STREAM_ENTRY_SIZE
+	for _, field := range fields {
+		size += STRING_OVERHEAD + len(field)
+	}
+	return size
+}
+
+func (s *Stream) ToRdb() *rdb.Stream {
+	converted := &rdb.Stream{
+		Entries: make([]rdb.StreamEntry, 0, len(s.entries)),
+		LastID:  rdb.StreamID{Ms: s.lastID.Ms, Seq: s.lastID.Seq},
+	}
+	for _, entry := range s.entries {
+		converted.Entries = append(converted.Entries, rdb.StreamEntry{
+			ID:     rdb.StreamID{Ms: entry.ID.Ms, Seq: entry.ID.Seq},
+			Fields: entry.Fields,
+		})
+	}
+	return converted
+}
+
+func StreamFromRdb(s *rdb.Stream) *Stream {
+	converted := &Stream{
+		entries: make([]StreamEntry, 0, len(s.Entries)),
+		lastID:  StreamID{s.LastID.Ms, s.LastID.Seq},
+	}
+	for _, entry := range s.Entries {
+		id := StreamID{entry.ID.Ms, entry.ID.Seq}
+		converted.entries = append(converted.entries, StreamEntry{id, entry.Fields})
+		converted.bytes += streamEntrySize(entry.Fields)
+		// New entries must never get an ID already used
+		if converted.lastID.Less(id) {
+			converted.lastID = id
+		}
+	}
+	return converted
+}
@@ -0,0 +1,194 @@
+// Package telemetry exports spans to an OpenTelemetry collector using the
+// OTLP/HTTP JSON encoding, which only needs the standard library.
+package telemetry
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	BATCH_SIZE     = 512
+	QUEUE_SIZE     = 4096
+	FLUSH_INTERVAL = 5 * time.Second
+
+	SPAN_KIND_INTERNAL = 1
+	SPAN_KIND_SERVER   = 2
+	SPAN_KIND_CLIENT   = 3
+
+	STATUS_UNSET = 0
+	STATUS_OK    = 1
+	STATUS_ERROR = 2
+)
+
+type attribute struct {
+	Key   string         `json:"key"`
+	Value attributeValue `json:"value"`
+}
+
+type attributeValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+type spanStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type Span struct {
+	TraceID    string      `json:"traceId"`
+	SpanID     string      `json:"spanId"`
+	Name       string      `json:"name"`
+	Kind       int         `json:"kind"`
+	StartNano  string      `json:"startTimeUnixNano"`
+	EndNano    string      `json:"endTimeUnixNano"`
+	Attributes []attribute `json:"attributes,omitempty"`
+	Status     spanStatus  `json:"status"`
+
+	tracer *Tracer
+	start  time.Time
+}
+
+// Tracer batches finished spans and posts them to the collector from a
+// single background goroutine. Spans are dropped when the queue is full, so a
+// slow collector never blocks command execution.
+type Tracer struct {
+	endpoint string
+	service  string
+	queue    chan *Span
+	client   *http.Client
+}
+
+// New returns a tracer exporting to an OTLP/HTTP endpoint such as
+// http://localhost:4318.
+func New(endpoint, service string) *Tracer {
+	t := &Tracer{
+		endpoint: strings.TrimSuffix(endpoint, "/") + "/v1/traces",
+		service:  service,
+		queue:    make(chan *Span, QUEUE_SIZE),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	go t.run()
+	return t
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// StartSpan starts a root span. A nil tracer returns a nil span, and every
+// method of a nil span is a no-op, so callers don't need to check whether
+// tracing is enabled.
+func (t *Tracer) StartSpan(name string, kind int) *Span {
+	if t == nil {
+		return nil
+	}
+
+	return &Span{
+		TraceID: randomHex(16),
+		SpanID:  randomHex(8),
+		Name:    name,
+		Kind:    kind,
+		tracer:  t,
+		start:   time.Now(),
+	}
+}
+
+func (s *Span) SetString(key, value string) {
+	if s == nil {
+		return
+	}
+	s.Attributes = append(s.Attributes, attribute{key, attributeValue{StringValue: &value}})
+}
+
+func (s *Span) SetInt(key string, value int) {
+	if s == nil {
+		return
+	}
+	v := strconv.Itoa(value)
+	s.Attributes = append(s.Attributes, attribute{key, attributeValue{IntValue: &v}})
+}
+
+// End finishes the span, marking it as failed when err is not nil
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+
+	s.StartNano = strconv.FormatInt(s.start.UnixNano(), 10)
+	s.EndNano = strconv.FormatInt(time.Now().UnixNano(), 10)
+	if err != nil {
+		s.Status = spanStatus{Code: STATUS_ERROR, Message: err.Error()}
+	}
+
+	select {
+	case s.tracer.queue <- s:
+	default:
+	}
+}
+
+func (t *Tracer) run() {
+	ticker := time.NewTicker(FLUSH_INTERVAL)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, BATCH_SIZE)
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) < BATCH_SIZE {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+
+		if err := t.export(batch); err != nil {
+			fmt.Println("error exporting spans, ", err)
+		}
+		batch = batch[:0]
+	}
+}
+
+func (t *Tracer) export(spans []*Span) error {
+	service := t.service
+	payload := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{
+				"attributes": []attribute{{"service.name", attributeValue{StringValue: &service}}},
+			},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]string{"name": "github.com/codecrafters-io/redis-starter-go"},
+				"spans": spans,
+			}},
+		}},
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Post(t.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector replied with status %s", resp.Status)
+	}
+	return nil
+}
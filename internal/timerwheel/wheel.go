@@ -0,0 +1,94 @@
+// Package timerwheel implements a hashed timing wheel, which keeps many
+// timeouts with a coarse resolution cheaper than one runtime timer each.
+package timerwheel
+
+import (
+	"sync"
+	"time"
+)
+
+// Wheel fires timers one tick at a time. A timer sits in the slot of the tick
+// it expires on, modulo the number of slots, along with the number of full
+// turns of the wheel left, so adding and stopping a timer are O(1) and each
+// tick only visits one slot.
+type Wheel struct {
+	mu    sync.Mutex
+	tick  time.Duration
+	slots []map[*Timer]struct{}
+	pos   int
+}
+
+type Timer struct {
+	wheel  *Wheel
+	slot   int
+	rounds int
+	fn     func()
+}
+
+// New creates a wheel and starts turning it. Timers fire up to one tick late.
+func New(tick time.Duration, slots int) *Wheel {
+	w := &Wheel{
+		tick:  tick,
+		slots: make([]map[*Timer]struct{}, slots),
+	}
+	for i := range w.slots {
+		w.slots[i] = map[*Timer]struct{}{}
+	}
+
+	go func() {
+		ticker := time.NewTicker(tick)
+		for range ticker.C {
+			w.advance()
+		}
+	}()
+	return w
+}
+
+// Add schedules fn to be called on the wheel's goroutine once d elapsed
+func (w *Wheel) Add(d time.Duration, fn func()) *Timer {
+	ticks := max(int((d+w.tick-1)/w.tick), 1)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	t := &Timer{
+		wheel:  w,
+		slot:   (w.pos + ticks) % len(w.slots),
+		rounds: (ticks - 1) / len(w.slots),
+		fn:     fn,
+	}
+	w.slots[t.slot][t] = struct{}{}
+	return t
+}
+
+// Stop prevents the timer from firing, reporting whether it was still pending
+func (t *Timer) Stop() bool {
+	t.wheel.mu.Lock()
+	defer t.wheel.mu.Unlock()
+
+	slot := t.wheel.slots[t.slot]
+	if _, ok := slot[t]; !ok {
+		return false
+	}
+	delete(slot, t)
+	return true
+}
+
+func (w *Wheel) advance() {
+	w.mu.Lock()
+	w.pos = (w.pos + 1) % len(w.slots)
+	var expired []*Timer
+	for t := range w.slots[w.pos] {
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		expired = append(expired, t)
+		delete(w.slots[w.pos], t)
+	}
+	w.mu.Unlock()
+
+	for _, t := range expired {
+		t.fn()
+	}
+}
@@ -0,0 +1,77 @@
+package timeseries
+
+import (
+	"math"
+	"strings"
+)
+
+type Aggregation string
+
+const (
+	AGG_AVG   Aggregation = "avg"
+	AGG_SUM   Aggregation = "sum"
+	AGG_MIN   Aggregation = "min"
+	AGG_MAX   Aggregation = "max"
+	AGG_RANGE Aggregation = "range"
+	AGG_COUNT Aggregation = "count"
+	AGG_FIRST Aggregation = "first"
+	AGG_LAST  Aggregation = "last"
+)
+
+func ParseAggregation(s string) (Aggregation, bool) {
+	a := Aggregation(strings.ToLower(s))
+	switch a {
+	case AGG_AVG, AGG_SUM, AGG_MIN, AGG_MAX, AGG_RANGE, AGG_COUNT, AGG_FIRST, AGG_LAST:
+		return a, true
+	default:
+		return "", false
+	}
+}
+
+// Aggregate groups sorted samples in buckets of the given duration, aligned
+// to the epoch, and returns one sample per non empty bucket, timestamped with
+// the start of the bucket.
+func Aggregate(samples []Sample, aggregation Aggregation, bucket int64) []Sample {
+	var out []Sample
+	for i := 0; i < len(samples); {
+		start := bucketStart(samples[i].Timestamp, bucket)
+		j := i
+		for j < len(samples) && samples[j].Timestamp < start+bucket {
+			j++
+		}
+		out = append(out, Sample{start, reduce(samples[i:j], aggregation)})
+		i = j
+	}
+	return out
+}
+
+func reduce(samples []Sample, aggregation Aggregation) float64 {
+	switch aggregation {
+	case AGG_COUNT:
+		return float64(len(samples))
+	case AGG_FIRST:
+		return samples[0].Value
+	case AGG_LAST:
+		return samples[len(samples)-1].Value
+	}
+
+	sum, lo, hi := 0.0, math.Inf(1), math.Inf(-1)
+	for _, s := range samples {
+		sum += s.Value
+		lo = math.Min(lo, s.Value)
+		hi = math.Max(hi, s.Value)
+	}
+
+	switch aggregation {
+	case AGG_SUM:
+		return sum
+	case AGG_MIN:
+		return lo
+	case AGG_MAX:
+		return hi
+	case AGG_RANGE:
+		return hi - lo
+	default:
+		return sum / float64(len(samples))
+	}
+}
@@ -0,0 +1,109 @@
+package timeseries
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+)
+
+var errCorrupted = errors.New("corrupted time series")
+
+// MarshalBinary encodes the series with varints, samples last
+func (s *Series) MarshalBinary() ([]byte, error) {
+	buf := binary.AppendVarint(nil, s.Retention)
+	buf = appendString(buf, string(s.DuplicatePolicy))
+
+	buf = binary.AppendUvarint(buf, uint64(len(s.Rules)))
+	for _, rule := range s.Rules {
+		buf = appendString(buf, rule.DestKey)
+		buf = appendString(buf, string(rule.Aggregation))
+		buf = binary.AppendVarint(buf, rule.Bucket)
+		buf = binary.AppendVarint(buf, rule.current)
+	}
+
+	buf = binary.AppendUvarint(buf, uint64(len(s.Samples)))
+	prev := int64(0)
+	for _, sample := range s.Samples {
+		// Timestamps are stored as deltas, which are small for regular series
+		buf = binary.AppendVarint(buf, sample.Timestamp-prev)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(sample.Value))
+		prev = sample.Timestamp
+	}
+	return buf, nil
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	n, size := binary.Varint(d.buf)
+	if size <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) uvarint() uint64 {
+	n, size := binary.Uvarint(d.buf)
+	if size <= 0 {
+		d.err = errCorrupted
+		return 0
+	}
+	d.buf = d.buf[size:]
+	return n
+}
+
+func (d *decoder) string() string {
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		d.err = errCorrupted
+		return ""
+	}
+	s := string(d.buf[:n])
+	d.buf = d.buf[n:]
+	return s
+}
+
+func Unmarshal(data []byte) (*Series, error) {
+	d := &decoder{buf: data}
+	s := &Series{Retention: d.varint(), DuplicatePolicy: DuplicatePolicy(d.string())}
+
+	for n := d.uvarint(); n > 0 && d.err == nil; n-- {
+		s.Rules = append(s.Rules, &Rule{
+			DestKey:     d.string(),
+			Aggregation: Aggregation(d.string()),
+			Bucket:      d.varint(),
+			current:     d.varint(),
+		})
+	}
+
+	n := d.uvarint()
+	if d.err != nil || n > uint64(len(d.buf)) {
+		return nil, errCorrupted
+	}
+	s.Samples = make([]Sample, 0, n)
+	prev := int64(0)
+	for ; n > 0 && d.err == nil; n-- {
+		ts := prev + d.varint()
+		if len(d.buf) < 8 {
+			return nil, errCorrupted
+		}
+		value := math.Float64frombits(binary.LittleEndian.Uint64(d.buf))
+		d.buf = d.buf[8:]
+		s.Samples = append(s.Samples, Sample{ts, value})
+		prev = ts
+	}
+	if d.err != nil {
+		return nil, d.err
+	}
+	return s, nil
+}
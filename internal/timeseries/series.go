@@ -0,0 +1,224 @@
+// Package timeseries implements append-optimized series of timestamped
+// samples, with retention, duplicate policies, aggregated range queries and
+// compaction rules downsampling a series into another.
+package timeseries
+
+import (
+	"math"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type Sample struct {
+	Timestamp int64
+	Value     float64
+}
+
+type DuplicatePolicy string
+
+const (
+	POLICY_BLOCK DuplicatePolicy = "block"
+	POLICY_FIRST DuplicatePolicy = "first"
+	POLICY_LAST  DuplicatePolicy = "last"
+	POLICY_MIN   DuplicatePolicy = "min"
+	POLICY_MAX   DuplicatePolicy = "max"
+	POLICY_SUM   DuplicatePolicy = "sum"
+)
+
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, bool) {
+	p := DuplicatePolicy(strings.ToLower(s))
+	switch p {
+	case POLICY_BLOCK, POLICY_FIRST, POLICY_LAST, POLICY_MIN, POLICY_MAX, POLICY_SUM:
+		return p, true
+	default:
+		return "", false
+	}
+}
+
+var ErrDuplicateBlocked = resp.NewError("ERR", "TSDB: Error at upsert, update is not supported when DUPLICATE_POLICY is set to BLOCK mode")
+
+var ErrTooOld = resp.NewError("ERR", "TSDB: Timestamp is older than retention")
+
+// Rule downsamples the series into the series stored at DestKey, aggregating
+// the samples of each bucket once a sample of a later bucket arrives.
+type Rule struct {
+	DestKey     string
+	Aggregation Aggregation
+	Bucket      int64
+	// Start of the bucket being filled, -1 before the first sample
+	current int64
+}
+
+type Series struct {
+	Samples []Sample
+	// Maximum age of the samples kept relative to the last one, in
+	// milliseconds. Zero keeps every sample.
+	Retention       int64
+	DuplicatePolicy DuplicatePolicy
+	Rules           []*Rule
+}
+
+func New(retention int64, policy DuplicatePolicy) *Series {
+	if policy == "" {
+		policy = POLICY_BLOCK
+	}
+	return &Series{Retention: retention, DuplicatePolicy: policy}
+}
+
+func (s *Series) Last() (Sample, bool) {
+	if len(s.Samples) == 0 {
+		return Sample{}, false
+	}
+	return s.Samples[len(s.Samples)-1], true
+}
+
+// Add inserts a sample, which is an append unless it is older than the last
+// one. A sample with the timestamp of an existing one is merged according to
+// the duplicate policy. Add returns the buckets the compaction rules closed,
+// as samples to add to their destination series.
+func (s *Series) Add(sample Sample, policy DuplicatePolicy) (map[*Rule]Sample, error) {
+	if policy == "" {
+		policy = s.DuplicatePolicy
+	}
+
+	last, ok := s.Last()
+	if ok && s.Retention > 0 && sample.Timestamp < last.Timestamp-s.Retention {
+		return nil, ErrTooOld
+	}
+
+	i := len(s.Samples)
+	if ok && sample.Timestamp <= last.Timestamp {
+		i = sort.Search(len(s.Samples), func(i int) bool {
+			return s.Samples[i].Timestamp >= sample.Timestamp
+		})
+	}
+
+	if i < len(s.Samples) && s.Samples[i].Timestamp == sample.Timestamp {
+		merged, err := merge(s.Samples[i].Value, sample.Value, policy)
+		if err != nil {
+			return nil, err
+		}
+		s.Samples[i].Value = merged
+		return nil, nil
+	}
+
+	s.Samples = slices.Insert(s.Samples, i, sample)
+	closed := s.applyRules(sample.Timestamp)
+	s.trim()
+	return closed, nil
+}
+
+func merge(old, new float64, policy DuplicatePolicy) (float64, error) {
+	switch policy {
+	case POLICY_FIRST:
+		return old, nil
+	case POLICY_LAST:
+		return new, nil
+	case POLICY_MIN:
+		return math.Min(old, new), nil
+	case POLICY_MAX:
+		return math.Max(old, new), nil
+	case POLICY_SUM:
+		return old + new, nil
+	default:
+		return 0, ErrDuplicateBlocked
+	}
+}
+
+func (s *Series) applyRules(ts int64) map[*Rule]Sample {
+	var closed map[*Rule]Sample
+	for _, rule := range s.Rules {
+		start := bucketStart(ts, rule.Bucket)
+		if rule.current < 0 {
+			rule.current = start
+			continue
+		}
+		if start <= rule.current {
+			continue
+		}
+
+		buckets := Aggregate(s.Range(rule.current, rule.current+rule.Bucket-1), rule.Aggregation, rule.Bucket)
+		if len(buckets) > 0 {
+			if closed == nil {
+				closed = make(map[*Rule]Sample)
+			}
+			closed[rule] = buckets[0]
+		}
+		rule.current = start
+	}
+	return closed
+}
+
+// trim drops the samples past the retention period
+func (s *Series) trim() {
+	last, ok := s.Last()
+	if !ok || s.Retention <= 0 {
+		return
+	}
+
+	i := sort.Search(len(s.Samples), func(i int) bool {
+		return s.Samples[i].Timestamp >= last.Timestamp-s.Retention
+	})
+	if i > 0 {
+		s.Samples = slices.Delete(s.Samples, 0, i)
+	}
+}
+
+// Range returns the samples with a timestamp from from to to, inclusive
+func (s *Series) Range(from, to int64) []Sample {
+	start := sort.Search(len(s.Samples), func(i int) bool {
+		return s.Samples[i].Timestamp >= from
+	})
+	end := sort.Search(len(s.Samples), func(i int) bool {
+		return s.Samples[i].Timestamp > to
+	})
+	if start >= end {
+		return nil
+	}
+	return s.Samples[start:end]
+}
+
+func (s *Series) AddRule(destKey string, aggregation Aggregation, bucket int64) error {
+	for _, rule := range s.Rules {
+		if rule.DestKey == destKey {
+			return resp.NewError("ERR", "TSDB: the destination key already has a src rule")
+		}
+	}
+
+	rule := &Rule{DestKey: destKey, Aggregation: aggregation, Bucket: bucket, current: -1}
+	if last, ok := s.Last(); ok {
+		rule.current = bucketStart(last.Timestamp, bucket)
+	}
+	s.Rules = append(s.Rules, rule)
+	return nil
+}
+
+func (s *Series) DeleteRule(destKey string) bool {
+	n := len(s.Rules)
+	s.Rules = slices.DeleteFunc(s.Rules, func(rule *Rule) bool {
+		return rule.DestKey == destKey
+	})
+	return len(s.Rules) < n
+}
+
+func (s *Series) Clone() *Series {
+	clone := *s
+	clone.Samples = slices.Clone(s.Samples)
+	clone.Rules = make([]*Rule, len(s.Rules))
+	for i, rule := range s.Rules {
+		r := *rule
+		clone.Rules[i] = &r
+	}
+	return &clone
+}
+
+func bucketStart(ts, bucket int64) int64 {
+	start := ts - ts%bucket
+	if ts < 0 && ts%bucket != 0 {
+		start -= bucket
+	}
+	return start
+}
@@ -0,0 +1,77 @@
+package vectorset
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"sort"
+)
+
+var errCorrupted = errors.New("corrupted vector set")
+
+// ParseFP32 decodes a vector given as a blob of little endian float32s
+func ParseFP32(blob []byte) ([]float32, bool) {
+	if len(blob) == 0 || len(blob)%4 != 0 {
+		return nil, false
+	}
+	vector := make([]float32, len(blob)/4)
+	for i := range vector {
+		vector[i] = math.Float32frombits(binary.LittleEndian.Uint32(blob[4*i:]))
+	}
+	return vector, true
+}
+
+// MarshalBinary encodes the dimension and the elements, sorted so that
+// equal sets encode the same
+func (s *Set) MarshalBinary() ([]byte, error) {
+	elements := make([]string, 0, len(s.elements))
+	for element := range s.elements {
+		elements = append(elements, element)
+	}
+	sort.Strings(elements)
+
+	buf := binary.AppendUvarint(nil, uint64(s.Dim))
+	buf = binary.AppendUvarint(buf, uint64(len(elements)))
+	for _, element := range elements {
+		buf = binary.AppendUvarint(buf, uint64(len(element)))
+		buf = append(buf, element...)
+		for _, x := range s.elements[element] {
+			buf = binary.LittleEndian.AppendUint32(buf, math.Float32bits(x))
+		}
+	}
+	return buf, nil
+}
+
+func Unmarshal(data []byte) (*Set, error) {
+	corrupted := false
+	uvarint := func() uint64 {
+		n, size := binary.Uvarint(data)
+		if size <= 0 {
+			corrupted = true
+			return 0
+		}
+		data = data[size:]
+		return n
+	}
+
+	dim := uvarint()
+	if corrupted || dim == 0 || dim > math.MaxInt32 {
+		return nil, errCorrupted
+	}
+	s := New(int(dim))
+
+	for n := uvarint(); n > 0 && !corrupted; n-- {
+		length := uvarint()
+		if corrupted || length > uint64(len(data)) || 4*dim > uint64(len(data))-length {
+			return nil, errCorrupted
+		}
+		element := string(data[:length])
+		vector, _ := ParseFP32(data[length : length+4*dim])
+		s.elements[element] = vector
+		data = data[length+4*dim:]
+	}
+	if corrupted {
+		return nil, errCorrupted
+	}
+	return s, nil
+}
@@ -0,0 +1,159 @@
+// Package vectorset implements sets of elements associated with float32
+// vectors of a fixed dimension, queried by similarity to a vector. Queries
+// are brute force, which is exact but linear in the size of the set.
+package vectorset
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+type Metric int
+
+const (
+	// Cosine similarity, scaled to [0, 1]
+	METRIC_COSINE Metric = iota
+	// Euclidean distance, as 1 / (1 + distance)
+	METRIC_L2
+)
+
+func ParseMetric(s string) (Metric, bool) {
+	switch strings.ToUpper(s) {
+	case "COSINE":
+		return METRIC_COSINE, true
+	case "L2":
+		return METRIC_L2, true
+	default:
+		return 0, false
+	}
+}
+
+var ErrZeroVector = resp.NewError("ERR", "zero vectors have no direction")
+
+type Set struct {
+	Dim      int
+	elements map[string][]float32
+}
+
+func New(dim int) *Set {
+	return &Set{Dim: dim, elements: make(map[string][]float32)}
+}
+
+func (s *Set) checkDim(vector []float32) error {
+	if len(vector) != s.Dim {
+		return resp.Errorf("ERR", "Vector dimension mismatch - got %d but set has %d", len(vector), s.Dim)
+	}
+	return nil
+}
+
+// Add sets the vector of an element, returning false if it was updated
+// rather than added
+func (s *Set) Add(element string, vector []float32) (bool, error) {
+	if err := s.checkDim(vector); err != nil {
+		return false, err
+	}
+	_, exists := s.elements[element]
+	s.elements[element] = append([]float32(nil), vector...)
+	return !exists, nil
+}
+
+func (s *Set) Remove(element string) bool {
+	_, ok := s.elements[element]
+	delete(s.elements, element)
+	return ok
+}
+
+func (s *Set) Get(element string) ([]float32, bool) {
+	vector, ok := s.elements[element]
+	return vector, ok
+}
+
+func (s *Set) Len() int {
+	return len(s.elements)
+}
+
+type Result struct {
+	Element string
+	Score   float64
+}
+
+// Search returns the count elements most similar to the query vector, by
+// decreasing score
+func (s *Set) Search(query []float32, count int, metric Metric) ([]Result, error) {
+	if err := s.checkDim(query); err != nil {
+		return nil, err
+	}
+
+	queryNorm := norm(query)
+	if metric == METRIC_COSINE && queryNorm == 0 {
+		return nil, ErrZeroVector
+	}
+
+	results := make([]Result, 0, len(s.elements))
+	for element, vector := range s.elements {
+		var score float64
+		switch metric {
+		case METRIC_COSINE:
+			n := norm(vector)
+			if n == 0 {
+				continue
+			}
+			score = (dot(query, vector)/(queryNorm*n) + 1) / 2
+		case METRIC_L2:
+			score = 1 / (1 + distance(query, vector))
+		}
+		results = append(results, Result{element, score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return results[i].Element < results[j].Element
+	})
+	if count < len(results) {
+		results = results[:count]
+	}
+	return results, nil
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func norm(v []float32) float64 {
+	return math.Sqrt(dot(v, v))
+}
+
+func distance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		d := float64(a[i]) - float64(b[i])
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// Size returns the number of bytes used by the elements and vectors
+func (s *Set) Size() int {
+	size := 0
+	for element, vector := range s.elements {
+		size += len(element) + 4*len(vector) + 40
+	}
+	return size
+}
+
+func (s *Set) Clone() *Set {
+	clone := New(s.Dim)
+	for element, vector := range s.elements {
+		clone.elements[element] = append([]float32(nil), vector...)
+	}
+	return clone
+}
@@ -0,0 +1,81 @@
+package module
+
+import (
+	"io"
+
+	"github.com/codecrafters-io/redis-starter-go/internal/resp"
+)
+
+// Client describes the connection running a command
+type Client interface {
+	RemoteAddr() string
+}
+
+// Keyspace gives commands access to string keys
+type Keyspace interface {
+	Get(key string) (value string, ok bool, err error)
+	Set(key, value string)
+	Delete(key string) bool
+}
+
+// Context is what a handler runs with: the client, the keyspace and the
+// methods to reply. A handler replies with exactly one value, which can be an
+// array whose elements are written next.
+type Context struct {
+	Client   Client
+	Keyspace Keyspace
+
+	encoder *resp.Encoder
+	replied bool
+}
+
+func NewContext(w io.Writer, client Client, keyspace Keyspace) *Context {
+	return &Context{
+		Client:   client,
+		Keyspace: keyspace,
+		encoder:  resp.NewEncoder(w),
+	}
+}
+
+// Replied reports whether anything was replied so far
+func (ctx *Context) Replied() bool {
+	return ctx.replied
+}
+
+func (ctx *Context) ReplySimpleString(s string) {
+	ctx.replied = true
+	ctx.encoder.WriteSimpleString(s)
+}
+
+// ReplyError replies with an error, which should start with an error code
+// such as ERR.
+func (ctx *Context) ReplyError(s string) {
+	ctx.replied = true
+	ctx.encoder.WriteError(s)
+}
+
+func (ctx *Context) ReplyString(s string) {
+	ctx.replied = true
+	ctx.encoder.WriteBulkString(s)
+}
+
+func (ctx *Context) ReplyInteger(n int64) {
+	ctx.replied = true
+	ctx.encoder.WriteInteger(n)
+}
+
+func (ctx *Context) ReplyNull() {
+	ctx.replied = true
+	ctx.encoder.WriteNull()
+}
+
+// ReplyArray starts an array of n elements, replied with the next calls
+func (ctx *Context) ReplyArray(n int) {
+	ctx.replied = true
+	ctx.encoder.WriteArrayHeader(n)
+}
+
+// Flush writes out the replies, it is called by the server after the handler
+func (ctx *Context) Flush() error {
+	return ctx.encoder.Flush()
+}
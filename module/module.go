@@ -0,0 +1,89 @@
+// Package module lets embedders add their own commands to the server.
+//
+// Commands are registered with Register, either from the init function of a
+// package linked into the server binary, or from the OnLoad function of a Go
+// plugin loaded with the loadmodule directive:
+//
+//	func OnLoad() error {
+//		return module.Register(module.Command{
+//			Name:  "hello.world",
+//			Arity: 1,
+//			Handler: func(ctx *module.Context, args []string) error {
+//				ctx.ReplySimpleString("hello")
+//				return nil
+//			},
+//		})
+//	}
+package module
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Handler executes a command. args excludes the command name. Errors are
+// replied to the client prefixed with ERR, unless something was replied
+// already.
+type Handler func(ctx *Context, args []string) error
+
+type Command struct {
+	Name string
+	// Number of arguments, command name included. A negative arity means at
+	// least -Arity arguments, as in Redis.
+	Arity int
+	// Positions of the key arguments, as in COMMAND INFO. FirstKey is 0 for
+	// commands without keys and a negative LastKey counts from the end.
+	FirstKey int
+	LastKey  int
+	KeyStep  int
+	// Write commands are executed one at a time and propagated to replicas
+	Write   bool
+	Handler Handler
+}
+
+var registry struct {
+	sync.Mutex
+	commands []Command
+	names    map[string]bool
+}
+
+// Register adds a command, which must be done before the server starts
+// accepting connections.
+func Register(cmd Command) error {
+	cmd.Name = strings.ToLower(cmd.Name)
+	if cmd.Name == "" || strings.ContainsAny(cmd.Name, " \r\n") {
+		return fmt.Errorf("invalid command name '%s'", cmd.Name)
+	}
+	if cmd.Arity == 0 {
+		return errors.New("arity can't be zero")
+	}
+	if cmd.Handler == nil {
+		return errors.New("missing handler")
+	}
+	if cmd.FirstKey > 0 && cmd.KeyStep <= 0 {
+		cmd.KeyStep = 1
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+
+	if registry.names[cmd.Name] {
+		return fmt.Errorf("command '%s' is already registered", cmd.Name)
+	}
+	if registry.names == nil {
+		registry.names = make(map[string]bool)
+	}
+	registry.names[cmd.Name] = true
+	registry.commands = append(registry.commands, cmd)
+	return nil
+}
+
+// Commands returns the registered commands
+func Commands() []Command {
+	registry.Lock()
+	defer registry.Unlock()
+
+	return append([]Command(nil), registry.commands...)
+}